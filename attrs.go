@@ -0,0 +1,302 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pdk
+
+import (
+	"io"
+	"sync/atomic"
+
+	gopilosa "github.com/pilosa/go-pilosa"
+	"github.com/pkg/errors"
+)
+
+// attrBatchSize is the number of attribute-setting queries Index sends in
+// each request, and the number of columns and rows it collects attributes for
+// before sending them.
+var attrBatchSize = 1000
+
+// normalizeAttr checks that key is a valid attribute name and that value is a
+// string, bool, integer or float, returning the value as a string, bool,
+// int64 or float64.
+func normalizeAttr(key string, value interface{}) (interface{}, error) {
+	if !gopilosa.ValidLabel(key) {
+		return nil, errors.Errorf("invalid attribute name '%s'", key)
+	}
+	switch v := value.(type) {
+	case string, bool, int64, float64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case uint:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return int64(v), nil
+	case float32:
+		return float64(v), nil
+	}
+	return nil, errors.Errorf("attribute '%s' is a %T, must be a string, bool, integer or float", key, value)
+}
+
+// attrRow identifies a row for setting attributes on.
+type attrRow struct {
+	field string
+	row   interface{}
+}
+
+// attrBatch collects the attributes to be set on columns and rows. Later
+// values for the same attribute replace earlier ones.
+type attrBatch struct {
+	cols map[interface{}]map[string]interface{}
+	rows map[attrRow]map[string]interface{}
+}
+
+func (b *attrBatch) len() int {
+	return len(b.cols) + len(b.rows)
+}
+
+func (b *attrBatch) setCol(col interface{}, key string, value interface{}) {
+	if b.cols == nil {
+		b.cols = make(map[interface{}]map[string]interface{})
+	}
+	attrs, ok := b.cols[col]
+	if !ok {
+		attrs = make(map[string]interface{})
+		b.cols[col] = attrs
+	}
+	attrs[key] = value
+}
+
+func (b *attrBatch) setRow(row attrRow, key string, value interface{}) {
+	if b.rows == nil {
+		b.rows = make(map[attrRow]map[string]interface{})
+	}
+	attrs, ok := b.rows[row]
+	if !ok {
+		attrs = make(map[string]interface{})
+		b.rows[row] = attrs
+	}
+	attrs[key] = value
+}
+
+// AddColAttr sets an attribute on a column. Attributes are collected and sent
+// to Pilosa in batches, and whenever the Index is flushed. If the Index has a
+// WAL, they are written to it instead, and sent from there.
+func (i *Index) AddColAttr(col uint64OrString, key string, value interface{}) error {
+	if !validUint64OrString(col) {
+		return errors.Errorf("a %T was passed as a column for attribute '%s', must be either uint64 or string", col, key)
+	}
+	value, err := normalizeAttr(key, value)
+	if err != nil {
+		return err
+	}
+	col = i.colKey(col)
+	i.attrLock.Lock()
+	i.attrs.setCol(col, key, value)
+	full := i.attrs.len() >= attrBatchSize
+	i.attrLock.Unlock()
+	atomic.StoreUint32(&i.dirty, 1)
+	if full {
+		return i.flushAttrs()
+	}
+	return nil
+}
+
+// AddRowAttr sets an attribute on a row of a field, creating the field if it
+// doesn't exist. As with AddColAttr, attributes are sent in batches.
+func (i *Index) AddRowAttr(fieldName string, row uint64OrString, key string, value interface{}) error {
+	if !validUint64OrString(row) {
+		return errors.Errorf("a %T was passed as a row for attribute '%s', must be either uint64 or string", row, key)
+	}
+	value, err := normalizeAttr(key, value)
+	if err != nil {
+		return err
+	}
+	_, rowKeys := row.(string)
+	_, field, err := i.recordChan(fieldName, func() ([]gopilosa.FieldOption, error) {
+		return fieldOptions(i.fieldConfigs(), fieldName, gopilosa.FieldTypeSet, rowKeys || i.nativeKeys())
+	})
+	if err != nil {
+		return err
+	}
+	row = rowKey(field, row)
+	i.attrLock.Lock()
+	i.attrs.setRow(attrRow{field: fieldName, row: row}, key, value)
+	full := i.attrs.len() >= attrBatchSize
+	i.attrLock.Unlock()
+	if full {
+		return i.flushAttrs()
+	}
+	return nil
+}
+
+// flushAttrs sends all the collected attributes to Pilosa, or writes them to
+// the attribute WAL if there is one. If a request fails, the attributes which
+// weren't sent are kept to be sent next time, unless they have been set again
+// since.
+func (i *Index) flushAttrs() error {
+	i.attrSendLock.Lock()
+	defer i.attrSendLock.Unlock()
+	i.attrLock.Lock()
+	batch := i.attrs
+	i.attrs = attrBatch{}
+	i.attrLock.Unlock()
+	if batch.len() == 0 {
+		return nil
+	}
+
+	i.lock.RLock()
+	queries := make([]gopilosa.PQLQuery, 0, batch.len())
+	for col, attrs := range batch.cols {
+		queries = append(queries, i.index.SetColumnAttrs(col, attrs))
+	}
+	for row, attrs := range batch.rows {
+		queries = append(queries, i.fields[row.field].SetRowAttrs(row.row, attrs))
+	}
+	i.lock.RUnlock()
+
+	if i.attrWAL != nil {
+		return i.logAttrs(queries)
+	}
+	for len(queries) > 0 {
+		n := len(queries)
+		if n > attrBatchSize {
+			n = attrBatchSize
+		}
+		if _, err := i.client.Query(i.index.BatchQuery(queries[:n]...)); err != nil {
+			i.keepAttrs(batch)
+			return errors.Wrap(err, "setting attributes")
+		}
+		queries = queries[n:]
+	}
+	return nil
+}
+
+// keepAttrs puts the attributes in batch back to be sent later, except for
+// those which have been set again since.
+func (i *Index) keepAttrs(batch attrBatch) {
+	i.attrLock.Lock()
+	defer i.attrLock.Unlock()
+	for col, attrs := range batch.cols {
+		for key, value := range attrs {
+			if _, ok := i.attrs.cols[col][key]; !ok {
+				i.attrs.setCol(col, key, value)
+			}
+		}
+	}
+	for row, attrs := range batch.rows {
+		for key, value := range attrs {
+			if _, ok := i.attrs.rows[row][key]; !ok {
+				i.attrs.setRow(row, key, value)
+			}
+		}
+	}
+}
+
+// attrWALName is the name of the directory for the attribute WAL, alongside
+// those for the fields. Pilosa field names can't start with an underscore.
+const attrWALName = "_attributes"
+
+// attrRecord is an attribute-setting query, as stored in the attribute WAL.
+// keys is whether the query sets attributes by key.
+type attrRecord struct {
+	query string
+	keys  bool
+}
+
+// Shard implements gopilosa.Record.
+func (attrRecord) Shard(shardWidth uint64) uint64 { return 0 }
+
+// Less implements gopilosa.Record.
+func (attrRecord) Less(other gopilosa.Record) bool { return false }
+
+// logAttrs writes queries to the attribute WAL and syncs it. Callers must hold
+// attrSendLock.
+func (i *Index) logAttrs(queries []gopilosa.PQLQuery) error {
+	for _, q := range queries {
+		if err := q.Error(); err != nil {
+			return errors.Wrap(err, "setting attributes")
+		}
+		sq := q.Serialize()
+		if err := i.attrWAL.append(attrRecord{query: sq.String(), keys: sq.HasWriteKeys()}); err != nil {
+			return errors.Wrap(err, "writing attributes to WAL")
+		}
+	}
+	return errors.Wrap(i.attrWAL.sync(), "writing attributes to WAL")
+}
+
+// drainAttrWAL sends the queries in wal to Pilosa until it is closed, retrying
+// failed requests in the same way as drainWAL.
+func (i *Index) drainAttrWAL(wal *fieldWAL) {
+	for {
+		recs, _, pos, err := wal.next(attrBatchSize)
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			i.setImportError(attrWALName, errors.Wrap(err, "reading attribute WAL"))
+			return
+		}
+		queries := make([]gopilosa.PQLQuery, len(recs))
+		for j, rec := range recs {
+			ar := rec.(attrRecord)
+			if ar.keys {
+				queries[j] = i.index.RawQuery(ar.query)
+			} else {
+				queries[j] = gopilosa.NewPQLBaseQuery(ar.query, i.index, nil)
+			}
+		}
+		err = i.retry(wal, func() error {
+			_, err := i.client.Query(i.index.BatchQuery(queries...))
+			return errors.Wrap(err, "setting attributes")
+		})
+		if err != nil {
+			i.setImportError(attrWALName, err)
+			return
+		}
+		if err := wal.commit(pos); err != nil {
+			i.setImportError(attrWALName, errors.Wrap(err, "committing attribute WAL"))
+			return
+		}
+	}
+}
@@ -27,6 +27,10 @@ func NewFileCommand(stdin io.Reader, stdout, stderr io.Writer) *cobra.Command {
 				return err
 			}
 			log.Println("Done: ", time.Since(start))
+			if FileMain.OutputDir != "" {
+				return nil
+			}
+			// keep serving the mapping proxy.
 			select {}
 		},
 	}
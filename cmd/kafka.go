@@ -60,7 +60,7 @@ func NewKafkaCommand(stdin io.Reader, stdout, stderr io.Writer) *cobra.Command {
 				return err
 			}
 			log.Println("Done: ", time.Since(start))
-			select {}
+			return nil
 		},
 	}
 	flags := kafkaCommand.Flags()
@@ -73,11 +73,14 @@ stdout.
 				}
 			}()
 			for {
-				rec, err := KafkaSource.Record()
+				rec, token, err := KafkaSource.RecordToken()
 				if err != nil {
 					return err
 				}
 				fmt.Fprintf(stdout, "record: %v\n", rec)
+				if err := KafkaSource.Ack(token, nil); err != nil {
+					return err
+				}
 			}
 		},
 	}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"io"
+	"log"
+	"time"
+
+	"github.com/jaffee/commandeer"
+	"github.com/pilosa/pdk/load"
+	"github.com/spf13/cobra"
+)
+
+// LoadMain is wrapped by NewLoadCommand and only exported for testing purposes.
+var LoadMain *load.Main
+
+// NewLoadCommand returns a new cobra command wrapping LoadMain.
+func NewLoadCommand(stdin io.Reader, stdout, stderr io.Writer) *cobra.Command {
+	var err error
+	LoadMain = load.NewMain()
+	loadCommand := &cobra.Command{
+		Use:   "load",
+		Short: "Import a directory of files written by a file indexer into Pilosa.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			start := time.Now()
+			err = LoadMain.Run()
+			if err != nil {
+				return err
+			}
+			log.Println("Done: ", time.Since(start))
+			return nil
+		},
+	}
+	flags := loadCommand.Flags()
+	err = commandeer.Flags(flags, LoadMain)
+	if err != nil {
+		panic(err)
+	}
+	return loadCommand
+}
+
+func init() {
+	subcommandFns["load"] = NewLoadCommand
+}
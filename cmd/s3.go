@@ -59,6 +59,10 @@ func NewS3Command(stdin io.Reader, stdout, stderr io.Writer) *cobra.Command {
 				return err
 			}
 			log.Println("Done: ", time.Since(start))
+			if S3Main.OutputDir != "" {
+				return nil
+			}
+			// keep serving the mapping proxy.
 			select {}
 		},
 	}
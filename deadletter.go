@@ -0,0 +1,122 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DeadLetter is a record which could not be ingested along with the stage it
+// failed at, the reason, and when it happened.
+type DeadLetter struct {
+	Record interface{}
+	Stage  Stage
+	Err    error
+	Time   time.Time
+}
+
+// MarshalJSON encodes a DeadLetter as a JSON object with "record", "stage",
+// "error", and "time" keys. If the record can't be encoded as JSON, its
+// formatted (%v) value is used instead.
+func (d DeadLetter) MarshalJSON() ([]byte, error) {
+	rec, err := json.Marshal(d.Record)
+	if err != nil {
+		rec, err = json.Marshal(fmt.Sprintf("%v", d.Record))
+		if err != nil {
+			return nil, errors.Wrap(err, "marshaling formatted record")
+		}
+	}
+	var errStr string
+	if d.Err != nil {
+		errStr = d.Err.Error()
+	}
+	return json.Marshal(struct {
+		Record json.RawMessage `json:"record"`
+		Stage  Stage           `json:"stage"`
+		Error  string          `json:"error"`
+		Time   time.Time       `json:"time"`
+	}{
+		Record: rec,
+		Stage:  d.Stage,
+		Error:  errStr,
+		Time:   d.Time,
+	})
+}
+
+// DeadLetterSink receives records which failed to be ingested so that they can
+// be inspected and replayed rather than being dropped. Implementations should
+// be thread safe.
+type DeadLetterSink interface {
+	Put(dl DeadLetter) error
+}
+
+// FileDeadLetterSink is a DeadLetterSink which appends each DeadLetter to a
+// file as a line of JSON.
+type FileDeadLetterSink struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// NewFileDeadLetterSink opens (or creates) the file at path for appending
+// DeadLetters.
+func NewFileDeadLetterSink(path string) (*FileDeadLetterSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening dead letter file")
+	}
+	return &FileDeadLetterSink{
+		f:   f,
+		enc: json.NewEncoder(f),
+	}, nil
+}
+
+// Put implements DeadLetterSink.
+func (s *FileDeadLetterSink) Put(dl DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return errors.Wrap(s.enc.Encode(dl), "writing dead letter")
+}
+
+// Close closes the underlying file.
+func (s *FileDeadLetterSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return errors.Wrap(s.f.Close(), "closing dead letter file")
+}
@@ -0,0 +1,116 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pdk_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pilosa/pdk"
+	"github.com/pkg/errors"
+)
+
+func TestFileDeadLetterSink(t *testing.T) {
+	f, err := ioutil.TempFile("", "deadletters")
+	if err != nil {
+		t.Fatalf("getting temp file: %v", err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	sink, err := pdk.NewFileDeadLetterSink(f.Name())
+	if err != nil {
+		t.Fatalf("opening sink: %v", err)
+	}
+	ts := time.Date(2019, time.June, 1, 12, 0, 0, 0, time.UTC)
+	dls := []pdk.DeadLetter{
+		{Record: map[string]interface{}{"a": 1}, Stage: pdk.StageParse, Err: errors.New("bad"), Time: ts},
+		{Record: []interface{}{complex(1, 2)}, Stage: pdk.StageMap, Err: errors.New("worse"), Time: ts},
+	}
+	for _, dl := range dls {
+		if err := sink.Put(dl); err != nil {
+			t.Fatalf("putting dead letter: %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("closing sink: %v", err)
+	}
+
+	f, err = os.Open(f.Name())
+	if err != nil {
+		t.Fatalf("reopening file: %v", err)
+	}
+	defer f.Close()
+	type line struct {
+		Record interface{} `json:"record"`
+		Stage  string      `json:"stage"`
+		Error  string      `json:"error"`
+		Time   time.Time   `json:"time"`
+	}
+	exp := []line{
+		{Record: map[string]interface{}{"a": 1.0}, Stage: "parse", Error: "bad", Time: ts},
+		{Record: "[(1+2i)]", Stage: "map", Error: "worse", Time: ts},
+	}
+	scanner := bufio.NewScanner(f)
+	i := 0
+	for ; scanner.Scan(); i++ {
+		var l line
+		if err := json.Unmarshal(scanner.Bytes(), &l); err != nil {
+			t.Fatalf("unmarshaling line %d: %v", i, err)
+		}
+		if i >= len(exp) {
+			t.Fatalf("unexpected extra line: %s", scanner.Bytes())
+		}
+		if l.Stage != exp[i].Stage || l.Error != exp[i].Error || !l.Time.Equal(exp[i].Time) {
+			t.Fatalf("line %d: exp %v, got %v", i, exp[i], l)
+		}
+		if recB, _ := json.Marshal(l.Record); string(recB) != mustMarshal(t, exp[i].Record) {
+			t.Fatalf("line %d: exp record %v, got %v", i, exp[i].Record, l.Record)
+		}
+	}
+	if i != len(exp) {
+		t.Fatalf("expected %d lines, got %d", len(exp), i)
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshaling %v: %v", v, err)
+	}
+	return string(b)
+}
@@ -36,6 +36,7 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"math"
+	"net"
 	"reflect"
 	"time"
 
@@ -58,6 +59,10 @@ type Context map[string]interface{}
 type Entity struct {
 	Subject IRI `json:"@id"`
 	Objects map[Property]Object
+
+	// Fields pins the Pilosa field that some properties are mapped to (as set
+	// by the field option of a pdk struct tag), in place of the path to them.
+	Fields map[Property]string `json:"-"`
 }
 
 func (e *Entity) Equal(e2 *Entity) error {
@@ -105,7 +110,13 @@ func equal(o, o2 Object) error {
 		if !(ok && ok2) {
 			return errors.Errorf("expected two literals, but got '%v' and '%v' of %T and %T", o, o2, o, o2)
 		}
-		if o != o2 {
+		if t, ok := o.(Time); ok {
+			// times are equal if they are the same instant, whatever their
+			// location.
+			if !time.Time(t).Equal(time.Time(o2.(Time))) {
+				return errors.Errorf("'%v' and '%v' not equal", o, o2)
+			}
+		} else if o != o2 {
 			return errors.Errorf("'%v' and '%v' not equal", o, o2)
 		}
 	}
@@ -197,6 +208,37 @@ func (e *Entity) SetString(value string, path ...string) error {
 	return nil
 }
 
+// copyEntity returns a deep copy of e, so that the copy can be changed
+// without affecting e.
+func copyEntity(e *Entity) *Entity {
+	ret := &Entity{Subject: e.Subject, Objects: make(map[Property]Object, len(e.Objects))}
+	for k, v := range e.Objects {
+		ret.Objects[k] = copyObject(v)
+	}
+	if e.Fields != nil {
+		ret.Fields = make(map[Property]string, len(e.Fields))
+		for k, v := range e.Fields {
+			ret.Fields[k] = v
+		}
+	}
+	return ret
+}
+
+func copyObject(o Object) Object {
+	switch obj := o.(type) {
+	case *Entity:
+		return copyEntity(obj)
+	case Objects:
+		ret := make(Objects, len(obj))
+		for i, v := range obj {
+			ret[i] = copyObject(v)
+		}
+		return ret
+	}
+	// Literals are values, so don't need copying.
+	return o
+}
+
 // EntityWithContext associates a Context
 // (https://json-ld.org/spec/latest/json-ld/#the-context) with an Entity so that
 // it can be Marshaled to valid and useful JSON-LD.
@@ -221,6 +263,15 @@ func (e *Entity) isObj() {}
 // allows for easy (if not particularly performant) interoperation with other
 // variants of RDF linked data.
 func (e *Entity) MarshalJSON() ([]byte, error) {
+	ret, err := e.jsonMap()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(ret)
+}
+
+// jsonMap returns e as a map from JSON-LD keys to values.
+func (e *Entity) jsonMap() (map[Property]interface{}, error) {
 	// TODO - this implementation does a lot of in-memory copying for simplicity, can probably be optimized.
 	ret := make(map[Property]interface{})
 	if e.Subject != "" {
@@ -232,7 +283,7 @@ func (e *Entity) MarshalJSON() ([]byte, error) {
 		}
 		ret[k] = v
 	}
-	return json.Marshal(ret)
+	return ret, nil
 }
 
 // Literal interface is implemented by types which correspond to RDF Literals.
@@ -270,30 +321,50 @@ func (S) literal() {}
 // 	return json.Marshal(ret)
 // }
 
-// type IPv4 net.IP
+// IPv4 is an IPv4 address.
+type IPv4 [4]byte
 
-// func (ip IPv4) MarshalJSON() ([]byte, error) {
-// 	ret := map[string]interface{}{
-// 		"@type":  "http://schema.pilosa.com/v0.1/ipv4",
-// 		"@value": fmt.Sprintf("%s", ip),
-// 	}
-// 	return json.Marshal(ret)
-// }
+func (IPv4) literal() {}
 
-// type IPv6 net.IP
+// String returns the dotted decimal form of ip.
+func (ip IPv4) String() string { return net.IP(ip[:]).String() }
 
-// func (ip IPv6) MarshalJSON() ([]byte, error) {
-// 	ret := map[string]interface{}{
-// 		"@type":  "http://schema.pilosa.com/v0.1/ipv6",
-// 		"@value": fmt.Sprintf("%s", ip),
-// 	}
-// 	return json.Marshal(ret)
-// }
+func (ip IPv4) MarshalJSON() ([]byte, error) {
+	ret := map[string]interface{}{
+		"@type":  "http://schema.pilosa.com/v0.1/ipv4",
+		"@value": ip.String(),
+	}
+	return json.Marshal(ret)
+}
+
+// IPv6 is an IPv6 address.
+type IPv6 [16]byte
+
+func (IPv6) literal() {}
+
+// String returns the canonical form of ip.
+func (ip IPv6) String() string { return net.IP(ip[:]).String() }
+
+func (ip IPv6) MarshalJSON() ([]byte, error) {
+	ret := map[string]interface{}{
+		"@type":  "http://schema.pilosa.com/v0.1/ipv6",
+		"@value": ip.String(),
+	}
+	return json.Marshal(ret)
+}
 
 type Time time.Time
 
 func (Time) literal() {}
 
+func (t Time) MarshalJSON() ([]byte, error) {
+	ret := map[string]interface{}{
+		"@type":  "xsd:dateTime",
+		"@value": time.Time(t).Format(time.RFC3339Nano),
+	}
+	return json.Marshal(ret)
+}
+
 type F32 float32
 
 func (F32) literal() {}
@@ -486,6 +557,8 @@ func (U U64) MarshalJSON() ([]byte, error) {
 func (B) isObj()    {}
 func (S) isObj()    {}
 func (Time) isObj() {}
+func (IPv4) isObj() {}
+func (IPv6) isObj() {}
 func (F32) isObj()  {}
 func (F64) isObj()  {}
 func (I) isObj()    {}
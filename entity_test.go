@@ -35,6 +35,7 @@ package pdk_test
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/pilosa/pdk"
 	"github.com/pkg/errors"
@@ -362,6 +363,16 @@ func TestEntityMarshalJSON(t *testing.T) {
 			val:  pdk.U64(1),
 			exp:  `{"@type":"unsignedLong","@value":1}`,
 		},
+		{
+			name: "time",
+			val:  pdk.Time(time.Date(2018, 3, 4, 5, 6, 7, 8, time.UTC)),
+			exp:  `{"@type":"xsd:dateTime","@value":"2018-03-04T05:06:07.000000008Z"}`,
+		},
+		{
+			name: "ipv4",
+			val:  pdk.IPv4{10, 0, 0, 1},
+			exp:  `{"@type":"http://schema.pilosa.com/v0.1/ipv4","@value":"10.0.0.1"}`,
+		},
 	}
 
 	for _, test := range tests {
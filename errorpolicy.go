@@ -0,0 +1,139 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pdk
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type errorAction int
+
+const (
+	defaultAction errorAction = iota
+	skipAction
+	abortAction
+	retryAction
+	quarantineAction
+)
+
+// ErrorPolicy determines what an Ingester does with a record when a Stage of
+// the pipeline fails. The zero value means "use the default", which is Abort
+// for StageSource and StageIndex, Quarantine for all other stages if the
+// Ingester has a DeadLetterSink, and Skip otherwise. Bad records from the
+// Source (see IngestError) are quarantined by default too, if there is a
+// DeadLetterSink.
+//
+// StageIndex covers errors adding data to the Indexer, and (if the Source is
+// an Acker and the Indexer an Acknowledger) errors importing it.
+type ErrorPolicy struct {
+	action  errorAction
+	retries int
+}
+
+var (
+	// Skip drops the failed record (or for StageSource, moves on to the next
+	// record) and carries on. Note that a Source which fails persistently will
+	// keep failing, although the Ingester backs off between attempts.
+	Skip = ErrorPolicy{action: skipAction}
+
+	// Abort stops the ingest. Records which are already in flight are
+	// finished, and Run returns an *IngestError.
+	Abort = ErrorPolicy{action: abortAction}
+
+	// Quarantine hands the failed record to the Ingester's DeadLetterSink and
+	// carries on.
+	Quarantine = ErrorPolicy{action: quarantineAction}
+)
+
+// Retry retries the failed stage up to n times before falling back to the
+// default policy for the stage.
+func Retry(n int) ErrorPolicy {
+	return ErrorPolicy{action: retryAction, retries: n}
+}
+
+// String implements fmt.Stringer.
+func (p ErrorPolicy) String() string {
+	switch p.action {
+	case skipAction:
+		return "skip"
+	case abortAction:
+		return "abort"
+	case retryAction:
+		return fmt.Sprintf("retry(%d)", p.retries)
+	case quarantineAction:
+		return "quarantine"
+	default:
+		return "default"
+	}
+}
+
+// IngestError is returned by Ingester.Run when an ErrorPolicy aborts the
+// ingest. It summarizes everything that went wrong during the run.
+type IngestError struct {
+	// Records is the number of records pulled from the Source.
+	Records uint64
+	// Failures is the number of records which failed at each Stage.
+	Failures map[Stage]uint64
+	// Errs holds the errors which aborted the ingest, followed by any error
+	// from closing the Indexer.
+	Errs []error
+
+	// Record is set when a Source returns an IngestError for a single record
+	// it read but couldn't decode, such as a message with an invalid payload.
+	// It holds the raw record, which the Ingester hands to the ErrorPolicy for
+	// StageSource and the DeadLetterSink.
+	Record interface{}
+}
+
+// Error implements the error interface.
+func (e *IngestError) Error() string {
+	if e.Record != nil {
+		errs := make([]string, len(e.Errs))
+		for i, err := range e.Errs {
+			errs[i] = err.Error()
+		}
+		return fmt.Sprintf("bad record: %s", strings.Join(errs, "; "))
+	}
+	stages := make([]string, 0, len(e.Failures))
+	for stage, n := range e.Failures {
+		stages = append(stages, fmt.Sprintf("%s: %d", stage, n))
+	}
+	sort.Strings(stages)
+	errs := make([]string, len(e.Errs))
+	for i, err := range e.Errs {
+		errs[i] = err.Error()
+	}
+	return fmt.Sprintf("ingest failed after %d records (failures: %s): %s", e.Records, strings.Join(stages, ", "), strings.Join(errs, "; "))
+}
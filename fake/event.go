@@ -45,42 +45,42 @@ var globalGen = NewEventGenerator(0)
 // Event is an example event that includes a variety of types.
 type Event struct {
 	// ID is a unique event identifier
-	ID string `json:"id"`
+	ID string `json:"id" pdk:"id,subject"`
 
 	// Station is a medium cardinality (1000s) string that has a 1 to many association with Events
-	Station string `json:"station"`
+	Station string `json:"station" pdk:"station"`
 
 	// UserID is a high cardinality (100s of millions) identifier that has a 1 to many association with events.
-	UserID int `json:"user_id"`
+	UserID int `json:"user_id" pdk:"user_id"`
 
-	// Time the event occured. TODO how is it encoded?
-	Timestamp string `json:"timestamp"`
+	// Time the event occured, encoded as RFC3339.
+	Timestamp string `json:"timestamp" pdk:"timestamp,time=2006-01-02T15:04:05Z07:00"`
 
 	// A set of medium cardinality items to associate with this event.
-	Favorites []string `json:"favorites"`
+	Favorites []string `json:"favorites" pdk:"favorites"`
 
 	// Set of complex objects.
-	Items []Item `json:"items"`
+	Items []Item `json:"items" pdk:"items"`
 
 	// Ordered list of objects.
-	Ranking []Item `json:"ranking"`
+	Ranking []Item `json:"ranking" pdk:"ranking"`
 
-	IfaceThing Interface `json:"ifacething"`
+	IfaceThing Interface `json:"ifacething" pdk:"ifacething"`
 
 	// An integer with a set range of possible values to associate with this event.
-	Velocity int `json:"velocity"`
+	Velocity int `json:"velocity" pdk:"velocity"`
 
 	// A boolean to associate with this event.
-	Active bool `json:"active"`
+	Active bool `json:"active" pdk:"active"`
 
 	// Another boolean at the top level.
-	Alive bool `json:"alive"`
+	Alive bool `json:"alive" pdk:"alive"`
 
 	// One more boolean with mixed case.
-	DeceasedBoolean bool `json:"deceasedBoolean"`
+	DeceasedBoolean bool `json:"deceasedBoolean" pdk:"deceasedBoolean"`
 
 	// The location of this event.
-	Geo Geo `json:"geo"`
+	Geo Geo `json:"geo" pdk:"geo"`
 }
 
 // Interface exists to make sure that parsing code can handle interface
@@ -97,17 +97,17 @@ func (String) isFake() {}
 // Geo represents a location.
 type Geo struct {
 	// Low cardinality association.
-	TimeZone string `json:"timezone"`
+	TimeZone string `json:"timezone" pdk:"timezone"`
 
 	// Fine grained location.
-	Longitude float64 `json:"longitude"`
-	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude" pdk:"longitude"`
+	Latitude  float64 `json:"latitude" pdk:"latitude"`
 }
 
 // Item has a name and integer value.
 type Item struct {
-	Name  string `json:"name"`
-	Value int    `json:"value"`
+	Name  string `json:"name" pdk:"name"`
+	Value int    `json:"value" pdk:"value"`
 }
 
 // EventGenerator generates random events.
@@ -45,12 +45,12 @@ func (s *UserSource) Record() (interface{}, error) {
 
 // User is a theoretical user type.
 type User struct {
-	ID        uint64
-	Age       int
-	FirstName string
-	LastName  string
-	Allergies []string
-	Title     string
+	ID        uint64   `pdk:"id,subject"`
+	Age       int      `pdk:"age"`
+	FirstName string   `pdk:"firstname"`
+	LastName  string   `pdk:"lastname"`
+	Allergies []string `pdk:"allergies"`
+	Title     string   `pdk:"title"`
 }
 
 // UserGenerator generates fake Users.
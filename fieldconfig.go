@@ -0,0 +1,300 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pdk
+
+import (
+	"math"
+	"path"
+
+	"github.com/BurntSushi/toml"
+	gopilosa "github.com/pilosa/go-pilosa"
+	"github.com/pkg/errors"
+)
+
+// FieldConfig describes how Index should create a field which doesn't already
+// exist in Pilosa. Anything left empty gets the same default it would without
+// a FieldConfig.
+type FieldConfig struct {
+	// Name is either the name of a field, or a pattern (see path.Match)
+	// matching the names of fields.
+	Name string `toml:"name" json:"name,omitempty"`
+
+	// Type is one of "set", "mutex", "bool", "int", or "time". By default,
+	// fields are created as set fields, or time fields if they are given a
+	// timestamp, or int fields if they are given values.
+	Type string `toml:"type" json:"type,omitempty"`
+
+	// CacheType is one of "ranked", "lru", or "none", and CacheSize is the
+	// size of the cache. They apply to set and mutex fields, and default to
+	// "ranked" and 100000.
+	CacheType string `toml:"cache-type" json:"cache-type,omitempty"`
+	CacheSize int    `toml:"cache-size" json:"cache-size,omitempty"`
+
+	// Quantum is the time quantum of a time field, e.g. "YMD". It defaults to
+	// "YMDH".
+	Quantum string `toml:"quantum" json:"quantum,omitempty"`
+
+	// Min and Max bound the values of an int field.
+	Min *int64 `toml:"min" json:"min,omitempty"`
+	Max *int64 `toml:"max" json:"max,omitempty"`
+
+	// Keys makes the field use string row keys. Fields are always created
+	// with keys if the first row added to them is a string.
+	Keys bool `toml:"keys" json:"keys,omitempty"`
+
+	// Scale is the number of decimal places kept in the values of an int
+	// field. CollapsingMapper multiplies values by 10^Scale (rounding floats)
+	// before they are stored, e.g. a Scale of 2 stores prices in cents, and
+	// PilosaForwarder scales query conditions and results to match. Min and
+	// Max are in stored units.
+	Scale int `toml:"scale" json:"scale,omitempty"`
+}
+
+func (c FieldConfig) validate() error {
+	if _, err := path.Match(c.Name, ""); err != nil {
+		return errors.Wrapf(err, "bad name '%s'", c.Name)
+	}
+	switch gopilosa.FieldType(c.Type) {
+	case gopilosa.FieldTypeDefault, gopilosa.FieldTypeSet, gopilosa.FieldTypeMutex, gopilosa.FieldTypeBool, gopilosa.FieldTypeInt, gopilosa.FieldTypeTime:
+	default:
+		return errors.Errorf("unknown field type '%s'", c.Type)
+	}
+	switch gopilosa.CacheType(c.CacheType) {
+	case gopilosa.CacheTypeDefault, gopilosa.CacheTypeRanked, gopilosa.CacheTypeLRU, gopilosa.CacheTypeNone:
+	default:
+		return errors.Errorf("unknown cache type '%s'", c.CacheType)
+	}
+	if c.CacheSize < 0 {
+		return errors.Errorf("negative cache size %d", c.CacheSize)
+	}
+	for _, r := range c.Quantum {
+		if r != 'Y' && r != 'M' && r != 'D' && r != 'H' {
+			return errors.Errorf("bad time quantum '%s'", c.Quantum)
+		}
+	}
+	if c.Min != nil && c.Max != nil && *c.Min > *c.Max {
+		return errors.Errorf("min %d is greater than max %d", *c.Min, *c.Max)
+	}
+	if c.Scale < 0 || c.Scale > 18 {
+		return errors.Errorf("scale %d is not between 0 and 18", c.Scale)
+	}
+	if c.Scale != 0 && c.Type != "" && gopilosa.FieldType(c.Type) != gopilosa.FieldTypeInt {
+		return errors.Errorf("scale given for %s field", c.Type)
+	}
+	return nil
+}
+
+// options returns the options for creating a field. fieldType is the type
+// the field would have without any configuration.
+func (c FieldConfig) options(fieldType gopilosa.FieldType) []gopilosa.FieldOption {
+	if c.Type != "" {
+		fieldType = gopilosa.FieldType(c.Type)
+	}
+	cacheType := gopilosa.CacheTypeRanked
+	if c.CacheType != "" {
+		cacheType = gopilosa.CacheType(c.CacheType)
+	}
+	cacheSize := 100000
+	if c.CacheSize != 0 {
+		cacheSize = c.CacheSize
+	}
+	quantum := gopilosa.TimeQuantumYearMonthDayHour
+	if c.Quantum != "" {
+		quantum = gopilosa.TimeQuantum(c.Quantum)
+	}
+
+	var opts []gopilosa.FieldOption
+	switch fieldType {
+	case gopilosa.FieldTypeMutex:
+		opts = append(opts, gopilosa.OptFieldTypeMutex(cacheType, cacheSize))
+	case gopilosa.FieldTypeBool:
+		opts = append(opts, gopilosa.OptFieldTypeBool())
+	case gopilosa.FieldTypeInt:
+		limits := []int64{math.MinInt64, math.MaxInt64}
+		if c.Min != nil {
+			limits[0] = *c.Min
+		}
+		if c.Max != nil {
+			limits[1] = *c.Max
+		}
+		opts = append(opts, gopilosa.OptFieldTypeInt(limits...))
+	case gopilosa.FieldTypeTime:
+		opts = append(opts, gopilosa.OptFieldTypeTime(quantum))
+	default:
+		opts = append(opts, gopilosa.OptFieldTypeSet(cacheType, cacheSize))
+	}
+	if c.Keys {
+		opts = append(opts, gopilosa.OptFieldKeys(true))
+	}
+	return opts
+}
+
+// fieldOptions returns the options for creating the named field, which is
+// being created because a column (or a value, if fieldType is int) was added
+// to it. rowKeys is whether the field should use row keys (e.g. because the
+// row added was a string), which only applies to set, mutex and time fields.
+func fieldOptions(configs []FieldConfig, fieldName string, fieldType gopilosa.FieldType, rowKeys bool) ([]gopilosa.FieldOption, error) {
+	conf := findFieldConfig(configs, fieldName)
+	if fieldType == gopilosa.FieldTypeInt {
+		if conf.Type != "" && conf.Type != string(gopilosa.FieldTypeInt) {
+			return nil, errors.Errorf("field '%s' is configured as a %s field, but a value was added to it", fieldName, conf.Type)
+		}
+	} else if conf.Type == string(gopilosa.FieldTypeInt) {
+		return nil, errors.Errorf("field '%s' is configured as an int field, but a column was added to it", fieldName)
+	}
+	opts := conf.options(fieldType)
+	if conf.Type != "" {
+		fieldType = gopilosa.FieldType(conf.Type)
+	}
+	switch fieldType {
+	case gopilosa.FieldTypeInt, gopilosa.FieldTypeBool:
+	default:
+		if rowKeys {
+			opts = append(opts, gopilosa.OptFieldKeys(true))
+		}
+	}
+	return opts, nil
+}
+
+// fieldConfigFor returns a FieldConfig which creates a field like field.
+func fieldConfigFor(field *gopilosa.Field) FieldConfig {
+	opts := field.Options()
+	conf := FieldConfig{
+		Name: field.Name(),
+		Type: string(opts.Type()),
+		Keys: opts.Keys(),
+	}
+	switch opts.Type() {
+	case gopilosa.FieldTypeSet, gopilosa.FieldTypeMutex, gopilosa.FieldTypeDefault:
+		conf.CacheType = string(opts.CacheType())
+		conf.CacheSize = opts.CacheSize()
+	case gopilosa.FieldTypeInt:
+		min, max := opts.Min(), opts.Max()
+		conf.Min, conf.Max = &min, &max
+	case gopilosa.FieldTypeTime:
+		conf.Quantum = string(opts.TimeQuantum())
+	}
+	return conf
+}
+
+// findFieldConfig returns the FieldConfig for the named field. A FieldConfig
+// whose Name is exactly the field name takes precedence, followed by the first
+// FieldConfig whose Name is a matching pattern. If nothing matches, the zero
+// FieldConfig is returned.
+func findFieldConfig(configs []FieldConfig, fieldName string) FieldConfig {
+	for _, c := range configs {
+		if c.Name == fieldName {
+			return c
+		}
+	}
+	for _, c := range configs {
+		if ok, _ := path.Match(c.Name, fieldName); ok {
+			return c
+		}
+	}
+	return FieldConfig{}
+}
+
+// hasScale returns true if any of configs has a Scale.
+func hasScale(configs []FieldConfig) bool {
+	for _, c := range configs {
+		if c.Scale != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadFieldConfigs reads FieldConfigs from a TOML file containing a "field"
+// table for each one. For example:
+//
+//	[[field]]
+//	name = "age"
+//	type = "int"
+//	min = 0
+//	max = 150
+//
+//	[[field]]
+//	name = "tag_*"
+//	cache-type = "lru"
+//	cache-size = 5000
+func LoadFieldConfigs(file string) ([]FieldConfig, error) {
+	var conf struct {
+		Fields []FieldConfig `toml:"field"`
+	}
+	md, err := toml.DecodeFile(file, &conf)
+	if err != nil {
+		return nil, errors.Wrapf(err, "decoding %s", file)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, errors.Errorf("unknown keys in %s: %v", file, undecoded)
+	}
+	for _, c := range conf.Fields {
+		if err := c.validate(); err != nil {
+			return nil, errors.Wrapf(err, "field config '%s' in %s", c.Name, file)
+		}
+	}
+	return conf.Fields, nil
+}
+
+// OptPilosaFieldConfigs configures how fields are created when they are first
+// added to, if they don't already exist. It may be given more than once, and
+// configs given earlier take precedence.
+func OptPilosaFieldConfigs(configs ...FieldConfig) PilosaOption {
+	return func(pilosaOpt *pilosaOptions) error {
+		for _, c := range configs {
+			if err := c.validate(); err != nil {
+				return errors.Wrapf(err, "field config '%s'", c.Name)
+			}
+		}
+		pilosaOpt.fieldConfigs = append(pilosaOpt.fieldConfigs, configs...)
+		return nil
+	}
+}
+
+// OptPilosaFieldConfigFile is like OptPilosaFieldConfigs, but loads the
+// configs from a TOML file with LoadFieldConfigs. It does nothing if file is
+// empty.
+func OptPilosaFieldConfigFile(file string) PilosaOption {
+	return func(pilosaOpt *pilosaOptions) error {
+		if file == "" {
+			return nil
+		}
+		configs, err := LoadFieldConfigs(file)
+		if err != nil {
+			return err
+		}
+		pilosaOpt.fieldConfigs = append(pilosaOpt.fieldConfigs, configs...)
+		return nil
+	}
+}
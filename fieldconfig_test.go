@@ -0,0 +1,113 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pdk
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadFieldConfigs(t *testing.T) {
+	f, err := ioutil.TempFile("", "fieldconfig")
+	if err != nil {
+		t.Fatalf("creating temp file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`
+[[field]]
+name = "age"
+type = "int"
+min = 0
+max = 150
+scale = 1
+
+[[field]]
+name = "tag_*"
+type = "mutex"
+cache-type = "lru"
+cache-size = 5000
+keys = true
+`)
+	if err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+	f.Close()
+
+	configs, err := LoadFieldConfigs(f.Name())
+	if err != nil {
+		t.Fatalf("loading configs: %v", err)
+	}
+	min, max := int64(0), int64(150)
+	expected := []FieldConfig{
+		{Name: "age", Type: "int", Min: &min, Max: &max, Scale: 1},
+		{Name: "tag_*", Type: "mutex", CacheType: "lru", CacheSize: 5000, Keys: true},
+	}
+	if !reflect.DeepEqual(configs, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, configs)
+	}
+
+	if err := ioutil.WriteFile(f.Name(), []byte("[[field]]\nname = \"a\"\ntype = \"bitmap\"\n"), 0644); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+	if _, err := LoadFieldConfigs(f.Name()); err == nil || !strings.Contains(err.Error(), "bitmap") {
+		t.Fatalf("expected unknown type error, got: %v", err)
+	}
+	if err := ioutil.WriteFile(f.Name(), []byte("[[field]]\nname = \"a\"\nsize = 3\n"), 0644); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+	if _, err := LoadFieldConfigs(f.Name()); err == nil || !strings.Contains(err.Error(), "size") {
+		t.Fatalf("expected unknown key error, got: %v", err)
+	}
+	if err := ioutil.WriteFile(f.Name(), []byte("[[field]]\nname = \"a\"\ntype = \"set\"\nscale = 2\n"), 0644); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+	if _, err := LoadFieldConfigs(f.Name()); err == nil || !strings.Contains(err.Error(), "scale") {
+		t.Fatalf("expected scale error, got: %v", err)
+	}
+}
+
+func TestFindFieldConfig(t *testing.T) {
+	configs := []FieldConfig{
+		{Name: "a*", Type: "mutex"},
+		{Name: "ab*", Type: "bool"},
+		{Name: "abc", Type: "time"},
+	}
+	for name, typ := range map[string]string{"abc": "time", "abd": "mutex", "a": "mutex", "b": ""} {
+		if conf := findFieldConfig(configs, name); conf.Type != typ {
+			t.Errorf("expected type '%s' for %s, got '%s'", typ, name, conf.Type)
+		}
+	}
+}
@@ -9,14 +9,29 @@ import (
 
 // Main contains the configuration for an ingester with an S3 Source.
 type Main struct {
-	Path        string   `help:"File or directory path to read from."`
-	PilosaHosts []string `help:"Comma separated list of Pilosa hosts and ports."`
-	Index       string   `help:"Pilosa index."`
-	BatchSize   uint     `help:"Batch size for Pilosa imports (latency/throughput tradeoff)."`
-	Framer      pdk.DashField
-	SubjectAt   string   `help:"Tells the source to add a unique 'subject' key to each record which is the filename + record number."`
-	SubjectPath []string `help:"Path to value in each record that should be mapped to column ID. Blank gets a sequential ID."`
-	Proxy       string   `help:"Bind to this address to proxy and translate requests to Pilosa"`
+	Path           string   `help:"File or directory path to read from."`
+	PilosaHosts    []string `help:"Comma separated list of Pilosa hosts and ports."`
+	Index          string   `help:"Pilosa index."`
+	BatchSize      uint     `help:"Batch size for Pilosa imports (latency/throughput tradeoff)."`
+	Framer         pdk.DashField
+	SubjectAt      string   `help:"Tells the source to add a unique 'subject' key to each record which is the filename + record number."`
+	SubjectPath    []string `help:"Path to value in each record that should be mapped to column ID. Blank gets a sequential ID."`
+	Proxy          string   `help:"Bind to this address to proxy and translate requests to Pilosa"`
+	AckLog         string   `help:"File to record the names of completely ingested files in. They are skipped when restarting. Blank disables."`
+	FieldConfig    string   `help:"TOML file describing how to create new fields in Pilosa."`
+	MutexFields    []string `help:"Comma separated list of fields which have a single string value per record, to be indexed as mutex fields."`
+	BoolFields     bool     `help:"Index bools in bool fields rather than as rows in a set field named after the property."`
+	ReplaceFields  []string `help:"Comma separated list of fields in which each record replaces the rows set by earlier records with the same subject."`
+	AttrFields     []string `help:"Comma separated list of fields whose values are set as column attributes rather than indexed."`
+	NativeKeys     bool     `help:"Let Pilosa translate string rows and columns to IDs, creating the index and fields with keys, rather than translating them locally."`
+	TimeLayouts    []string `help:"Comma separated list of layouts (as in Go's time.Parse) of strings which should be parsed as times."`
+	TimestampField string   `help:"Field holding the timestamp of each record, which is used for its rows in set fields. Other times are indexed as year, month, day and hour int fields."`
+	ListModes      []string `help:"Comma separated list of field:mode pairs setting how lists are mapped. The modes are set (the default), positional, first, last and count."`
+	InferTypes     bool     `help:"Infer the types (int, float, bool, time, ip or string) of string values, such as CSV columns."`
+	InferSample    int      `help:"Number of records sampled to infer the types of their columns before any are ingested."`
+	InferOverrides []string `help:"Comma separated list of column:type pairs fixing the types of columns. The types are string, int, float, bool, time, epoch and ip."`
+	Mapping        string   `help:"TOML or YAML file describing how each path in records is mapped (see pdk.MappingConfig). It replaces the framer options."`
+	OutputDir      string   `help:"Directory to write import files to, to be imported later with pdk load, rather than importing into Pilosa. Implies native keys. Blank imports into Pilosa."`
 }
 
 // NewMain gets a new Main with the default configuration.
@@ -28,21 +43,50 @@ func NewMain() *Main {
 		SubjectAt:   "#@!pdksubj",
 		SubjectPath: []string{},
 		Proxy:       ":13131",
+		InferSample: pdk.DefaultInferSample,
 	}
 }
 
 // Run runs the ingester.
 func (m *Main) Run() error {
-	src, err := NewSource(
+	opts := []SrcOption{
 		OptSrcPath(m.Path),
 		OptSrcSubjectAt(m.SubjectAt),
-	)
+	}
+	if m.AckLog != "" {
+		opts = append(opts, OptSrcAckLog(m.AckLog))
+	}
+	src, err := NewSource(opts...)
 	if err != nil {
 		return errors.Wrap(err, "getting file source")
 	}
 
+	var mapping *pdk.MappingConfig
+	if m.Mapping != "" {
+		mapping, err = pdk.LoadMappingConfig(m.Mapping)
+		if err != nil {
+			return errors.Wrap(err, "loading mapping config")
+		}
+		if subject := mapping.Subject(); subject != nil {
+			m.SubjectPath = subject
+		}
+	}
+
+	// import files are loaded without the local translator, so they have to
+	// hold the keys themselves.
+	if m.OutputDir != "" {
+		m.NativeKeys = true
+	}
+
 	translateColumns := true
 	parser := pdk.NewDefaultGenericParser()
+	parser.TimeLayouts = m.TimeLayouts
+	parser.InferTypes = m.InferTypes
+	parser.InferSample = m.InferSample
+	parser.InferOverrides, err = pdk.ParseInferTypes(m.InferOverrides)
+	if err != nil {
+		return errors.Wrap(err, "parsing inferred types")
+	}
 	if len(m.SubjectPath) == 0 && m.SubjectAt == "" {
 		parser.Subjecter = pdk.BlankSubjecter{}
 		translateColumns = false
@@ -55,18 +99,59 @@ func (m *Main) Run() error {
 
 	mapper := pdk.NewCollapsingMapper()
 	mapper.Framer = &m.Framer
-	if translateColumns {
+	mapper.MutexFields = m.MutexFields
+	mapper.BoolFields = m.BoolFields
+	mapper.ReplaceFields = m.ReplaceFields
+	mapper.AttrFields = m.AttrFields
+	mapper.TimestampField = m.TimestampField
+	mapper.ListModes, err = pdk.ParseListModes(m.ListModes)
+	if err != nil {
+		return errors.Wrap(err, "parsing list modes")
+	}
+	if m.FieldConfig != "" {
+		mapper.FieldConfigs, err = pdk.LoadFieldConfigs(m.FieldConfig)
+		if err != nil {
+			return errors.Wrap(err, "loading field configs")
+		}
+	}
+	if mapping != nil {
+		if err := mapping.Apply(parser, mapper); err != nil {
+			return errors.Wrap(err, "applying mapping config")
+		}
+	}
+	if m.NativeKeys {
+		mapper.Translator = nil
+		mapper.ColTranslator = nil
+		if translateColumns {
+			mapper.Nexter = nil
+		}
+	} else if translateColumns {
 		mapper.ColTranslator = pdk.NewMapFieldTranslator()
 	}
 
-	indexer, err := pdk.SetupPilosa(m.PilosaHosts, m.Index, nil, m.BatchSize)
+	if m.OutputDir != "" {
+		indexer, err := pdk.SetupFiles(m.OutputDir, m.Index, m.BatchSize,
+			pdk.OptPilosaFieldConfigs(mapper.FieldConfigs...),
+			pdk.OptPilosaNativeKeys(true))
+		if err != nil {
+			return errors.Wrap(err, "setting up import files")
+		}
+		ingester := pdk.NewIngester(src, parser, mapper, indexer)
+		return errors.Wrap(ingester.Run(), "running ingester")
+	}
+
+	indexer, err := pdk.SetupPilosa(m.PilosaHosts, m.Index, nil, m.BatchSize,
+		pdk.OptPilosaFieldConfigs(mapper.FieldConfigs...),
+		pdk.OptPilosaNativeKeys(m.NativeKeys))
 	if err != nil {
 		return errors.Wrap(err, "setting up Pilosa")
 	}
 	ingester := pdk.NewIngester(src, parser, mapper, indexer)
 
+	forwarder := pdk.NewPilosaForwarder(m.PilosaHosts[0], mapper.Translator, mapper.ColTranslator)
+	forwarder.FieldConfigs = mapper.FieldConfigs
 	go func() {
-		err = pdk.StartMappingProxy(m.Proxy, pdk.NewPilosaForwarder(m.PilosaHosts[0], mapper.Translator, mapper.ColTranslator))
+		err = pdk.StartMappingProxy(m.Proxy, forwarder)
 		log.Fatal(errors.Wrap(err, "starting mapping proxy"))
 	}()
 	return errors.Wrap(ingester.Run(), "running ingester")
@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/pilosa/pdk"
 	"github.com/pilosa/pilosa/test"
 )
 
@@ -89,3 +92,40 @@ func newFileWithData(t *testing.T, data string) string {
 
 	return tf.Name()
 }
+
+func TestFileIngestOutputDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pdk-file-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fname := newFileWithData(t, data)
+	cmd := NewMain()
+	cmd.Path = fname
+	cmd.PilosaHosts = []string{"localhost:1"}
+	cmd.SubjectPath = []string{"id"}
+	cmd.SubjectAt = ""
+	cmd.OutputDir = filepath.Join(dir, "out")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("running ingester: %v", err)
+	}
+
+	pilosa := test.MustRunCluster(t, 1)
+	defer func() {
+		err := pilosa.Close()
+		if err != nil {
+			t.Logf("closing cluster: %v", err)
+		}
+	}()
+	pilosaHost := pilosa[0].API.Node().URI.HostPort()
+	if err := pdk.LoadFiles([]string{pilosaHost}, cmd.OutputDir, 1000); err != nil {
+		t.Fatalf("loading files: %v", err)
+	}
+	resp := mustQueryHost(t, "Row(stuff=stuff2)", pilosaHost)
+	for _, key := range []string{`"120"`, `"122"`, `"123"`} {
+		if !strings.Contains(resp, key) {
+			t.Fatalf("expected %s in response: %s", key, resp)
+		}
+	}
+}
@@ -1,12 +1,14 @@
 package file
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"sync"
 	"sync/atomic"
 
 	"github.com/pilosa/pdk"
@@ -19,6 +21,19 @@ type Source struct {
 	rawSource *RawSource
 	records   chan record
 	subjectAt string
+
+	ackLog    string
+	ackLock   sync.Mutex
+	pending   map[pdk.AckToken]*fileAcks
+	nextToken pdk.AckToken
+}
+
+// fileAcks keeps track of the acknowledgements for the records in a file.
+type fileAcks struct {
+	name        string
+	outstanding int
+	read        bool
+	failed      bool
 }
 
 // SrcOption is a functional option for the file Source.
@@ -45,24 +60,48 @@ func OptSrcPath(pathname string) SrcOption {
 	}
 }
 
+// OptSrcAckLog makes the source append the name of each file to the log at
+// path once every record in it has been acknowledged (see pdk.Acker), and skip
+// the files which are already named in the log. This allows an interrupted
+// ingest to be restarted without reading the files it finished again.
+func OptSrcAckLog(path string) SrcOption {
+	return func(s *Source) error {
+		s.ackLog = path
+		return nil
+	}
+}
+
 func (s *Source) run() {
 	reader, err := s.rawSource.NextReader()
 	for ; err == nil; reader, err = s.rawSource.NextReader() {
 		src := json.NewSource(reader)
+		fa := &fileAcks{name: reader.Name()}
 		r := record{}
 		for i := 0; true; i++ {
 			r.data, r.err = src.Record()
 			if r.err == io.EOF {
-				reader.Close()
+				break
+			} else if r.err != nil {
+				fa.failed = true
+				s.records <- record{err: errors.Wrapf(r.err, "decoding json from %s", reader.Name())}
 				break
 			}
 			if s.subjectAt != "" {
 				r.data.(map[string]interface{})[s.subjectAt] = fmt.Sprintf("%s#%d", reader.Name(), i)
 			}
+			r.token = s.track(fa)
 			s.records <- r
 		}
+		reader.Close()
+		s.ackLock.Lock()
+		fa.read = true
+		err = s.finish(fa)
+		s.ackLock.Unlock()
+		if err != nil {
+			s.records <- record{err: err}
+		}
 	}
-	if err != nil {
+	if err != io.EOF {
 		s.records <- record{err: errors.Wrap(err, "getting next reader")}
 	}
 
@@ -74,6 +113,7 @@ func (s *Source) run() {
 func NewSource(opts ...SrcOption) (*Source, error) {
 	s := &Source{
 		records: make(chan record, 100),
+		pending: make(map[pdk.AckToken]*fileAcks),
 	}
 	for _, opt := range opts {
 		err := opt(s)
@@ -81,10 +121,94 @@ func NewSource(opts ...SrcOption) (*Source, error) {
 			return nil, err
 		}
 	}
+	if s.ackLog != "" {
+		if err := s.skipLogged(); err != nil {
+			return nil, errors.Wrap(err, "reading ack log")
+		}
+	}
 	go s.run()
 	return s, nil
 }
 
+// skipLogged removes the files named in the ack log from the RawSource.
+func (s *Source) skipLogged() error {
+	done := make(map[string]bool)
+	f, err := os.Open(s.ackLog)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		done[scanner.Text()] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	files := s.rawSource.files[:0]
+	for _, file := range s.rawSource.files {
+		if !done[filepath.Base(file)] {
+			files = append(files, file)
+		}
+	}
+	s.rawSource.files = files
+	return nil
+}
+
+// track starts keeping track of a record from fa's file so that the file can
+// be logged once the record has been acknowledged, and returns its token.
+func (s *Source) track(fa *fileAcks) pdk.AckToken {
+	if s.ackLog == "" {
+		return 0
+	}
+	s.ackLock.Lock()
+	defer s.ackLock.Unlock()
+	s.nextToken++
+	s.pending[s.nextToken] = fa
+	fa.outstanding++
+	return s.nextToken
+}
+
+// Ack implements pdk.Acker. It does nothing unless the source was created with
+// OptSrcAckLog.
+func (s *Source) Ack(token pdk.AckToken, err error) error {
+	if s.ackLog == "" {
+		return nil
+	}
+	s.ackLock.Lock()
+	defer s.ackLock.Unlock()
+	fa, ok := s.pending[token]
+	if !ok {
+		return errors.Errorf("acknowledging unknown record %d", token)
+	}
+	delete(s.pending, token)
+	fa.outstanding--
+	if err != nil {
+		fa.failed = true
+	}
+	return s.finish(fa)
+}
+
+// finish writes the name of the file to the ack log if it has been completely
+// read and all its records have been acknowledged. The caller must hold
+// s.ackLock.
+func (s *Source) finish(fa *fileAcks) error {
+	if s.ackLog == "" || !fa.read || fa.outstanding > 0 || fa.failed {
+		return nil
+	}
+	f, err := os.OpenFile(s.ackLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return errors.Wrap(err, "opening ack log")
+	}
+	if _, err := fmt.Fprintln(f, fa.name); err != nil {
+		f.Close()
+		return errors.Wrap(err, "writing ack log")
+	}
+	return errors.Wrap(f.Close(), "closing ack log")
+}
+
 // Record implements pdk.Record returning a map[string]interface{} for each json
 // object in the source files.
 func (s *Source) Record() (interface{}, error) {
@@ -95,9 +219,19 @@ func (s *Source) Record() (interface{}, error) {
 	return rec.data, rec.err
 }
 
+// RecordToken implements pdk.Acker.
+func (s *Source) RecordToken() (interface{}, pdk.AckToken, error) {
+	rec, ok := <-s.records
+	if !ok {
+		return nil, 0, io.EOF
+	}
+	return rec.data, rec.token, rec.err
+}
+
 type record struct {
-	data interface{}
-	err  error
+	data  interface{}
+	token pdk.AckToken
+	err   error
 }
 
 type RawSource struct {
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/pilosa/pdk"
@@ -125,3 +126,60 @@ func TestSource(t *testing.T) {
 	}
 
 }
+
+func TestSourceAckLog(t *testing.T) {
+	d := mustTempDir(t, "testsourceacklog")
+	defer func() {
+		os.RemoveAll(d)
+	}()
+	logDir := mustTempDir(t, "testsourceacklog")
+	defer func() {
+		os.RemoveAll(logDir)
+	}()
+	ackLog := filepath.Join(logDir, "acks")
+
+	done := filepath.Base(mustFile(t, d, `{"hey": 1}
+{"hey": 2}`))
+	mustFile(t, d, `{"hey": 3}
+{"hey": 4}`)
+
+	s, err := NewSource(OptSrcSubjectAt("here"), OptSrcPath(d), OptSrcAckLog(ackLog))
+	if err != nil {
+		t.Fatalf("getting source: %v", err)
+	}
+	var rec interface{}
+	var token pdk.AckToken
+	for rec, token, err = s.RecordToken(); err == nil; rec, token, err = s.RecordToken() {
+		subj := rec.(map[string]interface{})["here"].(string)
+		if strings.HasPrefix(subj, done) || strings.HasSuffix(subj, "#0") {
+			if err := s.Ack(token, nil); err != nil {
+				t.Fatalf("acking: %v", err)
+			}
+		}
+	}
+	if err != io.EOF {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	logged, err := ioutil.ReadFile(ackLog)
+	if err != nil {
+		t.Fatalf("reading ack log: %v", err)
+	}
+	if string(logged) != done+"\n" {
+		t.Fatalf("expected only %s in ack log, got: %s", done, logged)
+	}
+
+	s, err = NewSource(OptSrcPath(d), OptSrcAckLog(ackLog))
+	if err != nil {
+		t.Fatalf("getting source: %v", err)
+	}
+	n := 0
+	for rec, err = s.Record(); err == nil; rec, err = s.Record() {
+		if v := rec.(map[string]interface{})["hey"]; v != 3.0 && v != 4.0 {
+			t.Fatalf("read record from logged file: %v", rec)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 records, got %d", n)
+	}
+}
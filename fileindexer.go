@@ -0,0 +1,769 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pdk
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gopilosa "github.com/pilosa/go-pilosa"
+	"github.com/pkg/errors"
+)
+
+// importFileTimeFormat is the format of timestamps in import files, which keeps
+// them to the nanosecond.
+const importFileTimeFormat = time.RFC3339Nano
+
+// fileSchema is the contents of the schema.json written by a FileIndexer.
+type fileSchema struct {
+	Index  string        `json:"index"`
+	Keys   bool          `json:"keys,omitempty"`
+	Fields []FieldConfig `json:"fields"`
+}
+
+// FileIndexer is an Indexer which writes CSV import files to a directory
+// rather than importing into Pilosa, so that data can be prepared without
+// access to Pilosa and loaded later with LoadFiles (or "pdk load").
+//
+// The directory holds a schema.json describing the index and its fields,
+// an attrs.jsonl holding attributes, one JSON object per line (the last value
+// given for an attribute wins). There is a directory for each field
+// containing files named <shard>.<sequence>.csv.
+// Each line is "row,column[,timestamp]", with an RFC3339 timestamp, or
+// "column,value" for int fields.
+// Files named <shard>.<sequence>.clear.csv hold records to be cleared rather
+// than set. A new file is started whenever a shard switches between setting
+// and clearing, so loading each shard's files in sequence keeps everything in
+// the order it was added.
+type FileIndexer struct {
+	dir       string
+	batchSize uint
+	options   *pilosaOptions
+
+	mu       sync.Mutex
+	index    *gopilosa.Index
+	colKeys  bool
+	shards   map[fileShard]*shardBuffer
+	attrs    attrBatch
+	buffered uint
+
+	// newFields is set when a field is created, and cleared when the schema
+	// is written.
+	newFields bool
+
+	// acks are the acknowledgements waiting for the buffered records to be
+	// written out.
+	acks []func(err error)
+}
+
+// fileAttrs is a line of attrs.jsonl. It has either Col, or Field and Row.
+type fileAttrs struct {
+	Col   interface{}            `json:"col,omitempty"`
+	Field string                 `json:"field,omitempty"`
+	Row   interface{}            `json:"row,omitempty"`
+	Attrs map[string]interface{} `json:"attrs"`
+}
+
+// fileShard identifies the import files for one shard of a field.
+type fileShard struct {
+	field string
+	shard uint64
+}
+
+// shardBuffer holds the records for one shard of a field until they are
+// written out.
+type shardBuffer struct {
+	seq   int
+	clear bool
+	buf   bytes.Buffer
+	w     *csv.Writer
+}
+
+// SetupFiles returns a new FileIndexer which writes to dir, creating it if
+// necessary. Records are buffered in memory until there are batchSize of them,
+// or the Indexer is flushed. Field configs can be given with
+// OptPilosaFieldConfigs or OptPilosaFieldConfigFile, and OptPilosaNativeKeys
+// makes the index and fields keyed. Other options are ignored. It returns an
+// error if dir already contains import files.
+func SetupFiles(dir, indexName string, batchSize uint, options ...PilosaOption) (Indexer, error) {
+	pilosaOptions := &pilosaOptions{}
+	for _, opt := range options {
+		if err := opt(pilosaOptions); err != nil {
+			return nil, errors.Wrap(err, "applying options")
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "schema.json")); err == nil {
+		return nil, errors.Errorf("%s already contains import files", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "creating directory")
+	}
+	f := &FileIndexer{
+		dir:       dir,
+		batchSize: batchSize,
+		options:   pilosaOptions,
+		index:     gopilosa.NewSchema().Index(indexName),
+		colKeys:   pilosaOptions.nativeKeys,
+		shards:    make(map[fileShard]*shardBuffer),
+	}
+	return f, errors.Wrap(f.writeSchema(), "writing schema")
+}
+
+// AddColumn implements Indexer.
+func (f *FileIndexer) AddColumn(field string, col, row uint64OrString) error {
+	return f.addColumn(field, gopilosa.FieldTypeSet, col, row, time.Time{})
+}
+
+// AddColumnTimestamp implements Indexer.
+func (f *FileIndexer) AddColumnTimestamp(field string, col, row uint64OrString, ts time.Time) error {
+	return f.addColumn(field, gopilosa.FieldTypeTime, col, row, ts)
+}
+
+// AddMutex implements Indexer.
+func (f *FileIndexer) AddMutex(field string, col, row uint64OrString) error {
+	return f.addColumn(field, gopilosa.FieldTypeMutex, col, row, time.Time{})
+}
+
+// AddBool implements Indexer.
+func (f *FileIndexer) AddBool(field string, col uint64OrString, val bool) error {
+	var row uint64
+	if val {
+		row = 1
+	}
+	return f.addColumn(field, gopilosa.FieldTypeBool, col, row, time.Time{})
+}
+
+func (f *FileIndexer) addColumn(fieldName string, fieldType gopilosa.FieldType, col, row uint64OrString, ts time.Time) error {
+	if !validUint64OrString(col) || !validUint64OrString(row) {
+		return errors.Errorf("a %T and a %T were passed to field '%s', both must be either uint64 or string", col, row, fieldName)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, rowKeys := row.(string)
+	field, err := f.field(fieldName, func() ([]gopilosa.FieldOption, error) {
+		return fieldOptions(f.options.fieldConfigs, fieldName, fieldType, rowKeys || f.options.nativeKeys)
+	})
+	if err != nil {
+		return err
+	}
+	record := []string{formatUint64OrString(row), formatUint64OrString(col)}
+	// Only time fields can take timestamps.
+	if field.Options().Type() == gopilosa.FieldTypeTime && !ts.IsZero() {
+		record = append(record, ts.UTC().Format(importFileTimeFormat))
+	}
+	return f.write(fieldName, col, false, record)
+}
+
+// AddValue implements Indexer.
+func (f *FileIndexer) AddValue(fieldName string, col uint64OrString, val int64) error {
+	if !validUint64OrString(col) {
+		return errors.Errorf("a %T was passed to field '%s', must be either uint64 or string", col, fieldName)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err := f.field(fieldName, func() ([]gopilosa.FieldOption, error) {
+		return fieldOptions(f.options.fieldConfigs, fieldName, gopilosa.FieldTypeInt, false)
+	})
+	if err != nil {
+		return err
+	}
+	return f.write(fieldName, col, false, []string{formatUint64OrString(col), strconv.FormatInt(val, 10)})
+}
+
+// ClearColumn implements Indexer. Clearing from a field which nothing has been
+// added to does nothing.
+func (f *FileIndexer) ClearColumn(fieldName string, col, row uint64OrString) error {
+	if !validUint64OrString(col) || !validUint64OrString(row) {
+		return errors.Errorf("a %T and a %T were passed to field '%s', both must be either uint64 or string", col, row, fieldName)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.index.HasField(fieldName) {
+		return nil
+	}
+	return f.write(fieldName, col, true, []string{formatUint64OrString(row), formatUint64OrString(col)})
+}
+
+// ClearValue implements Indexer. As with ClearColumn, fields which nothing has
+// been added to are left alone.
+func (f *FileIndexer) ClearValue(fieldName string, col uint64OrString) error {
+	if !validUint64OrString(col) {
+		return errors.Errorf("a %T was passed to field '%s', must be either uint64 or string", col, fieldName)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.index.HasField(fieldName) {
+		return nil
+	}
+	opts := f.index.Field(fieldName).Options()
+	if opts.Type() != gopilosa.FieldTypeInt {
+		return errors.Errorf("can't clear a value from %s field '%s'", opts.Type(), fieldName)
+	}
+	return f.write(fieldName, col, true, []string{formatUint64OrString(col), strconv.FormatInt(opts.Min(), 10)})
+}
+
+// AddColAttr implements Indexer.
+func (f *FileIndexer) AddColAttr(col uint64OrString, key string, value interface{}) error {
+	if !validUint64OrString(col) {
+		return errors.Errorf("a %T was passed as a column for attribute '%s', must be either uint64 or string", col, key)
+	}
+	value, err := normalizeAttr(key, value)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := col.(string); ok {
+		f.colKeys = true
+	}
+	f.attrs.setCol(col, key, value)
+	return f.buffer()
+}
+
+// AddRowAttr implements Indexer. The field is created if nothing has been
+// added to it yet.
+func (f *FileIndexer) AddRowAttr(fieldName string, row uint64OrString, key string, value interface{}) error {
+	if !validUint64OrString(row) {
+		return errors.Errorf("a %T was passed as a row for attribute '%s', must be either uint64 or string", row, key)
+	}
+	value, err := normalizeAttr(key, value)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, rowKeys := row.(string)
+	_, err = f.field(fieldName, func() ([]gopilosa.FieldOption, error) {
+		return fieldOptions(f.options.fieldConfigs, fieldName, gopilosa.FieldTypeSet, rowKeys || f.options.nativeKeys)
+	})
+	if err != nil {
+		return err
+	}
+	f.attrs.setRow(attrRow{field: fieldName, row: row}, key, value)
+	return f.buffer()
+}
+
+// field returns the named field, creating it with the options returned by
+// opts if nothing has been added to it yet. Callers must hold f.mu.
+func (f *FileIndexer) field(fieldName string, opts func() ([]gopilosa.FieldOption, error)) (*gopilosa.Field, error) {
+	if f.index.HasField(fieldName) {
+		return f.index.Field(fieldName), nil
+	}
+	fieldOpts, err := opts()
+	if err != nil {
+		return nil, errors.Wrapf(err, "setting up field '%s'", fieldName)
+	}
+	if err := os.MkdirAll(filepath.Join(f.dir, fieldName), 0755); err != nil {
+		return nil, errors.Wrapf(err, "creating directory for field '%s'", fieldName)
+	}
+	f.newFields = true
+	return f.index.Field(fieldName, fieldOpts...), nil
+}
+
+// write buffers a record for the shard of the field which col is in, writing
+// everything out if the buffers are full. Callers must hold f.mu.
+func (f *FileIndexer) write(fieldName string, col uint64OrString, clear bool, record []string) error {
+	if _, ok := col.(string); ok {
+		f.colKeys = true
+	}
+	key := fileShard{field: fieldName, shard: uint64Cast(col) / gopilosa.DefaultShardWidth}
+	sb, ok := f.shards[key]
+	if !ok {
+		sb = &shardBuffer{clear: clear}
+		sb.w = csv.NewWriter(&sb.buf)
+		f.shards[key] = sb
+	} else if sb.clear != clear {
+		if err := f.writeOut(key, sb); err != nil {
+			return err
+		}
+		sb.seq++
+		sb.clear = clear
+	}
+	if err := sb.w.Write(record); err != nil {
+		return errors.Wrap(err, "writing record")
+	}
+	return f.buffer()
+}
+
+// buffer counts a record which has been buffered, and writes everything out
+// if the buffers are full. Callers must hold f.mu.
+func (f *FileIndexer) buffer() error {
+	f.buffered++
+	if f.buffered < f.batchSize {
+		return nil
+	}
+	return f.writeAll()
+}
+
+// writeAll writes out all the buffered records, and then calls the waiting
+// acknowledgements with the result. Callers must hold f.mu.
+func (f *FileIndexer) writeAll() error {
+	err := f.writeBuffers()
+	if err == nil && len(f.acks) > 0 && f.newFields {
+		// what is acknowledged must be loadable, so the schema has to
+		// include any new fields.
+		err = errors.Wrap(f.writeSchema(), "writing schema")
+	}
+	acks := f.acks
+	f.acks = nil
+	for _, ack := range acks {
+		ack(err)
+	}
+	return err
+}
+
+// writeBuffers writes out the buffered records and attributes. Callers must
+// hold f.mu.
+func (f *FileIndexer) writeBuffers() error {
+	for key, sb := range f.shards {
+		if err := f.writeOut(key, sb); err != nil {
+			return err
+		}
+	}
+	if err := f.writeAttrs(); err != nil {
+		return err
+	}
+	f.buffered = 0
+	return nil
+}
+
+// writeAttrs appends the buffered attributes to attrs.jsonl. Callers must
+// hold f.mu.
+func (f *FileIndexer) writeAttrs() error {
+	if f.attrs.len() == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for col, attrs := range f.attrs.cols {
+		if err := enc.Encode(fileAttrs{Col: col, Attrs: jsonAttrs(attrs)}); err != nil {
+			return errors.Wrap(err, "encoding attributes")
+		}
+	}
+	for row, attrs := range f.attrs.rows {
+		if err := enc.Encode(fileAttrs{Field: row.field, Row: row.row, Attrs: jsonAttrs(attrs)}); err != nil {
+			return errors.Wrap(err, "encoding attributes")
+		}
+	}
+	path := filepath.Join(f.dir, "attrs.jsonl")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrap(err, "opening attributes file")
+	}
+	if _, err := buf.WriteTo(file); err != nil {
+		file.Close()
+		return errors.Wrapf(err, "writing %s", path)
+	}
+	f.attrs = attrBatch{}
+	return errors.Wrapf(file.Close(), "closing %s", path)
+}
+
+// jsonAttrs returns attrs with floats written so that they are decoded as
+// floats even when they are whole numbers.
+func jsonAttrs(attrs map[string]interface{}) map[string]interface{} {
+	ret := make(map[string]interface{}, len(attrs))
+	for k, v := range attrs {
+		if fv, ok := v.(float64); ok {
+			s := strconv.FormatFloat(fv, 'g', -1, 64)
+			if !strings.ContainsAny(s, ".eE") {
+				s += ".0"
+			}
+			v = json.Number(s)
+		}
+		ret[k] = v
+	}
+	return ret
+}
+
+// writeOut appends a shard's buffered records to its current file. Callers
+// must hold f.mu.
+func (f *FileIndexer) writeOut(key fileShard, sb *shardBuffer) error {
+	sb.w.Flush()
+	if sb.buf.Len() == 0 {
+		return nil
+	}
+	name := strconv.FormatUint(key.shard, 10) + "." + strconv.Itoa(sb.seq)
+	if sb.clear {
+		name += ".clear"
+	}
+	path := filepath.Join(f.dir, key.field, name+".csv")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrap(err, "opening import file")
+	}
+	if _, err := sb.buf.WriteTo(file); err != nil {
+		file.Close()
+		return errors.Wrapf(err, "writing %s", path)
+	}
+	return errors.Wrapf(file.Close(), "closing %s", path)
+}
+
+// writeSchema writes schema.json, replacing any earlier version. Callers must
+// hold f.mu or have exclusive access to f.
+func (f *FileIndexer) writeSchema() error {
+	schema := fileSchema{Index: f.index.Name(), Keys: f.colKeys, Fields: []FieldConfig{}}
+	for _, field := range f.index.Fields() {
+		schema.Fields = append(schema.Fields, fieldConfigFor(field))
+	}
+	sort.Slice(schema.Fields, func(i, j int) bool { return schema.Fields[i].Name < schema.Fields[j].Name })
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encoding schema")
+	}
+	tmp := filepath.Join(f.dir, "schema.json.tmp")
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(f.dir, "schema.json")); err != nil {
+		return err
+	}
+	f.newFields = false
+	return nil
+}
+
+// Flush implements Indexer. It writes out everything which has been added, and
+// updates schema.json.
+func (f *FileIndexer) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.writeAll(); err != nil {
+		return err
+	}
+	return errors.Wrap(f.writeSchema(), "writing schema")
+}
+
+// Acknowledge implements Acknowledger. ack is called once everything added
+// before it has been written out, which happens when the buffers fill up or
+// the FileIndexer is flushed or closed (or straight away, if nothing is
+// buffered). It is called with the FileIndexer
+// locked, so it mustn't use it.
+func (f *FileIndexer) Acknowledge(ack func(err error)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.acks = append(f.acks, ack)
+	if f.buffered == 0 {
+		f.writeAll()
+	}
+}
+
+// Close implements Indexer. It flushes the FileIndexer.
+func (f *FileIndexer) Close() error {
+	return f.Flush()
+}
+
+// Client implements Indexer. It always returns nil, since a FileIndexer
+// doesn't talk to Pilosa.
+func (f *FileIndexer) Client() *gopilosa.Client {
+	return nil
+}
+
+func formatUint64OrString(u uint64OrString) string {
+	if s, ok := u.(string); ok {
+		return s
+	}
+	return strconv.FormatUint(uint64Cast(u), 10)
+}
+
+// LoadFiles imports a directory written by a FileIndexer into Pilosa. The
+// index and fields described by its schema.json are created if they don't
+// exist, and then each field's files are imported in order. Import and client
+// options are taken from OptPilosaImportOptions and OptPilosaClientOptions as
+// with SetupPilosa.
+func LoadFiles(hosts []string, dir string, batchSize uint, options ...PilosaOption) error {
+	pilosaOptions := &pilosaOptions{}
+	for _, opt := range options {
+		if err := opt(pilosaOptions); err != nil {
+			return errors.Wrap(err, "applying options")
+		}
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "schema.json"))
+	if err != nil {
+		return errors.Wrap(err, "reading schema")
+	}
+	var fs fileSchema
+	if err := json.Unmarshal(data, &fs); err != nil {
+		return errors.Wrap(err, "decoding schema")
+	}
+
+	schema := gopilosa.NewSchema()
+	var indexOpts []gopilosa.IndexOption
+	if fs.Keys {
+		indexOpts = append(indexOpts, gopilosa.OptIndexKeys(true))
+	}
+	index := schema.Index(fs.Index, indexOpts...)
+	for _, conf := range fs.Fields {
+		if err := conf.validate(); err != nil {
+			return errors.Wrapf(err, "field '%s' in schema", conf.Name)
+		}
+		index.Field(conf.Name, conf.options(gopilosa.FieldTypeSet)...)
+	}
+	client, err := gopilosa.NewClient(hosts, pilosaOptions.clientOpts()...)
+	if err != nil {
+		return errors.Wrap(err, "creating pilosa cluster client")
+	}
+	if err := client.SyncSchema(schema); err != nil {
+		return errors.Wrap(err, "synchronizing schema")
+	}
+
+	for _, conf := range fs.Fields {
+		field := index.Field(conf.Name)
+		files, err := listImportFiles(filepath.Join(dir, conf.Name))
+		if err != nil {
+			return errors.Wrapf(err, "listing files for field '%s'", conf.Name)
+		}
+		importOptions := fieldImportOptions(pilosaOptions, batchSize, field)
+		clearOptions := append(importOptions[:len(importOptions):len(importOptions)], gopilosa.OptImportClear(true))
+		for _, file := range files {
+			opts := importOptions
+			if file.clear {
+				opts = clearOptions
+			}
+			if err := loadFile(client, field, fs.Keys, file.path, opts); err != nil {
+				return errors.Wrapf(err, "importing %s", file.path)
+			}
+		}
+	}
+	return errors.Wrap(loadAttrs(client, index, filepath.Join(dir, "attrs.jsonl")), "loading attributes")
+}
+
+// loadAttrs sets the attributes in an attrs.jsonl, if it exists.
+func loadAttrs(client *gopilosa.Client, index *gopilosa.Index, path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	dec := json.NewDecoder(file)
+	dec.UseNumber()
+	var queries []gopilosa.PQLQuery
+	send := func() error {
+		if len(queries) == 0 {
+			return nil
+		}
+		_, err := client.Query(index.BatchQuery(queries...))
+		queries = queries[:0]
+		return err
+	}
+	for {
+		var fa fileAttrs
+		if err := dec.Decode(&fa); err == io.EOF {
+			break
+		} else if err != nil {
+			return errors.Wrapf(err, "decoding %s", path)
+		}
+		for k, v := range fa.Attrs {
+			if n, ok := v.(json.Number); ok {
+				if fa.Attrs[k], err = parseJSONNumber(n); err != nil {
+					return errors.Wrapf(err, "attribute '%s'", k)
+				}
+			}
+		}
+		if fa.Field != "" {
+			row, err := jsonIDOrKey(fa.Row)
+			if err != nil {
+				return errors.Wrap(err, "row")
+			}
+			queries = append(queries, index.Field(fa.Field).SetRowAttrs(row, fa.Attrs))
+		} else {
+			col, err := jsonIDOrKey(fa.Col)
+			if err != nil {
+				return errors.Wrap(err, "column")
+			}
+			queries = append(queries, index.SetColumnAttrs(col, fa.Attrs))
+		}
+		if len(queries) >= attrBatchSize {
+			if err := send(); err != nil {
+				return err
+			}
+		}
+	}
+	return send()
+}
+
+// parseJSONNumber returns n as an int64, or as a float64 if it has a decimal
+// point or exponent.
+func parseJSONNumber(n json.Number) (interface{}, error) {
+	if strings.ContainsAny(string(n), ".eE") {
+		return n.Float64()
+	}
+	return n.Int64()
+}
+
+// jsonIDOrKey converts a row or column decoded from JSON (with UseNumber) to a
+// uint64 or string.
+func jsonIDOrKey(v interface{}) (interface{}, error) {
+	switch tv := v.(type) {
+	case string:
+		return tv, nil
+	case json.Number:
+		return strconv.ParseUint(string(tv), 10, 64)
+	}
+	return nil, errors.Errorf("unexpected %T %v", v, v)
+}
+
+// importFile is one of the files written by a FileIndexer for a field.
+type importFile struct {
+	path  string
+	shard uint64
+	seq   int
+	clear bool
+}
+
+// listImportFiles returns the import files in dir, sorted by shard and then
+// sequence number.
+func listImportFiles(dir string) ([]importFile, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	files := make([]importFile, 0, len(infos))
+	for _, info := range infos {
+		name := strings.TrimSuffix(info.Name(), ".csv")
+		file := importFile{path: filepath.Join(dir, info.Name())}
+		if strings.HasSuffix(name, ".clear") {
+			name, file.clear = strings.TrimSuffix(name, ".clear"), true
+		}
+		parts := strings.Split(name, ".")
+		if len(parts) != 2 || !strings.HasSuffix(info.Name(), ".csv") {
+			return nil, errors.Errorf("unexpected file %s", file.path)
+		}
+		file.shard, err = strconv.ParseUint(parts[0], 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("unexpected file %s", file.path)
+		}
+		file.seq, err = strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, errors.Errorf("unexpected file %s", file.path)
+		}
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].shard != files[j].shard {
+			return files[i].shard < files[j].shard
+		}
+		return files[i].seq < files[j].seq
+	})
+	return files, nil
+}
+
+func loadFile(client *gopilosa.Client, field *gopilosa.Field, colKeys bool, path string, importOptions []gopilosa.ImportOption) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+	it := &csvRecordIterator{
+		r:       r,
+		values:  field.Options().Type() == gopilosa.FieldTypeInt,
+		rowKeys: field.Options().Keys(),
+		colKeys: colKeys,
+	}
+	return client.ImportField(field, it, importOptions...)
+}
+
+// csvRecordIterator is a gopilosa.RecordIterator which reads an import file
+// written by a FileIndexer.
+type csvRecordIterator struct {
+	r       *csv.Reader
+	line    int
+	values  bool
+	rowKeys bool
+	colKeys bool
+}
+
+// NextRecord implements gopilosa.RecordIterator.
+func (c *csvRecordIterator) NextRecord() (gopilosa.Record, error) {
+	record, err := c.r.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, errors.Wrap(err, "reading record")
+	}
+	c.line++
+	if c.values {
+		if len(record) != 2 {
+			return nil, errors.Errorf("line %d: expected 2 fields, got %d", c.line, len(record))
+		}
+		val := gopilosa.FieldValue{}
+		if val.ColumnID, val.ColumnKey, err = c.parse(record[0], c.colKeys); err != nil {
+			return nil, errors.Wrapf(err, "line %d: parsing column", c.line)
+		}
+		if val.Value, err = strconv.ParseInt(record[1], 10, 64); err != nil {
+			return nil, errors.Wrapf(err, "line %d: parsing value", c.line)
+		}
+		return val, nil
+	}
+	if len(record) != 2 && len(record) != 3 {
+		return nil, errors.Errorf("line %d: expected 2 or 3 fields, got %d", c.line, len(record))
+	}
+	col := gopilosa.Column{}
+	if col.RowID, col.RowKey, err = c.parse(record[0], c.rowKeys); err != nil {
+		return nil, errors.Wrapf(err, "line %d: parsing row", c.line)
+	}
+	if col.ColumnID, col.ColumnKey, err = c.parse(record[1], c.colKeys); err != nil {
+		return nil, errors.Wrapf(err, "line %d: parsing column", c.line)
+	}
+	if len(record) == 3 {
+		ts, err := time.Parse(importFileTimeFormat, record[2])
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d: parsing timestamp", c.line)
+		}
+		col.Timestamp = ts.UnixNano()
+	}
+	return col, nil
+}
+
+// parse returns s as a key if keys is true, or otherwise as an ID.
+func (c *csvRecordIterator) parse(s string, keys bool) (uint64, string, error) {
+	if keys {
+		return 0, s, nil
+	}
+	id, err := strconv.ParseUint(s, 10, 64)
+	return id, "", err
+}
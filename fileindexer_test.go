@@ -0,0 +1,232 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pdk_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	gopilosa "github.com/pilosa/go-pilosa"
+	"github.com/pilosa/pdk"
+	ptest "github.com/pilosa/pilosa/test"
+)
+
+func TestFileIndexer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pdk-files")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	indexer, err := pdk.SetupFiles(dir, "fileindex", 2)
+	if err != nil {
+		t.Fatalf("SetupFiles: %v", err)
+	}
+	secondShard := uint64(gopilosa.DefaultShardWidth + 3)
+	for _, err := range []error{
+		indexer.AddColumn("f", uint64(1), uint64(1)),
+		indexer.AddColumn("f", secondShard, uint64(1)),
+		indexer.ClearColumn("f", uint64(1), uint64(1)),
+		indexer.AddColumn("f", uint64(1), uint64(3)),
+		indexer.AddColumn("k", uint64(5), "a"),
+		indexer.AddValue("v", uint64(1), 42),
+		indexer.AddValue("v", uint64(2), 7),
+		indexer.ClearValue("v", uint64(2)),
+		indexer.AddColumnTimestamp("t", uint64(1), uint64(1), time.Date(2019, 6, 1, 12, 0, 30, 5, time.UTC)),
+		indexer.AddMutex("m", uint64(1), uint64(2)),
+		indexer.AddBool("b", uint64(2), true),
+		indexer.ClearColumn("unknown", uint64(1), uint64(1)),
+		indexer.AddColAttr(uint64(1), "name", "one"),
+		indexer.AddColAttr(uint64(1), "score", 2.5),
+		indexer.AddRowAttr("k", "a", "color", "red"),
+	} {
+		if err != nil {
+			t.Fatalf("adding: %v", err)
+		}
+	}
+	if err := indexer.Close(); err != nil {
+		t.Fatalf("closing: %v", err)
+	}
+
+	infos, err := ioutil.ReadDir(filepath.Join(dir, "f"))
+	if err != nil {
+		t.Fatalf("reading field directory: %v", err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	if expected := []string{"0.0.csv", "0.1.clear.csv", "0.2.csv", "1.0.csv"}; !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected files %v, got %v", expected, names)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "t", "0.0.csv")); err != nil || string(data) != "1,1,2019-06-01T12:00:30.000000005Z\n" {
+		t.Fatalf("unexpected time field file: %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "unknown")); !os.IsNotExist(err) {
+		t.Fatalf("expected no directory for a field which was only cleared, got %v", err)
+	}
+	if _, err := pdk.SetupFiles(dir, "fileindex", 2); err == nil {
+		t.Fatal("expected error setting up in a directory with import files")
+	}
+
+	s := ptest.MustRunCluster(t, 1)
+	hosts := []string{s[0].URL()}
+	if err := pdk.LoadFiles(hosts, dir, 1000); err != nil {
+		t.Fatalf("loading files: %v", err)
+	}
+
+	client, err := gopilosa.NewClient(hosts)
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	schema, err := client.Schema()
+	if err != nil {
+		t.Fatalf("getting schema: %v", err)
+	}
+	fields := schema.Index("fileindex").Fields()
+	for name, typ := range map[string]gopilosa.FieldType{
+		"f": gopilosa.FieldTypeSet,
+		"k": gopilosa.FieldTypeSet,
+		"v": gopilosa.FieldTypeInt,
+		"t": gopilosa.FieldTypeTime,
+		"m": gopilosa.FieldTypeMutex,
+		"b": gopilosa.FieldTypeBool,
+	} {
+		if actual := fields[name].Options().Type(); actual != typ {
+			t.Fatalf("expected field '%s' to be %s, got %s", name, typ, actual)
+		}
+	}
+	if !fields["k"].Options().Keys() {
+		t.Fatal("expected field 'k' to use keys")
+	}
+
+	for q, expected := range map[*gopilosa.PQLRowQuery][]uint64{
+		fields["f"].Row(1):     {secondShard},
+		fields["f"].Row(3):     {1},
+		fields["k"].Row("a"):   {5},
+		fields["v"].NotNull():  {1},
+		fields["v"].Equals(42): {1},
+		fields["m"].Row(2):     {1},
+		fields["b"].Row(true):  {2},
+		fields["t"].Range(1, time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC), time.Date(2019, 6, 1, 13, 0, 0, 0, time.UTC)): {1},
+		fields["t"].Range(1, time.Date(2019, 6, 1, 13, 0, 0, 0, time.UTC), time.Date(2019, 6, 1, 14, 0, 0, 0, time.UTC)): nil,
+	} {
+		resp, err := client.Query(q)
+		if err != nil {
+			t.Fatalf("querying %s: %v", q.Serialize(), err)
+		}
+		if cols := resp.Result().Row().Columns; !reflect.DeepEqual(cols, expected) && len(cols)+len(expected) > 0 {
+			t.Fatalf("expected %v for %s, got %v", expected, q.Serialize(), cols)
+		}
+	}
+
+	resp, err := client.Query(fields["k"].Row("a"), gopilosa.OptQueryColumnAttrs(true))
+	if err != nil {
+		t.Fatalf("querying attributes: %v", err)
+	}
+	if attrs := resp.Result().Row().Attributes; !reflect.DeepEqual(attrs, map[string]interface{}{"color": "red"}) {
+		t.Fatalf("unexpected row attributes %v", attrs)
+	}
+	resp, err = client.Query(fields["f"].Row(3), gopilosa.OptQueryColumnAttrs(true))
+	if err != nil {
+		t.Fatalf("querying attributes: %v", err)
+	}
+	if cols := resp.Columns(); len(cols) != 1 || !reflect.DeepEqual(cols[0].Attributes, map[string]interface{}{"name": "one", "score": 2.5}) {
+		t.Fatalf("unexpected column attributes %v", cols)
+	}
+}
+
+func TestFileIndexerAcknowledge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pdk-files")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	indexer, err := pdk.SetupFiles(dir, "fileindex", 2)
+	if err != nil {
+		t.Fatalf("SetupFiles: %v", err)
+	}
+	acker := indexer.(pdk.Acknowledger)
+	var acks []error
+	ack := func(err error) { acks = append(acks, err) }
+
+	// Nothing is buffered, so there's nothing to wait for.
+	acker.Acknowledge(ack)
+	if len(acks) != 1 || acks[0] != nil {
+		t.Fatalf("expected an immediate acknowledgement, got %v", acks)
+	}
+
+	// Acknowledgements wait until the buffers are written out, by which
+	// point the schema includes the new field.
+	if err := indexer.AddColumn("f", uint64(1), uint64(1)); err != nil {
+		t.Fatalf("adding: %v", err)
+	}
+	acker.Acknowledge(ack)
+	if len(acks) != 1 {
+		t.Fatalf("expected acknowledgement to wait, got %v", acks)
+	}
+	if err := indexer.AddColumn("f", uint64(2), uint64(1)); err != nil {
+		t.Fatalf("adding: %v", err)
+	}
+	if len(acks) != 2 || acks[1] != nil {
+		t.Fatalf("expected acknowledgement once written, got %v", acks)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "schema.json"))
+	if err != nil {
+		t.Fatalf("reading schema: %v", err)
+	}
+	if !strings.Contains(string(data), `"f"`) {
+		t.Fatalf("expected field 'f' in schema, got %s", data)
+	}
+
+	// A failed write is passed on.
+	if err := indexer.AddColumn("f", uint64(3), uint64(1)); err != nil {
+		t.Fatalf("adding: %v", err)
+	}
+	acker.Acknowledge(ack)
+	if err := os.RemoveAll(filepath.Join(dir, "f")); err != nil {
+		t.Fatalf("removing field directory: %v", err)
+	}
+	if err := indexer.Flush(); err == nil {
+		t.Fatal("expected error flushing")
+	}
+	if len(acks) != 3 || acks[2] == nil {
+		t.Fatalf("expected failed acknowledgement, got %v", acks)
+	}
+}
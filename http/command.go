@@ -33,9 +33,13 @@
 package http
 
 import (
+	"context"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
+	"syscall"
+	"time"
 
 	"github.com/pilosa/pdk"
 	"github.com/pilosa/pdk/leveldb"
@@ -49,15 +53,34 @@ type SubjecterOpts struct {
 
 // Main holds the config for the http command.
 type Main struct {
-	Bind          string   `help:"Listen for post requests on this address."`
-	PilosaHosts   []string `help:"List of host:port pairs for Pilosa cluster."`
-	Index         string   `help:"Pilosa index to write to."`
-	BatchSize     uint     `help:"Batch size for Pilosa imports."`
-	Framer        pdk.DashField
-	SubjectPath   []string `help:"Comma separated path to value in each record that should be mapped to column ID. Blank gets a sequential ID"`
-	Proxy         string   `help:"Bind to this address to proxy and translate requests to Pilosa"`
-	AllowedFields []string `help:"If any are passed, only frame names in this comma separated list will be indexed."`
-	TranslatorDir string   `help:"Directory for key/id mapping storage."`
+	Bind             string   `help:"Listen for post requests on this address."`
+	PilosaHosts      []string `help:"List of host:port pairs for Pilosa cluster."`
+	Index            string   `help:"Pilosa index to write to."`
+	BatchSize        uint     `help:"Batch size for Pilosa imports."`
+	Framer           pdk.DashField
+	SubjectPath      []string      `help:"Comma separated path to value in each record that should be mapped to column ID. Blank gets a sequential ID"`
+	Proxy            string        `help:"Bind to this address to proxy and translate requests to Pilosa"`
+	AllowedFields    []string      `help:"If any are passed, only frame names in this comma separated list will be indexed."`
+	TranslatorDir    string        `help:"Directory for key/id mapping storage."`
+	DeadLetters      string        `help:"File to append records which fail to be ingested to (as JSON lines). Blank drops them."`
+	ParseConcurrency int           `help:"Number of goroutines parsing records."`
+	MapConcurrency   int           `help:"Number of goroutines mapping parsed records."`
+	FlushInterval    time.Duration `help:"Maximum time to wait before importing received data into Pilosa. 0 waits for a full batch."`
+	Acks             bool          `help:"Don't respond to requests until their data has been imported."`
+	FieldConfig      string        `help:"TOML file describing how to create new fields in Pilosa."`
+	WALDir           string        `help:"Directory for a write-ahead log which buffers data on its way to Pilosa, so that ingest continues while Pilosa is unavailable. Blank disables."`
+	MutexFields      []string      `help:"Comma separated list of fields which have a single string value per record, to be indexed as mutex fields."`
+	BoolFields       bool          `help:"Index bools in bool fields rather than as rows in a set field named after the property."`
+	ReplaceFields    []string      `help:"Comma separated list of fields in which each record replaces the rows set by earlier records with the same subject. Records are then ingested in order, so parse and map concurrency must be 1."`
+	AttrFields       []string      `help:"Comma separated list of fields whose values are set as column attributes rather than indexed."`
+	NativeKeys       bool          `help:"Let Pilosa translate string rows and columns to IDs, creating the index and fields with keys, rather than translating them locally."`
+	TimeLayouts      []string      `help:"Comma separated list of layouts (as in Go's time.Parse) of strings which should be parsed as times."`
+	TimestampField   string        `help:"Field holding the timestamp of each record, which is used for its rows in set fields. Other times are indexed as year, month, day and hour int fields."`
+	ListModes        []string      `help:"Comma separated list of field:mode pairs setting how lists are mapped. The modes are set (the default), positional, first, last and count."`
+	InferTypes       bool          `help:"Infer the types (int, float, bool, time, ip or string) of string values, such as CSV columns."`
+	InferSample      int           `help:"Number of records sampled to infer the types of their columns before any are ingested."`
+	InferOverrides   []string      `help:"Comma separated list of column:type pairs fixing the types of columns. The types are string, int, float, bool, time, epoch and ip."`
+	Mapping          string        `help:"TOML or YAML file describing how each path in records is mapped (see pdk.MappingConfig). It replaces the framer options."`
 
 	proxy http.Server
 }
@@ -65,23 +88,31 @@ type Main struct {
 // NewMain gets a new Main with default values.
 func NewMain() *Main {
 	return &Main{
-		Bind:        ":12121",
-		PilosaHosts: []string{"localhost:10101"},
-		Index:       "jsonhttp",
-		BatchSize:   10,
-		Framer:      pdk.DashField{},
-		Proxy:       ":13131",
+		Bind:             ":12121",
+		PilosaHosts:      []string{"localhost:10101"},
+		Index:            "jsonhttp",
+		BatchSize:        10,
+		Framer:           pdk.DashField{},
+		Proxy:            ":13131",
+		ParseConcurrency: 1,
+		MapConcurrency:   1,
+		FlushInterval:    time.Second * 5,
+		InferSample:      pdk.DefaultInferSample,
 	}
 }
 
 // Run runs the http command.
 func (m *Main) Run() error {
-	src, err := NewJSONSource(WithAddr(m.Bind))
+	opts := []JSONSourceOption{WithAddr(m.Bind)}
+	if m.Acks {
+		opts = append(opts, WithAcks())
+	}
+	src, err := NewJSONSource(opts...)
 	if err != nil {
 		return errors.Wrap(err, "getting json source")
 	}
 
-	if m.TranslatorDir == "" {
+	if m.TranslatorDir == "" && !m.NativeKeys {
 		m.TranslatorDir, err = ioutil.TempDir("", "pdk")
 		if err != nil {
 			return errors.Wrap(err, "creating temp directory")
@@ -90,8 +121,26 @@ func (m *Main) Run() error {
 
 	log.Println("listening on", src.Addr())
 
+	var mapping *pdk.MappingConfig
+	if m.Mapping != "" {
+		mapping, err = pdk.LoadMappingConfig(m.Mapping)
+		if err != nil {
+			return errors.Wrap(err, "loading mapping config")
+		}
+		if subject := mapping.Subject(); subject != nil {
+			m.SubjectPath = subject
+		}
+	}
+
 	translateColumns := true
 	parser := pdk.NewDefaultGenericParser()
+	parser.TimeLayouts = m.TimeLayouts
+	parser.InferTypes = m.InferTypes
+	parser.InferSample = m.InferSample
+	parser.InferOverrides, err = pdk.ParseInferTypes(m.InferOverrides)
+	if err != nil {
+		return errors.Wrap(err, "parsing inferred types")
+	}
 	if len(m.SubjectPath) == 0 {
 		parser.Subjecter = pdk.BlankSubjecter{}
 		translateColumns = false
@@ -100,12 +149,40 @@ func (m *Main) Run() error {
 	}
 
 	mapper := pdk.NewCollapsingMapper()
-	mapper.Translator, err = leveldb.NewTranslator(m.TranslatorDir)
-	if err != nil {
-		return errors.Wrap(err, "creating translator")
+	if m.NativeKeys {
+		mapper.Translator = nil
+		mapper.ColTranslator = nil
+		if translateColumns {
+			mapper.Nexter = nil
+		}
+	} else {
+		mapper.Translator, err = leveldb.NewTranslator(m.TranslatorDir)
+		if err != nil {
+			return errors.Wrap(err, "creating translator")
+		}
 	}
 	mapper.Framer = &m.Framer
-	if translateColumns {
+	mapper.MutexFields = m.MutexFields
+	mapper.BoolFields = m.BoolFields
+	mapper.ReplaceFields = m.ReplaceFields
+	mapper.AttrFields = m.AttrFields
+	mapper.TimestampField = m.TimestampField
+	mapper.ListModes, err = pdk.ParseListModes(m.ListModes)
+	if err != nil {
+		return errors.Wrap(err, "parsing list modes")
+	}
+	if m.FieldConfig != "" {
+		mapper.FieldConfigs, err = pdk.LoadFieldConfigs(m.FieldConfig)
+		if err != nil {
+			return errors.Wrap(err, "loading field configs")
+		}
+	}
+	if mapping != nil {
+		if err := mapping.Apply(parser, mapper); err != nil {
+			return errors.Wrap(err, "applying mapping config")
+		}
+	}
+	if translateColumns && !m.NativeKeys {
 		log.Println("translating columns")
 		mapper.ColTranslator, err = leveldb.NewFieldTranslator(m.TranslatorDir, "__columns")
 		if err != nil {
@@ -115,21 +192,37 @@ func (m *Main) Run() error {
 		log.Println("not translating columns")
 	}
 
-	indexer, err := pdk.SetupPilosa(m.PilosaHosts, m.Index, nil, m.BatchSize)
+	indexer, err := pdk.SetupPilosa(m.PilosaHosts, m.Index, nil, m.BatchSize,
+		pdk.OptPilosaFlushInterval(m.FlushInterval),
+		pdk.OptPilosaFieldConfigs(mapper.FieldConfigs...),
+		pdk.OptPilosaWAL(m.WALDir),
+		pdk.OptPilosaNativeKeys(m.NativeKeys))
 	if err != nil {
 		return errors.Wrap(err, "setting up Pilosa")
 	}
 
 	ingester := pdk.NewIngester(src, parser, mapper, indexer)
+	ingester.ParseConcurrency = m.ParseConcurrency
+	ingester.MapConcurrency = m.MapConcurrency
 	if len(m.AllowedFields) > 0 {
 		ingester.AllowedFields = make(map[string]bool)
 		for _, fram := range m.AllowedFields {
 			ingester.AllowedFields[fram] = true
 		}
 	}
+	if m.DeadLetters != "" {
+		sink, err := pdk.NewFileDeadLetterSink(m.DeadLetters)
+		if err != nil {
+			return errors.Wrap(err, "opening dead letter sink")
+		}
+		defer sink.Close()
+		ingester.DeadLetters = sink
+	}
+	forwarder := pdk.NewPilosaForwarder(m.PilosaHosts[0], mapper.Translator, mapper.ColTranslator)
+	forwarder.FieldConfigs = mapper.FieldConfigs
 	m.proxy = http.Server{
 		Addr:    m.Proxy,
-		Handler: pdk.NewPilosaForwarder(m.PilosaHosts[0], mapper.Translator, mapper.ColTranslator),
+		Handler: forwarder,
 	}
 	go func() {
 		err := m.proxy.ListenAndServe()
@@ -137,5 +230,12 @@ func (m *Main) Run() error {
 			log.Printf("proxy closed: %v", err)
 		}
 	}()
-	return errors.Wrap(ingester.Run(), "running ingester")
+	ctx, cancel := pdk.SignalContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	err = ingester.RunContext(ctx)
+	if errors.Cause(err) == context.Canceled {
+		log.Printf("shut down: %v", err)
+		return nil
+	}
+	return errors.Wrap(err, "running ingester")
 }
@@ -37,8 +37,10 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/pilosa/pdk"
 	"github.com/pilosa/pdk/json"
 	"github.com/pkg/errors"
 )
@@ -50,6 +52,23 @@ type JSONSource struct {
 	listener net.Listener
 	server   *http.Server
 	records  chan record
+
+	mu       sync.Mutex
+	closed   bool
+	handlers sync.WaitGroup
+
+	acks      bool
+	ackLock   sync.Mutex
+	pending   map[pdk.AckToken]*requestAcks
+	nextToken pdk.AckToken
+}
+
+// requestAcks keeps track of the acknowledgements for the records from a
+// single request.
+type requestAcks struct {
+	wg  sync.WaitGroup
+	mu  sync.Mutex
+	err error
 }
 
 // WithAddr is an option for the JSONSource which causes it to bind to the given
@@ -80,6 +99,17 @@ func WithBuffer(n int) JSONSourceOption {
 	}
 }
 
+// WithAcks is an option for JSONSource which makes it wait until every record
+// in a request has been acknowledged before responding, so that a successful
+// response means the data has been imported. If any record fails, the response
+// is an error. Records are acknowledged by the Ingester, which (with Index)
+// waits for a full batch to be imported, so small batch sizes are best.
+func WithAcks() JSONSourceOption {
+	return func(j *JSONSource) {
+		j.acks = true
+	}
+}
+
 // JSONSourceOption is a functional option type for JSONSource.
 type JSONSourceOption func(j *JSONSource)
 
@@ -88,6 +118,7 @@ type JSONSourceOption func(j *JSONSource)
 func NewJSONSource(opts ...JSONSourceOption) (*JSONSource, error) {
 	j := &JSONSource{
 		records: make(chan record, 3),
+		pending: make(map[pdk.AckToken]*requestAcks),
 	}
 	for _, opt := range opts {
 		opt(j)
@@ -108,9 +139,9 @@ func NewJSONSource(opts ...JSONSourceOption) (*JSONSource, error) {
 	}
 	go func() {
 		err := j.server.Serve(j.listener)
-		if err != nil {
+		if err != nil && err != http.ErrServerClosed {
 			j.records <- record{err: errors.Wrap(err, "starting server")}
-			close(j.records)
+			j.Close()
 		}
 	}()
 	return j, nil
@@ -125,8 +156,9 @@ func (j *JSONSource) Addr() string {
 }
 
 type record struct {
-	data interface{}
-	err  error
+	data  interface{}
+	token pdk.AckToken
+	err   error
 }
 
 // Record returns an unmarshaled json document as a map[string]interface. That
@@ -139,27 +171,120 @@ func (j *JSONSource) Record() (interface{}, error) {
 	return rec.data, rec.err
 }
 
+// RecordToken implements pdk.Acker.
+func (j *JSONSource) RecordToken() (interface{}, pdk.AckToken, error) {
+	rec, ok := <-j.records
+	if !ok {
+		return nil, 0, io.EOF
+	}
+	return rec.data, rec.token, rec.err
+}
+
+// Ack implements pdk.Acker. It does nothing unless the JSONSource was created
+// with WithAcks.
+func (j *JSONSource) Ack(token pdk.AckToken, err error) error {
+	if !j.acks {
+		return nil
+	}
+	j.ackLock.Lock()
+	ra, ok := j.pending[token]
+	delete(j.pending, token)
+	j.ackLock.Unlock()
+	if !ok {
+		return errors.Errorf("acknowledging unknown record %d", token)
+	}
+	if err != nil {
+		ra.mu.Lock()
+		if ra.err == nil {
+			ra.err = err
+		}
+		ra.mu.Unlock()
+	}
+	ra.wg.Done()
+	return nil
+}
+
+// Close stops the JSONSource from accepting new requests. Records from requests
+// which were already being handled continue to be returned by Record, after
+// which Record returns io.EOF.
+func (j *JSONSource) Close() error {
+	j.mu.Lock()
+	if j.closed {
+		j.mu.Unlock()
+		return nil
+	}
+	j.closed = true
+	j.mu.Unlock()
+	err := j.server.Close()
+	go func() {
+		j.handlers.Wait()
+		close(j.records)
+	}()
+	return errors.Wrap(err, "closing server")
+}
+
 // ServeHTTP implements http.Handler for JSONSource
 func (j *JSONSource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		err := errors.Errorf("unsupported method: %v, request: %#v", r.Method, r)
+	j.mu.Lock()
+	if j.closed {
+		j.mu.Unlock()
+		http.Error(w, "source is closed", http.StatusServiceUnavailable)
+		return
+	}
+	j.handlers.Add(1)
+	j.mu.Unlock()
+
+	ra, err := j.handle(r)
+	// Only wait for acknowledgements once all the records have been sent, so
+	// that Close doesn't have to wait for them.
+	j.handlers.Done()
+	if err != nil {
 		log.Println(err)
-		http.Error(w, err.Error(), http.StatusMethodNotAllowed)
+		status := http.StatusBadRequest
+		if r.Method != http.MethodPost {
+			status = http.StatusMethodNotAllowed
+		}
+		http.Error(w, err.Error(), status)
 		return
 	}
+	if ra != nil {
+		ra.wg.Wait()
+		if ra.err != nil {
+			http.Error(w, errors.Wrap(ra.err, "ingesting records").Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// handle decodes the records in a request and sends them to be returned by
+// Record. If the JSONSource is waiting for acknowledgements, it returns what to
+// wait for.
+func (j *JSONSource) handle(r *http.Request) (*requestAcks, error) {
+	if r.Method != http.MethodPost {
+		return nil, errors.Errorf("unsupported method: %v, request: %#v", r.Method, r)
+	}
+	var ra *requestAcks
+	if j.acks {
+		ra = &requestAcks{}
+	}
 	jsource := json.NewSource(r.Body)
 	for {
 		stuff, err := jsource.Record()
 		if err == io.EOF {
-			return
+			return ra, nil
 		}
 		if err != nil {
-			err := errors.Wrap(err, "decoding json")
-			log.Println(err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+			return nil, errors.Wrap(err, "decoding json")
+		}
+		rec := record{data: stuff}
+		if ra != nil {
+			ra.wg.Add(1)
+			j.ackLock.Lock()
+			j.nextToken++
+			rec.token = j.nextToken
+			j.pending[rec.token] = ra
+			j.ackLock.Unlock()
 		}
-		j.records <- record{data: stuff}
+		j.records <- rec
 	}
 }
 
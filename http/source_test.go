@@ -34,13 +34,16 @@ package http_test
 
 import (
 	"fmt"
+	"io"
 	"net"
 	"net/http/httptest"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/pilosa/pdk/http"
+	"github.com/pkg/errors"
 )
 
 func TestJSONSource(t *testing.T) {
@@ -132,3 +135,84 @@ func TestJSONSource(t *testing.T) {
 	}
 
 }
+
+func TestJSONSourceClose(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+
+	j, err := http.NewJSONSource(http.WithListener(ln))
+	if err != nil {
+		t.Fatalf("getting json source: %v", err)
+	}
+
+	j.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(`{"hello": 2}`)))
+	if err := j.Close(); err != nil {
+		t.Fatalf("closing source: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	j.ServeHTTP(rec, httptest.NewRequest("POST", "/", strings.NewReader(`{"goodbye": 3}`)))
+	if rec.Code != 503 {
+		t.Fatalf("expected unavailable after close, got: %d", rec.Code)
+	}
+
+	data, err := j.Record()
+	if err != nil {
+		t.Fatalf("getting record accepted before close: %v", err)
+	}
+	if !reflect.DeepEqual(data, map[string]interface{}{"hello": 2.0}) {
+		t.Fatalf("unexpected data: %#v", data)
+	}
+	if _, err := j.Record(); err != io.EOF {
+		t.Fatalf("expected io.EOF after draining closed source, got: %v", err)
+	}
+}
+
+func TestJSONSourceAcks(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+
+	j, err := http.NewJSONSource(http.WithListener(ln), http.WithAcks())
+	if err != nil {
+		t.Fatalf("getting json source: %v", err)
+	}
+	defer j.Close()
+
+	for _, ackErr := range []error{nil, errors.New("import failed")} {
+		rec := httptest.NewRecorder()
+		done := make(chan struct{})
+		go func() {
+			j.ServeHTTP(rec, httptest.NewRequest("POST", "/", strings.NewReader(`{"hello": 2}{"hello": 2}`)))
+			close(done)
+		}()
+		_, first, err := j.RecordToken()
+		if err != nil {
+			t.Fatalf("getting record: %v", err)
+		}
+		_, second, err := j.RecordToken()
+		if err != nil {
+			t.Fatalf("getting record: %v", err)
+		}
+		if err := j.Ack(first, nil); err != nil {
+			t.Fatalf("acking: %v", err)
+		}
+		select {
+		case <-done:
+			t.Fatal("responded before all records were acknowledged")
+		case <-time.After(time.Millisecond * 10):
+		}
+		if err := j.Ack(second, ackErr); err != nil {
+			t.Fatalf("acking: %v", err)
+		}
+		<-done
+		if ackErr == nil && rec.Code != 200 {
+			t.Fatalf("expected success, got: %d %s", rec.Code, rec.Body)
+		} else if ackErr != nil && rec.Code != 500 {
+			t.Fatalf("expected failure, got: %d %s", rec.Code, rec.Body)
+		}
+	}
+}
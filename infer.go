@@ -0,0 +1,347 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pdk
+
+import (
+	"math"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// InferType is a type which GenericParser can infer for, or force on, string
+// values.
+type InferType string
+
+// InferTypes for GenericParser.InferOverrides. When inferring, the types are
+// tried in the order int, float, bool, time, ip, and strings which don't match
+// any of them remain strings.
+const (
+	// InferString leaves values as strings.
+	InferString InferType = "string"
+	// InferInt parses base 10 integers as I64s.
+	InferInt InferType = "int"
+	// InferFloat parses finite floating point numbers as F64s.
+	InferFloat InferType = "float"
+	// InferBool parses values accepted by strconv.ParseBool as Bs.
+	InferBool InferType = "bool"
+	// InferTime parses RFC3339 timestamps as Times.
+	InferTime InferType = "time"
+	// InferEpoch parses (possibly fractional) seconds since the Unix epoch as
+	// Times. Since these are indistinguishable from numbers, it is never
+	// inferred, and must be set as an override.
+	InferEpoch InferType = "epoch"
+	// InferIP parses IP addresses as IPv4s or IPv6s.
+	InferIP InferType = "ip"
+)
+
+// DefaultInferSample is the number of records GenericParser samples before
+// fixing the inferred types of their columns, if InferSample is not set.
+const DefaultInferSample = 100
+
+// inferOrder is the order in which types are tried when inferring.
+var inferOrder = []InferType{InferInt, InferFloat, InferBool, InferTime, InferIP}
+
+// ParseInferTypes parses InferOverrides from strings of the form
+// "column:type", e.g. "zip:string".
+func ParseInferTypes(specs []string) (map[string]InferType, error) {
+	types := make(map[string]InferType, len(specs))
+	for _, spec := range specs {
+		i := strings.LastIndex(spec, ":")
+		if i < 0 {
+			return nil, errors.Errorf("inferred type '%s' is not of the form column:type", spec)
+		}
+		typ := InferType(spec[i+1:])
+		switch typ {
+		case InferString, InferInt, InferFloat, InferBool, InferTime, InferEpoch, InferIP:
+		default:
+			return nil, errors.Errorf("unknown type '%s' for column '%s'", typ, spec[:i])
+		}
+		types[spec[:i]] = typ
+	}
+	return types, nil
+}
+
+// inferColumn tracks which types a column's sampled values have all matched.
+type inferColumn struct {
+	// candidates has bit i set if every sampled value matched inferOrder[i].
+	candidates uint
+	fixed      bool
+	typ        InferType
+}
+
+// SampleSize implements SamplingParser. It returns InferSample (or
+// DefaultInferSample) if InferTypes is set, and otherwise 0.
+func (m *GenericParser) SampleSize() int {
+	if !m.InferTypes {
+		return 0
+	}
+	if m.InferSample <= 0 {
+		return DefaultInferSample
+	}
+	return m.InferSample
+}
+
+// Sample implements SamplingParser, narrowing down the types which the string
+// values in data could be inferred as.
+func (m *GenericParser) Sample(data interface{}) {
+	switch data.(type) {
+	case *Entity, *EntityWithContext:
+		return
+	}
+	e, err := m.parseData(reflect.ValueOf(data))
+	if err != nil || e == nil {
+		return
+	}
+	m.inferMu.Lock()
+	defer m.inferMu.Unlock()
+	m.sample(e, nil)
+}
+
+// sample narrows down the candidate types of the columns of e's string values.
+// Callers must hold inferMu.
+func (m *GenericParser) sample(e *Entity, path []string) {
+	for prop, obj := range e.Objects {
+		propPath := append(path[:len(path):len(path)], string(prop))
+		objs, ok := obj.(Objects)
+		if !ok {
+			objs = Objects{obj}
+		}
+		for _, obj := range objs {
+			switch tobj := obj.(type) {
+			case *Entity:
+				m.sample(tobj, propPath)
+			case S:
+				col := strings.Join(propPath, ".")
+				if _, ok := m.InferOverrides[col]; ok || tobj == "" {
+					continue
+				}
+				c := m.inferColumn(col)
+				if !c.fixed {
+					c.candidates &= inferMatches(string(tobj))
+				}
+			}
+		}
+	}
+}
+
+// EndSample implements SamplingParser, fixing the type of each column which
+// was sampled. Columns which weren't have their types fixed by their first
+// value.
+func (m *GenericParser) EndSample() {
+	m.inferMu.Lock()
+	defer m.inferMu.Unlock()
+	for _, c := range m.inferCols {
+		if !c.fixed {
+			c.fixed = true
+			c.typ = firstInferType(c.candidates)
+		}
+	}
+}
+
+// inferColumn returns the inferColumn for col, creating it if necessary.
+// Callers must hold inferMu.
+func (m *GenericParser) inferColumn(col string) *inferColumn {
+	if m.inferCols == nil {
+		m.inferCols = make(map[string]*inferColumn)
+	}
+	c := m.inferCols[col]
+	if c == nil {
+		c = &inferColumn{candidates: 1<<uint(len(inferOrder)) - 1}
+		m.inferCols[col] = c
+	}
+	return c
+}
+
+// infer replaces the string values in e with inferred or overridden types,
+// dropping empty strings unless they are overridden to be strings. Values
+// which don't match a column's fixed type are dropped, or cause an error if
+// m.Strict is set.
+func (m *GenericParser) infer(e *Entity, path []string) error {
+	for prop, obj := range e.Objects {
+		propPath := append(path[:len(path):len(path)], string(prop))
+		switch tobj := obj.(type) {
+		case *Entity:
+			if err := m.infer(tobj, propPath); err != nil {
+				return err
+			}
+		case Objects:
+			items := tobj[:0]
+			for _, item := range tobj {
+				item, err := m.inferObject(item, propPath)
+				if err != nil {
+					return err
+				}
+				if item != nil {
+					items = append(items, item)
+				}
+			}
+			e.Objects[prop] = items
+		case S:
+			val, err := m.inferObject(tobj, propPath)
+			if err != nil {
+				return err
+			}
+			if val == nil {
+				delete(e.Objects, prop)
+			} else {
+				e.Objects[prop] = val
+			}
+		}
+	}
+	return nil
+}
+
+// inferObject infers the type of obj if it is a string, returning nil if the
+// value should be dropped.
+func (m *GenericParser) inferObject(obj Object, path []string) (Object, error) {
+	switch tobj := obj.(type) {
+	case *Entity:
+		return tobj, m.infer(tobj, path)
+	case S:
+		col := strings.Join(path, ".")
+		typ, ok := m.InferOverrides[col]
+		if tobj == "" && typ != InferString {
+			return nil, nil
+		}
+		if !ok {
+			if !m.InferTypes {
+				return tobj, nil
+			}
+			typ = m.inferType(col, string(tobj))
+		}
+		val, ok := parseAs(string(tobj), typ)
+		if !ok {
+			if m.Strict {
+				return nil, errors.Errorf("value '%s' of column '%s' is not a %s", tobj, col, typ)
+			}
+			m.Stats.Count("parser.infer.mismatch", 1, 1)
+			return nil, nil
+		}
+		return val, nil
+	}
+	return obj, nil
+}
+
+// inferType returns the type that s in column col should be parsed as, which
+// is the type fixed for col. If col's type hasn't been fixed, because it
+// wasn't sampled (see SamplingParser), it is fixed as the first type which s
+// matches.
+func (m *GenericParser) inferType(col, s string) InferType {
+	m.inferMu.RLock()
+	c := m.inferCols[col]
+	if c != nil && c.fixed {
+		typ := c.typ
+		m.inferMu.RUnlock()
+		return typ
+	}
+	m.inferMu.RUnlock()
+
+	matches := inferMatches(s)
+	m.inferMu.Lock()
+	defer m.inferMu.Unlock()
+	c = m.inferColumn(col)
+	if !c.fixed {
+		c.fixed = true
+		c.typ = firstInferType(c.candidates & matches)
+	}
+	return c.typ
+}
+
+// inferMatches returns a mask with bit i set if s can be parsed as
+// inferOrder[i].
+func inferMatches(s string) uint {
+	var matches uint
+	for i, typ := range inferOrder {
+		if _, ok := parseAs(s, typ); ok {
+			matches |= 1 << uint(i)
+		}
+	}
+	return matches
+}
+
+// firstInferType returns the first type in inferOrder whose bit is set in
+// mask, or InferString if there is none.
+func firstInferType(mask uint) InferType {
+	for i, typ := range inferOrder {
+		if mask&(1<<uint(i)) != 0 {
+			return typ
+		}
+	}
+	return InferString
+}
+
+// parseAs parses s as typ, reporting whether it could.
+func parseAs(s string, typ InferType) (Object, bool) {
+	switch typ {
+	case InferString:
+		return S(s), true
+	case InferInt:
+		i, err := strconv.ParseInt(s, 10, 64)
+		return I64(i), err == nil
+	case InferFloat:
+		f, err := strconv.ParseFloat(s, 64)
+		return F64(f), err == nil && !math.IsNaN(f) && !math.IsInf(f, 0)
+	case InferBool:
+		b, err := strconv.ParseBool(s)
+		return B(b), err == nil
+	case InferTime:
+		t, err := time.Parse(time.RFC3339Nano, s)
+		return Time(t), err == nil
+	case InferEpoch:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, false
+		}
+		sec, frac := math.Modf(f)
+		return Time(time.Unix(int64(sec), int64(frac*1e9)).UTC()), true
+	case InferIP:
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, false
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			var ret IPv4
+			copy(ret[:], ip4)
+			return ret, true
+		}
+		var ret IPv6
+		copy(ret[:], ip)
+		return ret, true
+	}
+	return nil, false
+}
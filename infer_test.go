@@ -0,0 +1,195 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pdk
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGenericParserInferTypes(t *testing.T) {
+	gp := NewDefaultGenericParser()
+	gp.InferTypes = true
+	gp.InferSample = 2
+	gp.InferOverrides = map[string]InferType{"zip": InferString, "ts": InferEpoch}
+	recs := []map[string]string{
+		{"n": "1", "f": "1", "b": "true", "t": "2019-06-01T12:30:00Z", "ip": "10.0.0.1", "s": "a", "zip": "02134", "ts": "1559392200", "empty": ""},
+		{"n": "2", "f": "2.5", "b": "F", "t": "2019-06-01T12:30:00.5Z", "ip": "::1", "s": "3", "zip": "94110", "ts": "1559392200.5", "empty": ""},
+		{"n": "3", "f": "4", "b": "false", "t": "2019-06-02T00:00:00Z", "ip": "10.0.0.2", "s": "b", "zip": "", "ts": "0", "empty": ""},
+	}
+	if size := gp.SampleSize(); size != 2 {
+		t.Fatalf("unexpected sample size %d", size)
+	}
+	for _, rec := range recs[:2] {
+		gp.Sample(rec)
+	}
+	gp.EndSample()
+	var ents []*Entity
+	for _, rec := range recs {
+		ent, err := gp.Parse(rec)
+		if err != nil {
+			t.Fatalf("parsing %v: %v", rec, err)
+		}
+		ents = append(ents, ent)
+	}
+	ts := time.Date(2019, time.June, 1, 12, 30, 0, 0, time.UTC)
+	expected := map[Property]Object{
+		"n":   I64(3),
+		"f":   F64(4),
+		"b":   B(false),
+		"t":   Time(time.Date(2019, time.June, 2, 0, 0, 0, 0, time.UTC)),
+		"ip":  IPv4{10, 0, 0, 2},
+		"s":   S("b"),
+		"zip": S(""),
+		"ts":  Time(time.Unix(0, 0).UTC()),
+	}
+	if !reflect.DeepEqual(ents[2].Objects, expected) {
+		t.Fatalf("unexpected objects: %#v", ents[2].Objects)
+	}
+	// the sampled records are parsed as the types fixed for the whole
+	// sample.
+	if ents[0].Objects["f"] != F64(1) || ents[1].Objects["f"] != F64(2.5) {
+		t.Fatalf("unexpected sampled floats: %v, %v", ents[0].Objects["f"], ents[1].Objects["f"])
+	}
+	if ents[0].Objects["s"] != S("a") || ents[1].Objects["s"] != S("3") {
+		t.Fatalf("unexpected sampled string: %#v", ents[1].Objects["s"])
+	}
+	if ents[1].Objects["ip"] != (IPv6{15: 1}) {
+		t.Fatalf("unexpected ipv6: %#v", ents[1].Objects["ip"])
+	}
+	if !time.Time(ents[1].Objects["ts"].(Time)).Equal(ts.Add(time.Millisecond * 500)) {
+		t.Fatalf("unexpected epoch time: %v", ents[1].Objects["ts"])
+	}
+
+	// mismatches after the type is fixed are dropped, or fail in strict
+	// mode. Columns which weren't sampled are fixed by their first value.
+	ent, err := gp.Parse(map[string]interface{}{"n": "x", "nested": map[string]string{"n": "5"}, "list": []string{"1", "", "2"}})
+	if err != nil {
+		t.Fatalf("parsing mismatch: %v", err)
+	}
+	expected = map[Property]Object{
+		"nested": &Entity{Objects: map[Property]Object{"n": I64(5)}},
+		"list":   Objects{I64(1), I64(2)},
+	}
+	if !reflect.DeepEqual(ent.Objects, expected) {
+		t.Fatalf("unexpected objects: %#v", ent.Objects)
+	}
+	ent, err = gp.Parse(map[string]interface{}{"list": []string{"1.5"}})
+	if err != nil {
+		t.Fatalf("parsing mismatch: %v", err)
+	}
+	if list := ent.Objects["list"].(Objects); len(list) != 0 {
+		t.Fatalf("expected mismatch with fixed type to be dropped: %#v", list)
+	}
+	gp.Strict = true
+	if _, err := gp.Parse(map[string]string{"n": "x"}); err == nil {
+		t.Fatal("expected error parsing mismatch in strict mode")
+	}
+}
+
+// kindParser is a GenericParser which records the type of each value of "f".
+type kindParser struct {
+	*GenericParser
+	mu    sync.Mutex
+	kinds []string
+}
+
+func (k *kindParser) Parse(data interface{}) (*Entity, error) {
+	e, err := k.GenericParser.Parse(data)
+	if err == nil {
+		k.mu.Lock()
+		k.kinds = append(k.kinds, fmt.Sprintf("%T", e.Objects["f"]))
+		k.mu.Unlock()
+	}
+	return e, err
+}
+
+func TestIngesterInferSample(t *testing.T) {
+	gp := NewDefaultGenericParser()
+	gp.Stats = NopStatter{}
+	gp.InferTypes = true
+	gp.InferSample = 3
+	parser := &kindParser{GenericParser: gp}
+	src := &sliceSource{recs: []interface{}{
+		map[string]string{"f": "1"},
+		map[string]string{"f": "2"},
+		map[string]string{"f": "2.5"},
+		map[string]string{"f": "3"},
+	}}
+	ingester := NewIngester(src, parser, NewCollapsingMapper(), &recordingIndexer{})
+	ingester.Stats = NopStatter{}
+	ingester.Log = NopLogger{}
+	if err := ingester.Run(); err != nil {
+		t.Fatalf("running ingester: %v", err)
+	}
+	if expected := []string{"pdk.F64", "pdk.F64", "pdk.F64", "pdk.F64"}; !reflect.DeepEqual(parser.kinds, expected) {
+		t.Fatalf("expected every record to be parsed with the sampled type, got %v", parser.kinds)
+	}
+}
+
+func TestParseInferTypes(t *testing.T) {
+	types, err := ParseInferTypes([]string{"zip:string", "a:b:ip"})
+	if err != nil {
+		t.Fatalf("parsing: %v", err)
+	}
+	if !reflect.DeepEqual(types, map[string]InferType{"zip": InferString, "a:b": InferIP}) {
+		t.Fatalf("unexpected types: %v", types)
+	}
+	for _, spec := range []string{"zip", "zip:uuid"} {
+		if _, err := ParseInferTypes([]string{spec}); err == nil {
+			t.Errorf("expected error parsing '%s'", spec)
+		}
+	}
+}
+
+func TestCollapsingMapperIPs(t *testing.T) {
+	cm := NewCollapsingMapper()
+	cm.Translator = nil
+	pr, err := cm.Map(&Entity{Objects: map[Property]Object{
+		"src": IPv4{10, 0, 0, 1},
+		"dst": IPv6{15: 1},
+	}})
+	if err != nil {
+		t.Fatalf("mapping: %v", err)
+	}
+	rows := make(map[string]interface{})
+	for _, row := range pr.Rows {
+		rows[row.Field] = row.ID
+	}
+	if !reflect.DeepEqual(rows, map[string]interface{}{"src": "10.0.0.1", "dst": "::1"}) {
+		t.Fatalf("unexpected rows: %v", rows)
+	}
+}
@@ -33,12 +33,30 @@
 package pdk
 
 import (
+	"context"
 	"io"
 	"log"
 	"os"
+	"os/signal"
+	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pilosa/pdk/termstat"
+	"github.com/pkg/errors"
+)
+
+// Stage identifies a step in the ingest pipeline.
+type Stage string
+
+// Stages of the ingest pipeline at which a record can fail.
+const (
+	StageSource    Stage = "source"
+	StageParse     Stage = "parse"
+	StageTransform Stage = "transform"
+	StageMap       Stage = "map"
+	StageIndex     Stage = "index"
 )
 
 // Ingester combines a Source, Parser, Mapper, and Indexer, and uses them to
@@ -47,7 +65,19 @@ import (
 // batch situation where the Source eventually returns io.EOF (or some other
 // error), and the Ingester completes (after the other components are done).
 type Ingester struct {
-	ParseConcurrency int
+	// The number of goroutines running each stage of the pipeline. Records
+	// are passed from one stage to the next on a channel which holds up to
+	// QueueSize records.
+	SourceConcurrency    int
+	ParseConcurrency     int
+	TransformConcurrency int
+	MapConcurrency       int
+	IndexConcurrency     int
+	QueueSize            int
+
+	// GaugeInterval is how often the number of records waiting in each
+	// stage's queue is reported to Stats.
+	GaugeInterval time.Duration
 
 	src     Source
 	parser  RecordParser
@@ -57,6 +87,13 @@ type Ingester struct {
 	Transformers  []Transformer
 	AllowedFields map[string]bool
 
+	// ErrorPolicies determines what happens when a record fails at each Stage.
+	// Stages which aren't present get the default ErrorPolicy.
+	ErrorPolicies map[Stage]ErrorPolicy
+
+	// DeadLetters receives records which are quarantined by an ErrorPolicy.
+	DeadLetters DeadLetterSink
+
 	Stats Statter
 	Log   Logger
 }
@@ -64,7 +101,13 @@ type Ingester struct {
 // NewIngester gets a new Ingester.
 func NewIngester(source Source, parser RecordParser, mapper RecordMapper, indexer Indexer) *Ingester {
 	return &Ingester{
-		ParseConcurrency: 1,
+		SourceConcurrency:    1,
+		ParseConcurrency:     1,
+		TransformConcurrency: 1,
+		MapConcurrency:       1,
+		IndexConcurrency:     1,
+		QueueSize:            1000,
+		GaugeInterval:        time.Second,
 
 		src:     source,
 		parser:  parser,
@@ -79,68 +122,615 @@ func NewIngester(source Source, parser RecordParser, mapper RecordMapper, indexe
 
 // Run runs the ingest.
 func (n *Ingester) Run() error {
-	pwg := sync.WaitGroup{}
-	for i := 0; i < n.ParseConcurrency; i++ {
-		pwg.Add(1)
+	return n.RunContext(context.Background())
+}
+
+// ingestRun holds the state of a single call to RunContext.
+type ingestRun struct {
+	ctx   context.Context
+	abort context.CancelFunc
+
+	acker        Acker
+	acknowledger Acknowledger
+
+	records uint64
+
+	mu       sync.Mutex
+	failures map[Stage]uint64
+	errs     []error
+}
+
+// RunContext runs the ingest until the Source is exhausted or ctx is done.
+//
+// When ctx is done, the Ingester stops pulling new records from the Source,
+// finishes parsing, transforming, mapping, and indexing the records which are
+// already in flight, and closes the Indexer so that everything it has buffered
+// is imported. If the Source implements io.Closer, it is closed at that point,
+// and records are pulled from it until it returns an error so that anything it
+// has already accepted is drained - Sources which block waiting for data should
+// implement io.Closer so that they can be stopped this way.
+//
+// If an ErrorPolicy aborts the ingest, it is stopped in the same way, and the
+// returned error is an *IngestError. Otherwise, if ctx is done before the
+// Source is exhausted, the returned error wraps ctx.Err() and reports the
+// number of records which were ingested.
+func (n *Ingester) RunContext(ctx context.Context) error {
+	for stage, policy := range n.ErrorPolicies {
+		if policy == Quarantine && n.DeadLetters == nil {
+			return errors.Errorf("quarantine policy for %s stage requires a DeadLetterSink", stage)
+		}
+	}
+	if om, ok := n.mapper.(OrderedMapper); ok && om.NeedsOrder() {
+		stages := []Stage{StageSource, StageParse, StageTransform, StageMap, StageIndex}
+		for i, c := range []int{n.SourceConcurrency, n.ParseConcurrency, n.TransformConcurrency, n.MapConcurrency, n.IndexConcurrency} {
+			if c > 1 {
+				return errors.Errorf("the mapper needs records in order, so the %s stage can't have a concurrency of %d", stages[i], c)
+			}
+		}
+	}
+	run := &ingestRun{failures: make(map[Stage]uint64)}
+	run.acker, _ = n.src.(Acker)
+	run.acknowledger, _ = n.indexer.(Acknowledger)
+	if run.acker != nil && run.acknowledger == nil {
+		n.Log.Printf("warning: the %T can't tell when records have been imported, so records from the source are acknowledged as soon as they are added to it and may be lost", n.indexer)
+	}
+	run.ctx, run.abort = context.WithCancel(ctx)
+	defer run.abort()
+
+	closer, closable := n.src.(io.Closer)
+	srcDone := make(chan struct{})
+	if closable {
 		go func() {
-			defer pwg.Done()
-			var recordErr error
-			for {
-				// Source
-				var rec interface{}
-				rec, recordErr = n.src.Record()
-				if recordErr != nil {
-					break
+			select {
+			case <-run.ctx.Done():
+				if err := closer.Close(); err != nil {
+					n.Log.Printf("closing source: %v", err)
 				}
-				n.Stats.Count("ingest.Record", 1, 1)
-
-				// Parse
-				val, err := n.parser.Parse(rec)
-				if err != nil {
-					n.Log.Printf("couldn't parse record %s, err: %v", rec, err)
-					n.Stats.Count("ingest.ParseError", 1, 1)
-					continue
-				}
-				n.Stats.Count("ingest.Parse", 1, 1)
-
-				// Transform
-				for _, tr := range n.Transformers {
-					err := tr.Transform(val)
-					if err != nil {
-						n.Log.Printf("Problem with transformer %#v: %v", tr, err)
-						n.Stats.Count("ingest.TransformError", 1, 1)
+			case <-srcDone:
+			}
+		}()
+	}
+
+	parseQ := make(chan *inflight, n.QueueSize)
+	transformQ := make(chan *inflight, n.QueueSize)
+	mapQ := make(chan *inflight, n.QueueSize)
+	indexQ := make(chan *inflight, n.QueueSize)
+
+	var sampled []*inflight
+	if sp, ok := n.parser.(SamplingParser); ok && sp.SampleSize() > 0 {
+		sampled = n.sample(run, sp)
+	}
+
+	go func() {
+		// the sampled records go first, so that they are in order.
+		for _, r := range sampled {
+			parseQ <- r
+		}
+		swg := sync.WaitGroup{}
+		for i := 0; i < workers(n.SourceConcurrency); i++ {
+			swg.Add(1)
+			go func() {
+				defer swg.Done()
+				var wait time.Duration
+				for {
+					if !closable && run.ctx.Err() != nil {
+						return
 					}
+					rec, token, err := n.nextRecord(run)
+					if err == io.EOF {
+						return
+					} else if err != nil {
+						if run.ctx.Err() != nil {
+							return
+						}
+						n.backOff(run, err, &wait)
+						continue
+					}
+					wait = 0
+					atomic.AddUint64(&run.records, 1)
+					n.Stats.Count("ingest.Record", 1, 1)
+					parseQ <- &inflight{rec: rec, token: token}
 				}
-				n.Stats.Count("ingest.Transform", 1, 1)
-
-				// Map
-				pr, err := n.mapper.Map(val)
-				if err != nil {
-					n.Log.Printf("couldn't map val: %s, err: %v", val, err)
-					n.Stats.Count("ingest.MapError", 1, 1)
-					continue
+			}()
+		}
+		swg.Wait()
+		close(srcDone)
+		close(parseQ)
+	}()
+
+	n.runStage(n.ParseConcurrency, parseQ, transformQ, func(r *inflight) bool {
+		return n.parseRecord(run, r)
+	})
+	n.runStage(n.TransformConcurrency, transformQ, mapQ, func(r *inflight) bool {
+		return n.transformRecord(run, r)
+	})
+	n.runStage(n.MapConcurrency, mapQ, indexQ, func(r *inflight) bool {
+		return n.mapRecord(run, r)
+	})
+	iwg := n.runStage(n.IndexConcurrency, indexQ, nil, func(r *inflight) bool {
+		n.indexRecord(run, r)
+		return true
+	})
+
+	done, reported := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(reported)
+		n.reportQueues(done, map[string]chan *inflight{
+			"ingest.ParseQueue":     parseQ,
+			"ingest.TransformQueue": transformQ,
+			"ingest.MapQueue":       mapQ,
+			"ingest.IndexQueue":     indexQ,
+		})
+	}()
+	iwg.Wait()
+	close(done)
+	<-reported
+
+	err := n.indexer.Close()
+	if len(run.errs) > 0 {
+		ierr := &IngestError{
+			Records:  run.records,
+			Failures: run.failures,
+			Errs:     run.errs,
+		}
+		if err != nil {
+			ierr.Errs = append(ierr.Errs, errors.Wrap(err, "closing indexer"))
+		}
+		return ierr
+	}
+	if ctx.Err() != nil {
+		if err != nil {
+			return errors.Wrapf(err, "closing indexer after ingest stopped (%v)", ctx.Err())
+		}
+		return errors.Wrapf(ctx.Err(), "ingest stopped after %d records", run.records)
+	}
+	return err
+}
+
+// SignalContext returns a copy of parent which is canceled when the process
+// receives any of the given signals. It is meant to be passed to
+// Ingester.RunContext so that ingest shuts down gracefully when (e.g.) SIGTERM
+// is received. The returned CancelFunc stops listening for signals.
+func SignalContext(parent context.Context, sigs ...os.Signal) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, sigs...)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+	return ctx, cancel
+}
+
+// sample reads records from the Source for sp to sample, until it has seen
+// SampleSize of them, the Source is exhausted or the ingest is stopped. It
+// returns them to be ingested first.
+func (n *Ingester) sample(run *ingestRun, sp SamplingParser) []*inflight {
+	defer sp.EndSample()
+	var sampled []*inflight
+	var wait time.Duration
+	for len(sampled) < sp.SampleSize() && run.ctx.Err() == nil {
+		rec, token, err := n.nextRecord(run)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			n.backOff(run, err, &wait)
+			continue
+		}
+		wait = 0
+		atomic.AddUint64(&run.records, 1)
+		n.Stats.Count("ingest.Record", 1, 1)
+		sp.Sample(rec)
+		sampled = append(sampled, &inflight{rec: rec, token: token})
+	}
+	return sampled
+}
+
+// nextRecord gets the next record from the Source, along with its token if the
+// Source is an Acker, applying the ErrorPolicy for StageSource if that fails.
+// It returns io.EOF when the Source is exhausted.
+//
+// If the Source returns an *IngestError holding a Record, that record is bad
+// rather than the Source being broken, so it isn't retried, and it is handed
+// to the ErrorPolicy (and DeadLetterSink) like a record which failed in any
+// other stage.
+func (n *Ingester) nextRecord(run *ingestRun) (rec interface{}, token AckToken, err error) {
+	var eof bool
+	var bad *IngestError
+	err = n.retry(run, StageSource, func() error {
+		if run.acker != nil {
+			rec, token, err = run.acker.RecordToken()
+		} else {
+			rec, err = n.src.Record()
+		}
+		if errors.Cause(err) == io.EOF {
+			eof = true
+			return nil
+		}
+		if ierr, ok := errors.Cause(err).(*IngestError); ok && ierr.Record != nil {
+			bad = ierr
+			return nil
+		}
+		return err
+	})
+	if eof {
+		return nil, 0, io.EOF
+	}
+	if bad != nil {
+		err = bad
+	}
+	if err != nil && run.ctx.Err() == nil {
+		n.Log.Printf("error in ingest run loop: %v", err)
+		n.Stats.Count("ingest.SourceError", 1, 1)
+		var r *inflight
+		if bad != nil {
+			r = &inflight{rec: bad.Record, token: token}
+		}
+		n.fail(run, r, StageSource, err)
+	}
+	return rec, token, err
+}
+
+// maxSourceBackoff is the longest the Ingester waits after the Source fails
+// before trying it again.
+var maxSourceBackoff = time.Second * 5
+
+// backOff waits before the Source is tried again after err, starting at 10ms
+// and doubling with each consecutive failure up to maxSourceBackoff, so that a
+// Source which keeps failing under the Skip policy doesn't spin. wait holds the
+// previous wait, and should be reset to 0 when a record is read. A bad record
+// doesn't need a wait, since the Source itself is fine.
+func (n *Ingester) backOff(run *ingestRun, err error, wait *time.Duration) {
+	if ierr, ok := err.(*IngestError); ok && ierr.Record != nil {
+		return
+	}
+	*wait *= 2
+	if *wait == 0 {
+		*wait = time.Millisecond * 10
+	} else if *wait > maxSourceBackoff {
+		*wait = maxSourceBackoff
+	}
+	select {
+	case <-time.After(*wait):
+	case <-run.ctx.Done():
+	}
+}
+
+// inflight is a record making its way through the pipeline, along with what
+// the stages it has passed through have made of it.
+type inflight struct {
+	rec   interface{}
+	token AckToken
+	ent   *Entity
+	pr    PilosaRecord
+	// mapped is set if pr was produced by a DirectParser, so the transform
+	// and map stages have nothing to do.
+	mapped bool
+}
+
+// workers returns the number of goroutines to run for a stage configured with
+// the given concurrency.
+func workers(concurrency int) int {
+	if concurrency < 1 {
+		return 1
+	}
+	return concurrency
+}
+
+// runStage starts goroutines which call f for each record received on in, and
+// pass it on to out if f returns true. out is closed once in is closed and all
+// the records have been processed. The returned WaitGroup is done at the same
+// point.
+func (n *Ingester) runStage(concurrency int, in <-chan *inflight, out chan<- *inflight, f func(r *inflight) bool) *sync.WaitGroup {
+	wg := &sync.WaitGroup{}
+	for i := 0; i < workers(concurrency); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range in {
+				if f(r) && out != nil {
+					out <- r
 				}
+			}
+		}()
+	}
+	if out != nil {
+		go func() {
+			wg.Wait()
+			close(out)
+		}()
+	}
+	return wg
+}
 
-				// Index
-				n.Stats.Count("ingest.Map", 1, 1)
-				for _, row := range pr.Rows {
-					if n.AllowedFields == nil || n.AllowedFields[row.Field] {
-						n.indexer.AddColumn(row.Field, pr.Col, row.ID)
-						n.Stats.Count("ingest.AddBit", 1, 1)
-					}
+// reportQueues reports the number of records waiting in each of the named
+// queues to Stats every GaugeInterval until done is closed.
+func (n *Ingester) reportQueues(done <-chan struct{}, queues map[string]chan *inflight) {
+	if n.GaugeInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(n.GaugeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for name, q := range queues {
+				n.Stats.Gauge(name, float64(len(q)), 1)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// parseRecord parses the raw record from the Source into an Entity, or
+// straight into a PilosaRecord if the parser is a DirectParser for the
+// Ingester's mapper and there are no Transformers.
+func (n *Ingester) parseRecord(run *ingestRun, r *inflight) bool {
+	direct, ok := n.parser.(DirectParser)
+	ok = ok && len(n.Transformers) == 0 && sameMapper(direct.RecordMapper(), n.mapper)
+	err := n.retry(run, StageParse, func() (err error) {
+		if ok {
+			r.pr, err = direct.ParseRecord(r.rec)
+			r.mapped = err == nil
+			return err
+		}
+		r.ent, err = n.parser.Parse(r.rec)
+		return err
+	})
+	if err != nil {
+		n.Log.Printf("couldn't parse record %s, err: %v", r.rec, err)
+		n.Stats.Count("ingest.ParseError", 1, 1)
+		n.fail(run, r, StageParse, err)
+		return false
+	}
+	n.Stats.Count("ingest.Parse", 1, 1)
+	return true
+}
+
+// sameMapper reports whether m1 and m2 are the same RecordMapper. Mappers of
+// types which can't be compared are never the same.
+func sameMapper(m1, m2 RecordMapper) bool {
+	if m1 == nil || m2 == nil || reflect.TypeOf(m1) != reflect.TypeOf(m2) || !reflect.TypeOf(m1).Comparable() {
+		return false
+	}
+	return m1 == m2
+}
+
+// transformRecord applies each of the Transformers to the parsed Entity.
+func (n *Ingester) transformRecord(run *ingestRun, r *inflight) bool {
+	if r.mapped {
+		return true
+	}
+	for _, tr := range n.Transformers {
+		err := n.retry(run, StageTransform, func() error {
+			return tr.Transform(r.ent)
+		})
+		if err != nil {
+			n.Log.Printf("Problem with transformer %#v: %v", tr, err)
+			n.Stats.Count("ingest.TransformError", 1, 1)
+			n.fail(run, r, StageTransform, err)
+			return false
+		}
+	}
+	n.Stats.Count("ingest.Transform", 1, 1)
+	return true
+}
+
+// mapRecord maps the Entity to a PilosaRecord.
+func (n *Ingester) mapRecord(run *ingestRun, r *inflight) bool {
+	if r.mapped {
+		return true
+	}
+	err := n.retry(run, StageMap, func() (err error) {
+		r.pr, err = n.mapper.Map(r.ent)
+		return err
+	})
+	if err != nil {
+		n.Log.Printf("couldn't map val: %s, err: %v", r.ent, err)
+		n.Stats.Count("ingest.MapError", 1, 1)
+		n.fail(run, r, StageMap, err)
+		return false
+	}
+	n.Stats.Count("ingest.Map", 1, 1)
+	return true
+}
+
+// indexRecord hands the bits and values in the PilosaRecord to the Indexer. If
+// the Source is an Acker, the record is acknowledged once the Indexer has
+// imported it, or straight away if the Indexer can't say when that is.
+func (n *Ingester) indexRecord(run *ingestRun, r *inflight) {
+	err := n.retry(run, StageIndex, func() error {
+		return n.index(r.pr)
+	})
+	if err != nil {
+		n.Log.Printf("couldn't index record %s, err: %v", r.rec, err)
+		n.Stats.Count("ingest.IndexError", 1, 1)
+		n.fail(run, r, StageIndex, err)
+		return
+	}
+	if run.acker == nil {
+		return
+	}
+	if run.acknowledger != nil {
+		run.acknowledger.Acknowledge(func(err error) {
+			if err != nil {
+				n.Stats.Count("ingest.ImportError", 1, 1)
+				n.fail(run, r, StageIndex, err)
+				return
+			}
+			n.ack(run, r, nil)
+		})
+	} else {
+		n.ack(run, r, nil)
+	}
+}
+
+// index clears and adds the bits and values in pr (and the records in its
+// More) in the Indexer, or in the Indexer for pr's Index.
+func (n *Ingester) index(pr PilosaRecord) error {
+	indexer := n.indexer
+	if pr.Index != "" {
+		router, ok := indexer.(IndexRouter)
+		if !ok {
+			return errors.Errorf("record is for index '%s', but the Indexer can't route to other indexes", pr.Index)
+		}
+		var err error
+		indexer, err = router.IndexerFor(pr.Index)
+		if err != nil {
+			return errors.Wrapf(err, "getting Indexer for index '%s'", pr.Index)
+		}
+	}
+	for _, row := range pr.ClearRows {
+		if n.AllowedFields == nil || n.AllowedFields[row.Field] {
+			if err := indexer.ClearColumn(row.Field, pr.Col, row.ID); err != nil {
+				return errors.Wrapf(err, "clearing bit from field '%s'", row.Field)
+			}
+			n.Stats.Count("ingest.ClearBit", 1, 1)
+		}
+	}
+	for _, field := range pr.ClearVals {
+		if n.AllowedFields == nil || n.AllowedFields[field] {
+			if err := indexer.ClearValue(field, pr.Col); err != nil {
+				return errors.Wrapf(err, "clearing value from field '%s'", field)
+			}
+			n.Stats.Count("ingest.ClearValue", 1, 1)
+		}
+	}
+	for _, row := range pr.Rows {
+		if n.AllowedFields == nil || n.AllowedFields[row.Field] {
+			var err error
+			switch row.Kind {
+			case RowMutex:
+				err = indexer.AddMutex(row.Field, pr.Col, row.ID)
+			case RowBool:
+				err = indexer.AddBool(row.Field, pr.Col, row.ID == uint64(1))
+			default:
+				ts := row.Time
+				if ts.IsZero() {
+					ts = pr.Time
 				}
-				for _, val := range pr.Vals {
-					if n.AllowedFields == nil || n.AllowedFields[val.Field] {
-						n.indexer.AddValue(val.Field, pr.Col, val.Value)
-						n.Stats.Count("ingest.AddValue", 1, 1)
-					}
+				if ts.IsZero() {
+					err = indexer.AddColumn(row.Field, pr.Col, row.ID)
+				} else {
+					err = indexer.AddColumnTimestamp(row.Field, pr.Col, row.ID, ts)
 				}
 			}
-			if recordErr != io.EOF && recordErr != nil {
-				n.Log.Printf("error in ingest run loop: %v", recordErr)
+			if err != nil {
+				return errors.Wrapf(err, "adding bit to field '%s'", row.Field)
 			}
-		}()
+			n.Stats.Count("ingest.AddBit", 1, 1)
+		}
+	}
+	for _, val := range pr.Vals {
+		if n.AllowedFields == nil || n.AllowedFields[val.Field] {
+			if err := indexer.AddValue(val.Field, pr.Col, val.Value); err != nil {
+				return errors.Wrapf(err, "adding value to field '%s'", val.Field)
+			}
+			n.Stats.Count("ingest.AddValue", 1, 1)
+		}
+	}
+	for _, attr := range pr.RowAttrs {
+		if n.AllowedFields == nil || n.AllowedFields[attr.Field] {
+			if err := indexer.AddRowAttr(attr.Field, attr.ID, attr.Key, attr.Value); err != nil {
+				return errors.Wrapf(err, "adding attribute to row in field '%s'", attr.Field)
+			}
+			n.Stats.Count("ingest.AddRowAttr", 1, 1)
+		}
+	}
+	for key, value := range pr.ColAttrs {
+		if err := indexer.AddColAttr(pr.Col, key, value); err != nil {
+			return errors.Wrap(err, "adding attribute to column")
+		}
+		n.Stats.Count("ingest.AddColAttr", 1, 1)
+	}
+	for _, more := range pr.More {
+		if err := n.index(more); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ack acknowledges r if the Source is an Acker.
+func (n *Ingester) ack(run *ingestRun, r *inflight, err error) {
+	if run.acker == nil {
+		return
+	}
+	if err := run.acker.Ack(r.token, err); err != nil {
+		n.Log.Printf("couldn't acknowledge record %s: %v", r.rec, err)
+		n.Stats.Count("ingest.AckError", 1, 1)
+	}
+}
+
+// retry calls f, and if the ErrorPolicy for stage is Retry, calls it again
+// until it succeeds or the retries are used up. It returns the last error.
+func (n *Ingester) retry(run *ingestRun, stage Stage, f func() error) error {
+	err := f()
+	policy := n.ErrorPolicies[stage]
+	if policy.action != retryAction {
+		return err
+	}
+	for i := 0; err != nil && i < policy.retries && run.ctx.Err() == nil; i++ {
+		n.Stats.Count("ingest.Retry", 1, 1)
+		err = f()
+	}
+	return err
+}
+
+// fail applies the ErrorPolicy for stage to a record which failed there. r is
+// nil for StageSource, unless the Source returned a bad record.
+func (n *Ingester) fail(run *ingestRun, r *inflight, stage Stage, err error) {
+	run.mu.Lock()
+	run.failures[stage]++
+	run.mu.Unlock()
+
+	action := n.ErrorPolicies[stage].action
+	if action == defaultAction || action == retryAction {
+		if stage == StageSource && r != nil && n.DeadLetters != nil {
+			// the Source is fine, so treat a bad record like a parse
+			// failure.
+			action = quarantineAction
+		} else if stage == StageSource || stage == StageIndex {
+			action = abortAction
+		} else if n.DeadLetters != nil {
+			action = quarantineAction
+		} else {
+			action = skipAction
+		}
+	}
+	var ackErr error
+	switch action {
+	case abortAction:
+		ackErr = errors.Wrapf(err, "%s", stage)
+		run.mu.Lock()
+		run.errs = append(run.errs, ackErr)
+		run.mu.Unlock()
+		run.abort()
+	case quarantineAction:
+		var rec interface{}
+		if r != nil {
+			rec = r.rec
+		}
+		ackErr = n.deadLetter(rec, stage, err)
+	}
+	if r != nil {
+		n.ack(run, r, ackErr)
+	}
+}
+
+// deadLetter hands a failed record to the DeadLetterSink.
+func (n *Ingester) deadLetter(rec interface{}, stage Stage, err error) error {
+	err = n.DeadLetters.Put(DeadLetter{Record: rec, Stage: stage, Err: err, Time: time.Now()})
+	if err != nil {
+		n.Log.Printf("couldn't write dead letter for record %s: %v", rec, err)
+		n.Stats.Count("ingest.DeadLetterError", 1, 1)
+		return errors.Wrap(err, "writing dead letter")
 	}
-	pwg.Wait()
-	return n.indexer.Close()
+	n.Stats.Count("ingest.DeadLetter", 1, 1)
+	return nil
 }
@@ -0,0 +1,864 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pdk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gopilosa "github.com/pilosa/go-pilosa"
+	"github.com/pkg/errors"
+)
+
+// streamSource returns sequential records forever until it is closed, after
+// which it returns the records it had already buffered, and then io.EOF.
+type streamSource struct {
+	recs   chan interface{}
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newStreamSource() *streamSource {
+	s := &streamSource{
+		recs:   make(chan interface{}, 10),
+		closed: make(chan struct{}),
+	}
+	go func() {
+		defer close(s.recs)
+		for i := 0; ; i++ {
+			select {
+			case s.recs <- map[string]interface{}{"id": i}:
+			case <-s.closed:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+func (s *streamSource) Record() (interface{}, error) {
+	rec, ok := <-s.recs
+	if !ok {
+		return nil, io.EOF
+	}
+	return rec, nil
+}
+
+func (s *streamSource) Close() error {
+	s.once.Do(func() { close(s.closed) })
+	return nil
+}
+
+// recordingIndexer is an Indexer which keeps track of what it was asked to do.
+type recordingIndexer struct {
+	mu      sync.Mutex
+	cols    int
+	vals    int
+	mutexes int
+	bools   int
+	clears  int
+	attrs   int
+	times   int
+	closed  bool
+}
+
+func (r *recordingIndexer) AddColumn(field string, col, row uint64OrString) error {
+	r.mu.Lock()
+	r.cols++
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *recordingIndexer) AddColumnTimestamp(field string, col, row uint64OrString, ts time.Time) error {
+	r.mu.Lock()
+	r.times++
+	r.mu.Unlock()
+	return r.AddColumn(field, col, row)
+}
+
+func (r *recordingIndexer) AddValue(field string, col uint64OrString, val int64) error {
+	r.mu.Lock()
+	r.vals++
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *recordingIndexer) AddMutex(field string, col, row uint64OrString) error {
+	r.mu.Lock()
+	r.mutexes++
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *recordingIndexer) AddBool(field string, col uint64OrString, val bool) error {
+	r.mu.Lock()
+	r.bools++
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *recordingIndexer) ClearColumn(field string, col, row uint64OrString) error {
+	r.mu.Lock()
+	r.clears++
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *recordingIndexer) ClearValue(field string, col uint64OrString) error {
+	r.mu.Lock()
+	r.clears++
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *recordingIndexer) AddRowAttr(field string, row uint64OrString, key string, value interface{}) error {
+	r.mu.Lock()
+	r.attrs++
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *recordingIndexer) AddColAttr(col uint64OrString, key string, value interface{}) error {
+	r.mu.Lock()
+	r.attrs++
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *recordingIndexer) Flush() error { return nil }
+
+func (r *recordingIndexer) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *recordingIndexer) Client() *gopilosa.Client { return nil }
+
+func newTestIngester(src Source, indexer Indexer) *Ingester {
+	parser := NewDefaultGenericParser()
+	parser.Stats = NopStatter{}
+	parser.Log = NopLogger{}
+	ingester := NewIngester(src, parser, NewCollapsingMapper(), indexer)
+	ingester.Stats = NopStatter{}
+	ingester.Log = NopLogger{}
+	return ingester
+}
+
+func TestIngesterRunContextCancel(t *testing.T) {
+	src := newStreamSource()
+	indexer := &recordingIndexer{}
+	ingester := newTestIngester(src, indexer)
+	ingester.ParseConcurrency = 3
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() {
+		errs <- ingester.RunContext(ctx)
+	}()
+	time.Sleep(time.Millisecond * 50)
+	cancel()
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-time.After(time.Second * 5):
+		t.Fatal("RunContext did not return after cancellation")
+	}
+	if errors.Cause(err) != context.Canceled {
+		t.Fatalf("expected context.Canceled, got: %v", err)
+	}
+	if !indexer.closed {
+		t.Fatal("indexer was not closed")
+	}
+	if _, ok := <-src.recs; ok {
+		t.Fatal("source was not drained")
+	}
+	if indexer.vals == 0 {
+		t.Fatal("nothing was indexed")
+	}
+}
+
+type countingSource struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (c *countingSource) Record() (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n++
+	return map[string]interface{}{"id": c.n}, nil
+}
+
+func TestIngesterRunContextCancelUnclosableSource(t *testing.T) {
+	src := &countingSource{}
+	indexer := &recordingIndexer{}
+	ingester := newTestIngester(src, indexer)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() {
+		errs <- ingester.RunContext(ctx)
+	}()
+	time.Sleep(time.Millisecond * 10)
+	cancel()
+
+	select {
+	case err := <-errs:
+		if errors.Cause(err) != context.Canceled {
+			t.Fatalf("expected context.Canceled, got: %v", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("RunContext did not return after cancellation")
+	}
+	if indexer.vals != src.n {
+		t.Fatalf("pulled %d records from source, but indexed %d", src.n, indexer.vals)
+	}
+}
+
+func TestIngesterRunEOF(t *testing.T) {
+	src := newStreamSource()
+	src.Close()
+	indexer := &recordingIndexer{}
+	ingester := newTestIngester(src, indexer)
+	if err := ingester.Run(); err != nil {
+		t.Fatalf("running ingester: %v", err)
+	}
+	if !indexer.closed {
+		t.Fatal("indexer was not closed")
+	}
+}
+
+type sliceSource struct {
+	mu   sync.Mutex
+	recs []interface{}
+}
+
+func (s *sliceSource) Record() (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.recs) == 0 {
+		return nil, io.EOF
+	}
+	rec := s.recs[0]
+	s.recs = s.recs[1:]
+	return rec, nil
+}
+
+type memDeadLetterSink struct {
+	mu  sync.Mutex
+	dls []DeadLetter
+}
+
+func (m *memDeadLetterSink) Put(dl DeadLetter) error {
+	m.mu.Lock()
+	m.dls = append(m.dls, dl)
+	m.mu.Unlock()
+	return nil
+}
+
+type failTransformer struct{}
+
+func (failTransformer) Transform(e *Entity) error {
+	if _, ok := e.Objects["fail"]; ok {
+		return errors.New("failing transform")
+	}
+	return nil
+}
+
+func TestIngesterDeadLetters(t *testing.T) {
+	src := &sliceSource{recs: []interface{}{
+		map[string]interface{}{"id": 1},
+		7,
+		map[string]interface{}{"id": 2, "fail": 1},
+	}}
+	indexer := &recordingIndexer{}
+	sink := &memDeadLetterSink{}
+	ingester := newTestIngester(src, indexer)
+	ingester.Transformers = []Transformer{failTransformer{}}
+	ingester.DeadLetters = sink
+	if err := ingester.Run(); err != nil {
+		t.Fatalf("running ingester: %v", err)
+	}
+
+	if len(sink.dls) != 2 {
+		t.Fatalf("expected 2 dead letters, got: %v", sink.dls)
+	}
+	if sink.dls[0].Stage != StageParse || sink.dls[0].Record != 7 || sink.dls[0].Err == nil || sink.dls[0].Time.IsZero() {
+		t.Fatalf("unexpected parse dead letter: %#v", sink.dls[0])
+	}
+	if sink.dls[1].Stage != StageTransform {
+		t.Fatalf("unexpected transform dead letter: %#v", sink.dls[1])
+	}
+	if indexer.vals != 1 {
+		t.Fatalf("expected only the good record to be indexed, got %d values", indexer.vals)
+	}
+}
+
+func TestIngesterErrorPolicyAbort(t *testing.T) {
+	src := &sliceSource{recs: []interface{}{
+		map[string]interface{}{"id": 1},
+		7,
+		map[string]interface{}{"id": 2},
+	}}
+	indexer := &recordingIndexer{}
+	ingester := newTestIngester(src, indexer)
+	ingester.ErrorPolicies = map[Stage]ErrorPolicy{StageParse: Abort}
+	err := ingester.Run()
+	ierr, ok := err.(*IngestError)
+	if !ok {
+		t.Fatalf("expected *IngestError, got: %#v", err)
+	}
+	if ierr.Records < 2 || ierr.Failures[StageParse] != 1 || len(ierr.Errs) != 1 {
+		t.Fatalf("unexpected ingest error: %v", ierr)
+	}
+	if indexer.vals == 0 || !indexer.closed {
+		t.Fatalf("expected first record to be indexed and indexer closed, got %d values, closed: %v", indexer.vals, indexer.closed)
+	}
+}
+
+type flakyTransformer struct {
+	mu    sync.Mutex
+	fails int
+}
+
+func (f *flakyTransformer) Transform(e *Entity) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fails > 0 {
+		f.fails--
+		return errors.New("flaky transform")
+	}
+	return nil
+}
+
+func TestIngesterErrorPolicyRetry(t *testing.T) {
+	for _, test := range []struct {
+		fails int
+		vals  int
+	}{
+		{fails: 2, vals: 1},
+		{fails: 3, vals: 0},
+	} {
+		src := &sliceSource{recs: []interface{}{map[string]interface{}{"id": 1}}}
+		indexer := &recordingIndexer{}
+		ingester := newTestIngester(src, indexer)
+		ingester.Transformers = []Transformer{&flakyTransformer{fails: test.fails}}
+		ingester.ErrorPolicies = map[Stage]ErrorPolicy{StageTransform: Retry(2)}
+		if err := ingester.Run(); err != nil {
+			t.Fatalf("running ingester: %v", err)
+		}
+		if indexer.vals != test.vals {
+			t.Fatalf("%d failures with 2 retries: expected %d values, got %d", test.fails, test.vals, indexer.vals)
+		}
+	}
+}
+
+type errSource struct{}
+
+func (errSource) Record() (interface{}, error) {
+	return nil, errors.New("broken source")
+}
+
+func TestIngesterErrorPolicySourceDefault(t *testing.T) {
+	ingester := newTestIngester(errSource{}, &recordingIndexer{})
+	err := ingester.Run()
+	if ierr, ok := err.(*IngestError); !ok || ierr.Failures[StageSource] != 1 {
+		t.Fatalf("expected *IngestError with a source failure, got: %v", err)
+	}
+}
+
+// failingSource fails a number of times before it's exhausted.
+type failingSource struct {
+	mu    sync.Mutex
+	fails int
+	calls []time.Time
+}
+
+func (f *failingSource) Record() (interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, time.Now())
+	if len(f.calls) > f.fails {
+		return nil, io.EOF
+	}
+	return nil, errors.New("broken source")
+}
+
+func TestIngesterErrorPolicySourceBackoff(t *testing.T) {
+	src := &failingSource{fails: 3}
+	ingester := newTestIngester(src, &recordingIndexer{})
+	ingester.ErrorPolicies = map[Stage]ErrorPolicy{StageSource: Skip}
+	if err := ingester.Run(); err != nil {
+		t.Fatalf("running ingester: %v", err)
+	}
+	if len(src.calls) != 4 {
+		t.Fatalf("expected 4 calls to the source, got %d", len(src.calls))
+	}
+	for i, min := range []time.Duration{10, 20, 40} {
+		if wait := src.calls[i+1].Sub(src.calls[i]); wait < min*time.Millisecond {
+			t.Fatalf("expected to wait at least %dms after failure %d, waited %v", min, i+1, wait)
+		}
+	}
+}
+
+// badRecordSource is an ackSource which can't decode string records.
+type badRecordSource struct {
+	ackSource
+}
+
+func (b *badRecordSource) RecordToken() (interface{}, AckToken, error) {
+	rec, token, err := b.ackSource.RecordToken()
+	if s, ok := rec.(string); ok {
+		return nil, token, &IngestError{Record: s, Errs: []error{errors.New("can't decode")}}
+	}
+	return rec, token, err
+}
+
+func TestIngesterBadSourceRecord(t *testing.T) {
+	newSource := func() *badRecordSource {
+		return &badRecordSource{ackSource{
+			sliceSource: sliceSource{recs: []interface{}{"garbage", map[string]interface{}{"id": 1}}},
+			acks:        make(map[AckToken]error),
+		}}
+	}
+	src := newSource()
+	indexer := &recordingIndexer{}
+	sink := &memDeadLetterSink{}
+	ingester := newTestIngester(src, indexer)
+	ingester.DeadLetters = sink
+	if err := ingester.Run(); err != nil {
+		t.Fatalf("running ingester: %v", err)
+	}
+	if len(sink.dls) != 1 || sink.dls[0].Stage != StageSource || sink.dls[0].Record != "garbage" {
+		t.Fatalf("expected the bad record to be dead lettered, got: %#v", sink.dls)
+	}
+	if len(src.acks) != 2 || src.acks[1] != nil || src.acks[2] != nil {
+		t.Fatalf("expected both records to be acknowledged, got: %v", src.acks)
+	}
+	if indexer.vals != 1 {
+		t.Fatalf("expected the good record to be indexed, got %d values", indexer.vals)
+	}
+
+	// without a DeadLetterSink, a bad record aborts like any source error.
+	src = newSource()
+	err := newTestIngester(src, &recordingIndexer{}).Run()
+	if ierr, ok := err.(*IngestError); !ok || ierr.Failures[StageSource] != 1 {
+		t.Fatalf("expected *IngestError with a source failure, got: %v", err)
+	}
+	if src.acks[1] == nil {
+		t.Fatalf("aborted bad record acknowledged without error: %v", src.acks)
+	}
+}
+
+func TestIngesterErrorPolicyQuarantineNeedsSink(t *testing.T) {
+	ingester := newTestIngester(&sliceSource{}, &recordingIndexer{})
+	ingester.ErrorPolicies = map[Stage]ErrorPolicy{StageMap: Quarantine}
+	if err := ingester.Run(); err == nil {
+		t.Fatal("expected error running with quarantine policy and no dead letter sink")
+	}
+}
+
+// gaugeStatter records the gauges reported to it.
+type gaugeStatter struct {
+	NopStatter
+	mu     sync.Mutex
+	gauges map[string]int
+}
+
+func (g *gaugeStatter) Gauge(name string, value float64, rate float64, tags ...string) {
+	g.mu.Lock()
+	g.gauges[name]++
+	g.mu.Unlock()
+}
+
+func TestIngesterStageConcurrency(t *testing.T) {
+	recs := make([]interface{}, 1000)
+	for i := range recs {
+		recs[i] = map[string]interface{}{"id": i}
+	}
+	src := &sliceSource{recs: recs}
+	indexer := &recordingIndexer{}
+	stats := &gaugeStatter{gauges: make(map[string]int)}
+	ingester := newTestIngester(src, indexer)
+	ingester.SourceConcurrency = 2
+	ingester.ParseConcurrency = 4
+	ingester.TransformConcurrency = 3
+	ingester.MapConcurrency = 4
+	ingester.IndexConcurrency = 2
+	ingester.QueueSize = 10
+	ingester.GaugeInterval = time.Millisecond
+	ingester.Transformers = []Transformer{TransformerFunc(func(e *Entity) error {
+		time.Sleep(time.Microsecond * 100)
+		return nil
+	})}
+	ingester.Stats = stats
+	if err := ingester.Run(); err != nil {
+		t.Fatalf("running ingester: %v", err)
+	}
+	if indexer.vals != len(recs) {
+		t.Fatalf("expected %d values, got %d", len(recs), indexer.vals)
+	}
+	for _, name := range []string{"ingest.ParseQueue", "ingest.TransformQueue", "ingest.MapQueue", "ingest.IndexQueue"} {
+		if stats.gauges[name] == 0 {
+			t.Errorf("%s was not reported: %v", name, stats.gauges)
+		}
+	}
+}
+
+// ackSource is a sliceSource which numbers its records from 1 and records
+// acknowledgements.
+type ackSource struct {
+	sliceSource
+	mu   sync.Mutex
+	next AckToken
+	acks map[AckToken]error
+}
+
+func (a *ackSource) RecordToken() (interface{}, AckToken, error) {
+	rec, err := a.Record()
+	if err != nil {
+		return nil, 0, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.next++
+	return rec, a.next, nil
+}
+
+func (a *ackSource) Ack(token AckToken, err error) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.acks[token]; ok {
+		return errors.Errorf("%d acknowledged twice", token)
+	}
+	a.acks[token] = err
+	return nil
+}
+
+// ackIndexer is a recordingIndexer which acknowledges everything when it's
+// closed.
+type ackIndexer struct {
+	recordingIndexer
+	acks []func(error)
+}
+
+func (a *ackIndexer) Acknowledge(ack func(err error)) {
+	a.mu.Lock()
+	a.acks = append(a.acks, ack)
+	a.mu.Unlock()
+}
+
+func (a *ackIndexer) Close() error {
+	for _, ack := range a.acks {
+		ack(nil)
+	}
+	a.acks = nil
+	return a.recordingIndexer.Close()
+}
+
+// warningLogger is a Logger which records warnings.
+type warningLogger struct {
+	NopLogger
+	mu       sync.Mutex
+	warnings []string
+}
+
+func (w *warningLogger) Printf(format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	if strings.HasPrefix(msg, "warning:") {
+		w.mu.Lock()
+		w.warnings = append(w.warnings, msg)
+		w.mu.Unlock()
+	}
+}
+
+func TestIngesterAcks(t *testing.T) {
+	good := map[string]interface{}{"id": 1}
+	bad := map[string]interface{}{"id": 2, "fail": 1}
+	for _, indexer := range []Indexer{&recordingIndexer{}, &ackIndexer{}} {
+		// identical records are acknowledged separately.
+		src := &ackSource{
+			sliceSource: sliceSource{recs: []interface{}{good, bad, good}},
+			acks:        make(map[AckToken]error),
+		}
+		ingester := newTestIngester(src, indexer)
+		ingester.Transformers = []Transformer{failTransformer{}}
+		logger := &warningLogger{}
+		ingester.Log = logger
+		if err := ingester.Run(); err != nil {
+			t.Fatalf("running ingester: %v", err)
+		}
+		if _, ok := indexer.(Acknowledger); ok == (len(logger.warnings) > 0) {
+			t.Fatalf("unexpected warnings for %T: %v", indexer, logger.warnings)
+		}
+		for _, token := range []AckToken{1, 3} {
+			if err, ok := src.acks[token]; !ok || err != nil {
+				t.Fatalf("good record %d not acknowledged: %v", token, src.acks)
+			}
+		}
+		if err, ok := src.acks[2]; !ok || err != nil {
+			t.Fatalf("skipped record not acknowledged: %v", src.acks)
+		}
+
+		src = &ackSource{
+			sliceSource: sliceSource{recs: []interface{}{bad}},
+			acks:        make(map[AckToken]error),
+		}
+		ingester = newTestIngester(src, indexer)
+		ingester.Transformers = []Transformer{failTransformer{}}
+		ingester.ErrorPolicies = map[Stage]ErrorPolicy{StageTransform: Abort}
+		if err := ingester.Run(); err == nil {
+			t.Fatal("expected error from aborted ingest")
+		}
+		if err := src.acks[1]; err == nil {
+			t.Fatalf("aborted record acknowledged without error: %v", src.acks)
+		}
+	}
+}
+
+// failIndexer is a recordingIndexer which fails to add values.
+type failIndexer struct {
+	recordingIndexer
+}
+
+func (f *failIndexer) AddValue(field string, col uint64OrString, val int64) error {
+	return errors.New("can't add value")
+}
+
+func TestIngesterIndexError(t *testing.T) {
+	src := &sliceSource{recs: []interface{}{map[string]interface{}{"id": 1}}}
+	ingester := newTestIngester(src, &failIndexer{})
+	err := ingester.Run()
+	if ierr, ok := err.(*IngestError); !ok || ierr.Failures[StageIndex] != 1 {
+		t.Fatalf("expected *IngestError with an index failure, got: %v", err)
+	}
+}
+
+func TestIngesterRowKinds(t *testing.T) {
+	src := &sliceSource{recs: []interface{}{
+		map[string]interface{}{"id": 1, "status": "done", "tag": "red", "active": false},
+	}}
+	indexer := &recordingIndexer{}
+	ingester := newTestIngester(src, indexer)
+	mapper := NewCollapsingMapper()
+	mapper.MutexFields = []string{"status"}
+	mapper.BoolFields = true
+	ingester.mapper = mapper
+	if err := ingester.Run(); err != nil {
+		t.Fatalf("running ingester: %v", err)
+	}
+	if indexer.cols != 1 || indexer.mutexes != 1 || indexer.bools != 1 || indexer.vals != 1 {
+		t.Fatalf("unexpected adds: %d cols, %d mutexes, %d bools, %d vals", indexer.cols, indexer.mutexes, indexer.bools, indexer.vals)
+	}
+}
+
+func TestIngesterClears(t *testing.T) {
+	src := &sliceSource{recs: []interface{}{
+		map[string]interface{}{"city": "a"},
+		map[string]interface{}{"city": "b"},
+	}}
+	indexer := &recordingIndexer{}
+	ingester := newTestIngester(src, indexer)
+	mapper := NewCollapsingMapper()
+	mapper.ColTranslator = NewMapFieldTranslator()
+	mapper.ReplaceFields = []string{"city"}
+	ingester.mapper = mapper
+	if err := ingester.Run(); err != nil {
+		t.Fatalf("running ingester: %v", err)
+	}
+	if indexer.cols != 2 || indexer.clears != 1 {
+		t.Fatalf("unexpected adds: %d cols, %d clears", indexer.cols, indexer.clears)
+	}
+}
+
+// routingIndexer is a recordingIndexer which routes to a recordingIndexer for
+// each index.
+type routingIndexer struct {
+	recordingIndexer
+	indexes map[string]*recordingIndexer
+}
+
+func (r *routingIndexer) IndexerFor(index string) (Indexer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	idx, ok := r.indexes[index]
+	if !ok {
+		idx = &recordingIndexer{}
+		r.indexes[index] = idx
+	}
+	return idx, nil
+}
+
+func TestIngesterIndexes(t *testing.T) {
+	src := &sliceSource{recs: []interface{}{
+		map[string]interface{}{"user": "u1", "session": "s1", "page": "home"},
+		map[string]interface{}{"user": "u1", "session": "s2", "page": "cart"},
+	}}
+	indexer := &routingIndexer{indexes: make(map[string]*recordingIndexer)}
+	ingester := newTestIngester(src, indexer)
+	ingester.mapper = MultiIndexMapper{
+		{Index: "users", Subjecter: SubjectPath{"user"}, Mapper: NewCollapsingMapper()},
+		{Index: "sessions", Subjecter: SubjectPath{"session"}, Mapper: NewCollapsingMapper()},
+	}
+	if err := ingester.Run(); err != nil {
+		t.Fatalf("running ingester: %v", err)
+	}
+	if indexer.cols != 0 {
+		t.Fatalf("expected nothing in the default index, got %d cols", indexer.cols)
+	}
+	// Each index gets page, and the other index's subject.
+	for _, index := range []string{"users", "sessions"} {
+		if idx := indexer.indexes[index]; idx == nil || idx.cols != 4 {
+			t.Fatalf("unexpected adds to index '%s': %+v", index, idx)
+		}
+	}
+
+	src = &sliceSource{recs: []interface{}{map[string]interface{}{"page": "home"}}}
+	ingester = newTestIngester(src, &recordingIndexer{})
+	ingester.mapper = MultiIndexMapper{{Index: "users", Mapper: NewCollapsingMapper()}}
+	ingester.ErrorPolicies = map[Stage]ErrorPolicy{StageIndex: Abort}
+	if err := ingester.Run(); err == nil {
+		t.Fatal("expected error routing to an index without an IndexRouter")
+	}
+}
+
+func TestIngesterAttrs(t *testing.T) {
+	src := &sliceSource{recs: []interface{}{
+		map[string]interface{}{"name": "a", "url": "http://a", "tag": "red"},
+	}}
+	indexer := &recordingIndexer{}
+	ingester := newTestIngester(src, indexer)
+	mapper := NewCollapsingMapper()
+	mapper.AttrFields = []string{"name", "url"}
+	ingester.mapper = mapper
+	if err := ingester.Run(); err != nil {
+		t.Fatalf("running ingester: %v", err)
+	}
+	if indexer.cols != 1 || indexer.attrs != 2 {
+		t.Fatalf("unexpected adds: %d cols, %d attrs", indexer.cols, indexer.attrs)
+	}
+}
+
+func TestIngesterTimestamps(t *testing.T) {
+	src := &sliceSource{recs: []interface{}{
+		map[string]interface{}{"ts": "2019-06-01T12:00:00Z", "tag": "red", "status": "done"},
+		map[string]interface{}{"tag": "blue"},
+	}}
+	indexer := &recordingIndexer{}
+	ingester := newTestIngester(src, indexer)
+	ingester.parser.(*GenericParser).TimeLayouts = []string{time.RFC3339}
+	mapper := NewCollapsingMapper()
+	mapper.MutexFields = []string{"status"}
+	mapper.TimestampField = "ts"
+	ingester.mapper = mapper
+	if err := ingester.Run(); err != nil {
+		t.Fatalf("running ingester: %v", err)
+	}
+	if indexer.cols != 2 || indexer.times != 1 || indexer.mutexes != 1 || indexer.vals != 0 {
+		t.Fatalf("unexpected adds: %d cols, %d with timestamps, %d mutexes, %d vals", indexer.cols, indexer.times, indexer.mutexes, indexer.vals)
+	}
+}
+
+// directParser is a DirectParser which maps every record to one row.
+type directParser struct {
+	*GenericParser
+	mapper RecordMapper
+}
+
+func (directParser) ParseRecord(data interface{}) (PilosaRecord, error) {
+	return PilosaRecord{Col: uint64(1), Rows: []Row{{Field: "f", ID: uint64(2)}}}, nil
+}
+
+func (p directParser) RecordMapper() RecordMapper {
+	return p.mapper
+}
+
+func TestIngesterDirectParser(t *testing.T) {
+	tests := []struct {
+		name         string
+		ownMapper    bool
+		transformers []Transformer
+		direct       bool
+	}{
+		{name: "direct", ownMapper: true, direct: true},
+		{name: "other mapper"},
+		{name: "transformers", ownMapper: true, transformers: []Transformer{nopTransformer{}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := &sliceSource{recs: []interface{}{map[string]interface{}{"a": "b"}, map[string]interface{}{"c": 1}}}
+			indexer := &recordingIndexer{}
+			ingester := newTestIngester(src, indexer)
+			parser := directParser{GenericParser: ingester.parser.(*GenericParser), mapper: NewCollapsingMapper()}
+			if test.ownMapper {
+				parser.mapper = ingester.mapper
+			}
+			ingester.parser = parser
+			ingester.Transformers = test.transformers
+			if err := ingester.Run(); err != nil {
+				t.Fatalf("running ingester: %v", err)
+			}
+			if test.direct && (indexer.cols != 2 || indexer.vals != 0) {
+				t.Fatalf("expected 2 columns and no values from the direct parser, got %d and %d", indexer.cols, indexer.vals)
+			} else if !test.direct && (indexer.cols != 1 || indexer.vals != 1) {
+				t.Fatalf("expected records to be mapped by the Ingester's mapper, got %d columns and %d values", indexer.cols, indexer.vals)
+			}
+		})
+	}
+}
+
+type nopTransformer struct{}
+
+func (nopTransformer) Transform(e *Entity) error { return nil }
+
+func TestIngesterOrderedMapper(t *testing.T) {
+	src := &sliceSource{recs: []interface{}{map[string]interface{}{"a": "b"}}}
+	ingester := newTestIngester(src, &recordingIndexer{})
+	ingester.mapper.(*CollapsingMapper).ReplaceFields = []string{"a"}
+	ingester.MapConcurrency = 2
+	if err := ingester.Run(); err == nil || !strings.Contains(err.Error(), "map stage") {
+		t.Fatalf("expected an error about map concurrency, got %v", err)
+	}
+	ingester.MapConcurrency = 1
+	if err := ingester.Run(); err != nil {
+		t.Fatalf("running ingester: %v", err)
+	}
+}
@@ -0,0 +1,658 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pdk
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// XSD is the IRI of the XML Schema datatypes, which the "xsd" prefix of
+	// literal types expands to unless a Context defines it.
+	XSD = "http://www.w3.org/2001/XMLSchema#"
+
+	// PilosaSchema is the IRI prefix of literal types with no XSD equivalent.
+	PilosaSchema = "http://schema.pilosa.com/v0.1/"
+)
+
+// literalDecoders decode the @value of a JSON-LD value object into a Literal
+// of the type given by its (expanded) @type.
+var literalDecoders = map[string]func(v interface{}) (Literal, error){
+	XSD + "string": func(v interface{}) (Literal, error) {
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.Errorf("%v is not a string", v)
+		}
+		return S(s), nil
+	},
+	XSD + "boolean": func(v interface{}) (Literal, error) {
+		switch v := v.(type) {
+		case bool:
+			return B(v), nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			return B(b), err
+		}
+		return nil, errors.Errorf("%v is not a boolean", v)
+	},
+	XSD + "dateTime": func(v interface{}) (Literal, error) {
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.Errorf("%v is not a dateTime", v)
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		return Time(t), err
+	},
+	PilosaSchema + "ipv4": func(v interface{}) (Literal, error) {
+		ip := parseIP(v).To4()
+		if ip == nil {
+			return nil, errors.Errorf("%v is not an IPv4 address", v)
+		}
+		var ret IPv4
+		copy(ret[:], ip)
+		return ret, nil
+	},
+	PilosaSchema + "ipv6": func(v interface{}) (Literal, error) {
+		ip := parseIP(v)
+		if ip == nil {
+			return nil, errors.Errorf("%v is not an IPv6 address", v)
+		}
+		var ret IPv6
+		copy(ret[:], ip.To16())
+		return ret, nil
+	},
+	XSD + "float": func(v interface{}) (Literal, error) {
+		f, err := strconv.ParseFloat(numberString(v), 32)
+		return F32(f), err
+	},
+	XSD + "double": func(v interface{}) (Literal, error) {
+		f, err := strconv.ParseFloat(numberString(v), 64)
+		return F64(f), err
+	},
+	XSD + "byte": func(v interface{}) (Literal, error) {
+		i, err := strconv.ParseInt(numberString(v), 10, 8)
+		return I8(i), err
+	},
+	XSD + "short": func(v interface{}) (Literal, error) {
+		i, err := strconv.ParseInt(numberString(v), 10, 16)
+		return I16(i), err
+	},
+	XSD + "int": func(v interface{}) (Literal, error) {
+		i, err := strconv.ParseInt(numberString(v), 10, 32)
+		return I32(i), err
+	},
+	XSD + "long": func(v interface{}) (Literal, error) {
+		i, err := strconv.ParseInt(numberString(v), 10, 64)
+		return I64(i), err
+	},
+	XSD + "unsignedByte": func(v interface{}) (Literal, error) {
+		u, err := strconv.ParseUint(numberString(v), 10, 8)
+		return U8(u), err
+	},
+	XSD + "unsignedShort": func(v interface{}) (Literal, error) {
+		u, err := strconv.ParseUint(numberString(v), 10, 16)
+		return U16(u), err
+	},
+	XSD + "unsignedInt": func(v interface{}) (Literal, error) {
+		u, err := strconv.ParseUint(numberString(v), 10, 32)
+		return U32(u), err
+	},
+	XSD + "unsignedLong": func(v interface{}) (Literal, error) {
+		u, err := strconv.ParseUint(numberString(v), 10, 64)
+		return U64(u), err
+	},
+}
+
+// numberString returns the text of a JSON number (decoded with UseNumber) or
+// string, so that it can be parsed without losing precision.
+func numberString(v interface{}) string {
+	switch v := v.(type) {
+	case json.Number:
+		return string(v)
+	case string:
+		return v
+	}
+	return ""
+}
+
+func parseIP(v interface{}) net.IP {
+	s, _ := v.(string)
+	return net.ParseIP(s)
+}
+
+// ldContext is a Context compiled for expanding and compacting IRIs.
+type ldContext struct {
+	terms map[string]ldTerm
+	vocab string
+	base  string
+}
+
+// ldTerm is a term definition from a Context.
+type ldTerm struct {
+	id  string // the IRI (or compact IRI) the term stands for, if any
+	typ string // the @type values of the term are coerced to, if any
+}
+
+// compile checks the Context and prepares it for use.
+func (c Context) compile() (*ldContext, error) {
+	ctx := &ldContext{terms: make(map[string]ldTerm, len(c))}
+	for k, v := range c {
+		switch k {
+		case "@vocab", "@base":
+			s, ok := v.(string)
+			if !ok {
+				return nil, errors.Errorf("%s must be a string, not %T", k, v)
+			}
+			if k == "@vocab" {
+				ctx.vocab = s
+			} else {
+				ctx.base = s
+			}
+			continue
+		case "@language", "@version":
+			continue
+		}
+		switch def := v.(type) {
+		case nil:
+		case string:
+			ctx.terms[k] = ldTerm{id: def}
+		case map[string]interface{}:
+			var term ldTerm
+			if id, ok := def["@id"]; ok {
+				if term.id, ok = id.(string); !ok {
+					return nil, errors.Errorf("@id of term %s must be a string, not %T", k, id)
+				}
+			}
+			if typ, ok := def["@type"]; ok {
+				if term.typ, ok = typ.(string); !ok {
+					return nil, errors.Errorf("@type of term %s must be a string, not %T", k, typ)
+				}
+			}
+			ctx.terms[k] = term
+		default:
+			return nil, errors.Errorf("unsupported definition of term %s: %T", k, v)
+		}
+	}
+	return ctx, nil
+}
+
+// expand returns the absolute IRI for s, which may be a term, a compact IRI
+// ("prefix:suffix"), or relative to @vocab (if vocab is set, as for
+// properties and types) or @base (if not, as for @id). Keywords and strings
+// which can't be expanded are returned unchanged. ctx may be nil.
+func (ctx *ldContext) expand(s string, vocab bool) string {
+	return ctx.expandDepth(s, vocab, 0)
+}
+
+func (ctx *ldContext) expandDepth(s string, vocab bool, depth int) string {
+	if strings.HasPrefix(s, "@") || depth > 10 {
+		return s
+	}
+	if ctx != nil && vocab {
+		if term, ok := ctx.terms[s]; ok && term.id != "" && term.id != s {
+			return ctx.expandDepth(term.id, true, depth+1)
+		}
+	}
+	if i := strings.Index(s, ":"); i > 0 {
+		prefix, suffix := s[:i], s[i+1:]
+		if strings.HasPrefix(suffix, "//") {
+			return s
+		}
+		if ctx != nil {
+			if term, ok := ctx.terms[prefix]; ok && term.id != "" {
+				return ctx.expandDepth(term.id, true, depth+1) + suffix
+			}
+		}
+		if prefix == "xsd" {
+			return XSD + suffix
+		}
+		return s
+	}
+	if ctx == nil {
+		return s
+	}
+	if vocab && ctx.vocab != "" {
+		return ctx.vocab + s
+	}
+	if !vocab && ctx.base != "" {
+		base, err := url.Parse(ctx.base)
+		if err != nil {
+			return s
+		}
+		ref, err := url.Parse(s)
+		if err != nil {
+			return s
+		}
+		return base.ResolveReference(ref).String()
+	}
+	return s
+}
+
+// compact returns the shortest term, compact IRI or relative IRI which
+// expands to iri, or iri itself if there is none. Ties are broken
+// alphabetically so that the result is deterministic.
+func (ctx *ldContext) compact(iri string, vocab bool) string {
+	best := iri
+	try := func(c string) {
+		if len(c) > len(best) || (len(c) == len(best) && c >= best) {
+			return
+		}
+		if ctx.expand(c, vocab) == iri {
+			best = c
+		}
+	}
+	for name, term := range ctx.terms {
+		if term.id == "" {
+			continue
+		}
+		exp := ctx.expand(name, true)
+		if exp == iri && vocab {
+			try(name)
+		} else if strings.HasPrefix(iri, exp) && !strings.Contains(name, ":") {
+			try(name + ":" + iri[len(exp):])
+		}
+	}
+	if vocab && ctx.vocab != "" && strings.HasPrefix(iri, ctx.vocab) {
+		try(iri[len(ctx.vocab):])
+	}
+	if !vocab && ctx.base != "" && strings.HasPrefix(iri, ctx.base) {
+		try(iri[len(ctx.base):])
+	}
+	return best
+}
+
+// Expand returns a copy of e in which every property and subject is replaced
+// by the absolute IRI the Context maps it to, so that e no longer depends on
+// the Context. Properties the Context doesn't define are left as they are,
+// rather than being dropped as in the JSON-LD expansion algorithm.
+func (c Context) Expand(e *Entity) (*Entity, error) {
+	ctx, err := c.compile()
+	if err != nil {
+		return nil, errors.Wrap(err, "compiling context")
+	}
+	return renameEntity(e, ctx.expand)
+}
+
+// Compact returns a copy of e in which every property and subject is replaced
+// by the shortest term or compact IRI the Context maps to it. It reverses
+// Expand.
+func (c Context) Compact(e *Entity) (*Entity, error) {
+	ctx, err := c.compile()
+	if err != nil {
+		return nil, errors.Wrap(err, "compiling context")
+	}
+	return renameEntity(e, ctx.compact)
+}
+
+// renameEntity returns a copy of e with its subject and properties (and those
+// of the entities it contains) renamed by fn.
+func renameEntity(e *Entity, fn func(s string, vocab bool) string) (*Entity, error) {
+	ret := &Entity{Objects: make(map[Property]Object, len(e.Objects))}
+	if e.Subject != "" {
+		ret.Subject = IRI(fn(string(e.Subject), false))
+	}
+	for prop, obj := range e.Objects {
+		name := Property(fn(string(prop), true))
+		if _, exists := ret.Objects[name]; exists {
+			return nil, errors.Errorf("more than one property of %s is renamed to %s", e.Subject, name)
+		}
+		obj, err := renameObject(obj, fn)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%v", prop)
+		}
+		ret.Objects[name] = obj
+	}
+	if e.Fields != nil {
+		ret.Fields = make(map[Property]string, len(e.Fields))
+		for prop, field := range e.Fields {
+			ret.Fields[Property(fn(string(prop), true))] = field
+		}
+	}
+	return ret, nil
+}
+
+func renameObject(o Object, fn func(s string, vocab bool) string) (Object, error) {
+	switch obj := o.(type) {
+	case *Entity:
+		return renameEntity(obj, fn)
+	case Objects:
+		ret := make(Objects, len(obj))
+		for i, v := range obj {
+			var err error
+			if ret[i], err = renameObject(v, fn); err != nil {
+				return nil, errors.Wrapf(err, "index %d", i)
+			}
+		}
+		return ret, nil
+	}
+	return o, nil
+}
+
+// UnmarshalJSON decodes JSON-LD as written by MarshalJSON, restoring the
+// type of every Literal from its @type, except that I and U, which are written
+// as xsd:long and unsignedLong, become I64 and U64. Values with no @type
+// become S, B or F64 depending on their JSON type, lists become Objects, and
+// other objects Entities.
+func (e *Entity) UnmarshalJSON(data []byte) error {
+	m, err := decodeJSONObject(data)
+	if err != nil {
+		return err
+	}
+	if _, ok := m["@context"]; ok {
+		return errors.New("entity has a @context, decode it into an EntityWithContext")
+	}
+	ent, err := entityFromJSON(m, nil, false)
+	if err != nil {
+		return err
+	}
+	*e = *ent
+	return nil
+}
+
+// MarshalJSON encodes e as a JSON-LD node object with its Context. The
+// Entity's properties are written as they are; use Context.Compact first to
+// shorten absolute IRIs.
+func (e *EntityWithContext) MarshalJSON() ([]byte, error) {
+	ret, err := e.Entity.jsonMap()
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := ret["@context"]; exists {
+		return nil, errors.New("invalid entity for json: '@context' is a property")
+	}
+	if e.Context != nil {
+		ret["@context"] = e.Context
+	}
+	return json.Marshal(ret)
+}
+
+// UnmarshalJSON decodes a JSON-LD node object and its @context. Values are
+// decoded as by Entity.UnmarshalJSON, except that @type IRIs are expanded
+// with the Context, and that plain values of properties whose term
+// definitions have an @type are coerced to it. Properties are not expanded;
+// use Context.Expand for that.
+func (e *EntityWithContext) UnmarshalJSON(data []byte) error {
+	m, err := decodeJSONObject(data)
+	if err != nil {
+		return err
+	}
+	c, err := contextFromJSON(m["@context"])
+	if err != nil {
+		return err
+	}
+	ctx, err := c.compile()
+	if err != nil {
+		return errors.Wrap(err, "compiling context")
+	}
+	ent, err := entityFromJSON(m, ctx, true)
+	if err != nil {
+		return err
+	}
+	e.Entity = *ent
+	e.Context = c
+	return nil
+}
+
+// ParseJSONLD decodes a JSON-LD document, which may be a node object, a list
+// of them, or an object with a @graph, into an EntityWithContext for each
+// node. The @context of the document applies to every node, along with any
+// @context of the node itself. Remote contexts are not supported.
+func ParseJSONLD(data []byte) ([]*EntityWithContext, error) {
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, errors.Wrap(err, "decoding json")
+	}
+	var nodes []interface{}
+	var docCtx Context
+	switch doc := doc.(type) {
+	case []interface{}:
+		nodes = doc
+	case map[string]interface{}:
+		graph, ok := doc["@graph"]
+		if !ok {
+			nodes = []interface{}{doc}
+			break
+		}
+		if nodes, ok = graph.([]interface{}); !ok {
+			nodes = []interface{}{graph}
+		}
+		var err error
+		if docCtx, err = contextFromJSON(doc["@context"]); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.Errorf("JSON-LD document must be an object or list, not %T", doc)
+	}
+	ret := make([]*EntityWithContext, 0, len(nodes))
+	for i, node := range nodes {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf("node %d is a %T, not an object", i, node)
+		}
+		c, err := contextFromJSON(m["@context"])
+		if err != nil {
+			return nil, errors.Wrapf(err, "node %d", i)
+		}
+		c = mergeContexts(docCtx, c)
+		ctx, err := c.compile()
+		if err != nil {
+			return nil, errors.Wrapf(err, "compiling context of node %d", i)
+		}
+		ent, err := entityFromJSON(m, ctx, true)
+		if err != nil {
+			return nil, errors.Wrapf(err, "node %d", i)
+		}
+		ret = append(ret, &EntityWithContext{Entity: *ent, Context: c})
+	}
+	return ret, nil
+}
+
+func decodeJSONObject(data []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&m); err != nil {
+		return nil, errors.Wrap(err, "decoding json")
+	}
+	return m, nil
+}
+
+// contextFromJSON converts the decoded value of a @context, which may be an
+// object or a list of them, to a Context.
+func contextFromJSON(v interface{}) (Context, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return Context(v), nil
+	case []interface{}:
+		var ret Context
+		for _, c := range v {
+			cm, err := contextFromJSON(c)
+			if err != nil {
+				return nil, err
+			}
+			ret = mergeContexts(ret, cm)
+		}
+		return ret, nil
+	case string:
+		return nil, errors.Errorf("remote context %s is not supported", v)
+	}
+	return nil, errors.Errorf("unsupported @context of type %T", v)
+}
+
+// mergeContexts returns a Context with the definitions of both, those of c2
+// taking precedence.
+func mergeContexts(c1, c2 Context) Context {
+	if c1 == nil {
+		return c2
+	} else if c2 == nil {
+		return c1
+	}
+	ret := make(Context, len(c1)+len(c2))
+	for k, v := range c1 {
+		ret[k] = v
+	}
+	for k, v := range c2 {
+		ret[k] = v
+	}
+	return ret
+}
+
+// entityFromJSON converts a decoded JSON-LD node object to an Entity. A
+// @context is skipped at the top level, where the caller has dealt with it.
+func entityFromJSON(m map[string]interface{}, ctx *ldContext, top bool) (*Entity, error) {
+	e := NewEntity()
+	// decode in a fixed order so that errors are deterministic.
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := m[k]
+		switch k {
+		case "@id":
+			id, ok := v.(string)
+			if !ok {
+				return nil, errors.Errorf("@id must be a string, not %T", v)
+			}
+			e.Subject = IRI(id)
+			continue
+		case "@context":
+			if top {
+				continue
+			}
+			return nil, errors.New("nested @context is not supported")
+		}
+		var coerce string
+		if ctx != nil {
+			coerce = ctx.terms[k].typ
+		}
+		obj, err := objectFromJSON(v, ctx, coerce)
+		if err != nil {
+			return nil, errors.Wrap(err, k)
+		}
+		if obj != nil {
+			e.Objects[Property(k)] = obj
+		}
+	}
+	return e, nil
+}
+
+// objectFromJSON converts a decoded JSON-LD value to an Object. coerce is the
+// @type from the term definition of the property the value belongs to, if
+// any. JSON nulls return a nil Object.
+func objectFromJSON(v interface{}, ctx *ldContext, coerce string) (Object, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		ret := make(Objects, 0, len(v))
+		for i, item := range v {
+			obj, err := objectFromJSON(item, ctx, coerce)
+			if err != nil {
+				return nil, errors.Wrapf(err, "index %d", i)
+			}
+			if obj != nil {
+				ret = append(ret, obj)
+			}
+		}
+		return ret, nil
+	case map[string]interface{}:
+		if val, ok := v["@value"]; ok {
+			typ, _ := v["@type"].(string)
+			return literalObject(literalFromJSON(val, typ, ctx))
+		}
+		if list, ok := v["@list"]; ok {
+			return objectFromJSON(list, ctx, coerce)
+		}
+		if set, ok := v["@set"]; ok {
+			return objectFromJSON(set, ctx, coerce)
+		}
+		return entityFromJSON(v, ctx, false)
+	}
+	if coerce == "@id" {
+		if s, ok := v.(string); ok {
+			return &Entity{Subject: IRI(s), Objects: make(map[Property]Object)}, nil
+		}
+	}
+	return literalObject(literalFromJSON(v, coerce, ctx))
+}
+
+// literalObject returns lit as an Object, which all Literals are.
+func literalObject(lit Literal, err error) (Object, error) {
+	if err != nil {
+		return nil, err
+	}
+	return lit.(Object), nil
+}
+
+// literalFromJSON converts the @value of a JSON-LD value object to a Literal
+// of the given type.
+func literalFromJSON(v interface{}, typ string, ctx *ldContext) (Literal, error) {
+	if typ == "" || typ == "@id" {
+		switch v := v.(type) {
+		case string:
+			return S(v), nil
+		case bool:
+			return B(v), nil
+		case json.Number:
+			f, err := v.Float64()
+			return F64(f), err
+		}
+		return nil, errors.Errorf("unsupported value %v of type %T", v, v)
+	}
+	iri := ctx.expand(typ, true)
+	if !strings.Contains(iri, ":") {
+		// unprefixed XSD types, as written by earlier versions.
+		iri = XSD + iri
+	}
+	decode, ok := literalDecoders[iri]
+	if !ok {
+		return nil, errors.Errorf("unsupported literal type %s", typ)
+	}
+	lit, err := decode(v)
+	return lit, errors.Wrapf(err, "decoding %s", typ)
+}
@@ -0,0 +1,127 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+// Package jsonld provides a pdk.Source which reads JSON-LD documents, such as
+// Entities persisted with json.Marshal, so that they can be indexed (again).
+package jsonld
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/pilosa/pdk"
+	"github.com/pkg/errors"
+)
+
+// Source is a pdk.Source for reading JSON-LD documents. Each record is a
+// *pdk.EntityWithContext, which pdk.GenericParser passes through unchanged.
+type Source struct {
+	dec   *json.Decoder
+	queue []*pdk.EntityWithContext
+
+	// Expand makes the Source expand the properties and subject of each
+	// entity with its context (see pdk.Context.Expand), and drop the context.
+	Expand bool
+}
+
+// NewSource gets a new JSON-LD source which will decode a stream of
+// documents from the given reader. Each document may be a node object, a
+// list of them, or an object with a @graph, and yields a record per node.
+func NewSource(r io.Reader) *Source {
+	return &Source{
+		dec: json.NewDecoder(r),
+	}
+}
+
+// Record implements pdk.Source. It returns the next node of the documents
+// from the reader as a *pdk.EntityWithContext.
+func (s *Source) Record() (interface{}, error) {
+	for len(s.queue) == 0 {
+		var doc json.RawMessage
+		if err := s.dec.Decode(&doc); err != nil {
+			return nil, err
+		}
+		nodes, err := pdk.ParseJSONLD(doc)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing JSON-LD")
+		}
+		s.queue = nodes
+	}
+	rec := s.queue[0]
+	s.queue = s.queue[1:]
+	if s.Expand {
+		ent, err := rec.Context.Expand(&rec.Entity)
+		if err != nil {
+			return nil, errors.Wrapf(err, "expanding %s", rec.Subject)
+		}
+		rec = &pdk.EntityWithContext{Entity: *ent}
+	}
+	return rec, nil
+}
+
+type rawSourceSource struct {
+	rs     pdk.RawSource
+	expand bool
+
+	reader pdk.NamedReadCloser
+	s      *Source
+}
+
+// NewSourceFromRawSource gets a new JSON-LD source which reads the documents
+// from each reader of rs in turn. If expand is set, entities are expanded as
+// by Source.Expand.
+func NewSourceFromRawSource(rs pdk.RawSource, expand bool) pdk.Source {
+	return &rawSourceSource{rs: rs, expand: expand}
+}
+
+func (r *rawSourceSource) Record() (interface{}, error) {
+	for {
+		if r.s == nil {
+			reader, err := r.rs.NextReader()
+			if err != nil {
+				if err == io.EOF {
+					return nil, err
+				}
+				return nil, errors.Wrap(err, "getting next reader")
+			}
+			r.reader, r.s = reader, NewSource(reader)
+			r.s.Expand = r.expand
+		}
+		rec, err := r.s.Record()
+		if err == io.EOF {
+			r.reader.Close()
+			r.reader, r.s = nil, nil
+			continue
+		}
+		return rec, err
+	}
+}
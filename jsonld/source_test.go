@@ -0,0 +1,139 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package jsonld_test
+
+import (
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pilosa/pdk"
+	"github.com/pilosa/pdk/jsonld"
+)
+
+const testDocs = `{"@context":{"ex":"http://example.com/"},"@id":"ex:a","ex:n":{"@type":"xsd:int","@value":1}}
+[{"@id":"ex:b"},{"@id":"ex:c"}]
+{"@context":{"ex":"http://example.com/"},"@graph":[{"@id":"ex:d","ex:p":"q"}]}
+`
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		expand   bool
+		subjects []pdk.IRI
+	}{
+		{name: "compact", subjects: []pdk.IRI{"ex:a", "ex:b", "ex:c", "ex:d"}},
+		{name: "expand", expand: true, subjects: []pdk.IRI{"http://example.com/a", "ex:b", "ex:c", "http://example.com/d"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := jsonld.NewSource(strings.NewReader(testDocs))
+			src.Expand = test.expand
+			var subjects []pdk.IRI
+			for {
+				rec, err := src.Record()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("getting record: %v", err)
+				}
+				ent, err := pdk.NewDefaultGenericParser().Parse(rec)
+				if err != nil {
+					t.Fatalf("parsing record: %v", err)
+				}
+				if ent != &rec.(*pdk.EntityWithContext).Entity {
+					t.Fatalf("GenericParser should pass entities through")
+				}
+				subjects = append(subjects, ent.Subject)
+			}
+			if !reflect.DeepEqual(subjects, test.subjects) {
+				t.Fatalf("got subjects %v, expected %v", subjects, test.subjects)
+			}
+		})
+	}
+}
+
+func TestSourceExpand(t *testing.T) {
+	src := jsonld.NewSource(strings.NewReader(testDocs))
+	src.Expand = true
+	rec, err := src.Record()
+	if err != nil {
+		t.Fatalf("getting record: %v", err)
+	}
+	ent := rec.(*pdk.EntityWithContext)
+	if ent.Context != nil {
+		t.Fatalf("expanded entity should have no context: %v", ent.Context)
+	}
+	exp := map[pdk.Property]pdk.Object{"http://example.com/n": pdk.I32(1)}
+	if !reflect.DeepEqual(ent.Objects, exp) {
+		t.Fatalf("got %#v, expected %#v", ent.Objects, exp)
+	}
+}
+
+type namedReader struct {
+	io.ReadCloser
+	name string
+}
+
+func (n namedReader) Name() string                 { return n.name }
+func (n namedReader) Meta() map[string]interface{} { return nil }
+
+type sliceRawSource []string
+
+func (s *sliceRawSource) NextReader() (pdk.NamedReadCloser, error) {
+	if len(*s) == 0 {
+		return nil, io.EOF
+	}
+	doc := (*s)[0]
+	*s = (*s)[1:]
+	return namedReader{ReadCloser: ioutil.NopCloser(strings.NewReader(doc)), name: doc}, nil
+}
+
+func TestSourceFromRawSource(t *testing.T) {
+	src := jsonld.NewSourceFromRawSource(&sliceRawSource{testDocs, "", `{"@id":"e"}`}, false)
+	n := 0
+	for {
+		_, err := src.Record()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("getting record: %v", err)
+		}
+		n++
+	}
+	if n != 5 {
+		t.Fatalf("expected 5 records, got %d", n)
+	}
+}
@@ -0,0 +1,299 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pdk_test
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pilosa/pdk"
+)
+
+func TestEntityJSONRoundTrip(t *testing.T) {
+	e := &pdk.Entity{
+		Subject: "http://example.com/e1",
+		Objects: map[pdk.Property]pdk.Object{
+			"b":    pdk.B(true),
+			"s":    pdk.S("hello"),
+			"time": pdk.Time(time.Date(2018, 3, 4, 5, 6, 7, 8, time.UTC)),
+			"ipv4": pdk.IPv4{10, 0, 0, 1},
+			"ipv6": pdk.IPv6{0x20, 0x01, 0x0d, 0xb8, 15: 1},
+			"f32":  pdk.F32(1.1),
+			"f64":  pdk.F64(99.3374),
+			"i":    pdk.I(-5),
+			"i8":   pdk.I8(-127),
+			"i16":  pdk.I16(-32000),
+			"i32":  pdk.I32(-1123456789),
+			"i64":  pdk.I64(math.MinInt64),
+			"u":    pdk.U(190),
+			"u8":   pdk.U8(255),
+			"u16":  pdk.U16(65535),
+			"u32":  pdk.U32(3123456789),
+			"u64":  pdk.U64(math.MaxUint64),
+			"list": pdk.Objects{pdk.S("a"), pdk.I8(1)},
+			"nested": &pdk.Entity{
+				Subject: "http://example.com/e2",
+				Objects: map[pdk.Property]pdk.Object{"x": pdk.F64(3)},
+			},
+		},
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("marshaling: %v", err)
+	}
+	e2 := &pdk.Entity{}
+	if err := json.Unmarshal(data, e2); err != nil {
+		t.Fatalf("unmarshaling: %v", err)
+	}
+	// I and U share their JSON-LD types with I64 and U64.
+	e.Objects["i"], e.Objects["u"] = pdk.I64(-5), pdk.U64(190)
+	if !reflect.DeepEqual(e, e2) {
+		t.Fatalf("round trip through %s:\n%#v\n%#v", data, e, e2)
+	}
+}
+
+func TestEntityUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		exp    *pdk.Entity
+		expErr string
+	}{
+		{
+			name: "plain values",
+			data: `{"@id":"x","s":"a","b":false,"n":2,"l":["a",1],"z":null,"o":{"p":"q"}}`,
+			exp: &pdk.Entity{Subject: "x", Objects: map[pdk.Property]pdk.Object{
+				"s": pdk.S("a"),
+				"b": pdk.B(false),
+				"n": pdk.F64(2),
+				"l": pdk.Objects{pdk.S("a"), pdk.F64(1)},
+				"o": &pdk.Entity{Objects: map[pdk.Property]pdk.Object{"p": pdk.S("q")}},
+			}},
+		},
+		{
+			name: "typed values",
+			data: `{"a":{"@type":"xsd:long","@value":"12"},"b":{"@type":"unsignedByte","@value":3},"c":{"@type":"http://www.w3.org/2001/XMLSchema#boolean","@value":"true"},"d":{"@list":[{"@value":"v"}]}}`,
+			exp: &pdk.Entity{Objects: map[pdk.Property]pdk.Object{
+				"a": pdk.I64(12),
+				"b": pdk.U8(3),
+				"c": pdk.B(true),
+				"d": pdk.Objects{pdk.S("v")},
+			}},
+		},
+		{
+			name:   "out of range",
+			data:   `{"a":{"@type":"xsd:byte","@value":300}}`,
+			expErr: "decoding xsd:byte",
+		},
+		{
+			name:   "unknown type",
+			data:   `{"a":{"@type":"xsd:gYear","@value":"2018"}}`,
+			expErr: "unsupported literal type xsd:gYear",
+		},
+		{
+			name:   "context",
+			data:   `{"@context":{},"a":"b"}`,
+			expErr: "EntityWithContext",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := &pdk.Entity{}
+			err := json.Unmarshal([]byte(test.data), e)
+			if test.expErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expErr) {
+					t.Fatalf("expected error containing %q, got %v", test.expErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unmarshaling: %v", err)
+			}
+			if !reflect.DeepEqual(e, test.exp) {
+				t.Fatalf("got %#v, expected %#v", e, test.exp)
+			}
+		})
+	}
+}
+
+func TestEntityWithContextJSON(t *testing.T) {
+	data := `{
+		"@context": {
+			"ex": "http://example.com/",
+			"x": "http://www.w3.org/2001/XMLSchema#",
+			"age": {"@id": "ex:age", "@type": "x:short"},
+			"friend": {"@id": "ex:friend", "@type": "@id"}
+		},
+		"@id": "ex:bob",
+		"age": 42,
+		"friend": "ex:alice",
+		"height": {"@type": "x:float", "@value": 1.8}
+	}`
+	e := &pdk.EntityWithContext{}
+	if err := json.Unmarshal([]byte(data), e); err != nil {
+		t.Fatalf("unmarshaling: %v", err)
+	}
+	exp := &pdk.Entity{Subject: "ex:bob", Objects: map[pdk.Property]pdk.Object{
+		"age":    pdk.I16(42),
+		"friend": &pdk.Entity{Subject: "ex:alice", Objects: map[pdk.Property]pdk.Object{}},
+		"height": pdk.F32(1.8),
+	}}
+	if !reflect.DeepEqual(&e.Entity, exp) {
+		t.Fatalf("got %#v, expected %#v", e.Entity, exp)
+	}
+	if len(e.Context) != 4 {
+		t.Fatalf("unexpected context: %v", e.Context)
+	}
+
+	out, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("marshaling: %v", err)
+	}
+	e2 := &pdk.EntityWithContext{}
+	if err := json.Unmarshal(out, e2); err != nil {
+		t.Fatalf("unmarshaling %s: %v", out, err)
+	}
+	if !reflect.DeepEqual(e, e2) {
+		t.Fatalf("round trip through %s:\n%#v\n%#v", out, e, e2)
+	}
+}
+
+func TestContextExpandCompact(t *testing.T) {
+	ctx := pdk.Context{
+		"@vocab": "http://schema.org/",
+		"@base":  "http://example.com/people/",
+		"foaf":   "http://xmlns.com/foaf/0.1/",
+		"name":   "foaf:name",
+		"knows":  map[string]interface{}{"@id": "foaf:knows", "@type": "@id"},
+	}
+	compact := &pdk.Entity{
+		Subject: "bob",
+		Objects: map[pdk.Property]pdk.Object{
+			"name":          pdk.S("Bob"),
+			"foaf:age":      pdk.I(40),
+			"jobTitle":      pdk.S("builder"),
+			"http://x.y/z":  pdk.B(true),
+			"urn:isbn:1234": pdk.S("book"),
+			"knows": pdk.Objects{
+				&pdk.Entity{Subject: "alice", Objects: map[pdk.Property]pdk.Object{"name": pdk.S("Alice")}},
+			},
+		},
+		Fields: map[pdk.Property]string{"name": "names"},
+	}
+	expanded := &pdk.Entity{
+		Subject: "http://example.com/people/bob",
+		Objects: map[pdk.Property]pdk.Object{
+			"http://xmlns.com/foaf/0.1/name": pdk.S("Bob"),
+			"http://xmlns.com/foaf/0.1/age":  pdk.I(40),
+			"http://schema.org/jobTitle":     pdk.S("builder"),
+			"http://x.y/z":                   pdk.B(true),
+			"urn:isbn:1234":                  pdk.S("book"),
+			"http://xmlns.com/foaf/0.1/knows": pdk.Objects{
+				&pdk.Entity{
+					Subject: "http://example.com/people/alice",
+					Objects: map[pdk.Property]pdk.Object{"http://xmlns.com/foaf/0.1/name": pdk.S("Alice")},
+				},
+			},
+		},
+		Fields: map[pdk.Property]string{"http://xmlns.com/foaf/0.1/name": "names"},
+	}
+
+	got, err := ctx.Expand(compact)
+	if err != nil {
+		t.Fatalf("expanding: %v", err)
+	}
+	if !reflect.DeepEqual(got, expanded) {
+		t.Fatalf("expanded:\n%#v\nexpected:\n%#v", got, expanded)
+	}
+	got, err = ctx.Compact(expanded)
+	if err != nil {
+		t.Fatalf("compacting: %v", err)
+	}
+	if !reflect.DeepEqual(got, compact) {
+		t.Fatalf("compacted:\n%#v\nexpected:\n%#v", got, compact)
+	}
+
+	collide := &pdk.Entity{Objects: map[pdk.Property]pdk.Object{"name": pdk.S("a"), "foaf:name": pdk.S("b")}}
+	if _, err := ctx.Expand(collide); err == nil {
+		t.Fatal("expected error expanding two properties to the same IRI")
+	}
+}
+
+func TestParseJSONLD(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		subjects []pdk.IRI
+		expErr   string
+	}{
+		{name: "node", data: `{"@id":"a","p":1}`, subjects: []pdk.IRI{"a"}},
+		{name: "list", data: `[{"@id":"a"},{"@id":"b"}]`, subjects: []pdk.IRI{"a", "b"}},
+		{name: "graph", data: `{"@context":{"ex":"http://example.com/"},"@graph":[{"@id":"ex:a"},{"@id":"ex:b","@context":{"y":"ex:y"}}]}`, subjects: []pdk.IRI{"ex:a", "ex:b"}},
+		{name: "remote context", data: `{"@context":"http://schema.org/","@id":"a"}`, expErr: "remote context"},
+		{name: "nested context", data: `{"@id":"a","p":{"@context":{}}}`, expErr: "nested @context"},
+		{name: "literal", data: `"a"`, expErr: "must be an object or list"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nodes, err := pdk.ParseJSONLD([]byte(test.data))
+			if test.expErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expErr) {
+					t.Fatalf("expected error containing %q, got %v", test.expErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsing: %v", err)
+			}
+			var subjects []pdk.IRI
+			for _, n := range nodes {
+				subjects = append(subjects, n.Subject)
+			}
+			if !reflect.DeepEqual(subjects, test.subjects) {
+				t.Fatalf("got subjects %v, expected %v", subjects, test.subjects)
+			}
+		})
+	}
+
+	nodes, err := pdk.ParseJSONLD([]byte(`{"@context":{"ex":"http://example.com/"},"@graph":[{"@id":"ex:b","@context":{"y":"ex:y"}}]}`))
+	if err != nil {
+		t.Fatalf("parsing: %v", err)
+	}
+	if len(nodes[0].Context) != 2 {
+		t.Fatalf("node context should include the document's: %v", nodes[0].Context)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package kafka
+
+import (
+	"encoding/json"
+
+	"github.com/Shopify/sarama"
+	"github.com/pilosa/pdk"
+	"github.com/pkg/errors"
+)
+
+// DeadLetterSink implements pdk.DeadLetterSink by publishing each DeadLetter
+// as a JSON message to a Kafka topic, from which the failed records can be
+// inspected or replayed.
+type DeadLetterSink struct {
+	Hosts []string
+	Topic string
+
+	producer sarama.SyncProducer
+}
+
+// NewDeadLetterSink gets a new DeadLetterSink.
+func NewDeadLetterSink() *DeadLetterSink {
+	return &DeadLetterSink{
+		Hosts: []string{"localhost:9092"},
+		Topic: "pdk-dead-letters",
+	}
+}
+
+// Open initializes the kafka producer.
+func (s *DeadLetterSink) Open() error {
+	conf := sarama.NewConfig()
+	conf.Version = sarama.V0_10_0_0
+	conf.Producer.Return.Successes = true
+	var err error
+	s.producer, err = sarama.NewSyncProducer(s.Hosts, conf)
+	return errors.Wrap(err, "getting new producer")
+}
+
+// Put implements pdk.DeadLetterSink. Raw kafka messages (as returned by a
+// Source with Type "raw") are published with their original value as the
+// record.
+func (s *DeadLetterSink) Put(dl pdk.DeadLetter) error {
+	if msg, ok := dl.Record.(*sarama.ConsumerMessage); ok {
+		if json.Valid(msg.Value) {
+			dl.Record = json.RawMessage(msg.Value)
+		} else {
+			dl.Record = string(msg.Value)
+		}
+	}
+	val, err := json.Marshal(dl)
+	if err != nil {
+		return errors.Wrap(err, "marshaling dead letter")
+	}
+	_, _, err = s.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: s.Topic,
+		Value: sarama.ByteEncoder(val),
+	})
+	return errors.Wrap(err, "publishing dead letter")
+}
+
+// Close closes the underlying kafka producer.
+func (s *DeadLetterSink) Close() error {
+	return errors.Wrap(s.producer.Close(), "closing kafka producer")
+}
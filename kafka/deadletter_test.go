@@ -0,0 +1,80 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package kafka
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/pilosa/pdk"
+	"github.com/pkg/errors"
+)
+
+func TestDeadLetterSink(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	var published []byte
+	producer.ExpectSendMessageWithCheckerFunctionAndSucceed(func(val []byte) error {
+		published = val
+		return nil
+	})
+	sink := NewDeadLetterSink()
+	sink.producer = producer
+
+	err := sink.Put(pdk.DeadLetter{
+		Record: &sarama.ConsumerMessage{Value: []byte(`{"hello": "world"}`)},
+		Stage:  pdk.StageParse,
+		Err:    errors.New("bad record"),
+		Time:   time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("putting dead letter: %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("closing sink: %v", err)
+	}
+
+	msg := struct {
+		Record map[string]interface{} `json:"record"`
+		Stage  string                 `json:"stage"`
+		Error  string                 `json:"error"`
+	}{}
+	if err := json.Unmarshal(published, &msg); err != nil {
+		t.Fatalf("unmarshaling published message '%s': %v", published, err)
+	}
+	if msg.Record["hello"] != "world" || msg.Stage != "parse" || msg.Error != "bad record" {
+		t.Fatalf("unexpected published message: %s", published)
+	}
+}
@@ -33,9 +33,13 @@
 package kafka
 
 import (
+	"context"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
+	"syscall"
+	"time"
 
 	"github.com/pilosa/pdk"
 	"github.com/pkg/errors"
@@ -43,18 +47,36 @@ import (
 
 // Main holds the options for running Pilosa ingestion from Kafka.
 type Main struct {
-	Hosts         []string `help:"Comma separated list of Kafka hosts and ports"`
-	Topics        []string `help:"Comma separated list of Kafka topics"`
-	Group         string   `help:"Kafka group"`
-	RegistryURL   string   `help:"URL of the confluent schema registry. Pass an empty string to use JSON instead of Avro."`
-	Framer        pdk.DashField
-	PilosaHosts   []string `help:"Comma separated list of Pilosa hosts and ports."`
-	Index         string   `help:"Pilosa index."`
-	BatchSize     uint     `help:"Batch size for Pilosa imports (latency/throughput tradeoff)."`
-	SubjectPath   []string `help:"Comma separated path to value in each record that should be mapped to column ID. Blank gets a sequential ID"`
-	AllowedFields []string `help:"If any are passed, only frame names in this comma separated list will be indexed."`
-	MaxRecords    int      `help:"Maximum number of records to ingest from kafka before stopping."`
-	TranslatorDir string   `help:"Directory for key/id mapping storage."`
+	Hosts            []string `help:"Comma separated list of Kafka hosts and ports"`
+	Topics           []string `help:"Comma separated list of Kafka topics"`
+	Group            string   `help:"Kafka group"`
+	RegistryURL      string   `help:"URL of the confluent schema registry. Pass an empty string to use JSON instead of Avro."`
+	Framer           pdk.DashField
+	PilosaHosts      []string      `help:"Comma separated list of Pilosa hosts and ports."`
+	Index            string        `help:"Pilosa index."`
+	BatchSize        uint          `help:"Batch size for Pilosa imports (latency/throughput tradeoff)."`
+	SubjectPath      []string      `help:"Comma separated path to value in each record that should be mapped to column ID. Blank gets a sequential ID"`
+	AllowedFields    []string      `help:"If any are passed, only frame names in this comma separated list will be indexed."`
+	MaxRecords       int           `help:"Maximum number of records to ingest from kafka before stopping."`
+	TranslatorDir    string        `help:"Directory for key/id mapping storage."`
+	NativeKeys       bool          `help:"Create the index and fields with keys, so that Pilosa translates string rows and columns to IDs."`
+	DeadLetters      string        `help:"Kafka topic to publish records which fail to be ingested to. Blank drops them."`
+	ParseConcurrency int           `help:"Number of goroutines parsing records."`
+	MapConcurrency   int           `help:"Number of goroutines mapping parsed records."`
+	FlushInterval    time.Duration `help:"Maximum time to wait before importing consumed data into Pilosa and committing offsets. 0 waits for a full batch."`
+	FieldConfig      string        `help:"TOML file describing how to create new fields in Pilosa."`
+	WALDir           string        `help:"Directory for a write-ahead log which buffers data on its way to Pilosa, so that ingest continues while Pilosa is unavailable. Blank disables."`
+	MutexFields      []string      `help:"Comma separated list of fields which have a single string value per record, to be indexed as mutex fields."`
+	BoolFields       bool          `help:"Index bools in bool fields rather than as rows in a set field named after the property."`
+	ReplaceFields    []string      `help:"Comma separated list of fields in which each record replaces the rows set by earlier records with the same subject. Records are then ingested in order, so parse and map concurrency must be 1."`
+	AttrFields       []string      `help:"Comma separated list of fields whose values are set as column attributes rather than indexed."`
+	TimeLayouts      []string      `help:"Comma separated list of layouts (as in Go's time.Parse) of strings which should be parsed as times."`
+	TimestampField   string        `help:"Field holding the timestamp of each record, which is used for its rows in set fields. Other times are indexed as year, month, day and hour int fields."`
+	ListModes        []string      `help:"Comma separated list of field:mode pairs setting how lists are mapped. The modes are set (the default), positional, first, last and count."`
+	InferTypes       bool          `help:"Infer the types (int, float, bool, time, ip or string) of string values, such as CSV columns."`
+	InferSample      int           `help:"Number of values of each column sampled before fixing its inferred type."`
+	InferOverrides   []string      `help:"Comma separated list of column:type pairs fixing the types of columns. The types are string, int, float, bool, time, epoch and ip."`
+	Mapping          string        `help:"TOML or YAML file describing how each path in records is mapped (see pdk.MappingConfig). It replaces the framer options."`
 
 	proxy http.Server
 }
@@ -62,13 +84,17 @@ type Main struct {
 // NewMain returns a new Main.
 func NewMain() *Main {
 	return &Main{
-		Hosts:       []string{"localhost:9092"},
-		Topics:      []string{"test"},
-		Group:       "group0",
-		RegistryURL: "localhost:8081",
-		PilosaHosts: []string{"localhost:10101"},
-		Index:       "pdk",
-		BatchSize:   1000,
+		Hosts:            []string{"localhost:9092"},
+		Topics:           []string{"test"},
+		Group:            "group0",
+		RegistryURL:      "localhost:8081",
+		PilosaHosts:      []string{"localhost:10101"},
+		Index:            "pdk",
+		BatchSize:        1000,
+		ParseConcurrency: 1,
+		MapConcurrency:   1,
+		FlushInterval:    time.Second * 5,
+		InferSample:      pdk.DefaultInferSample,
 	}
 }
 
@@ -106,7 +132,25 @@ func (m *Main) Run() (err error) {
 		}
 	}
 
+	var mapping *pdk.MappingConfig
+	if m.Mapping != "" {
+		mapping, err = pdk.LoadMappingConfig(m.Mapping)
+		if err != nil {
+			return errors.Wrap(err, "loading mapping config")
+		}
+		if subject := mapping.Subject(); subject != nil {
+			m.SubjectPath = subject
+		}
+	}
+
 	parser := pdk.NewDefaultGenericParser()
+	parser.TimeLayouts = m.TimeLayouts
+	parser.InferTypes = m.InferTypes
+	parser.InferSample = m.InferSample
+	parser.InferOverrides, err = pdk.ParseInferTypes(m.InferOverrides)
+	if err != nil {
+		return errors.Wrap(err, "parsing inferred types")
+	}
 	if len(m.SubjectPath) == 0 {
 		parser.Subjecter = pdk.BlankSubjecter{}
 	} else {
@@ -117,21 +161,64 @@ func (m *Main) Run() (err error) {
 	mapper.Translator = nil
 	mapper.ColTranslator = nil
 	mapper.Nexter = nil
+	mapper.MutexFields = m.MutexFields
+	mapper.BoolFields = m.BoolFields
+	mapper.ReplaceFields = m.ReplaceFields
+	mapper.AttrFields = m.AttrFields
+	mapper.TimestampField = m.TimestampField
+	mapper.ListModes, err = pdk.ParseListModes(m.ListModes)
+	if err != nil {
+		return errors.Wrap(err, "parsing list modes")
+	}
+	if m.FieldConfig != "" {
+		mapper.FieldConfigs, err = pdk.LoadFieldConfigs(m.FieldConfig)
+		if err != nil {
+			return errors.Wrap(err, "loading field configs")
+		}
+	}
+	if mapping != nil {
+		if err := mapping.Apply(parser, mapper); err != nil {
+			return errors.Wrap(err, "applying mapping config")
+		}
+	}
 
-	indexer, err := pdk.SetupPilosa(m.PilosaHosts, m.Index, nil, m.BatchSize)
+	indexer, err := pdk.SetupPilosa(m.PilosaHosts, m.Index, nil, m.BatchSize,
+		pdk.OptPilosaFlushInterval(m.FlushInterval),
+		pdk.OptPilosaFieldConfigs(mapper.FieldConfigs...),
+		pdk.OptPilosaWAL(m.WALDir),
+		pdk.OptPilosaNativeKeys(m.NativeKeys))
 	if err != nil {
 		return errors.Wrap(err, "setting up Pilosa")
 	}
 
 	ingester := pdk.NewIngester(src, parser, mapper, indexer)
+	ingester.ParseConcurrency = m.ParseConcurrency
+	ingester.MapConcurrency = m.MapConcurrency
 	if len(m.AllowedFields) > 0 {
 		ingester.AllowedFields = make(map[string]bool)
 		for _, fram := range m.AllowedFields {
 			ingester.AllowedFields[fram] = true
 		}
 	}
+	if m.DeadLetters != "" {
+		sink := NewDeadLetterSink()
+		sink.Hosts = m.Hosts
+		sink.Topic = m.DeadLetters
+		if err := sink.Open(); err != nil {
+			return errors.Wrap(err, "opening dead letter sink")
+		}
+		defer sink.Close()
+		ingester.DeadLetters = sink
+	}
 
-	return errors.Wrap(ingester.Run(), "running ingester")
+	ctx, cancel := pdk.SignalContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	err = ingester.RunContext(ctx)
+	if errors.Cause(err) == context.Canceled {
+		log.Printf("shut down: %v", err)
+		return nil
+	}
+	return errors.Wrap(err, "running ingester")
 }
 
 func (m *Main) Close() error {
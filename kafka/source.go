@@ -45,10 +45,15 @@ import (
 	"github.com/Shopify/sarama"
 	"github.com/bsm/sarama-cluster"
 	"github.com/elodina/go-avro"
+	"github.com/pilosa/pdk"
 	"github.com/pkg/errors"
 )
 
-// Source implements the pdk.Source interface using kafka as a data source.
+// Source implements the pdk.Source interface using kafka as a data source. It
+// also implements pdk.Acker - the offset of a message is only committed once
+// it, and every message before it in the same partition, has been
+// acknowledged without error. Once a message is acknowledged with an error,
+// the Source stops consuming and returns that error from Record.
 type Source struct {
 	Hosts   []string
 	Topics  []string
@@ -59,6 +64,36 @@ type Source struct {
 
 	consumer *cluster.Consumer
 	messages <-chan *sarama.ConsumerMessage
+	marker   offsetMarker
+
+	// recvLock makes receiving a message and starting to track it atomic, so
+	// that messages are tracked in offset order.
+	recvLock sync.Mutex
+
+	ackLock    sync.Mutex
+	pending    map[pdk.AckToken]*pendingMessage
+	nextToken  pdk.AckToken
+	partitions map[topicPartition][]*pendingMessage
+	// ackErr is set when a message is acknowledged with an error.
+	ackErr error
+}
+
+// offsetMarker is the part of *cluster.Consumer which the Source uses to
+// commit offsets.
+type offsetMarker interface {
+	MarkOffset(msg *sarama.ConsumerMessage, metadata string)
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// pendingMessage is a message which has been returned by Record but not yet
+// had its offset marked.
+type pendingMessage struct {
+	msg   *sarama.ConsumerMessage
+	acked bool
 }
 
 // NewSource gets a new Source
@@ -68,37 +103,128 @@ func NewSource() *Source {
 		Topics: []string{"test"},
 		Group:  "group0",
 		Type:   "json",
+
+		pending:    make(map[pdk.AckToken]*pendingMessage),
+		partitions: make(map[topicPartition][]*pendingMessage),
 	}
 }
 
 // Record returns the value of the next kafka message.
 func (s *Source) Record() (interface{}, error) {
+	rec, _, err := s.RecordToken()
+	return rec, err
+}
+
+// RecordToken implements pdk.Acker.
+func (s *Source) RecordToken() (interface{}, pdk.AckToken, error) {
+	msg, pm, err := s.message()
+	if err != nil {
+		return nil, 0, err
+	}
+	var ret interface{}
+	switch s.Type {
+	case "json":
+		parsed := make(map[string]interface{})
+		err := json.Unmarshal(msg.Value, &parsed)
+		if err != nil {
+			return nil, s.track(pm), badMessage(string(msg.Value), errors.Wrap(err, "unmarshaling json"))
+		}
+		ret = parsed
+	case "raw":
+		ret = msg
+	default:
+		s.markAcked(pm)
+		return nil, 0, errors.Errorf("unsupported kafka message type: '%v'", s.Type)
+	}
+	return ret, s.track(pm), nil
+}
+
+// message receives the next message from kafka and starts tracking it so that
+// its offset won't be committed before it has been acknowledged.
+func (s *Source) message() (*sarama.ConsumerMessage, *pendingMessage, error) {
+	s.recvLock.Lock()
+	defer s.recvLock.Unlock()
 	if s.MaxMsgs > 0 {
 		s.numMsgs++
 		if s.numMsgs > s.MaxMsgs {
-			return nil, io.EOF
+			return nil, nil, io.EOF
 		}
 	}
-	msg, ok := <-s.consumer.Messages()
-	if ok {
-		var ret interface{}
-		switch s.Type {
-		case "json":
-			parsed := make(map[string]interface{})
-			err := json.Unmarshal(msg.Value, &parsed)
-			if err != nil {
-				return nil, errors.Wrap(err, "unmarshaling json")
-			}
-			ret = parsed
-		case "raw":
-			ret = msg
-		default:
-			return nil, errors.Errorf("unsupported kafka message type: '%v'", s.Type)
-		}
-		s.consumer.MarkOffset(msg, "") // mark message as processed
-		return ret, nil
+	s.ackLock.Lock()
+	err := s.ackErr
+	s.ackLock.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+	msg, ok := <-s.messages
+	if !ok {
+		return nil, nil, errors.New("messages channel closed")
+	}
+	pm := &pendingMessage{msg: msg}
+	tp := topicPartition{topic: msg.Topic, partition: msg.Partition}
+	s.ackLock.Lock()
+	s.partitions[tp] = append(s.partitions[tp], pm)
+	s.ackLock.Unlock()
+	return msg, pm, nil
+}
+
+// badMessage returns an error for a message which couldn't be decoded, which
+// the Ingester handles according to its ErrorPolicy for pdk.StageSource rather
+// than treating the Source as broken. The message is acknowledged along with
+// the error.
+func badMessage(value interface{}, err error) error {
+	return &pdk.IngestError{Record: value, Errs: []error{err}}
+}
+
+// track returns a token for a record from the message pm.
+func (s *Source) track(pm *pendingMessage) pdk.AckToken {
+	s.ackLock.Lock()
+	defer s.ackLock.Unlock()
+	s.nextToken++
+	s.pending[s.nextToken] = pm
+	return s.nextToken
+}
+
+// Ack implements pdk.Acker. If err is not nil, the offset of the record's message
+// (and every later message in the same partition) will not be committed, so
+// the message will be consumed again when the consumer group restarts. Rather
+// than holding back commits indefinitely, the Source stops consuming: Record
+// returns the error from then on.
+func (s *Source) Ack(token pdk.AckToken, err error) error {
+	s.ackLock.Lock()
+	pm, ok := s.pending[token]
+	delete(s.pending, token)
+	if ok && err != nil && s.ackErr == nil {
+		s.ackErr = errors.Wrapf(err, "message at offset %d of partition %d of topic '%s' failed", pm.msg.Offset, pm.msg.Partition, pm.msg.Topic)
+	}
+	s.ackLock.Unlock()
+	if !ok {
+		return errors.Errorf("acknowledging unknown record %d", token)
+	}
+	if err != nil {
+		return nil
+	}
+	s.markAcked(pm)
+	return nil
+}
+
+// markAcked records that a message is done with, and marks the offset of the
+// latest message in its partition which has no unacknowledged messages before
+// it.
+func (s *Source) markAcked(pm *pendingMessage) {
+	tp := topicPartition{topic: pm.msg.Topic, partition: pm.msg.Partition}
+	s.ackLock.Lock()
+	defer s.ackLock.Unlock()
+	pm.acked = true
+	queue := s.partitions[tp]
+	var last *pendingMessage
+	for len(queue) > 0 && queue[0].acked {
+		last, queue = queue[0], queue[1:]
+	}
+	s.partitions[tp] = queue
+	if last != nil {
+		s.marker.MarkOffset(last.msg, "")
 	}
-	return nil, errors.New("messages channel closed")
 }
 
 // Open initializes the kafka source.
@@ -117,6 +243,7 @@ func (s *Source) Open() error {
 		return errors.Wrap(err, "getting new consumer")
 	}
 	s.messages = s.consumer.Messages()
+	s.marker = s.consumer
 
 	// consume errors
 	go func() {
@@ -152,6 +279,10 @@ type ConfluentSource struct {
 // NewConfluentSource returns a new ConfluentSource.
 func NewConfluentSource() *ConfluentSource {
 	src := &ConfluentSource{
+		Source: Source{
+			pending:    make(map[pdk.AckToken]*pendingMessage),
+			partitions: make(map[topicPartition][]*pendingMessage),
+		},
 		cache: make(map[int32]avro.Schema),
 	}
 	src.Type = "raw"
@@ -160,16 +291,21 @@ func NewConfluentSource() *ConfluentSource {
 
 // Record returns the next value from kafka.
 func (s *ConfluentSource) Record() (interface{}, error) {
-	rec, err := s.Source.Record()
+	rec, _, err := s.RecordToken()
+	return rec, err
+}
+
+// RecordToken implements pdk.Acker.
+func (s *ConfluentSource) RecordToken() (interface{}, pdk.AckToken, error) {
+	msg, pm, err := s.message()
 	if err != nil {
-		return rec, err
+		return nil, 0, err
 	}
-	msg, ok := rec.(*sarama.ConsumerMessage)
-	if !ok {
-		return rec, errors.Errorf("record is not a raw kafka record, but a %T", rec)
+	rec, err := s.decodeAvroValueWithSchemaRegistry(msg.Value)
+	if err != nil {
+		return nil, s.track(pm), badMessage(msg.Value, err)
 	}
-	val := msg.Value
-	return s.decodeAvroValueWithSchemaRegistry(val)
+	return rec, s.track(pm), nil
 }
 
 func (s *ConfluentSource) decodeAvroValueWithSchemaRegistry(val []byte) (interface{}, error) {
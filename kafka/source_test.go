@@ -38,10 +38,14 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/Shopify/sarama"
 	"github.com/elodina/go-avro"
 	"github.com/linkedin/goavro"
+	"github.com/pilosa/pdk"
 	"github.com/pkg/errors"
 )
 
@@ -74,6 +78,66 @@ var value = map[string]interface{}{
 	},
 }
 
+type recordingMarker struct {
+	offsets map[int32][]int64
+}
+
+func (r *recordingMarker) MarkOffset(msg *sarama.ConsumerMessage, metadata string) {
+	r.offsets[msg.Partition] = append(r.offsets[msg.Partition], msg.Offset)
+}
+
+func TestSourceAck(t *testing.T) {
+	messages := make(chan *sarama.ConsumerMessage, 10)
+	for i, part := range []int32{0, 1, 0, 0, 1} {
+		messages <- &sarama.ConsumerMessage{Topic: "t", Partition: part, Offset: int64(i), Value: []byte(`{"a": 1}`)}
+	}
+	messages <- &sarama.ConsumerMessage{Topic: "t", Partition: 0, Offset: 5, Value: []byte(`not json`)}
+	marker := &recordingMarker{offsets: make(map[int32][]int64)}
+	src := NewSource()
+	src.messages = messages
+	src.marker = marker
+
+	recs := make([]pdk.AckToken, 5)
+	for i := range recs {
+		_, token, err := src.RecordToken()
+		if err != nil {
+			t.Fatalf("getting record: %v", err)
+		}
+		recs[i] = token
+	}
+	_, badToken, err := src.RecordToken()
+	if bad, ok := err.(*pdk.IngestError); !ok || bad.Record != "not json" {
+		t.Fatalf("expected bad record error decoding invalid json, got: %v", err)
+	}
+	if len(marker.offsets) != 0 {
+		t.Fatalf("offsets marked before acknowledgement: %v", marker.offsets)
+	}
+
+	// partition 0: 0, 2, 3, 5; partition 1: 1, 4
+	for _, i := range []int{2, 4, 1, 0} {
+		if err := src.Ack(recs[i], nil); err != nil {
+			t.Fatalf("acking: %v", err)
+		}
+	}
+	if err := src.Ack(badToken, nil); err != nil {
+		t.Fatalf("acking bad record: %v", err)
+	}
+	if err := src.Ack(recs[3], errors.New("failed")); err != nil {
+		t.Fatalf("acking: %v", err)
+	}
+	expected := map[int32][]int64{0: {2}, 1: {4}}
+	if !reflect.DeepEqual(marker.offsets, expected) {
+		t.Fatalf("expected marked offsets %v, got %v", expected, marker.offsets)
+	}
+	messages <- &sarama.ConsumerMessage{Topic: "t", Partition: 1, Offset: 6, Value: []byte(`{"a": 1}`)}
+	if _, _, err := src.RecordToken(); err == nil || !strings.Contains(err.Error(), "failed") {
+		t.Fatalf("expected the failure to stop the source, got: %v", err)
+	}
+	if err := src.Ack(recs[0], nil); err == nil {
+		t.Fatal("expected error acknowledging a record twice")
+	}
+}
+
 func GetAvroEncodedValue(t *testing.T) []byte {
 	codec, err := goavro.NewCodec(schema1)
 	if err != nil {
@@ -0,0 +1,63 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+// Package load implements the "pdk load" command, which imports files written
+// by a pdk.FileIndexer into Pilosa.
+package load
+
+import (
+	"github.com/pilosa/pdk"
+	"github.com/pkg/errors"
+)
+
+// Main contains the configuration for loading import files into Pilosa.
+type Main struct {
+	Dir         string   `help:"Directory of import files written by a file indexer."`
+	PilosaHosts []string `help:"Comma separated list of Pilosa hosts and ports."`
+	BatchSize   uint     `help:"Batch size for Pilosa imports."`
+}
+
+// NewMain gets a new Main with the default configuration.
+func NewMain() *Main {
+	return &Main{
+		PilosaHosts: []string{"localhost:10101"},
+		BatchSize:   100000,
+	}
+}
+
+// Run imports the files.
+func (m *Main) Run() error {
+	if m.Dir == "" {
+		return errors.New("a directory is required")
+	}
+	return errors.Wrap(pdk.LoadFiles(m.PilosaHosts, m.Dir, m.BatchSize), "loading files")
+}
@@ -57,7 +57,7 @@ type IntMapper struct {
 	// TODO: support both "above" and "below" ranges, instead of just "external"
 }
 
-//BinaryIntMapper is a Mapper for int types, mapping to a set of buckets representing the value in a binary sense
+// BinaryIntMapper is a Mapper for int types, mapping to a set of buckets representing the value in a binary sense
 type BinaryIntMapper struct {
 	Min           int64
 	Max           int64
@@ -251,10 +251,25 @@ func (m IntMapper) ID(ii ...interface{}) (rowIDs []int64, err error) {
 	return []int64{i - m.Min}, nil
 }
 
-// ID maps floats to binary column sets
+// ID maps ints to binary column sets. The ID of each set bit of the value's
+// offset from Min is returned, so Max-Min must fit in BitDepth bits. See
+// binaryIDs for the row of values with no bits set.
 func (m BinaryIntMapper) ID(ii ...interface{}) (rowIDs []int64, err error) {
-	// TODO implement (have to redo the Mapper interface to return slice)
-	return []int64{0}, nil
+	i := ii[0].(int64)
+	externalID := int64(m.BitDepth)
+
+	// bounds check
+	if i < m.Min || i > m.Max {
+		if m.allowExternal {
+			return []int64{externalID}, nil
+		}
+		return []int64{0}, fmt.Errorf("int %v out of range", i)
+	}
+	q := uint64(i - m.Min)
+	if m.BitDepth < 64 && q>>uint(m.BitDepth) != 0 {
+		return []int64{0}, fmt.Errorf("int %v doesn't fit in %d bits", i, m.BitDepth)
+	}
+	return binaryIDs(q, m.BitDepth), nil
 }
 
 // ID maps arbitrary ints to a rowID range
@@ -306,10 +321,41 @@ func (m FloatMapper) ID(fi ...interface{}) (rowIDs []int64, err error) {
 	return []int64{0}, nil
 }
 
-// ID maps floats to binary column sets
+// ID maps floats to binary column sets. The value is quantized to an integer
+// of BitDepth bits spanning Min to Max, and the ID of each set bit is
+// returned. See binaryIDs for the row of values with no bits set.
 func (m BinaryFloatMapper) ID(fi ...interface{}) (rowIDs []int64, err error) {
-	// TODO implement (have to redo the Mapper interface to handle slice)
-	return []int64{0}, nil
+	f := fi[0].(float64)
+	externalID := int64(m.BitDepth)
+
+	// bounds check
+	if f < m.Min || f > m.Max {
+		if m.allowExternal {
+			return []int64{externalID}, nil
+		}
+		return []int64{0}, fmt.Errorf("float %v out of range", f)
+	}
+
+	// quantize, then set a row for each bit
+	maxVal := uint64(1)<<uint(m.BitDepth) - 1
+	q := uint64(float64(maxVal) * (f - m.Min) / (m.Max - m.Min))
+	return binaryIDs(q, m.BitDepth), nil
+}
+
+// binaryIDs returns the IDs of the set bits of q, among the low bitDepth bits.
+// Row bitDepth is the external row, so a q of zero, which has no bits set, maps
+// to row bitDepth+1 rather than to no rows at all.
+func binaryIDs(q uint64, bitDepth int) []int64 {
+	if q == 0 {
+		return []int64{int64(bitDepth) + 1}
+	}
+	var rowIDs []int64
+	for i := 0; i < bitDepth; i++ {
+		if q&(1<<uint(i)) != 0 {
+			rowIDs = append(rowIDs, int64(i))
+		}
+	}
+	return rowIDs
 }
 
 // ID maps pairs of floats to regular buckets
@@ -33,7 +33,12 @@
 package pdk
 
 import (
+	"container/list"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -47,6 +52,86 @@ type CollapsingMapper struct {
 	ColTranslator FieldTranslator
 	Framer        Framer
 	Nexter        INexter
+
+	// MutexFields lists fields (as named by the Framer) which hold a single
+	// string value per record, like an enum. Their values are mapped to rows
+	// in mutex fields rather than set fields.
+	MutexFields []string
+
+	// BoolFields maps bool values to bool fields named by the Framer from
+	// their whole path. Otherwise, true values are mapped to a row named
+	// after the last path element in a set field, and false values are
+	// dropped.
+	BoolFields bool
+
+	// ReplaceFields lists fields (as named by the Framer) which should only
+	// hold the rows from the latest record for each column. The mapper
+	// remembers the rows it has mapped for each column in these fields, and
+	// clears the ones which a new record doesn't have. Fields missing from a
+	// record are left alone. This is kept in memory, so rows mapped before a
+	// restart aren't cleared, and records for the same column must be mapped
+	// and indexed in order, which an Ingester ensures by refusing to run
+	// with more than one goroutine in any stage (see OrderedMapper).
+	ReplaceFields []string
+
+	// ReplaceCacheSize is the number of columns whose rows are remembered
+	// for each of ReplaceFields. Beyond it, the least recently mapped
+	// columns are forgotten, and their rows aren't cleared by their next
+	// record. Zero means DefaultReplaceCacheSize.
+	ReplaceCacheSize int
+
+	// AttrFields lists fields (as named by the Framer) whose values are set
+	// as attributes of the column, named after the field, rather than being
+	// indexed. This is for things like display names and URLs which don't
+	// need to be queried. If there are several values (e.g. in a list), the
+	// last one wins.
+	AttrFields []string
+
+	// TimestampField names a field (as named by the Framer) holding a Time
+	// which is used as the timestamp of the whole record, rather than being
+	// indexed. Rows in set fields get it as their Time, so the fields are
+	// created as time fields. Other Times are decomposed into int fields
+	// holding their (UTC) year, month, day and hour, named by the Framer from
+	// their path plus "year", "month", "day" and "hour".
+	TimestampField string
+
+	// FieldConfigs give the Scale of int fields (see FieldConfig), so that
+	// floats aren't truncated when they are stored, and bools are mapped to
+	// fields with the Type "bool" as if BoolFields were set. Other settings
+	// are ignored.
+	FieldConfigs []FieldConfig
+
+	// Mappers map numbers and Times in the named fields (as named by the
+	// Framer) to rows in set fields rather than values in int fields, e.g.
+	// with a LinearFloatMapper to put numbers in buckets, or a
+	// TimeOfDayMapper. The rows are the IDs returned by the Mapper, which is
+	// passed an int64 if it's an IntMapper, SparseIntMapper or
+	// BinaryIntMapper, a float64 for other numbers, and a time.Time for Times.
+	Mappers map[string]Mapper
+
+	// ListModes set how lists are mapped, keyed by the field name (as named
+	// by the Framer) of the list's path. Lists are mapped as sets (ListSet)
+	// by default.
+	ListModes map[string]ListMode
+
+	replaceLock sync.Mutex
+	replaced    map[string]*replaceCache
+}
+
+// DefaultReplaceCacheSize is the default ReplaceCacheSize of a
+// CollapsingMapper.
+const DefaultReplaceCacheSize = 1 << 20
+
+// replaceCache holds the rows mapped to the most recently mapped columns of
+// one of the ReplaceFields, in least recently used order.
+type replaceCache struct {
+	cols  map[interface{}]*list.Element
+	order *list.List
+}
+
+type replaceEntry struct {
+	col interface{}
+	ids []uint64OrString
 }
 
 // NewCollapsingMapper returns a CollapsingMapper with basic implementations of
@@ -64,9 +149,25 @@ func NewCollapsingMapper() *CollapsingMapper {
 
 // Map implements the RecordMapper interface.
 func (m *CollapsingMapper) Map(e *Entity) (PilosaRecord, error) {
+	pr, err := m.NewRecord(e.Subject)
+	if err != nil {
+		return pr, err
+	}
+	err = m.mapObj(e, &pr, []string{})
+	if err == nil {
+		m.FinishRecord(&pr)
+	}
+	return pr, err
+}
+
+// NewRecord returns an empty PilosaRecord for the record with the given
+// subject, with its column set as Map would. NewRecord, MapObject and
+// FinishRecord allow records to be mapped piece by piece without building an
+// Entity, as parsers generated by pdk gen-parser do.
+func (m *CollapsingMapper) NewRecord(subject IRI) (PilosaRecord, error) {
 	pr := PilosaRecord{}
 	if m.ColTranslator != nil {
-		col, err := m.ColTranslator.GetID(string(e.Subject))
+		col, err := m.ColTranslator.GetID(string(subject))
 		if err != nil {
 			return pr, errors.Wrap(err, "getting column id from subject")
 		}
@@ -74,35 +175,109 @@ func (m *CollapsingMapper) Map(e *Entity) (PilosaRecord, error) {
 	} else if m.Nexter != nil {
 		pr.Col = m.Nexter.Next()
 	} else {
-		pr.Col = string(e.Subject)
+		pr.Col = string(subject)
 	}
-	return pr, m.mapObj(e, &pr, []string{})
+	return pr, nil
 }
 
-func (m *CollapsingMapper) mapObj(val Object, pr *PilosaRecord, path []string) error {
-	if objs, ok := val.(Objects); ok {
-		// treat lists as sets
-		//
-		// should add an option to add index as a path component when order
-		// matters. Actually, mapper should have a context which has this
-		// information on a per-list basis.
-		for _, obj := range objs {
-			err := m.mapObj(obj, pr, path)
-			if err != nil {
-				return errors.Wrap(err, "mapping obj from list")
+// MapObject maps obj, found at path in a record, into pr.
+func (m *CollapsingMapper) MapObject(pr *PilosaRecord, obj Object, path ...string) error {
+	return m.mapObj(obj, pr, path)
+}
+
+// NeedsOrder implements OrderedMapper. Records must be mapped in order if
+// there are ReplaceFields.
+func (m *CollapsingMapper) NeedsOrder() bool {
+	return len(m.ReplaceFields) > 0
+}
+
+// FinishRecord does any work which needs the whole of a mapped record, such
+// as clearing the rows of ReplaceFields which it no longer has.
+func (m *CollapsingMapper) FinishRecord(pr *PilosaRecord) {
+	if len(m.ReplaceFields) > 0 {
+		m.replace(pr)
+	}
+}
+
+// replace adds the rows which were mapped to pr's column by earlier records,
+// but which aren't in pr, to pr.ClearRows for each of m.ReplaceFields.
+func (m *CollapsingMapper) replace(pr *PilosaRecord) {
+	current := make(map[string][]uint64OrString)
+	for _, row := range pr.Rows {
+		if containsString(m.ReplaceFields, row.Field) {
+			current[row.Field] = append(current[row.Field], row.ID)
+		}
+	}
+	m.replaceLock.Lock()
+	defer m.replaceLock.Unlock()
+	if m.replaced == nil {
+		m.replaced = make(map[string]*replaceCache)
+	}
+	size := m.ReplaceCacheSize
+	if size <= 0 {
+		size = DefaultReplaceCacheSize
+	}
+	for field, ids := range current {
+		cache, ok := m.replaced[field]
+		if !ok {
+			cache = &replaceCache{cols: make(map[interface{}]*list.Element), order: list.New()}
+			m.replaced[field] = cache
+		}
+		el, ok := cache.cols[pr.Col]
+		if !ok {
+			el = cache.order.PushFront(&replaceEntry{col: pr.Col})
+			cache.cols[pr.Col] = el
+			for cache.order.Len() > size {
+				oldest := cache.order.Back()
+				cache.order.Remove(oldest)
+				delete(cache.cols, oldest.Value.(*replaceEntry).col)
 			}
+		} else {
+			cache.order.MoveToFront(el)
 		}
-		return nil
+		entry := el.Value.(*replaceEntry)
+	prior:
+		for _, old := range entry.ids {
+			for _, id := range ids {
+				if id == old {
+					continue prior
+				}
+			}
+			pr.ClearRow(field, old)
+		}
+		entry.ids = ids
+	}
+}
+
+func (m *CollapsingMapper) mapObj(val Object, pr *PilosaRecord, path []string) error {
+	if objs, ok := val.(Objects); ok {
+		return m.mapList(objs, pr, path)
 	}
 	if ent, ok := val.(*Entity); ok {
 		for prop, obj := range ent.Objects {
-			err := m.mapObj(obj, pr, append(path, string(prop)))
+			propPath := append(path, string(prop))
+			if field, ok := ent.Fields[prop]; ok {
+				// pinned fields are framed as if they were top level
+				// properties named for the field.
+				propPath = []string{field}
+			}
+			err := m.mapObj(obj, pr, propPath)
 			if err != nil {
 				return errors.Wrapf(err, "mapping entity")
 			}
 		}
 		return nil
 	}
+	if lit, ok := val.(Literal); ok && len(m.AttrFields) > 0 {
+		field, err := m.Framer.Field(path)
+		if err != nil {
+			return errors.Wrapf(err, "getting field from %v", path)
+		}
+		if containsString(m.AttrFields, field) {
+			pr.AddColAttr(field, attrValue(lit))
+			return nil
+		}
+	}
 	if lit, ok := val.(Literal); ok {
 		err := m.mapLit(lit, pr, path)
 		return errors.Wrapf(err, "mapping literal '%v'", lit)
@@ -120,7 +295,17 @@ func (m *CollapsingMapper) mapLit(val Literal, pr *PilosaRecord, path []string)
 		if field == "" {
 			field = "default"
 		}
-		pr.AddVal(field, Int64ize(tval))
+		if mapper, ok := m.Mappers[field]; ok {
+			if timeMapper(mapper) {
+				return errors.Errorf("can't map number %v in '%s' with %T", val, field, mapper)
+			}
+			return mapRows(mapper, mapperArg(mapper, tval), pr, field)
+		}
+		if scale := findFieldConfig(m.FieldConfigs, field).Scale; scale != 0 {
+			pr.AddVal(field, scaleValue(tval, scale))
+		} else {
+			pr.AddVal(field, Int64ize(tval))
+		}
 	case S:
 		field, err := m.Framer.Field(path)
 		if err != nil {
@@ -129,16 +314,55 @@ func (m *CollapsingMapper) mapLit(val Literal, pr *PilosaRecord, path []string)
 		if field == "" {
 			return nil
 		}
+		var idOrKey uint64OrString = string(tval)
 		if m.Translator != nil {
-			id, err := m.Translator.GetID(field, tval)
+			idOrKey, err = m.Translator.GetID(field, tval)
 			if err != nil {
 				return errors.Wrapf(err, "getting id from %v", val)
 			}
-			pr.AddRow(field, id)
+		}
+		if containsString(m.MutexFields, field) {
+			pr.AddMutex(field, idOrKey)
 		} else {
-			pr.AddRow(field, string(tval))
+			pr.AddRow(field, idOrKey)
+		}
+	case IPv4:
+		return m.mapLit(S(tval.String()), pr, path)
+	case IPv6:
+		return m.mapLit(S(tval.String()), pr, path)
+	case Time:
+		field, err := m.Framer.Field(path)
+		if err != nil {
+			return errors.Wrapf(err, "getting field from %v", path)
+		}
+		if field == "" {
+			return nil
+		}
+		if m.TimestampField != "" && field == m.TimestampField {
+			pr.Time = time.Time(tval)
+			return nil
 		}
+		if mapper, ok := m.Mappers[field]; ok {
+			if !timeMapper(mapper) {
+				return errors.Errorf("can't map time %v in '%s' with %T", val, field, mapper)
+			}
+			return mapRows(mapper, time.Time(tval), pr, field)
+		}
+		return m.mapTimeParts(time.Time(tval).UTC(), pr, path)
 	case B:
+		if m.BoolFields || len(m.FieldConfigs) > 0 {
+			field, err := m.Framer.Field(path)
+			if err != nil {
+				return errors.Wrapf(err, "getting field from %v", path)
+			}
+			if m.BoolFields || (field != "" && findFieldConfig(m.FieldConfigs, field).Type == "bool") {
+				if field == "" {
+					field = "default"
+				}
+				pr.AddBool(field, bool(tval))
+				return nil
+			}
+		}
 		// for bools, use the last path element as the row name - only set if val is true
 		if !tval {
 			return nil
@@ -167,6 +391,192 @@ func (m *CollapsingMapper) mapLit(val Literal, pr *PilosaRecord, path []string)
 	return nil
 }
 
+// ListMode is how CollapsingMapper maps the items of a list.
+type ListMode string
+
+// ListModes for CollapsingMapper.ListModes.
+const (
+	// ListSet maps every item with the list's path, so that e.g. a list of
+	// strings sets several rows in one field.
+	ListSet ListMode = "set"
+	// ListPositional adds each item's index to its path, so that e.g. the
+	// "name" of each item in "items" is mapped to "items-0-name",
+	// "items-1-name" and so on.
+	ListPositional ListMode = "positional"
+	// ListFirst only maps the first item.
+	ListFirst ListMode = "first"
+	// ListLast only maps the last item.
+	ListLast ListMode = "last"
+	// ListCount maps the length of the list to a value in an int field
+	// instead of mapping the items.
+	ListCount ListMode = "count"
+)
+
+// ParseListModes parses ListModes from strings of the form "field:mode", e.g.
+// "items:count".
+func ParseListModes(specs []string) (map[string]ListMode, error) {
+	modes := make(map[string]ListMode, len(specs))
+	for _, spec := range specs {
+		i := strings.LastIndex(spec, ":")
+		if i < 0 {
+			return nil, errors.Errorf("list mode '%s' is not of the form field:mode", spec)
+		}
+		mode := ListMode(spec[i+1:])
+		switch mode {
+		case ListSet, ListPositional, ListFirst, ListLast, ListCount:
+		default:
+			return nil, errors.Errorf("unknown list mode '%s' for '%s'", mode, spec[:i])
+		}
+		modes[spec[:i]] = mode
+	}
+	return modes, nil
+}
+
+// mapList maps the items of a list according to its ListMode.
+func (m *CollapsingMapper) mapList(objs Objects, pr *PilosaRecord, path []string) error {
+	mode := ListSet
+	var field string
+	if len(m.ListModes) > 0 {
+		var err error
+		field, err = m.Framer.Field(path)
+		if err != nil {
+			return errors.Wrapf(err, "getting field from %v", path)
+		}
+		if fieldMode, ok := m.ListModes[field]; ok && field != "" {
+			mode = fieldMode
+		}
+	}
+	switch mode {
+	case ListSet:
+	case ListPositional:
+		for i, obj := range objs {
+			itemPath := append(path[:len(path):len(path)], strconv.Itoa(i))
+			if err := m.mapObj(obj, pr, itemPath); err != nil {
+				return errors.Wrapf(err, "mapping item %d from list", i)
+			}
+		}
+		return nil
+	case ListFirst:
+		if len(objs) > 0 {
+			objs = objs[:1]
+		}
+	case ListLast:
+		if len(objs) > 0 {
+			objs = objs[len(objs)-1:]
+		}
+	case ListCount:
+		pr.AddVal(field, int64(len(objs)))
+		return nil
+	default:
+		return errors.Errorf("unknown list mode '%s' for '%s'", mode, field)
+	}
+	for _, obj := range objs {
+		err := m.mapObj(obj, pr, path)
+		if err != nil {
+			return errors.Wrap(err, "mapping obj from list")
+		}
+	}
+	return nil
+}
+
+// mapRows adds a row to pr in field for each ID mapper returns for arg.
+func mapRows(mapper Mapper, arg interface{}, pr *PilosaRecord, field string) error {
+	ids, err := mapper.ID(arg)
+	if err != nil {
+		return errors.Wrapf(err, "mapping %v to rows of '%s'", arg, field)
+	}
+	for _, id := range ids {
+		pr.AddRow(field, uint64(id))
+	}
+	return nil
+}
+
+// timeMapper returns true if mapper maps time.Times rather than numbers.
+func timeMapper(mapper Mapper) bool {
+	switch mapper.(type) {
+	case TimeOfDayMapper, DayOfWeekMapper, DayOfMonthMapper, MonthMapper, YearMapper:
+		return true
+	}
+	return false
+}
+
+// mapperArg converts a numeric Literal to the type mapper expects.
+func mapperArg(mapper Mapper, val Literal) interface{} {
+	switch mapper.(type) {
+	case IntMapper, SparseIntMapper, BinaryIntMapper:
+		return Int64ize(val)
+	}
+	return Float64ize(val)
+}
+
+// mapTimeParts adds the year, month, day and hour of t to pr as values in
+// fields named from path.
+func (m *CollapsingMapper) mapTimeParts(t time.Time, pr *PilosaRecord, path []string) error {
+	parts := []struct {
+		name  string
+		value int
+	}{
+		{"year", t.Year()},
+		{"month", int(t.Month())},
+		{"day", t.Day()},
+		{"hour", t.Hour()},
+	}
+	for _, part := range parts {
+		partPath := append(path[:len(path):len(path)], part.name)
+		field, err := m.Framer.Field(partPath)
+		if err != nil {
+			return errors.Wrapf(err, "getting field from %v", partPath)
+		}
+		if field != "" {
+			pr.AddVal(field, int64(part.value))
+		}
+	}
+	return nil
+}
+
+// attrValue converts a Literal to a value for an attribute.
+func attrValue(val Literal) interface{} {
+	switch tval := val.(type) {
+	case S:
+		return string(tval)
+	case B:
+		return bool(tval)
+	case F32:
+		return float64(tval)
+	case F64:
+		return float64(tval)
+	case Time:
+		return time.Time(tval).Format(time.RFC3339Nano)
+	case IPv4:
+		return tval.String()
+	case IPv6:
+		return tval.String()
+	}
+	return Int64ize(val)
+}
+
+// scaleValue returns val multiplied by 10^scale, rounded to the nearest int64.
+func scaleValue(val Literal, scale int) int64 {
+	switch val.(type) {
+	case F32, F64:
+		return int64(math.Round(Float64ize(val) * math.Pow10(scale)))
+	}
+	factor := int64(1)
+	for i := 0; i < scale; i++ {
+		factor *= 10
+	}
+	return Int64ize(val) * factor
+}
+
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
 func Int64ize(val Literal) int64 {
 	switch tval := val.(type) {
 	case F32:
@@ -199,12 +609,51 @@ func Int64ize(val Literal) int64 {
 
 }
 
+// Float64ize converts a numeric Literal to a float64.
+func Float64ize(val Literal) float64 {
+	switch tval := val.(type) {
+	case F32:
+		return float64(tval)
+	case F64:
+		return float64(tval)
+	case U:
+		return float64(tval)
+	case U64:
+		return float64(tval)
+	default:
+		return float64(Int64ize(val))
+	}
+}
+
 // PilosaRecord represents a number of set columns and values in a single Column
 // in Pilosa.
 type PilosaRecord struct {
 	Col  uint64OrString
 	Rows []Row
 	Vals []Val
+
+	// Time is the timestamp for Rows in set fields which don't have their
+	// own Time. If it's zero, they have no timestamp.
+	Time time.Time
+
+	// ClearRows and ClearVals are cleared from the Column before Rows and
+	// Vals are set. ClearVals holds the names of int fields.
+	ClearRows []Row
+	ClearVals []string
+
+	// ColAttrs are attributes to set on the Column, and RowAttrs are
+	// attributes to set on rows.
+	ColAttrs map[string]interface{}
+	RowAttrs []RowAttr
+
+	// Index is the Pilosa index the record is written to. If it's empty, the
+	// record goes to the Indexer's own index. Otherwise the Indexer must be
+	// an IndexRouter.
+	Index string
+
+	// More holds further records (usually for other indexes) which were
+	// mapped from the same source record.
+	More []PilosaRecord
 }
 
 // AddVal adds a new value to be range encoded into the given field to the
@@ -219,24 +668,139 @@ func (pr *PilosaRecord) AddRow(field string, idOrKey uint64OrString) {
 }
 
 // AddRowTime adds a new column to be set with a timestamp to the PilosaRecord.
-func (pr *PilosaRecord) AddRowTime(field string, id uint64, ts time.Time) {
-	pr.Rows = append(pr.Rows, Row{Field: field, ID: id, Time: ts})
+func (pr *PilosaRecord) AddRowTime(field string, idOrKey uint64OrString, ts time.Time) {
+	pr.Rows = append(pr.Rows, Row{Field: field, ID: idOrKey, Time: ts})
+}
+
+// AddMutex adds a new column to be set in a mutex field to the PilosaRecord.
+func (pr *PilosaRecord) AddMutex(field string, idOrKey uint64OrString) {
+	pr.Rows = append(pr.Rows, Row{Field: field, ID: idOrKey, Kind: RowMutex})
+}
+
+// AddBool adds a new value to be set in a bool field to the PilosaRecord.
+func (pr *PilosaRecord) AddBool(field string, value bool) {
+	var id uint64
+	if value {
+		id = 1
+	}
+	pr.Rows = append(pr.Rows, Row{Field: field, ID: id, Kind: RowBool})
+}
+
+// ClearRow adds a column to be cleared to the PilosaRecord.
+func (pr *PilosaRecord) ClearRow(field string, idOrKey uint64OrString) {
+	pr.ClearRows = append(pr.ClearRows, Row{Field: field, ID: idOrKey})
+}
+
+// ClearVal adds a field whose value should be cleared to the PilosaRecord.
+func (pr *PilosaRecord) ClearVal(field string) {
+	pr.ClearVals = append(pr.ClearVals, field)
+}
+
+// AddColAttr adds an attribute to set on the column to the PilosaRecord.
+func (pr *PilosaRecord) AddColAttr(key string, value interface{}) {
+	if pr.ColAttrs == nil {
+		pr.ColAttrs = make(map[string]interface{})
+	}
+	pr.ColAttrs[key] = value
+}
+
+// AddRowAttr adds an attribute to set on a row to the PilosaRecord.
+func (pr *PilosaRecord) AddRowAttr(field string, idOrKey uint64OrString, key string, value interface{}) {
+	pr.RowAttrs = append(pr.RowAttrs, RowAttr{Field: field, ID: idOrKey, Key: key, Value: value})
 }
 
+// RowKind is the type of Pilosa field a Row is set in.
+type RowKind int
+
+const (
+	// RowSet is a row in a set field, or a time field if the Row has a Time.
+	RowSet RowKind = iota
+	// RowMutex is a row in a mutex field, in which each column can only be
+	// set in one row.
+	RowMutex
+	// RowBool is a row in a bool field. Its ID is 1 for true and 0 for false.
+	RowBool
+)
+
 // Row represents a column to set in Pilosa sans column id (which is held by the
 // PilosaRecord containing the Row).
 type Row struct {
 	Field string
 	ID    uint64OrString
+	Kind  RowKind
 
 	// Time is the timestamp for the column in Pilosa which is the intersection of
 	// this row and the Column in the PilosaRecord which holds this row.
 	Time time.Time
 }
 
+// RowAttr represents an attribute to set on a row in Pilosa.
+type RowAttr struct {
+	Field string
+	ID    uint64OrString
+	Key   string
+	Value interface{}
+}
+
 // Val represents a BSI value to set in a Pilosa field sans column id (which is
 // held by the PilosaRecord containing the Val).
 type Val struct {
 	Field string
 	Value int64
 }
+
+// MultiIndexMapper is a RecordMapper which maps each Entity once for each of
+// several indexes, e.g. with a different subject (and so column) for each. The
+// record for the first IndexMapping is returned, with the others in its More.
+type MultiIndexMapper []IndexMapping
+
+// IndexMapping describes how a MultiIndexMapper maps Entities for one index.
+type IndexMapping struct {
+	// Index is the name of the index.
+	Index string
+
+	// Subjecter, if it isn't nil, replaces the Entity's Subject before it is
+	// mapped.
+	Subjecter EntitySubjecter
+
+	Mapper RecordMapper
+}
+
+// NeedsOrder implements OrderedMapper. Records must be mapped in order if
+// any of m's mappers need them to be.
+func (m MultiIndexMapper) NeedsOrder() bool {
+	for _, im := range m {
+		if om, ok := im.Mapper.(OrderedMapper); ok && om.NeedsOrder() {
+			return true
+		}
+	}
+	return false
+}
+
+// Map implements the RecordMapper interface. Each IndexMapping gets its own
+// copy of e.
+func (m MultiIndexMapper) Map(e *Entity) (PilosaRecord, error) {
+	if len(m) == 0 {
+		return PilosaRecord{}, errors.New("no index mappings")
+	}
+	prs := make([]PilosaRecord, len(m))
+	for i, im := range m {
+		ec := copyEntity(e)
+		if im.Subjecter != nil {
+			subj, err := im.Subjecter.Subject(ec)
+			if err != nil {
+				return PilosaRecord{}, errors.Wrapf(err, "getting subject for index '%s'", im.Index)
+			}
+			ec.Subject = IRI(subj)
+		}
+		pr, err := im.Mapper.Map(ec)
+		if err != nil {
+			return PilosaRecord{}, errors.Wrapf(err, "mapping for index '%s'", im.Index)
+		}
+		pr.Index = im.Index
+		prs[i] = pr
+	}
+	pr := prs[0]
+	pr.More = append(pr.More, prs[1:]...)
+	return pr, nil
+}
@@ -34,9 +34,12 @@ package pdk_test
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/pilosa/pdk"
+	"github.com/pilosa/pdk/fake"
 )
 
 func TestCollapsingMapper(t *testing.T) {
@@ -150,3 +153,372 @@ func TestCollapsingMapper(t *testing.T) {
 		})
 	}
 }
+
+func TestCollapsingMapperMutexAndBool(t *testing.T) {
+	cm := pdk.NewCollapsingMapper()
+	cm.MutexFields = []string{"status"}
+	cm.BoolFields = true
+
+	e := &pdk.Entity{
+		Subject: "blah",
+		Objects: map[pdk.Property]pdk.Object{
+			"status": pdk.S("done"),
+			"tag":    pdk.S("red"),
+			"active": pdk.B(true),
+			"alive":  pdk.B(false),
+		},
+	}
+	pr, err := cm.Map(e)
+	if err != nil {
+		t.Fatalf("mapping entity: %v", err)
+	}
+	expected := map[string]pdk.Row{
+		"status": {Field: "status", ID: uint64(0), Kind: pdk.RowMutex},
+		"tag":    {Field: "tag", ID: uint64(0), Kind: pdk.RowSet},
+		"active": {Field: "active", ID: uint64(1), Kind: pdk.RowBool},
+		"alive":  {Field: "alive", ID: uint64(0), Kind: pdk.RowBool},
+	}
+	if len(pr.Rows) != len(expected) {
+		t.Fatalf("wrong rows: %v", pr.Rows)
+	}
+	for _, row := range pr.Rows {
+		if row != expected[row.Field] {
+			t.Errorf("expected %v, got %v", expected[row.Field], row)
+		}
+	}
+}
+
+func TestCollapsingMapperReplace(t *testing.T) {
+	cm := pdk.NewCollapsingMapper()
+	cm.ColTranslator = pdk.NewMapFieldTranslator()
+	cm.ReplaceFields = []string{"city"}
+
+	tests := []struct {
+		objects map[pdk.Property]pdk.Object
+		clears  []pdk.Row
+	}{
+		{
+			map[pdk.Property]pdk.Object{"city": pdk.S("a"), "tag": pdk.S("x")},
+			nil,
+		},
+		{
+			map[pdk.Property]pdk.Object{"city": pdk.S("a"), "tag": pdk.S("y")},
+			nil,
+		},
+		{
+			map[pdk.Property]pdk.Object{"tag": pdk.S("y")},
+			nil,
+		},
+		{
+			map[pdk.Property]pdk.Object{"city": pdk.S("b")},
+			[]pdk.Row{{Field: "city", ID: uint64(0)}},
+		},
+	}
+	for i, test := range tests {
+		pr, err := cm.Map(&pdk.Entity{Subject: "blah", Objects: test.objects})
+		if err != nil {
+			t.Fatalf("mapping entity %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(pr.ClearRows, test.clears) {
+			t.Fatalf("expected clears %v for entity %d, got %v", test.clears, i, pr.ClearRows)
+		}
+	}
+}
+
+func TestCollapsingMapperReplaceCacheSize(t *testing.T) {
+	cm := pdk.NewCollapsingMapper()
+	cm.ColTranslator = pdk.NewMapFieldTranslator()
+	cm.ReplaceFields = []string{"city"}
+	cm.ReplaceCacheSize = 2
+
+	mapCity := func(subj pdk.IRI, city string) []pdk.Row {
+		pr, err := cm.Map(&pdk.Entity{Subject: subj, Objects: map[pdk.Property]pdk.Object{"city": pdk.S(city)}})
+		if err != nil {
+			t.Fatalf("mapping %s: %v", subj, err)
+		}
+		return pr.ClearRows
+	}
+	mapCity("a", "x")
+	mapCity("b", "x")
+	if clears := mapCity("a", "y"); len(clears) != 1 {
+		t.Fatalf("expected a's old city to be cleared, got %v", clears)
+	}
+	// c pushes out b, the least recently mapped.
+	mapCity("c", "x")
+	if clears := mapCity("b", "y"); len(clears) != 0 {
+		t.Fatalf("expected b to have been forgotten, got clears %v", clears)
+	}
+	if clears := mapCity("c", "y"); len(clears) != 1 {
+		t.Fatalf("expected c's old city to be cleared, got %v", clears)
+	}
+}
+
+func TestMultiIndexMapper(t *testing.T) {
+	users, sessions := pdk.NewCollapsingMapper(), pdk.NewCollapsingMapper()
+	users.ColTranslator = pdk.NewMapFieldTranslator()
+	sessions.ColTranslator = pdk.NewMapFieldTranslator()
+	m := pdk.MultiIndexMapper{
+		{Index: "users", Mapper: users},
+		{Index: "sessions", Subjecter: pdk.SubjectPath{"session"}, Mapper: sessions},
+	}
+	e := &pdk.Entity{
+		Subject: "u1",
+		Objects: map[pdk.Property]pdk.Object{
+			"session": pdk.S("s1"),
+			"page":    pdk.S("home"),
+		},
+	}
+	pr, err := m.Map(e)
+	if err != nil {
+		t.Fatalf("mapping entity: %v", err)
+	}
+	if _, ok := e.Objects["session"]; !ok {
+		t.Fatal("mapping changed the original entity")
+	}
+	if pr.Index != "users" || len(pr.Rows) != 2 || len(pr.More) != 1 {
+		t.Fatalf("unexpected users record: %+v", pr)
+	}
+	more := pr.More[0]
+	if more.Index != "sessions" || len(more.Rows) != 1 || more.Rows[0].Field != "page" {
+		t.Fatalf("unexpected sessions record: %+v", more)
+	}
+	if subj, err := sessions.ColTranslator.Get(more.Col.(uint64)); err != nil || subj != "s1" {
+		t.Fatalf("expected sessions column to be s1, got %v, %v", subj, err)
+	}
+}
+
+func TestCollapsingMapperAttrFields(t *testing.T) {
+	cm := pdk.NewCollapsingMapper()
+	cm.AttrFields = []string{"name", "address-url", "score"}
+	e := &pdk.Entity{
+		Subject: "blah",
+		Objects: map[pdk.Property]pdk.Object{
+			"name":  pdk.S("Blah"),
+			"score": pdk.F64(2.5),
+			"tag":   pdk.S("red"),
+			"address": &pdk.Entity{Objects: map[pdk.Property]pdk.Object{
+				"url": pdk.S("http://example.com"),
+			}},
+		},
+	}
+	pr, err := cm.Map(e)
+	if err != nil {
+		t.Fatalf("mapping entity: %v", err)
+	}
+	expected := map[string]interface{}{"name": "Blah", "address-url": "http://example.com", "score": 2.5}
+	if !reflect.DeepEqual(pr.ColAttrs, expected) {
+		t.Fatalf("expected attributes %v, got %v", expected, pr.ColAttrs)
+	}
+	if len(pr.Rows) != 1 || pr.Rows[0].Field != "tag" || len(pr.Vals) != 0 {
+		t.Fatalf("unexpected rows %v and vals %v", pr.Rows, pr.Vals)
+	}
+}
+
+func TestCollapsingMapperTimes(t *testing.T) {
+	cm := pdk.NewCollapsingMapper()
+	cm.Translator = nil
+	cm.TimestampField = "event-ts"
+	cm.MutexFields = []string{"status"}
+	ts := time.Date(2019, time.June, 1, 12, 30, 0, 0, time.UTC)
+	e := &pdk.Entity{
+		Subject: "blah",
+		Objects: map[pdk.Property]pdk.Object{
+			"event": &pdk.Entity{Objects: map[pdk.Property]pdk.Object{
+				"ts": pdk.Time(ts),
+			}},
+			"tag":    pdk.S("red"),
+			"status": pdk.S("done"),
+			"born":   pdk.Time(time.Date(1990, time.March, 4, 5, 6, 7, 0, time.FixedZone("x", 3600))),
+		},
+	}
+	pr, err := cm.Map(e)
+	if err != nil {
+		t.Fatalf("mapping entity: %v", err)
+	}
+	if !pr.Time.Equal(ts) {
+		t.Fatalf("expected record time %v, got %v", ts, pr.Time)
+	}
+	vals := make(map[string]int64)
+	for _, val := range pr.Vals {
+		vals[val.Field] = val.Value
+	}
+	expected := map[string]int64{"born-year": 1990, "born-month": 3, "born-day": 4, "born-hour": 4}
+	if !reflect.DeepEqual(vals, expected) {
+		t.Fatalf("expected vals %v, got %v", expected, vals)
+	}
+	if len(pr.Rows) != 2 {
+		t.Fatalf("unexpected rows %v", pr.Rows)
+	}
+}
+
+func TestCollapsingMapperFloats(t *testing.T) {
+	cm := pdk.NewCollapsingMapper()
+	cm.FieldConfigs = []pdk.FieldConfig{{Name: "price", Scale: 2}, {Name: "count", Scale: 1}}
+	cm.Mappers = map[string]pdk.Mapper{
+		"temp": pdk.LinearFloatMapper{Min: 0, Max: 100, Res: 10},
+		"bits": pdk.BinaryFloatMapper{Min: 0, Max: 7, BitDepth: 3},
+		"size": pdk.IntMapper{Min: 10, Max: 20},
+		"when": pdk.DayOfWeekMapper{},
+	}
+	e := &pdk.Entity{
+		Subject: "blah",
+		Objects: map[pdk.Property]pdk.Object{
+			"price": pdk.F64(3.99),
+			"count": pdk.I(7),
+			"other": pdk.F32(2.5),
+			"temp":  pdk.F64(42.5),
+			"bits":  pdk.F64(5),
+			"size":  pdk.I(12),
+			"when":  pdk.Time(time.Date(2019, time.June, 1, 0, 0, 0, 0, time.UTC)),
+		},
+	}
+	pr, err := cm.Map(e)
+	if err != nil {
+		t.Fatalf("mapping entity: %v", err)
+	}
+	vals := make(map[string]int64)
+	for _, val := range pr.Vals {
+		vals[val.Field] = val.Value
+	}
+	expectedVals := map[string]int64{"price": 399, "count": 70, "other": 2}
+	if !reflect.DeepEqual(vals, expectedVals) {
+		t.Fatalf("expected vals %v, got %v", expectedVals, vals)
+	}
+	rows := make(map[string][]interface{})
+	for _, row := range pr.Rows {
+		rows[row.Field] = append(rows[row.Field], row.ID)
+	}
+	expectedRows := map[string][]interface{}{"temp": {uint64(4)}, "bits": {uint64(0), uint64(2)}, "size": {uint64(2)}, "when": {uint64(time.Saturday)}}
+	if !reflect.DeepEqual(rows, expectedRows) {
+		t.Fatalf("expected rows %v, got %v", expectedRows, rows)
+	}
+
+	e.Objects = map[pdk.Property]pdk.Object{"temp": pdk.F64(101)}
+	if _, err := cm.Map(e); err == nil {
+		t.Fatal("expected error for value out of range")
+	}
+}
+
+func TestBinaryMappers(t *testing.T) {
+	tests := []struct {
+		mapper pdk.Mapper
+		val    interface{}
+		ids    []int64
+		err    bool
+	}{
+		{mapper: pdk.BinaryFloatMapper{Min: 0, Max: 7, BitDepth: 3}, val: 5.0, ids: []int64{0, 2}},
+		{mapper: pdk.BinaryFloatMapper{Min: 0, Max: 7, BitDepth: 3}, val: 0.0, ids: []int64{4}},
+		{mapper: pdk.BinaryFloatMapper{Min: 0, Max: 7, BitDepth: 3}, val: 0.5, ids: []int64{4}},
+		{mapper: pdk.BinaryFloatMapper{Min: 0, Max: 7, BitDepth: 3}, val: -1.0, err: true},
+		{mapper: pdk.BinaryFloatMapper{Min: -4, Max: 3, BitDepth: 3}, val: -3.0, ids: []int64{0}},
+		{mapper: pdk.BinaryFloatMapper{Min: -4, Max: 3, BitDepth: 3}, val: -4.0, ids: []int64{4}},
+		{mapper: pdk.BinaryIntMapper{Min: 0, Max: 7, BitDepth: 3}, val: int64(6), ids: []int64{1, 2}},
+		{mapper: pdk.BinaryIntMapper{Min: 0, Max: 7, BitDepth: 3}, val: int64(0), ids: []int64{4}},
+		{mapper: pdk.BinaryIntMapper{Min: 0, Max: 7, BitDepth: 3}, val: int64(-1), err: true},
+		{mapper: pdk.BinaryIntMapper{Min: 0, Max: 7, BitDepth: 3}, val: int64(8), err: true},
+		{mapper: pdk.BinaryIntMapper{Min: -8, Max: 7, BitDepth: 4}, val: int64(-3), ids: []int64{0, 2}},
+		{mapper: pdk.BinaryIntMapper{Min: -8, Max: 7, BitDepth: 4}, val: int64(-8), ids: []int64{5}},
+		{mapper: pdk.BinaryIntMapper{Min: 0, Max: 100, BitDepth: 3}, val: int64(9), err: true},
+	}
+	for _, test := range tests {
+		ids, err := test.mapper.ID(test.val)
+		if test.err {
+			if err == nil {
+				t.Errorf("%#v: expected error mapping %v, got %v", test.mapper, test.val, ids)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%#v: mapping %v: %v", test.mapper, test.val, err)
+		} else if !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("%#v: expected %v for %v, got %v", test.mapper, test.ids, test.val, ids)
+		}
+	}
+}
+
+func TestCollapsingMapperListModes(t *testing.T) {
+	cm := pdk.NewCollapsingMapper()
+	cm.Translator = nil
+	var err error
+	cm.ListModes, err = pdk.ParseListModes([]string{"items:positional", "first:first", "last:last", "count:count"})
+	if err != nil {
+		t.Fatalf("parsing list modes: %v", err)
+	}
+	list := func() pdk.Objects { return pdk.Objects{pdk.S("a"), pdk.S("b"), pdk.S("c")} }
+	e := &pdk.Entity{
+		Subject: "blah",
+		Objects: map[pdk.Property]pdk.Object{
+			"items": pdk.Objects{
+				&pdk.Entity{Objects: map[pdk.Property]pdk.Object{"name": pdk.S("x")}},
+				&pdk.Entity{Objects: map[pdk.Property]pdk.Object{"name": pdk.S("y")}},
+			},
+			"set":   list(),
+			"first": list(),
+			"last":  list(),
+			"count": list(),
+			"empty": pdk.Objects{},
+		},
+	}
+	pr, err := cm.Map(e)
+	if err != nil {
+		t.Fatalf("mapping entity: %v", err)
+	}
+	rows := make(map[string][]interface{})
+	for _, row := range pr.Rows {
+		rows[row.Field] = append(rows[row.Field], row.ID)
+	}
+	expected := map[string][]interface{}{
+		"items-0-name": {"x"},
+		"items-1-name": {"y"},
+		"set":          {"a", "b", "c"},
+		"first":        {"a"},
+		"last":         {"c"},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Fatalf("expected rows %v, got %v", expected, rows)
+	}
+	if len(pr.Vals) != 1 || pr.Vals[0] != (pdk.Val{Field: "count", Value: 3}) {
+		t.Fatalf("unexpected vals %v", pr.Vals)
+	}
+
+	for _, specs := range [][]string{{"items"}, {"items:ordered"}} {
+		if _, err := pdk.ParseListModes(specs); err == nil {
+			t.Errorf("expected error parsing %v", specs)
+		}
+	}
+}
+
+func TestCollapsingMapperStructTags(t *testing.T) {
+	gp := pdk.NewDefaultGenericParser()
+	cm := pdk.NewCollapsingMapper()
+	cm.Translator = nil
+	cm.ColTranslator = nil
+	cm.Nexter = nil
+	user := &fake.User{ID: 3, Age: 41, FirstName: "ada", Allergies: []string{"nuts"}}
+	ent, err := gp.Parse(user)
+	if err != nil {
+		t.Fatalf("parsing: %v", err)
+	}
+	ent.Objects["loc"] = &pdk.Entity{
+		Objects: map[pdk.Property]pdk.Object{"zone": pdk.S("UTC")},
+		Fields:  map[pdk.Property]string{"zone": "timezone"},
+	}
+	pr, err := cm.Map(ent)
+	if err != nil {
+		t.Fatalf("mapping: %v", err)
+	}
+	if pr.Col != "3" {
+		t.Fatalf("expected column 3, got %v", pr.Col)
+	}
+	rows := make(map[string]interface{})
+	for _, row := range pr.Rows {
+		rows[row.Field] = row.ID
+	}
+	expected := map[string]interface{}{"firstname": "ada", "lastname": "", "title": "", "allergies": "nuts", "timezone": "UTC"}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Fatalf("expected rows %v, got %v", expected, rows)
+	}
+	if len(pr.Vals) != 1 || pr.Vals[0] != (pdk.Val{Field: "age", Value: 41}) {
+		t.Fatalf("unexpected vals %v", pr.Vals)
+	}
+}
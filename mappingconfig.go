@@ -0,0 +1,402 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pdk
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	gopilosa "github.com/pilosa/go-pilosa"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// MappingConfig describes how records are parsed and mapped, so that a
+// GenericParser and CollapsingMapper can be set up for a new kind of data
+// without writing Go. Paths which aren't configured are mapped as usual, with
+// field names from a DashField.
+type MappingConfig struct {
+	// Ignore and Collapse configure the DashField which names fields for
+	// paths without a Field.
+	Ignore   []string `toml:"ignore" yaml:"ignore"`
+	Collapse []string `toml:"collapse" yaml:"collapse"`
+
+	// TimeLayouts and BoolFields set the GenericParser's TimeLayouts and the
+	// CollapsingMapper's BoolFields.
+	TimeLayouts []string `toml:"time-layouts" yaml:"time-layouts"`
+	BoolFields  bool     `toml:"bool-fields" yaml:"bool-fields"`
+
+	Paths []PathConfig `toml:"path" yaml:"path"`
+}
+
+// PathConfig describes how the value at a path in records is mapped.
+type PathConfig struct {
+	// Path is the list of keys leading to the value, e.g. ["pickup", "time"].
+	Path []string `toml:"path" yaml:"path"`
+
+	// Field is the name of the field the value is mapped to. Values nested
+	// under the path are mapped to fields named by joining Field and the
+	// rest of their path with dashes.
+	Field string `toml:"field" yaml:"field"`
+
+	// Type is the type of the field: "set", "mutex", "bool", "int" or
+	// "time". Values in mutex fields must be strings, and values in bool
+	// fields bools, which are mapped as with BoolFields.
+	Type string `toml:"type" yaml:"type"`
+
+	// Scale is the Scale of an int field (see FieldConfig).
+	Scale int `toml:"scale" yaml:"scale"`
+
+	// Mapper maps numbers or times to rows rather than values.
+	Mapper *MapperConfig `toml:"mapper" yaml:"mapper"`
+
+	// List is the ListMode of a list: "set", "positional", "first", "last"
+	// or "count".
+	List string `toml:"list" yaml:"list"`
+
+	// Ignore drops the value, and everything nested under it.
+	Ignore bool `toml:"ignore" yaml:"ignore"`
+
+	// Subject makes the value the subject of the record, which is mapped to
+	// its column, rather than indexing it.
+	Subject bool `toml:"subject" yaml:"subject"`
+
+	// Attr sets the value as an attribute of the column rather than
+	// indexing it.
+	Attr bool `toml:"attr" yaml:"attr"`
+
+	// Timestamp makes the value (a time) the timestamp of the record rather
+	// than indexing it.
+	Timestamp bool `toml:"timestamp" yaml:"timestamp"`
+}
+
+// MapperConfig describes a Mapper.
+type MapperConfig struct {
+	// Type is one of "int" (IntMapper), "linear-float" (LinearFloatMapper),
+	// "float" (FloatMapper), "binary-float" (BinaryFloatMapper),
+	// "time-of-day" (TimeOfDayMapper), "day-of-week", "day-of-month", "month"
+	// or "year".
+	Type string `toml:"type" yaml:"type"`
+
+	// Min and Max bound the values of int, linear-float and binary-float
+	// Mappers.
+	Min ConfigFloat `toml:"min" yaml:"min"`
+	Max ConfigFloat `toml:"max" yaml:"max"`
+
+	// Res is the number of buckets of linear-float and time-of-day Mappers.
+	Res ConfigFloat `toml:"res" yaml:"res"`
+
+	// Buckets are the bucket boundaries of a float Mapper.
+	Buckets []ConfigFloat `toml:"buckets" yaml:"buckets"`
+
+	// BitDepth is the number of bits of a binary-float Mapper.
+	BitDepth int `toml:"bit-depth" yaml:"bit-depth"`
+}
+
+// ConfigFloat is a float64 which can also be written as an integer in TOML.
+type ConfigFloat float64
+
+// UnmarshalTOML implements toml.Unmarshaler.
+func (f *ConfigFloat) UnmarshalTOML(v interface{}) error {
+	switch n := v.(type) {
+	case int64:
+		*f = ConfigFloat(n)
+	case float64:
+		*f = ConfigFloat(n)
+	default:
+		return errors.Errorf("expected a number, but got %T %v", v, v)
+	}
+	return nil
+}
+
+// LoadMappingConfig reads a MappingConfig from a YAML file if its extension
+// is ".yaml" or ".yml", and from a TOML file otherwise. For example:
+//
+//	time-layouts = ["2006-01-02 15:04:05"]
+//
+//	[[path]]
+//	path = ["id"]
+//	subject = true
+//
+//	[[path]]
+//	path = ["pickup", "time"]
+//	field = "pickup_time"
+//	mapper = {type = "time-of-day", res = 48}
+//
+//	[[path]]
+//	path = ["fare"]
+//	type = "int"
+//	scale = 2
+//
+//	[[path]]
+//	path = ["items"]
+//	list = "count"
+func LoadMappingConfig(file string) (*MappingConfig, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading mapping config")
+	}
+	conf := &MappingConfig{}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		if err := yaml.UnmarshalStrict(data, conf); err != nil {
+			return nil, errors.Wrapf(err, "decoding %s", file)
+		}
+	default:
+		md, err := toml.Decode(string(data), conf)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decoding %s", file)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return nil, errors.Errorf("unknown keys in %s: %v", file, undecoded)
+		}
+	}
+	if err := conf.validate(); err != nil {
+		return nil, errors.Wrapf(err, "mapping config %s", file)
+	}
+	return conf, nil
+}
+
+func (c *MappingConfig) validate() error {
+	var subjects, timestamps int
+	for _, p := range c.Paths {
+		if len(p.Path) == 0 {
+			return errors.New("empty path")
+		}
+		if p.Field != "" && !gopilosa.ValidLabel(p.Field) {
+			return errors.Errorf("invalid field name '%s' for %v", p.Field, p.Path)
+		}
+		switch p.Type {
+		case "", "set", "mutex", "bool", "int", "time":
+		default:
+			return errors.Errorf("unknown field type '%s' for %v", p.Type, p.Path)
+		}
+		if err := (FieldConfig{Type: p.Type, Scale: p.Scale}).validate(); err != nil {
+			return errors.Wrapf(err, "path %v", p.Path)
+		}
+		if p.List != "" {
+			if _, err := ParseListModes([]string{"list:" + p.List}); err != nil {
+				return errors.Errorf("unknown list mode '%s' for %v", p.List, p.Path)
+			}
+		}
+		if p.Mapper != nil {
+			if _, err := p.Mapper.mapper(); err != nil {
+				return errors.Wrapf(err, "mapper for %v", p.Path)
+			}
+		}
+		if p.Subject {
+			subjects++
+		}
+		if p.Timestamp {
+			timestamps++
+		}
+	}
+	if subjects > 1 {
+		return errors.New("more than one subject path")
+	}
+	if timestamps > 1 {
+		return errors.New("more than one timestamp path")
+	}
+	return nil
+}
+
+// mapper returns the Mapper the MapperConfig describes.
+func (c MapperConfig) mapper() (Mapper, error) {
+	lo, hi, res := float64(c.Min), float64(c.Max), float64(c.Res)
+	buckets := make([]float64, len(c.Buckets))
+	for i, b := range c.Buckets {
+		buckets[i] = float64(b)
+	}
+	switch c.Type {
+	case "int":
+		if lo > hi {
+			return nil, errors.Errorf("min %v is greater than max %v", lo, hi)
+		}
+		return IntMapper{Min: int64(lo), Max: int64(hi), Res: int64(hi) - int64(lo) + 1}, nil
+	case "linear-float":
+		if lo >= hi || res < 1 {
+			return nil, errors.Errorf("bad min %v, max %v or res %v", lo, hi, res)
+		}
+		return LinearFloatMapper{Min: lo, Max: hi, Res: res}, nil
+	case "float":
+		if len(buckets) < 2 || !sort.Float64sAreSorted(buckets) {
+			return nil, errors.Errorf("buckets %v must be at least two sorted values", buckets)
+		}
+		return FloatMapper{Buckets: buckets}, nil
+	case "binary-float":
+		if lo >= hi || c.BitDepth < 1 || c.BitDepth > 63 {
+			return nil, errors.Errorf("bad min %v, max %v or bit depth %d", lo, hi, c.BitDepth)
+		}
+		return BinaryFloatMapper{Min: lo, Max: hi, BitDepth: c.BitDepth}, nil
+	case "time-of-day":
+		if res < 1 {
+			return nil, errors.Errorf("bad res %v", res)
+		}
+		return TimeOfDayMapper{Res: int64(res)}, nil
+	case "day-of-week":
+		return DayOfWeekMapper{}, nil
+	case "day-of-month":
+		return DayOfMonthMapper{}, nil
+	case "month":
+		return MonthMapper{}, nil
+	case "year":
+		return YearMapper{}, nil
+	default:
+		return nil, errors.Errorf("unknown mapper type '%s'", c.Type)
+	}
+}
+
+// Subject returns the subject path, if there is one.
+func (c *MappingConfig) Subject() []string {
+	for _, p := range c.Paths {
+		if p.Subject {
+			return p.Path
+		}
+	}
+	return nil
+}
+
+// Apply sets up parser and mapper as the MappingConfig describes. The
+// mapper's Framer is replaced, and the FieldConfigs for the configured paths
+// are added to its FieldConfigs, so they should also be given to the Indexer.
+func (c *MappingConfig) Apply(parser *GenericParser, mapper *CollapsingMapper) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	framer := &mappingFramer{dash: DashField{Ignore: c.Ignore, Collapse: c.Collapse}}
+	for _, p := range c.Paths {
+		if p.Ignore || p.Field != "" {
+			framer.paths = append(framer.paths, pathField{path: p.Path, field: p.Field, ignore: p.Ignore})
+		}
+	}
+	// Longer paths are more specific, so they are matched first.
+	sort.SliceStable(framer.paths, func(i, j int) bool {
+		return len(framer.paths[i].path) > len(framer.paths[j].path)
+	})
+	mapper.Framer = framer
+	mapper.BoolFields = mapper.BoolFields || c.BoolFields
+	parser.TimeLayouts = append(parser.TimeLayouts, c.TimeLayouts...)
+
+	for _, p := range c.Paths {
+		if p.Ignore {
+			continue
+		}
+		if p.Subject {
+			parser.EntitySubjecter = SubjectPath(p.Path)
+			continue
+		}
+		field, err := framer.Field(p.Path)
+		if err != nil {
+			return errors.Wrapf(err, "getting field from %v", p.Path)
+		}
+		if field == "" {
+			continue
+		}
+		if p.Type != "" || p.Scale != 0 {
+			mapper.FieldConfigs = append(mapper.FieldConfigs, FieldConfig{Name: field, Type: p.Type, Scale: p.Scale})
+		}
+		if p.Type == "mutex" {
+			mapper.MutexFields = append(mapper.MutexFields, field)
+		}
+		if p.Attr {
+			mapper.AttrFields = append(mapper.AttrFields, field)
+		}
+		if p.Timestamp {
+			mapper.TimestampField = field
+		}
+		if p.List != "" {
+			if mapper.ListModes == nil {
+				mapper.ListModes = make(map[string]ListMode)
+			}
+			mapper.ListModes[field] = ListMode(p.List)
+		}
+		if p.Mapper != nil {
+			m, err := p.Mapper.mapper()
+			if err != nil {
+				return errors.Wrapf(err, "mapper for %v", p.Path)
+			}
+			if mapper.Mappers == nil {
+				mapper.Mappers = make(map[string]Mapper)
+			}
+			mapper.Mappers[field] = m
+		}
+	}
+	return nil
+}
+
+// mappingFramer is a Framer which names the fields of configured paths, and
+// falls back to a DashField for the rest.
+type mappingFramer struct {
+	dash  DashField
+	paths []pathField
+}
+
+type pathField struct {
+	path   []string
+	field  string
+	ignore bool
+}
+
+// Field implements Framer. A path under a configured path is named by joining
+// the configured Field and the DashField name of the rest of the path.
+func (f *mappingFramer) Field(path []string) (string, error) {
+	for _, pf := range f.paths {
+		if !hasPathPrefix(path, pf.path) {
+			continue
+		}
+		if pf.ignore {
+			return "", nil
+		}
+		rest, err := f.dash.Field(path[len(pf.path):])
+		if err != nil || rest == "" {
+			return pf.field, err
+		}
+		return pf.field + "-" + rest, nil
+	}
+	return f.dash.Field(path)
+}
+
+func hasPathPrefix(path, prefix []string) bool {
+	if len(path) < len(prefix) {
+		return false
+	}
+	for i, p := range prefix {
+		if path[i] != p {
+			return false
+		}
+	}
+	return true
+}
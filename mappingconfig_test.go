@@ -0,0 +1,246 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pdk_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pilosa/pdk"
+)
+
+const tomlMapping = `
+time-layouts = ["2006-01-02 15:04"]
+ignore = ["debug"]
+
+[[path]]
+path = ["id"]
+subject = true
+
+[[path]]
+path = ["pickup", "time"]
+field = "pickup_time"
+mapper = {type = "time-of-day", res = 24}
+
+[[path]]
+path = ["pickup", "place"]
+field = "place"
+
+[[path]]
+path = ["fare"]
+type = "int"
+scale = 2
+
+[[path]]
+path = ["vendor"]
+type = "mutex"
+
+[[path]]
+path = ["flags", "paid"]
+field = "paid"
+type = "bool"
+
+[[path]]
+path = ["items"]
+list = "count"
+
+[[path]]
+path = ["driver"]
+attr = true
+
+[[path]]
+path = ["secret"]
+ignore = true
+`
+
+const yamlMapping = `
+time-layouts: ["2006-01-02 15:04"]
+ignore: [debug]
+path:
+  - path: [id]
+    subject: true
+  - path: [pickup, time]
+    field: pickup_time
+    mapper: {type: time-of-day, res: 24}
+  - path: [pickup, place]
+    field: place
+  - path: [fare]
+    type: int
+    scale: 2
+  - path: [vendor]
+    type: mutex
+  - path: [flags, paid]
+    field: paid
+    type: bool
+  - path: [items]
+    list: count
+  - path: [driver]
+    attr: true
+  - path: [secret]
+    ignore: true
+`
+
+func TestMappingConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mappingconfig")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, data := range map[string]string{"mapping.toml": tomlMapping, "mapping.yaml": yamlMapping} {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(dir, name)
+			if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+				t.Fatalf("writing config: %v", err)
+			}
+			conf, err := pdk.LoadMappingConfig(file)
+			if err != nil {
+				t.Fatalf("loading config: %v", err)
+			}
+			if subj := conf.Subject(); !reflect.DeepEqual(subj, []string{"id"}) {
+				t.Fatalf("unexpected subject %v", subj)
+			}
+
+			parser := pdk.NewDefaultGenericParser()
+			parser.Stats = pdk.NopStatter{}
+			mapper := pdk.NewCollapsingMapper()
+			mapper.Translator = nil
+			mapper.ColTranslator = nil
+			mapper.Nexter = nil
+			if err := conf.Apply(parser, mapper); err != nil {
+				t.Fatalf("applying config: %v", err)
+			}
+			expectedConfigs := []pdk.FieldConfig{{Name: "fare", Type: "int", Scale: 2}, {Name: "vendor", Type: "mutex"}, {Name: "paid", Type: "bool"}}
+			if !reflect.DeepEqual(mapper.FieldConfigs, expectedConfigs) {
+				t.Fatalf("expected field configs %v, got %v", expectedConfigs, mapper.FieldConfigs)
+			}
+
+			ent, err := parser.Parse(map[string]interface{}{
+				"id":     "trip1",
+				"pickup": map[string]interface{}{"time": "2019-06-01 13:45", "place": map[string]interface{}{"zone": "a"}},
+				"fare":   12.5,
+				"vendor": "v",
+				"flags":  map[string]interface{}{"paid": false, "shared": true},
+				"items":  []interface{}{"x", "y"},
+				"driver": "bob",
+				"secret": "s",
+				"debug":  map[string]interface{}{"level": "high"},
+			})
+			if err != nil {
+				t.Fatalf("parsing: %v", err)
+			}
+			pr, err := mapper.Map(ent)
+			if err != nil {
+				t.Fatalf("mapping: %v", err)
+			}
+			if pr.Col != "trip1" {
+				t.Fatalf("unexpected column %v", pr.Col)
+			}
+			rows := make(map[string]interface{})
+			for _, row := range pr.Rows {
+				rows[row.Field] = row.ID
+				if row.Field == "vendor" && row.Kind != pdk.RowMutex {
+					t.Fatalf("vendor should be a mutex row: %v", row)
+				}
+				if (row.Field == "paid") != (row.Kind == pdk.RowBool) {
+					t.Fatalf("only paid should be a bool row: %v", row)
+				}
+			}
+			// unconfigured bools are still mapped to a row named after them.
+			expectedRows := map[string]interface{}{"pickup_time": uint64(13), "place-zone": "a", "vendor": "v", "paid": uint64(0), "flags": "shared"}
+			if !reflect.DeepEqual(rows, expectedRows) {
+				t.Fatalf("expected rows %v, got %v", expectedRows, rows)
+			}
+			vals := make(map[string]int64)
+			for _, val := range pr.Vals {
+				vals[val.Field] = val.Value
+			}
+			if expectedVals := map[string]int64{"fare": 1250, "items": 2}; !reflect.DeepEqual(vals, expectedVals) {
+				t.Fatalf("expected vals %v, got %v", expectedVals, vals)
+			}
+			if !reflect.DeepEqual(pr.ColAttrs, map[string]interface{}{"driver": "bob"}) {
+				t.Fatalf("unexpected column attributes %v", pr.ColAttrs)
+			}
+		})
+	}
+}
+
+func TestLoadMappingConfigErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mappingconfig")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tst := range []struct {
+		file   string
+		data   string
+		errStr string
+	}{
+		{"unknown.toml", "[[path]]\npath = [\"a\"]\nsize = 1\n", "size"},
+		{"unknown.yml", "path:\n  - path: [a]\n    size: 1\n", "size"},
+		{"type.toml", "[[path]]\npath = [\"a\"]\ntype = \"bitmap\"\n", "bitmap"},
+		{"list.toml", "[[path]]\npath = [\"a\"]\nlist = \"ordered\"\n", "ordered"},
+		{"mapper.toml", "[[path]]\npath = [\"a\"]\nmapper = {type = \"linear-float\", min = 1, max = 0}\n", "min"},
+		{"subjects.toml", "[[path]]\npath = [\"a\"]\nsubject = true\n[[path]]\npath = [\"b\"]\nsubject = true\n", "subject"},
+		{"field.toml", "[[path]]\npath = [\"a\"]\nfield = \"Bad Name\"\n", "Bad Name"},
+	} {
+		file := filepath.Join(dir, tst.file)
+		if err := ioutil.WriteFile(file, []byte(tst.data), 0644); err != nil {
+			t.Fatalf("writing config: %v", err)
+		}
+		if _, err := pdk.LoadMappingConfig(file); err == nil || !strings.Contains(err.Error(), tst.errStr) {
+			t.Errorf("%s: expected error containing '%s', got %v", tst.file, tst.errStr, err)
+		}
+	}
+}
+
+func TestCollapsingMapperMapperTypes(t *testing.T) {
+	cm := pdk.NewCollapsingMapper()
+	cm.Mappers = map[string]pdk.Mapper{"n": pdk.YearMapper{}, "t": pdk.IntMapper{Min: 0, Max: 10}}
+	for _, obj := range []pdk.Object{pdk.I(1), pdk.Time(time.Now())} {
+		field := "n"
+		if _, ok := obj.(pdk.Time); ok {
+			field = "t"
+		}
+		e := &pdk.Entity{Objects: map[pdk.Property]pdk.Object{pdk.Property(field): obj}}
+		if _, err := cm.Map(e); err == nil {
+			t.Errorf("expected error mapping %v with %T", obj, cm.Mappers[field])
+		}
+	}
+}
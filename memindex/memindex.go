@@ -0,0 +1,402 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+// Package memindex provides a pdk.Indexer which keeps everything in memory,
+// and can be queried, so that pipelines can be tested without a Pilosa server.
+package memindex
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	gopilosa "github.com/pilosa/go-pilosa"
+	"github.com/pilosa/pdk"
+	"github.com/pkg/errors"
+)
+
+// Index is a pdk.Indexer which stores bits and values in memory. Like
+// pdk.Index, it creates fields as set, time, mutex, bool or int fields
+// depending on how they are first added to, and it is safe for concurrent use.
+// Bool fields have row 1 for true and row 0 for false.
+type Index struct {
+	mu       sync.RWMutex
+	fields   map[string]*field
+	colAttrs map[interface{}]map[string]interface{}
+}
+
+var (
+	_ pdk.Indexer      = &Index{}
+	_ pdk.Acknowledger = &Index{}
+)
+
+type field struct {
+	typ gopilosa.FieldType
+
+	// rows maps each row to the set of columns in it.
+	rows map[interface{}]map[interface{}]struct{}
+
+	// times maps each bit of a time field to its timestamps.
+	times map[bit][]time.Time
+
+	values map[interface{}]int64
+
+	attrs map[interface{}]map[string]interface{}
+}
+
+type bit struct {
+	row, col interface{}
+}
+
+// NewIndex returns a new, empty Index.
+func NewIndex() *Index {
+	return &Index{
+		fields:   make(map[string]*field),
+		colAttrs: make(map[interface{}]map[string]interface{}),
+	}
+}
+
+// AddColumn implements pdk.Indexer.
+func (i *Index) AddColumn(fieldName string, col, row interface{}) error {
+	return i.addColumn(fieldName, gopilosa.FieldTypeSet, col, row, time.Time{})
+}
+
+// AddColumnTimestamp implements pdk.Indexer.
+func (i *Index) AddColumnTimestamp(fieldName string, col, row interface{}, ts time.Time) error {
+	return i.addColumn(fieldName, gopilosa.FieldTypeTime, col, row, ts)
+}
+
+// AddMutex implements pdk.Indexer. Adding a column clears it from the field's
+// other rows.
+func (i *Index) AddMutex(fieldName string, col, row interface{}) error {
+	return i.addColumn(fieldName, gopilosa.FieldTypeMutex, col, row, time.Time{})
+}
+
+// AddBool implements pdk.Indexer.
+func (i *Index) AddBool(fieldName string, col interface{}, val bool) error {
+	var row uint64
+	if val {
+		row = 1
+	}
+	return i.addColumn(fieldName, gopilosa.FieldTypeBool, col, row, time.Time{})
+}
+
+func (i *Index) addColumn(fieldName string, fieldType gopilosa.FieldType, col, row interface{}, ts time.Time) error {
+	if !valid(col) || !valid(row) {
+		return errors.Errorf("a %T and a %T were passed to field '%s', both must be either uint64 or string", col, row, fieldName)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	f := i.field(fieldName, fieldType)
+	if f.typ == gopilosa.FieldTypeInt {
+		return errors.Errorf("can't add a column to int field '%s'", fieldName)
+	}
+	if f.typ == gopilosa.FieldTypeMutex || f.typ == gopilosa.FieldTypeBool {
+		for _, cols := range f.rows {
+			delete(cols, col)
+		}
+	}
+	cols, ok := f.rows[row]
+	if !ok {
+		cols = make(map[interface{}]struct{})
+		f.rows[row] = cols
+	}
+	cols[col] = struct{}{}
+	if f.typ == gopilosa.FieldTypeTime && !ts.IsZero() {
+		b := bit{row: row, col: col}
+		f.times[b] = append(f.times[b], ts)
+	}
+	return nil
+}
+
+// AddValue implements pdk.Indexer.
+func (i *Index) AddValue(fieldName string, col interface{}, val int64) error {
+	if !valid(col) {
+		return errors.Errorf("a %T was passed to field '%s', must be either uint64 or string", col, fieldName)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	f := i.field(fieldName, gopilosa.FieldTypeInt)
+	if f.typ != gopilosa.FieldTypeInt {
+		return errors.Errorf("can't add a value to %s field '%s'", f.typ, fieldName)
+	}
+	f.values[col] = val
+	return nil
+}
+
+// ClearColumn implements pdk.Indexer.
+func (i *Index) ClearColumn(fieldName string, col, row interface{}) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	f, ok := i.fields[fieldName]
+	if !ok {
+		return nil
+	}
+	delete(f.rows[row], col)
+	delete(f.times, bit{row: row, col: col})
+	return nil
+}
+
+// ClearValue implements pdk.Indexer.
+func (i *Index) ClearValue(fieldName string, col interface{}) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	f, ok := i.fields[fieldName]
+	if !ok {
+		return nil
+	}
+	if f.typ != gopilosa.FieldTypeInt {
+		return errors.Errorf("can't clear a value from %s field '%s'", f.typ, fieldName)
+	}
+	delete(f.values, col)
+	return nil
+}
+
+// AddColAttr implements pdk.Indexer.
+func (i *Index) AddColAttr(col interface{}, key string, value interface{}) error {
+	if !valid(col) {
+		return errors.Errorf("a %T was passed as a column for attribute '%s', must be either uint64 or string", col, key)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	setAttr(i.colAttrs, col, key, value)
+	return nil
+}
+
+// AddRowAttr implements pdk.Indexer. The field is created as a set field if
+// it doesn't exist.
+func (i *Index) AddRowAttr(fieldName string, row interface{}, key string, value interface{}) error {
+	if !valid(row) {
+		return errors.Errorf("a %T was passed as a row for attribute '%s', must be either uint64 or string", row, key)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	setAttr(i.field(fieldName, gopilosa.FieldTypeSet).attrs, row, key, value)
+	return nil
+}
+
+func setAttr(m map[interface{}]map[string]interface{}, k interface{}, key string, value interface{}) {
+	attrs, ok := m[k]
+	if !ok {
+		attrs = make(map[string]interface{})
+		m[k] = attrs
+	}
+	attrs[key] = value
+}
+
+// field returns the named field, creating it with the given type if it
+// doesn't exist. Callers must hold i.mu.Lock().
+func (i *Index) field(fieldName string, fieldType gopilosa.FieldType) *field {
+	f, ok := i.fields[fieldName]
+	if !ok {
+		f = &field{
+			typ:    fieldType,
+			rows:   make(map[interface{}]map[interface{}]struct{}),
+			times:  make(map[bit][]time.Time),
+			values: make(map[interface{}]int64),
+			attrs:  make(map[interface{}]map[string]interface{}),
+		}
+		i.fields[fieldName] = f
+	}
+	return f
+}
+
+// Flush implements pdk.Indexer. It does nothing.
+func (i *Index) Flush() error { return nil }
+
+// Acknowledge implements pdk.Acknowledger. Everything is stored as soon as it
+// is added, so ack is called straight away.
+func (i *Index) Acknowledge(ack func(err error)) { ack(nil) }
+
+// Close implements pdk.Indexer. It does nothing, and the Index can still be
+// queried afterwards.
+func (i *Index) Close() error { return nil }
+
+// Client implements pdk.Indexer. It returns nil.
+func (i *Index) Client() *gopilosa.Client { return nil }
+
+// Fields returns the names of all the fields which have been added to, in
+// order.
+func (i *Index) Fields() []string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	names := make([]string, 0, len(i.fields))
+	for name := range i.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FieldType returns the type of the named field, or "" if it doesn't exist.
+func (i *Index) FieldType(fieldName string) gopilosa.FieldType {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if f, ok := i.fields[fieldName]; ok {
+		return f.typ
+	}
+	return ""
+}
+
+// Rows returns the rows of the named field which have any columns set, with
+// uint64 rows in order followed by string rows in order.
+func (i *Index) Rows(fieldName string) []interface{} {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	f, ok := i.fields[fieldName]
+	if !ok {
+		return nil
+	}
+	rows := make([]interface{}, 0, len(f.rows))
+	for row, cols := range f.rows {
+		if len(cols) > 0 {
+			rows = append(rows, row)
+		}
+	}
+	sortKeys(rows)
+	return rows
+}
+
+// Row returns the uint64 columns set in a row of the named field, in order.
+// row may be a uint64 or a string.
+func (i *Index) Row(fieldName string, row interface{}) []uint64 {
+	var ids []uint64
+	for _, col := range i.columns(fieldName, row) {
+		if id, ok := col.(uint64); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// RowKeys is like Row, but returns the string columns.
+func (i *Index) RowKeys(fieldName string, row interface{}) []string {
+	var keys []string
+	for _, col := range i.columns(fieldName, row) {
+		if key, ok := col.(string); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (i *Index) columns(fieldName string, row interface{}) []interface{} {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	f, ok := i.fields[fieldName]
+	if !ok {
+		return nil
+	}
+	cols := make([]interface{}, 0, len(f.rows[row]))
+	for col := range f.rows[row] {
+		cols = append(cols, col)
+	}
+	sortKeys(cols)
+	return cols
+}
+
+// Timestamps returns the timestamps a bit of the named time field was set
+// with, in the order they were added.
+func (i *Index) Timestamps(fieldName string, col, row interface{}) []time.Time {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	f, ok := i.fields[fieldName]
+	if !ok {
+		return nil
+	}
+	return append([]time.Time(nil), f.times[bit{row: row, col: col}]...)
+}
+
+// Value returns a column's value in the named int field, and whether it has
+// one.
+func (i *Index) Value(fieldName string, col interface{}) (int64, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	f, ok := i.fields[fieldName]
+	if !ok {
+		return 0, false
+	}
+	val, ok := f.values[col]
+	return val, ok
+}
+
+// ColAttrs returns a copy of the attributes set on a column.
+func (i *Index) ColAttrs(col interface{}) map[string]interface{} {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return copyAttrs(i.colAttrs[col])
+}
+
+// RowAttrs returns a copy of the attributes set on a row of the named field.
+func (i *Index) RowAttrs(fieldName string, row interface{}) map[string]interface{} {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	f, ok := i.fields[fieldName]
+	if !ok {
+		return nil
+	}
+	return copyAttrs(f.attrs[row])
+}
+
+func copyAttrs(attrs map[string]interface{}) map[string]interface{} {
+	if attrs == nil {
+		return nil
+	}
+	ret := make(map[string]interface{}, len(attrs))
+	for k, v := range attrs {
+		ret[k] = v
+	}
+	return ret
+}
+
+func valid(u interface{}) bool {
+	switch u.(type) {
+	case uint64, string:
+		return true
+	}
+	return false
+}
+
+// sortKeys sorts a slice of uint64s and strings, putting the uint64s first.
+func sortKeys(keys []interface{}) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, aIsID := keys[i].(uint64)
+		b, bIsID := keys[j].(uint64)
+		if aIsID != bIsID {
+			return aIsID
+		}
+		if aIsID {
+			return a < b
+		}
+		return keys[i].(string) < keys[j].(string)
+	})
+}
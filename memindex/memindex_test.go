@@ -0,0 +1,193 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package memindex_test
+
+import (
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	gopilosa "github.com/pilosa/go-pilosa"
+	"github.com/pilosa/pdk"
+	"github.com/pilosa/pdk/memindex"
+)
+
+func TestIndex(t *testing.T) {
+	idx := memindex.NewIndex()
+	ts := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, err := range []error{
+		idx.AddColumn("f", uint64(3), uint64(1)),
+		idx.AddColumn("f", uint64(1), uint64(1)),
+		idx.AddColumn("f", "a", uint64(1)),
+		idx.AddColumn("f", uint64(2), "x"),
+		idx.ClearColumn("f", uint64(3), uint64(1)),
+		idx.AddColumnTimestamp("t", uint64(1), uint64(2), ts),
+		idx.AddMutex("m", uint64(1), uint64(1)),
+		idx.AddMutex("m", uint64(1), uint64(2)),
+		idx.AddBool("b", uint64(1), true),
+		idx.AddBool("b", uint64(1), false),
+		idx.AddValue("v", uint64(1), 42),
+		idx.AddValue("v", uint64(2), 7),
+		idx.ClearValue("v", uint64(2)),
+		idx.ClearColumn("unknown", uint64(1), uint64(1)),
+		idx.AddColAttr(uint64(1), "name", "one"),
+		idx.AddRowAttr("f", "x", "color", "red"),
+	} {
+		if err != nil {
+			t.Fatalf("adding: %v", err)
+		}
+	}
+	if err := idx.AddValue("f", uint64(1), 1); err == nil {
+		t.Fatal("expected error adding a value to a set field")
+	}
+	if err := idx.AddColumn("v", uint64(1), uint64(1)); err == nil {
+		t.Fatal("expected error adding a column to an int field")
+	}
+	if err := idx.AddColumn("f", 1, 1); err == nil {
+		t.Fatal("expected error adding ints")
+	}
+
+	if fields := idx.Fields(); !reflect.DeepEqual(fields, []string{"b", "f", "m", "t", "v"}) {
+		t.Fatalf("unexpected fields %v", fields)
+	}
+	if typ := idx.FieldType("m"); typ != gopilosa.FieldTypeMutex {
+		t.Fatalf("expected mutex field, got %s", typ)
+	}
+	if rows := idx.Rows("f"); !reflect.DeepEqual(rows, []interface{}{uint64(1), "x"}) {
+		t.Fatalf("unexpected rows %v", rows)
+	}
+	for _, test := range []struct {
+		field    string
+		row      interface{}
+		expected []uint64
+	}{
+		{field: "f", row: uint64(1), expected: []uint64{1}},
+		{field: "f", row: "x", expected: []uint64{2}},
+		{field: "t", row: uint64(2), expected: []uint64{1}},
+		{field: "m", row: uint64(1), expected: nil},
+		{field: "m", row: uint64(2), expected: []uint64{1}},
+		{field: "b", row: uint64(0), expected: []uint64{1}},
+		{field: "b", row: uint64(1), expected: nil},
+	} {
+		if cols := idx.Row(test.field, test.row); !reflect.DeepEqual(cols, test.expected) {
+			t.Errorf("expected %v in row %v of %s, got %v", test.expected, test.row, test.field, cols)
+		}
+	}
+	if keys := idx.RowKeys("f", uint64(1)); !reflect.DeepEqual(keys, []string{"a"}) {
+		t.Fatalf("unexpected row keys %v", keys)
+	}
+	if times := idx.Timestamps("t", uint64(1), uint64(2)); !reflect.DeepEqual(times, []time.Time{ts}) {
+		t.Fatalf("unexpected timestamps %v", times)
+	}
+	if val, ok := idx.Value("v", uint64(1)); !ok || val != 42 {
+		t.Fatalf("expected value 42, got %d, %v", val, ok)
+	}
+	if val, ok := idx.Value("v", uint64(2)); ok {
+		t.Fatalf("expected no value after clearing, got %d", val)
+	}
+	if attrs := idx.ColAttrs(uint64(1)); !reflect.DeepEqual(attrs, map[string]interface{}{"name": "one"}) {
+		t.Fatalf("unexpected column attributes %v", attrs)
+	}
+	if attrs := idx.RowAttrs("f", "x"); !reflect.DeepEqual(attrs, map[string]interface{}{"color": "red"}) {
+		t.Fatalf("unexpected row attributes %v", attrs)
+	}
+}
+
+type sliceSource struct {
+	recs []interface{}
+}
+
+func (s *sliceSource) Record() (interface{}, error) {
+	if len(s.recs) == 0 {
+		return nil, io.EOF
+	}
+	rec := s.recs[0]
+	s.recs = s.recs[1:]
+	return rec, nil
+}
+
+func TestIngest(t *testing.T) {
+	src := &sliceSource{recs: []interface{}{
+		map[string]interface{}{"id": "a", "color": "red", "size": 3, "active": true},
+		map[string]interface{}{"id": "b", "color": "blue", "size": 5, "active": false},
+		map[string]interface{}{"id": "c", "color": "red", "size": 7},
+	}}
+	parser := pdk.NewDefaultGenericParser()
+	parser.EntitySubjecter = pdk.SubjectPath([]string{"id"})
+	mapper := pdk.NewCollapsingMapper()
+	mapper.BoolFields = true
+	mapper.ColTranslator = pdk.NewMapFieldTranslator()
+	idx := memindex.NewIndex()
+	ingester := pdk.NewIngester(src, parser, mapper, idx)
+	ingester.Stats = pdk.NopStatter{}
+	if err := ingester.Run(); err != nil {
+		t.Fatalf("running ingester: %v", err)
+	}
+
+	cols := make(map[string]uint64)
+	for _, subj := range []string{"a", "b", "c"} {
+		col, err := mapper.ColTranslator.GetID(subj)
+		if err != nil {
+			t.Fatalf("getting column for %s: %v", subj, err)
+		}
+		cols[subj] = col
+	}
+	red, err := mapper.Translator.GetID("color", "red")
+	if err != nil {
+		t.Fatalf("getting row id: %v", err)
+	}
+	if actual, expected := idx.Row("color", red), []uint64{cols["a"], cols["c"]}; !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %v in color=red, got %v", expected, actual)
+	}
+	if val, ok := idx.Value("size", cols["b"]); !ok || val != 5 {
+		t.Fatalf("expected size 5 for b, got %d, %v", val, ok)
+	}
+	if actual, expected := idx.Row("active", uint64(1)), []uint64{cols["a"]}; !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %v active, got %v", expected, actual)
+	}
+}
+
+func TestIndexAcknowledge(t *testing.T) {
+	idx := memindex.NewIndex()
+	acked := false
+	idx.Acknowledge(func(err error) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		acked = true
+	})
+	if !acked {
+		t.Fatal("expected acknowledgement straight away")
+	}
+}
@@ -0,0 +1,310 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pdk
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gopilosa "github.com/pilosa/go-pilosa"
+	"github.com/pkg/errors"
+)
+
+// MultiIndex is an Indexer which writes to any number of Pilosa indexes,
+// setting up an Index for each one (and creating it in Pilosa if necessary)
+// the first time it is used. All of the Indexes share one client. The Indexer
+// methods write to the default index, and IndexerFor gets the Indexer for
+// any other.
+type MultiIndex struct {
+	client       *gopilosa.Client
+	defaultIndex string
+	batchSize    uint
+	options      *pilosaOptions
+
+	mu      sync.Mutex
+	indexes map[string]*Index
+
+	ackLock sync.Mutex
+	acks    []func(err error)
+
+	stopFlushing chan struct{}
+	flushWG      sync.WaitGroup
+}
+
+var (
+	_ IndexRouter  = &MultiIndex{}
+	_ Acknowledger = &MultiIndex{}
+)
+
+// SetupMultiPilosa returns a new MultiIndex. defaultIndex may be empty if
+// every record names its index. It takes the same options as SetupPilosa,
+// which apply to every index.
+func SetupMultiPilosa(hosts []string, defaultIndex string, batchsize uint, options ...PilosaOption) (*MultiIndex, error) {
+	pilosaOptions := &pilosaOptions{}
+	for _, opt := range options {
+		if err := opt(pilosaOptions); err != nil {
+			return nil, errors.Wrap(err, "applying options")
+		}
+	}
+	client, err := gopilosa.NewClient(hosts, pilosaOptions.clientOpts()...)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating pilosa cluster client")
+	}
+	m := &MultiIndex{
+		client:       client,
+		defaultIndex: defaultIndex,
+		batchSize:    batchsize,
+		options:      pilosaOptions,
+		indexes:      make(map[string]*Index),
+	}
+	if defaultIndex != "" {
+		if _, err := m.index(defaultIndex); err != nil {
+			return nil, err
+		}
+	}
+	if pilosaOptions.flushInterval > 0 {
+		m.stopFlushing = make(chan struct{})
+		m.flushWG.Add(1)
+		go func() {
+			defer m.flushWG.Done()
+			autoFlush(pilosaOptions.flushInterval, m.stopFlushing, m.swapDirty, m.Flush)
+		}()
+	}
+	return m, nil
+}
+
+// IndexerFor implements IndexRouter.
+func (m *MultiIndex) IndexerFor(index string) (Indexer, error) {
+	return m.index(index)
+}
+
+// index returns the Index for the named index, setting it up if necessary.
+func (m *MultiIndex) index(name string) (*Index, error) {
+	if name == "" {
+		return nil, errors.New("no index given, and there is no default index")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if idx, ok := m.indexes[name]; ok {
+		return idx, nil
+	}
+	idx, err := setupIndex(m.client, gopilosa.NewSchema(), name, m.batchSize, m.options)
+	if err != nil {
+		return nil, errors.Wrapf(err, "setting up index '%s'", name)
+	}
+	m.indexes[name] = idx
+	return idx, nil
+}
+
+// allIndexes returns all the Indexes which have been set up, in order of
+// name.
+func (m *MultiIndex) allIndexes() []*Index {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.indexes))
+	for name := range m.indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	indexes := make([]*Index, len(names))
+	for i, name := range names {
+		indexes[i] = m.indexes[name]
+	}
+	return indexes
+}
+
+// AddColumn implements Indexer.
+func (m *MultiIndex) AddColumn(field string, col, row uint64OrString) error {
+	idx, err := m.index(m.defaultIndex)
+	if err != nil {
+		return err
+	}
+	return idx.AddColumn(field, col, row)
+}
+
+// AddColumnTimestamp implements Indexer.
+func (m *MultiIndex) AddColumnTimestamp(field string, col, row uint64OrString, ts time.Time) error {
+	idx, err := m.index(m.defaultIndex)
+	if err != nil {
+		return err
+	}
+	return idx.AddColumnTimestamp(field, col, row, ts)
+}
+
+// AddValue implements Indexer.
+func (m *MultiIndex) AddValue(field string, col uint64OrString, val int64) error {
+	idx, err := m.index(m.defaultIndex)
+	if err != nil {
+		return err
+	}
+	return idx.AddValue(field, col, val)
+}
+
+// AddMutex implements Indexer.
+func (m *MultiIndex) AddMutex(field string, col, row uint64OrString) error {
+	idx, err := m.index(m.defaultIndex)
+	if err != nil {
+		return err
+	}
+	return idx.AddMutex(field, col, row)
+}
+
+// AddBool implements Indexer.
+func (m *MultiIndex) AddBool(field string, col uint64OrString, val bool) error {
+	idx, err := m.index(m.defaultIndex)
+	if err != nil {
+		return err
+	}
+	return idx.AddBool(field, col, val)
+}
+
+// ClearColumn implements Indexer.
+func (m *MultiIndex) ClearColumn(field string, col, row uint64OrString) error {
+	idx, err := m.index(m.defaultIndex)
+	if err != nil {
+		return err
+	}
+	return idx.ClearColumn(field, col, row)
+}
+
+// ClearValue implements Indexer.
+func (m *MultiIndex) ClearValue(field string, col uint64OrString) error {
+	idx, err := m.index(m.defaultIndex)
+	if err != nil {
+		return err
+	}
+	return idx.ClearValue(field, col)
+}
+
+// AddRowAttr implements Indexer.
+func (m *MultiIndex) AddRowAttr(field string, row uint64OrString, key string, value interface{}) error {
+	idx, err := m.index(m.defaultIndex)
+	if err != nil {
+		return err
+	}
+	return idx.AddRowAttr(field, row, key, value)
+}
+
+// AddColAttr implements Indexer.
+func (m *MultiIndex) AddColAttr(col uint64OrString, key string, value interface{}) error {
+	idx, err := m.index(m.defaultIndex)
+	if err != nil {
+		return err
+	}
+	return idx.AddColAttr(col, key, value)
+}
+
+// Client implements Indexer. It returns the client shared by all the indexes.
+func (m *MultiIndex) Client() *gopilosa.Client {
+	return m.client
+}
+
+// Acknowledge implements Acknowledger. As with Index, acknowledgements are
+// collected until there are batchSize of them, and then called once
+// everything added to any index so far has been imported.
+func (m *MultiIndex) Acknowledge(ack func(err error)) {
+	m.ackLock.Lock()
+	m.acks = append(m.acks, ack)
+	if uint(len(m.acks)) < m.batchSize {
+		m.ackLock.Unlock()
+		return
+	}
+	acks := m.acks
+	m.acks = nil
+	m.ackLock.Unlock()
+	m.flush(acks)
+}
+
+// Flush implements Indexer. It flushes every index.
+func (m *MultiIndex) Flush() error {
+	m.ackLock.Lock()
+	acks := m.acks
+	m.acks = nil
+	m.ackLock.Unlock()
+	return m.flush(acks)
+}
+
+// swapDirty clears the dirty flags of all the indexes, returning whether any
+// were set.
+func (m *MultiIndex) swapDirty() bool {
+	dirty := false
+	for _, idx := range m.allIndexes() {
+		if idx.swapDirty() {
+			dirty = true
+		}
+	}
+	return dirty
+}
+
+// flush flushes every index, and then calls acks with the first error, which
+// it also returns.
+func (m *MultiIndex) flush(acks []func(err error)) error {
+	var err error
+	for _, idx := range m.allIndexes() {
+		if ferr := idx.Flush(); ferr != nil && err == nil {
+			err = errors.Wrapf(ferr, "flushing index '%s'", idx.index.Name())
+		}
+	}
+	for _, ack := range acks {
+		ack(err)
+	}
+	return err
+}
+
+// Close implements Indexer. It closes every index, and combines their errors.
+func (m *MultiIndex) Close() error {
+	if m.stopFlushing != nil {
+		close(m.stopFlushing)
+		m.flushWG.Wait()
+	}
+	m.ackLock.Lock()
+	acks := m.acks
+	m.acks = nil
+	m.ackLock.Unlock()
+	if len(acks) > 0 {
+		m.flush(acks)
+	}
+
+	var msgs []string
+	for _, idx := range m.allIndexes() {
+		if err := idx.Close(); err != nil {
+			msgs = append(msgs, errors.Wrapf(err, "index '%s'", idx.index.Name()).Error())
+		}
+	}
+	if len(msgs) > 0 {
+		return errors.Errorf("closing indexes: %s", strings.Join(msgs, "; "))
+	}
+	return nil
+}
@@ -37,6 +37,9 @@ import (
 	"log"
 	"os"
 	"reflect"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pilosa/pdk/termstat"
 	"github.com/pkg/errors"
@@ -46,6 +49,16 @@ import (
 // Parse method. At the top level it accepts a map or struct (or pointer or
 // interface holding one of these). It will only parse exported fields on
 // structs.
+//
+// Struct fields may carry a `pdk` tag of the form
+// `pdk:"name,omitempty,subject,field=foo,time=layout"` (or `pdk:"-"`). The
+// name renames the property (defaulting to the Go field name), "-" or
+// "ignore" skips the field, omitempty skips zero values, subject makes the
+// field's value the Entity's subject instead of a property, field pins the
+// Pilosa field the property is mapped to, and time parses a string field as a
+// Time using the given layout. Since layouts may contain commas, time must be
+// the last option. A subject tag on a top level struct takes precedence over
+// the Subjecter and EntitySubjecter.
 type GenericParser struct {
 	Subjecter       Subjecter
 	EntitySubjecter EntitySubjecter
@@ -55,6 +68,28 @@ type GenericParser struct {
 	// the entire record to fail.
 	Strict bool
 
+	// TimeLayouts are layouts (as for time.Parse) which strings are tried
+	// against in order. A string matching one of them is parsed as a Time
+	// rather than an S. time.Time values are always parsed as Times.
+	TimeLayouts []string
+
+	// InferTypes enables inferring the types of string values, for sources
+	// such as CSV which only produce strings. See InferType.
+	InferTypes bool
+
+	// InferSample is the number of records which are sampled before the
+	// inferred types of their columns are fixed (see SamplingParser).
+	// DefaultInferSample is used if it is zero.
+	InferSample int
+
+	// InferOverrides fixes the types of columns (keyed by their path joined
+	// with "."), rather than inferring them. It is used even if InferTypes
+	// is false.
+	InferOverrides map[string]InferType
+
+	inferMu   sync.RWMutex
+	inferCols map[string]*inferColumn
+
 	Stats Statter
 	Log   Logger
 }
@@ -83,15 +118,25 @@ func (p SubjectPath) Subject(e *Entity) (string, error) {
 		next = ent.Objects[Property(item)]
 	}
 	delete(prev.Objects, Property(item)) // remove the subject from the entity so that it isn't indexed
-	switch next.(type) {
+	return FormatSubject(next)
+}
+
+// FormatSubject formats a parsed literal as a subject, as SubjectPath and
+// subject struct tags do.
+func FormatSubject(obj Object) (string, error) {
+	switch obj.(type) {
 	case I, I8, I16, I32, I64, U, U8, U16, U32, U64:
-		return fmt.Sprintf("%d", next), nil
+		return fmt.Sprintf("%d", obj), nil
 	case F32, F64:
-		return fmt.Sprintf("%f", next), nil
+		return fmt.Sprintf("%f", obj), nil
 	case S:
-		return string(next.(S)), nil
+		return string(obj.(S)), nil
+	case Time:
+		return time.Time(obj.(Time)).Format(time.RFC3339Nano), nil
+	case IPv4, IPv6:
+		return fmt.Sprintf("%s", obj), nil
 	default:
-		return "", fmt.Errorf("can't make %v of type %T an IRI", next, next)
+		return "", fmt.Errorf("can't make %v of type %T an IRI", obj, obj)
 	}
 }
 
@@ -129,34 +174,54 @@ func NewDefaultGenericParser() *GenericParser {
 }
 
 // Parse of the GenericParser tries to parse any value into a pdk.Entity.
+//
+// Entities, such as those read from JSON-LD by the jsonld package, are passed
+// through as they are, so that they can be mapped again.
 func (m *GenericParser) Parse(data interface{}) (e *Entity, err error) {
-	val := reflect.ValueOf(data)
-	// dereference pointers, and get concrete values from interfaces
-	val = deref(val)
-	// Map and Struct are the only valid Kinds at the top level.
-	switch val.Kind() {
-	case reflect.Map:
-		e, err = m.parseMap(val)
-	case reflect.Struct:
-		e, err = m.parseStruct(val)
-	default:
-		e, err = nil, errors.Errorf("unsupported kind, '%v' in GenericParser: %v", val.Kind(), data)
+	switch data := data.(type) {
+	case *Entity:
+		return data, nil
+	case *EntityWithContext:
+		return &data.Entity, nil
 	}
+	// dereference pointers, and get concrete values from interfaces
+	val := deref(reflect.ValueOf(data))
+	e, err = m.parseData(val)
 	if err != nil {
 		return e, err
 	}
 	var subj string
-	if !m.SubjectAll {
+	if !m.SubjectAll && !(val.Kind() == reflect.Struct && hasSubjectTag(val.Type())) {
 		if m.EntitySubjecter != nil {
 			subj, err = m.EntitySubjecter.Subject(e)
 		} else {
 			subj, err = m.Subjecter.Subject(data)
 		}
 		e.Subject = IRI(subj)
+		if err != nil {
+			return e, err
+		}
+	}
+	if m.InferTypes || len(m.InferOverrides) > 0 {
+		err = m.infer(e, nil)
 	}
 	return e, err
 }
 
+// parseData parses a map or struct into an Entity, without getting its
+// subject or inferring types.
+func (m *GenericParser) parseData(val reflect.Value) (*Entity, error) {
+	val = deref(val)
+	// Map and Struct are the only valid Kinds at the top level.
+	switch val.Kind() {
+	case reflect.Map:
+		return m.parseMap(val)
+	case reflect.Struct:
+		return m.parseStruct(val)
+	}
+	return nil, errors.Errorf("unsupported kind, '%v' in GenericParser: %v", val.Kind(), val)
+}
+
 func deref(val reflect.Value) reflect.Value {
 	knd := val.Kind()
 	i := 0
@@ -208,34 +273,181 @@ func (m *GenericParser) parseMap(val reflect.Value) (*Entity, error) {
 
 func (m *GenericParser) parseStruct(val reflect.Value) (*Entity, error) {
 	ent := NewEntity()
-	subj, err := m.Subjecter.Subject(val.Interface())
-	if err != nil {
-		return nil, errors.Wrapf(err, "getting subject from '%v", val.Interface())
+	// a subject field takes the place of the Subjecter.
+	if !hasSubjectTag(val.Type()) {
+		subj, err := m.Subjecter.Subject(val.Interface())
+		if err != nil {
+			return nil, errors.Wrapf(err, "getting subject from '%v", val.Interface())
+		}
+		ent.Subject = IRI(subj)
 	}
-	ent.Subject = IRI(subj)
 
 	for i := 0; i < val.NumField(); i++ {
 		field := val.Type().Field(i)
 		if field.PkgPath != "" {
 			continue // this field is unexported, so we ignore it.
 		}
+		tag, err := ParseStructTag(field.Tag.Get("pdk"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing pdk tag on field '%v'", field.Name)
+		}
+		if tag.Ignore {
+			continue
+		}
 		fieldv := val.Field(i)
 		fieldv = deref(fieldv)
-		obj, err := m.parseValue(fieldv)
+		if tag.OmitEmpty && isEmptyValue(fieldv) {
+			continue
+		}
+		var obj Object
+		if tag.TimeLayout != "" {
+			obj, err = parseTimeValue(fieldv, tag.TimeLayout)
+		} else {
+			obj, err = m.parseValue(fieldv)
+		}
 		if err != nil {
 			if m.Strict {
 				return nil, errors.Wrapf(err, "parsing field:%v value:%v", field, fieldv)
 			}
 			continue
 		}
-		if _, ok := ent.Objects[Property(field.Name)]; ok {
+		if tag.Subject {
+			subj, err := FormatSubject(obj)
+			if err != nil {
+				return nil, errors.Wrapf(err, "getting subject from field '%v'", field.Name)
+			}
+			ent.Subject = IRI(subj)
+			continue
+		}
+		prop := Property(field.Name)
+		if tag.Name != "" {
+			prop = Property(tag.Name)
+		}
+		if _, ok := ent.Objects[prop]; ok {
 			return nil, errors.Errorf("unexpected name collision with struct field '%v", field.Name)
 		}
-		ent.Objects[Property(field.Name)] = obj
+		ent.Objects[prop] = obj
+		if tag.Field != "" {
+			if ent.Fields == nil {
+				ent.Fields = make(map[Property]string)
+			}
+			ent.Fields[prop] = tag.Field
+		}
 	}
 	return ent, nil
 }
 
+// StructTag holds the options of a parsed `pdk` struct tag. See
+// GenericParser.
+type StructTag struct {
+	Name       string
+	Ignore     bool
+	OmitEmpty  bool
+	Subject    bool
+	Field      string
+	TimeLayout string
+}
+
+// ParseStructTag parses the value of a `pdk` struct tag.
+func ParseStructTag(tag string) (StructTag, error) {
+	st := StructTag{}
+	if tag == "" {
+		return st, nil
+	}
+	if tag == "-" {
+		st.Ignore = true
+		return st, nil
+	}
+	parts := strings.Split(tag, ",")
+	st.Name = parts[0]
+	for i := 1; i < len(parts); i++ {
+		opt := parts[i]
+		switch {
+		case opt == "ignore":
+			st.Ignore = true
+		case opt == "omitempty":
+			st.OmitEmpty = true
+		case opt == "subject":
+			st.Subject = true
+		case strings.HasPrefix(opt, "field="):
+			st.Field = strings.TrimPrefix(opt, "field=")
+			if st.Field == "" {
+				return st, errors.New("empty field option")
+			}
+		case strings.HasPrefix(opt, "time="):
+			// the layout is the rest of the tag, since it may contain commas
+			st.TimeLayout = strings.TrimPrefix(strings.Join(parts[i:], ","), "time=")
+			if st.TimeLayout == "" {
+				return st, errors.New("empty time option")
+			}
+			return st, nil
+		default:
+			return st, errors.Errorf("unknown option '%s'", opt)
+		}
+	}
+	return st, nil
+}
+
+// hasSubjectTag reports whether any exported field of the struct type typ is
+// tagged as the subject.
+func hasSubjectTag(typ reflect.Type) bool {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		if tag, err := ParseStructTag(field.Tag.Get("pdk")); err == nil && tag.Subject && !tag.Ignore {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTimeValue parses a string (or time.Time) value as a Time using layout.
+func parseTimeValue(val reflect.Value, layout string) (Object, error) {
+	if val.IsValid() && val.Type() == timeType {
+		return Time(val.Interface().(time.Time)), nil
+	}
+	if val.Kind() != reflect.String {
+		return nil, errors.Errorf("can't parse kind %v as a time", val.Kind())
+	}
+	t, err := time.Parse(layout, val.String())
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing time")
+	}
+	return Time(t), nil
+}
+
+// isEmptyValue reports whether val is the zero value of its type (or invalid,
+// as for a nil pointer) for the purposes of omitempty.
+func isEmptyValue(val reflect.Value) bool {
+	switch val.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return val.Len() == 0
+	case reflect.Bool:
+		return !val.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return val.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return val.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return val.Float() == 0
+	case reflect.Struct:
+		if val.Type() == timeType {
+			return val.Interface().(time.Time).IsZero()
+		}
+	}
+	return false
+}
+
+// ParseValue parses a single value (a field of a struct, say) as Parse would,
+// returning a Literal, Objects or *Entity.
+func (m *GenericParser) ParseValue(v interface{}) (Object, error) {
+	return m.parseValue(deref(reflect.ValueOf(v)))
+}
+
 func (m *GenericParser) parseValue(val reflect.Value) (Object, error) {
 	switch k := val.Kind(); k {
 	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128, reflect.String:
@@ -245,6 +457,9 @@ func (m *GenericParser) parseValue(val reflect.Value) (Object, error) {
 		}
 		return lit, nil
 	case reflect.Map, reflect.Struct:
+		if val.Type() == timeType && val.CanInterface() {
+			return Time(val.Interface().(time.Time)), nil
+		}
 		return m.parseObj(val)
 	case reflect.Array, reflect.Slice:
 		return m.parseContainer(val)
@@ -260,6 +475,8 @@ func (m *GenericParser) parseValue(val reflect.Value) (Object, error) {
 
 }
 
+var timeType = reflect.TypeOf(time.Time{})
+
 // parseContainer parses arrays and slices.
 func (m *GenericParser) parseContainer(val reflect.Value) (Object, error) {
 	if dtype := val.Type(); dtype.Elem().Kind() == reflect.Uint8 {
@@ -328,13 +545,24 @@ func (m *GenericParser) parseLit(val reflect.Value) (Object, error) {
 		m.Stats.Count("parser.parseLit."+k.String(), 1, 1)
 		return nil, errors.New("nested slices/arrays of literals are not supported - parseLit should not be called with these kinds of values")
 	case reflect.String:
-		return S(val.String()), nil
+		return m.parseString(val.String()), nil
 	default:
 		m.Stats.Count("parser.parseLit."+k.String(), 1, 1)
 		return nil, errors.Errorf("kind %v is not supported", val.Kind())
 	}
 }
 
+// parseString returns a Time if s matches one of m.TimeLayouts, and an S
+// otherwise.
+func (m *GenericParser) parseString(s string) Object {
+	for _, layout := range m.TimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return Time(t)
+		}
+	}
+	return S(s)
+}
+
 func (m *GenericParser) parseObj(val reflect.Value) (Object, error) {
 	switch val.Kind() {
 	case reflect.Map:
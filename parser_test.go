@@ -37,6 +37,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/pilosa/pdk/fake"
 	"github.com/pilosa/pdk/mock"
@@ -318,3 +319,124 @@ func TestGenericParserWithStruct(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestGenericParserTimes(t *testing.T) {
+	gp := NewDefaultGenericParser()
+	gp.TimeLayouts = []string{"2006-01-02", time.RFC3339}
+	ts := time.Date(2019, time.June, 1, 12, 30, 0, 0, time.UTC)
+	testRec := map[string]interface{}{
+		"t":      ts,
+		"tp":     &ts,
+		"day":    "2019-06-01",
+		"rfc":    "2019-06-01T12:30:00Z",
+		"string": "2019",
+		"nested": struct{ When time.Time }{ts},
+	}
+	ent, err := gp.Parse(testRec)
+	if err != nil {
+		t.Fatalf("parsing: %v", err)
+	}
+	expected := map[Property]Object{
+		"t":      Time(ts),
+		"tp":     Time(ts),
+		"day":    Time(time.Date(2019, time.June, 1, 0, 0, 0, 0, time.UTC)),
+		"rfc":    Time(ts),
+		"string": S("2019"),
+		"nested": &Entity{Objects: map[Property]Object{"When": Time(ts)}},
+	}
+	if !reflect.DeepEqual(ent.Objects, expected) {
+		t.Fatalf("unexpected objects: %#v", ent.Objects)
+	}
+}
+
+type tagged struct {
+	ID       int      `pdk:",subject"`
+	Name     string   `pdk:"name"`
+	Nick     string   `pdk:"nick,omitempty"`
+	Secret   string   `pdk:"-"`
+	Skipped  string   `pdk:"skipped,ignore"`
+	Zone     string   `pdk:"zone,field=timezone"`
+	When     string   `pdk:"when,time=Jan 2, 2006"`
+	Tags     []string `pdk:"tags,omitempty"`
+	Inner    *O       `pdk:"inner,omitempty"`
+	Untagged time.Time
+}
+
+func TestGenericParserStructTags(t *testing.T) {
+	gp := NewDefaultGenericParser()
+	// the subject field takes the place of the Subjecter.
+	gp.Subjecter = SubjectFunc(func(d interface{}) (string, error) { return "", fmt.Errorf("Subjecter called for %T", d) })
+	rec := tagged{
+		ID:      7,
+		Name:    "sloth",
+		Secret:  "shh",
+		Skipped: "nope",
+		Zone:    "UTC",
+		When:    "Jun 1, 2019",
+	}
+	ent, err := gp.Parse(&rec)
+	if err != nil {
+		t.Fatalf("parsing: %v", err)
+	}
+	if ent.Subject != "7" {
+		t.Fatalf("expected subject 7, got '%v'", ent.Subject)
+	}
+	expected := map[Property]Object{
+		"name":     S("sloth"),
+		"zone":     S("UTC"),
+		"when":     Time(time.Date(2019, time.June, 1, 0, 0, 0, 0, time.UTC)),
+		"Untagged": Time(time.Time{}),
+	}
+	if !reflect.DeepEqual(ent.Objects, expected) {
+		t.Fatalf("unexpected objects: %#v", ent.Objects)
+	}
+	if !reflect.DeepEqual(ent.Fields, map[Property]string{"zone": "timezone"}) {
+		t.Fatalf("unexpected fields: %v", ent.Fields)
+	}
+
+	rec.When = "yesterday"
+	ent, err = gp.Parse(rec)
+	if err != nil {
+		t.Fatalf("parsing with bad time: %v", err)
+	}
+	if _, ok := ent.Objects["when"]; ok {
+		t.Fatalf("unparseable time should have been skipped: %v", ent.Objects)
+	}
+	gp.Strict = true
+	if _, err = gp.Parse(rec); err == nil {
+		t.Fatal("expected error parsing bad time in strict mode")
+	}
+
+	bad := struct {
+		A int `pdk:"a,bogus"`
+	}{}
+	if _, err = gp.Parse(bad); err == nil {
+		t.Fatal("expected error parsing unknown tag option")
+	}
+}
+
+func TestParseStructTag(t *testing.T) {
+	tests := []struct {
+		tag string
+		exp StructTag
+	}{
+		{tag: "", exp: StructTag{}},
+		{tag: "-", exp: StructTag{Ignore: true}},
+		{tag: "a,omitempty,subject", exp: StructTag{Name: "a", OmitEmpty: true, Subject: true}},
+		{tag: ",field=f,time=Jan 2, 2006", exp: StructTag{Field: "f", TimeLayout: "Jan 2, 2006"}},
+	}
+	for _, test := range tests {
+		st, err := ParseStructTag(test.tag)
+		if err != nil {
+			t.Fatalf("parsing '%s': %v", test.tag, err)
+		}
+		if st != test.exp {
+			t.Errorf("parsing '%s': expected %+v, got %+v", test.tag, test.exp, st)
+		}
+	}
+	for _, tag := range []string{"a,field=", "a,time=", "a,nope"} {
+		if _, err := ParseStructTag(tag); err == nil {
+			t.Errorf("expected error parsing '%s'", tag)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package parsergen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Main holds the options for the gen-parser subcommand.
+type Main struct {
+	Dir    string `help:"Directory of the Go package declaring the type."`
+	Type   string `help:"Name of the struct type to generate a parser for."`
+	Name   string `help:"Name of the generated parser type. Defaults to the type name followed by Parser."`
+	Output string `help:"File to write the parser to, relative to the package directory. Defaults to the lower cased type name followed by _pdkparser.go. Use - for stdout."`
+}
+
+// NewMain returns a new Main.
+func NewMain() *Main {
+	return &Main{
+		Dir: ".",
+	}
+}
+
+// Run generates the parser and writes it out.
+func (m *Main) Run() error {
+	src, err := Generate(Config{Dir: m.Dir, Type: m.Type, Name: m.Name})
+	if err != nil {
+		return errors.Wrap(err, "generating parser")
+	}
+	if m.Output == "-" {
+		_, err = os.Stdout.Write(src)
+		return errors.Wrap(err, "writing parser")
+	}
+	out := m.Output
+	if out == "" {
+		out = strings.ToLower(m.Type) + "_pdkparser.go"
+	}
+	if !filepath.IsAbs(out) {
+		out = filepath.Join(m.Dir, out)
+	}
+	return errors.Wrap(ioutil.WriteFile(out, src, 0644), "writing parser")
+}
@@ -0,0 +1,610 @@
+// Code generated by pdk gen-parser. DO NOT EDIT.
+
+package example
+
+import (
+	"time"
+
+	"github.com/pilosa/pdk"
+	"github.com/pkg/errors"
+)
+
+// EventParser parses Event records without reflection. It is a pdk.RecordParser
+// which returns the same Entities as Parser, and a pdk.DirectParser which
+// returns the same PilosaRecords as Parser followed by Mapper. Records which
+// aren't Events, and Parser settings which the generated code doesn't
+// implement (TimeLayouts, type inference and EntitySubjecter), are handled by
+// Parser and Mapper.
+type EventParser struct {
+	Parser *pdk.GenericParser
+	Mapper *pdk.CollapsingMapper
+}
+
+// NewEventParser returns a new EventParser using parser and mapper.
+func NewEventParser(parser *pdk.GenericParser, mapper *pdk.CollapsingMapper) *EventParser {
+	return &EventParser{Parser: parser, Mapper: mapper}
+}
+
+// RecordMapper implements pdk.DirectParser, and returns p.Mapper.
+func (p *EventParser) RecordMapper() pdk.RecordMapper {
+	return p.Mapper
+}
+
+// Parse implements pdk.RecordParser, and returns the same Entity as
+// p.Parser.Parse.
+func (p *EventParser) Parse(data interface{}) (*pdk.Entity, error) {
+	v, ok := p.record(data)
+	if !ok {
+		return p.Parser.Parse(data)
+	}
+	ent, err := p.entityEvent(v)
+	if err != nil {
+		return nil, err
+	}
+	return ent, nil
+}
+
+// ParseRecord implements pdk.DirectParser, and returns the same PilosaRecord
+// as p.Mapper.Map would for the Entity returned by p.Parser.Parse.
+func (p *EventParser) ParseRecord(data interface{}) (pdk.PilosaRecord, error) {
+	v, ok := p.record(data)
+	if !ok {
+		ent, err := p.Parser.Parse(data)
+		if err != nil {
+			return pdk.PilosaRecord{}, err
+		}
+		return p.Mapper.Map(ent)
+	}
+	var subj string
+	// ID
+	{
+		obj := pdk.S(v.ID)
+		s, err := pdk.FormatSubject(obj)
+		if err != nil {
+			return pdk.PilosaRecord{}, errors.Wrapf(err, "getting subject from field '%s'", "ID")
+		}
+		subj = s
+	}
+	pr, err := p.Mapper.NewRecord(pdk.IRI(subj))
+	if err != nil {
+		return pr, err
+	}
+	// Station
+	{
+		obj := pdk.S(v.Station)
+		if err := p.Mapper.MapObject(&pr, obj, "station"); err != nil {
+			return pr, errors.Wrap(err, "mapping entity")
+		}
+	}
+	// UserID
+	{
+		obj := pdk.I(v.UserID)
+		if err := p.Mapper.MapObject(&pr, obj, "user_id"); err != nil {
+			return pr, errors.Wrap(err, "mapping entity")
+		}
+	}
+	// Timestamp
+	{
+		obj, err := p.parseTime(string(v.Timestamp), "2006-01-02T15:04:05Z07:00")
+		if err != nil {
+			if p.Parser.Strict {
+				return pr, errors.Wrapf(err, "parsing field %s", "Timestamp")
+			}
+		} else {
+			if err := p.Mapper.MapObject(&pr, obj, "timestamp"); err != nil {
+				return pr, errors.Wrap(err, "mapping entity")
+			}
+		}
+	}
+	// Favorites
+	{
+		obj, err := p.obj1(v.Favorites)
+		if err != nil {
+			if p.Parser.Strict {
+				return pr, errors.Wrapf(err, "parsing field %s", "Favorites")
+			}
+		} else {
+			if err := p.Mapper.MapObject(&pr, obj, "favorites"); err != nil {
+				return pr, errors.Wrap(err, "mapping entity")
+			}
+		}
+	}
+	// Items
+	{
+		obj, err := p.obj2(v.Items)
+		if err != nil {
+			if p.Parser.Strict {
+				return pr, errors.Wrapf(err, "parsing field %s", "Items")
+			}
+		} else {
+			if err := p.Mapper.MapObject(&pr, obj, "items"); err != nil {
+				return pr, errors.Wrap(err, "mapping entity")
+			}
+		}
+	}
+	// Ranking
+	{
+		obj, err := p.obj3(v.Ranking)
+		if err != nil {
+			if p.Parser.Strict {
+				return pr, errors.Wrapf(err, "parsing field %s", "Ranking")
+			}
+		} else {
+			if err := p.Mapper.MapObject(&pr, obj, "ranking"); err != nil {
+				return pr, errors.Wrap(err, "mapping entity")
+			}
+		}
+	}
+	// IfaceThing
+	{
+		obj, err := p.Parser.ParseValue(v.IfaceThing)
+		if err != nil {
+			if p.Parser.Strict {
+				return pr, errors.Wrapf(err, "parsing field %s", "IfaceThing")
+			}
+		} else {
+			if err := p.Mapper.MapObject(&pr, obj, "ifacething"); err != nil {
+				return pr, errors.Wrap(err, "mapping entity")
+			}
+		}
+	}
+	// Velocity
+	{
+		obj := pdk.I(v.Velocity)
+		if err := p.Mapper.MapObject(&pr, obj, "velocity"); err != nil {
+			return pr, errors.Wrap(err, "mapping entity")
+		}
+	}
+	// Active
+	{
+		obj := pdk.B(v.Active)
+		if err := p.Mapper.MapObject(&pr, obj, "active"); err != nil {
+			return pr, errors.Wrap(err, "mapping entity")
+		}
+	}
+	// Alive
+	{
+		obj := pdk.B(v.Alive)
+		if err := p.Mapper.MapObject(&pr, obj, "alive"); err != nil {
+			return pr, errors.Wrap(err, "mapping entity")
+		}
+	}
+	// Deceased
+	{
+		obj := pdk.B(v.Deceased)
+		if err := p.Mapper.MapObject(&pr, obj, "deceasedBoolean"); err != nil {
+			return pr, errors.Wrap(err, "mapping entity")
+		}
+	}
+	// Geo
+	{
+		obj, err := p.obj4(&v.Geo)
+		if err != nil {
+			if p.Parser.Strict {
+				return pr, errors.Wrapf(err, "parsing field %s", "Geo")
+			}
+		} else {
+			if err := p.Mapper.MapObject(&pr, obj, "geo"); err != nil {
+				return pr, errors.Wrap(err, "mapping entity")
+			}
+		}
+	}
+	// Score
+	if !(v.Score == nil || (*v.Score) == 0) {
+		obj, err := p.obj5(v.Score)
+		if err != nil {
+			if p.Parser.Strict {
+				return pr, errors.Wrapf(err, "parsing field %s", "Score")
+			}
+		} else {
+			if err := p.Mapper.MapObject(&pr, obj, "score"); err != nil {
+				return pr, errors.Wrap(err, "mapping entity")
+			}
+		}
+	}
+	// Zone
+	if !(v.Zone == "") {
+		obj := pdk.S(v.Zone)
+		if err := p.Mapper.MapObject(&pr, obj, "timezone"); err != nil {
+			return pr, errors.Wrap(err, "mapping entity")
+		}
+	}
+	// Hash
+	{
+		obj := pdk.S(v.Hash[:])
+		if err := p.Mapper.MapObject(&pr, obj, "hash"); err != nil {
+			return pr, errors.Wrap(err, "mapping entity")
+		}
+	}
+	// Seen
+	if !(v.Seen.IsZero()) {
+		obj := pdk.Time(v.Seen)
+		if err := p.Mapper.MapObject(&pr, obj, "seen"); err != nil {
+			return pr, errors.Wrap(err, "mapping entity")
+		}
+	}
+	// Extra
+	if !(len(v.Extra) == 0) {
+		obj, err := p.Parser.ParseValue(v.Extra)
+		if err != nil {
+			if p.Parser.Strict {
+				return pr, errors.Wrapf(err, "parsing field %s", "Extra")
+			}
+		} else {
+			if err := p.Mapper.MapObject(&pr, obj, "extra"); err != nil {
+				return pr, errors.Wrap(err, "mapping entity")
+			}
+		}
+	}
+	// Meta
+	{
+		obj, err := p.obj6(v.Meta)
+		if err != nil {
+			if p.Parser.Strict {
+				return pr, errors.Wrapf(err, "parsing field %s", "Meta")
+			}
+		} else {
+			if err := p.Mapper.MapObject(&pr, obj, "Meta"); err != nil {
+				return pr, errors.Wrap(err, "mapping entity")
+			}
+		}
+	}
+	p.Mapper.FinishRecord(&pr)
+	return pr, nil
+}
+
+// record returns data as a *Event, or false if it isn't one or p.Parser has
+// settings which the generated code doesn't implement.
+func (p *EventParser) record(data interface{}) (*Event, bool) {
+	if p.Parser.EntitySubjecter != nil || len(p.Parser.TimeLayouts) > 0 || p.Parser.InferTypes || len(p.Parser.InferOverrides) > 0 {
+		return nil, false
+	}
+	switch v := data.(type) {
+	case *Event:
+		return v, v != nil
+	case Event:
+		return &v, true
+	}
+	return nil, false
+}
+
+// entityEvent parses an Event into an Entity.
+func (p *EventParser) entityEvent(v *Event) (*pdk.Entity, error) {
+	ent := pdk.NewEntity()
+	// ID
+	{
+		obj := pdk.S(v.ID)
+		s, err := pdk.FormatSubject(obj)
+		if err != nil {
+			return nil, errors.Wrapf(err, "getting subject from field '%s'", "ID")
+		}
+		ent.Subject = pdk.IRI(s)
+	}
+	// Station
+	{
+		obj := pdk.S(v.Station)
+		ent.Objects["station"] = obj
+	}
+	// UserID
+	{
+		obj := pdk.I(v.UserID)
+		ent.Objects["user_id"] = obj
+	}
+	// Timestamp
+	{
+		obj, err := p.parseTime(string(v.Timestamp), "2006-01-02T15:04:05Z07:00")
+		if err != nil {
+			if p.Parser.Strict {
+				return nil, errors.Wrapf(err, "parsing field %s", "Timestamp")
+			}
+		} else {
+			ent.Objects["timestamp"] = obj
+		}
+	}
+	// Favorites
+	{
+		obj, err := p.obj1(v.Favorites)
+		if err != nil {
+			if p.Parser.Strict {
+				return nil, errors.Wrapf(err, "parsing field %s", "Favorites")
+			}
+		} else {
+			ent.Objects["favorites"] = obj
+		}
+	}
+	// Items
+	{
+		obj, err := p.obj2(v.Items)
+		if err != nil {
+			if p.Parser.Strict {
+				return nil, errors.Wrapf(err, "parsing field %s", "Items")
+			}
+		} else {
+			ent.Objects["items"] = obj
+		}
+	}
+	// Ranking
+	{
+		obj, err := p.obj3(v.Ranking)
+		if err != nil {
+			if p.Parser.Strict {
+				return nil, errors.Wrapf(err, "parsing field %s", "Ranking")
+			}
+		} else {
+			ent.Objects["ranking"] = obj
+		}
+	}
+	// IfaceThing
+	{
+		obj, err := p.Parser.ParseValue(v.IfaceThing)
+		if err != nil {
+			if p.Parser.Strict {
+				return nil, errors.Wrapf(err, "parsing field %s", "IfaceThing")
+			}
+		} else {
+			ent.Objects["ifacething"] = obj
+		}
+	}
+	// Velocity
+	{
+		obj := pdk.I(v.Velocity)
+		ent.Objects["velocity"] = obj
+	}
+	// Active
+	{
+		obj := pdk.B(v.Active)
+		ent.Objects["active"] = obj
+	}
+	// Alive
+	{
+		obj := pdk.B(v.Alive)
+		ent.Objects["alive"] = obj
+	}
+	// Deceased
+	{
+		obj := pdk.B(v.Deceased)
+		ent.Objects["deceasedBoolean"] = obj
+	}
+	// Geo
+	{
+		obj, err := p.obj4(&v.Geo)
+		if err != nil {
+			if p.Parser.Strict {
+				return nil, errors.Wrapf(err, "parsing field %s", "Geo")
+			}
+		} else {
+			ent.Objects["geo"] = obj
+		}
+	}
+	// Score
+	if !(v.Score == nil || (*v.Score) == 0) {
+		obj, err := p.obj5(v.Score)
+		if err != nil {
+			if p.Parser.Strict {
+				return nil, errors.Wrapf(err, "parsing field %s", "Score")
+			}
+		} else {
+			ent.Objects["score"] = obj
+		}
+	}
+	// Zone
+	if !(v.Zone == "") {
+		obj := pdk.S(v.Zone)
+		ent.Objects["zone"] = obj
+		if ent.Fields == nil {
+			ent.Fields = make(map[pdk.Property]string)
+		}
+		ent.Fields["zone"] = "timezone"
+	}
+	// Hash
+	{
+		obj := pdk.S(v.Hash[:])
+		ent.Objects["hash"] = obj
+	}
+	// Seen
+	if !(v.Seen.IsZero()) {
+		obj := pdk.Time(v.Seen)
+		ent.Objects["seen"] = obj
+	}
+	// Extra
+	if !(len(v.Extra) == 0) {
+		obj, err := p.Parser.ParseValue(v.Extra)
+		if err != nil {
+			if p.Parser.Strict {
+				return nil, errors.Wrapf(err, "parsing field %s", "Extra")
+			}
+		} else {
+			ent.Objects["extra"] = obj
+		}
+	}
+	// Meta
+	{
+		obj, err := p.obj6(v.Meta)
+		if err != nil {
+			if p.Parser.Strict {
+				return nil, errors.Wrapf(err, "parsing field %s", "Meta")
+			}
+		} else {
+			ent.Objects["Meta"] = obj
+		}
+	}
+	return ent, nil
+}
+
+// parseTime parses s into a Time using layout.
+func (p *EventParser) parseTime(s, layout string) (pdk.Object, error) {
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing time")
+	}
+	return pdk.Time(t), nil
+}
+
+// obj1 parses a []string into an Object.
+func (p *EventParser) obj1(v []string) (pdk.Object, error) {
+	ret := make(pdk.Objects, len(v))
+	for i := range v {
+		ret[i] = pdk.S(v[i])
+	}
+	return ret, nil
+}
+
+// obj2 parses a []Item into an Object.
+func (p *EventParser) obj2(v []Item) (pdk.Object, error) {
+	ret := make(pdk.Objects, len(v))
+	for i := range v {
+		obj, err := p.obj7(&v[i])
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing value")
+		}
+		ret[i] = obj
+	}
+	return ret, nil
+}
+
+// obj3 parses a []*Item into an Object.
+func (p *EventParser) obj3(v []*Item) (pdk.Object, error) {
+	ret := make(pdk.Objects, len(v))
+	for i := range v {
+		obj, err := p.obj8(v[i])
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing value")
+		}
+		ret[i] = obj
+	}
+	return ret, nil
+}
+
+// obj4 parses a Geo into an Object.
+func (p *EventParser) obj4(v *Geo) (pdk.Object, error) {
+	ent, err := p.entityGeo(v)
+	if err != nil {
+		return nil, err
+	}
+	return ent, nil
+}
+
+// obj5 parses a *float64 into an Object.
+func (p *EventParser) obj5(v *float64) (pdk.Object, error) {
+	if v == nil {
+		return nil, errors.New("nil pointer")
+	}
+	return pdk.F64(*v), nil
+}
+
+// obj6 parses a *Meta into an Object.
+func (p *EventParser) obj6(v *Meta) (pdk.Object, error) {
+	if v == nil {
+		return nil, errors.New("nil pointer")
+	}
+	return p.obj9(v)
+}
+
+// obj7 parses an Item into an Object.
+func (p *EventParser) obj7(v *Item) (pdk.Object, error) {
+	ent, err := p.entityItem(v)
+	if err != nil {
+		return nil, err
+	}
+	return ent, nil
+}
+
+// obj8 parses a *Item into an Object.
+func (p *EventParser) obj8(v *Item) (pdk.Object, error) {
+	if v == nil {
+		return nil, errors.New("nil pointer")
+	}
+	return p.obj7(v)
+}
+
+// entityGeo parses a Geo into an Entity.
+func (p *EventParser) entityGeo(v *Geo) (*pdk.Entity, error) {
+	ent := pdk.NewEntity()
+	subj, err := p.Parser.Subjecter.Subject(*v)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting subject from '%v", *v)
+	}
+	ent.Subject = pdk.IRI(subj)
+	// TimeZone
+	{
+		obj := pdk.S(v.TimeZone)
+		ent.Objects["timezone"] = obj
+	}
+	// Longitude
+	{
+		obj := pdk.F64(v.Longitude)
+		ent.Objects["longitude"] = obj
+	}
+	// Latitude
+	{
+		obj := pdk.F64(v.Latitude)
+		ent.Objects["latitude"] = obj
+	}
+	return ent, nil
+}
+
+// obj9 parses a Meta into an Object.
+func (p *EventParser) obj9(v *Meta) (pdk.Object, error) {
+	ent, err := p.entityMeta(v)
+	if err != nil {
+		return nil, err
+	}
+	return ent, nil
+}
+
+// entityItem parses an Item into an Entity.
+func (p *EventParser) entityItem(v *Item) (*pdk.Entity, error) {
+	ent := pdk.NewEntity()
+	subj, err := p.Parser.Subjecter.Subject(*v)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting subject from '%v", *v)
+	}
+	ent.Subject = pdk.IRI(subj)
+	// Name
+	{
+		obj := pdk.S(v.Name)
+		ent.Objects["name"] = obj
+	}
+	// Value
+	{
+		obj := pdk.I(v.Value)
+		ent.Objects["value"] = obj
+	}
+	return ent, nil
+}
+
+// entityMeta parses a Meta into an Entity.
+func (p *EventParser) entityMeta(v *Meta) (*pdk.Entity, error) {
+	ent := pdk.NewEntity()
+	subj, err := p.Parser.Subjecter.Subject(*v)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting subject from '%v", *v)
+	}
+	ent.Subject = pdk.IRI(subj)
+	// Source
+	{
+		obj := pdk.S(v.Source)
+		ent.Objects["Source"] = obj
+	}
+	// Tags
+	if !(len(v.Tags) == 0) {
+		obj, err := p.obj10(v.Tags)
+		if err != nil {
+			if p.Parser.Strict {
+				return nil, errors.Wrapf(err, "parsing field %s", "Tags")
+			}
+		} else {
+			ent.Objects["Tags"] = obj
+		}
+	}
+	return ent, nil
+}
+
+// obj10 parses a Tags into an Object.
+func (p *EventParser) obj10(v Tags) (pdk.Object, error) {
+	ret := make(pdk.Objects, len(v))
+	for i := range v {
+		ret[i] = pdk.S(v[i])
+	}
+	return ret, nil
+}
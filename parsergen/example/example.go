@@ -0,0 +1,155 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+// Package example holds record types with parsers generated by pdk
+// gen-parser, which are used to test the generator, and to benchmark the
+// generated parsers against GenericParser and CollapsingMapper.
+package example
+
+import (
+	"time"
+
+	"github.com/pilosa/pdk/fake"
+)
+
+//go:generate pdk gen-parser --type Event --output event_pdkparser.go
+//go:generate pdk gen-parser --type User --output user_pdkparser.go
+//go:generate pdk gen-parser --type Visit --output visit_pdkparser.go
+
+// Event is fake.Event, with some extra fields to exercise the generator.
+type Event struct {
+	ID         string      `pdk:"id,subject"`
+	Station    string      `pdk:"station"`
+	UserID     int         `pdk:"user_id"`
+	Timestamp  string      `pdk:"timestamp,time=2006-01-02T15:04:05Z07:00"`
+	Favorites  []string    `pdk:"favorites"`
+	Items      []Item      `pdk:"items"`
+	Ranking    []*Item     `pdk:"ranking"`
+	IfaceThing interface{} `pdk:"ifacething"`
+	Velocity   int         `pdk:"velocity"`
+	Active     bool        `pdk:"active"`
+	Alive      bool        `pdk:"alive"`
+	Deceased   bool        `pdk:"deceasedBoolean"`
+	Geo        Geo         `pdk:"geo"`
+
+	Score  *float64               `pdk:"score,omitempty"`
+	Zone   string                 `pdk:"zone,field=timezone,omitempty"`
+	Hash   [4]byte                `pdk:"hash"`
+	Seen   time.Time              `pdk:"seen,omitempty"`
+	Extra  map[string]interface{} `pdk:"extra,omitempty"`
+	Secret string                 `pdk:"-"`
+	*Meta
+}
+
+// Geo is fake.Geo.
+type Geo struct {
+	TimeZone  string  `pdk:"timezone"`
+	Longitude float64 `pdk:"longitude"`
+	Latitude  float64 `pdk:"latitude"`
+}
+
+// Item is fake.Item.
+type Item struct {
+	Name  string `pdk:"name"`
+	Value int    `pdk:"value"`
+}
+
+// Meta is embedded in Event.
+type Meta struct {
+	Source string
+	Tags   Tags `pdk:",omitempty"`
+}
+
+// Tags is a named slice type.
+type Tags []string
+
+// User is fake.User.
+type User struct {
+	ID        uint64   `pdk:"id,subject"`
+	Age       int      `pdk:"age"`
+	FirstName string   `pdk:"firstname"`
+	LastName  string   `pdk:"lastname"`
+	Allergies []string `pdk:"allergies"`
+	Title     string   `pdk:"title"`
+}
+
+// Visit is a record without a subject field, so its subject comes from the
+// Subjecter.
+type Visit struct {
+	Station string `pdk:"station"`
+	UserID  int    `pdk:"user_id"`
+	Items   []Item `pdk:"items"`
+	Geo     *Geo   `pdk:"geo,omitempty"`
+}
+
+// NewEvent converts a fake.Event into an Event, filling in the extra fields
+// from it.
+func NewEvent(e *fake.Event) *Event {
+	ev := &Event{
+		ID:         e.ID,
+		Station:    e.Station,
+		UserID:     e.UserID,
+		Timestamp:  e.Timestamp,
+		Favorites:  e.Favorites,
+		IfaceThing: e.IfaceThing,
+		Velocity:   e.Velocity,
+		Active:     e.Active,
+		Alive:      e.Alive,
+		Deceased:   e.DeceasedBoolean,
+		Geo:        Geo(e.Geo),
+		Secret:     e.Station,
+	}
+	for _, it := range e.Items {
+		ev.Items = append(ev.Items, Item(it))
+	}
+	for _, it := range e.Ranking {
+		it := Item(it)
+		ev.Ranking = append(ev.Ranking, &it)
+	}
+	if e.Active {
+		score := float64(e.Velocity) / 7
+		ev.Score = &score
+		ev.Zone = e.Geo.TimeZone
+		ev.Meta = &Meta{Source: e.Station, Tags: e.Favorites}
+	}
+	if e.Alive {
+		ev.Extra = map[string]interface{}{"station": e.Station, "velocity": e.Velocity}
+		ev.Seen = time.Unix(int64(e.UserID), 0).UTC()
+	}
+	copy(ev.Hash[:], e.ID)
+	return ev
+}
+
+// NewUser converts a fake.User into a User.
+func NewUser(u *fake.User) *User {
+	return (*User)(u)
+}
@@ -0,0 +1,292 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package example_test
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pilosa/pdk"
+	"github.com/pilosa/pdk/fake"
+	"github.com/pilosa/pdk/parsergen/example"
+)
+
+func newParser() *pdk.GenericParser {
+	return &pdk.GenericParser{Subjecter: pdk.BlankSubjecter{}, Stats: pdk.NopStatter{}}
+}
+
+func newMapper() *pdk.CollapsingMapper {
+	m := pdk.NewCollapsingMapper()
+	m.Translator = nil
+	m.ColTranslator = nil
+	m.Nexter = nil
+	return m
+}
+
+// sortRecord sorts the parts of pr which the generic mapper builds in map
+// iteration order.
+func sortRecord(pr *pdk.PilosaRecord) {
+	sort.Slice(pr.Rows, func(i, j int) bool { return fmt.Sprint(pr.Rows[i]) < fmt.Sprint(pr.Rows[j]) })
+	sort.Slice(pr.Vals, func(i, j int) bool { return fmt.Sprint(pr.Vals[i]) < fmt.Sprint(pr.Vals[j]) })
+}
+
+// pathSubjecter is a Subjecter which gets the subject from the struct field at
+// a dotted path of field names, failing for records which don't have it.
+type pathSubjecter struct {
+	path  string
+	calls int
+}
+
+func (s *pathSubjecter) Subject(d interface{}) (string, error) {
+	s.calls++
+	v := reflect.Indirect(reflect.ValueOf(d))
+	for _, name := range strings.Split(s.path, ".") {
+		if v.Kind() != reflect.Struct {
+			return "", fmt.Errorf("no %s in %T", s.path, d)
+		}
+		v = reflect.Indirect(v.FieldByName(name))
+	}
+	if !v.IsValid() {
+		return "", fmt.Errorf("no %s in %T", s.path, d)
+	}
+	return fmt.Sprint(v.Interface()), nil
+}
+
+type parser interface {
+	pdk.RecordParser
+	pdk.DirectParser
+}
+
+func testEquivalence(t *testing.T, recs []interface{}, newGenerated func(*pdk.GenericParser, *pdk.CollapsingMapper) parser) {
+	settings := map[string]func(*pdk.GenericParser, *pdk.CollapsingMapper){
+		"default": func(*pdk.GenericParser, *pdk.CollapsingMapper) {},
+		"strict":  func(p *pdk.GenericParser, m *pdk.CollapsingMapper) { p.Strict = true },
+		"subjecter": func(p *pdk.GenericParser, m *pdk.CollapsingMapper) {
+			p.Subjecter = pdk.SubjectFunc(func(d interface{}) (string, error) { return fmt.Sprintf("%T", d), nil })
+		},
+		"subjectAll": func(p *pdk.GenericParser, m *pdk.CollapsingMapper) {
+			p.SubjectAll = true
+			p.Subjecter = pdk.SubjectFunc(func(d interface{}) (string, error) { return fmt.Sprintf("%T", d), nil })
+		},
+		"path": func(p *pdk.GenericParser, m *pdk.CollapsingMapper) {
+			p.Subjecter = &pathSubjecter{path: "Station"}
+		},
+		"pathStrict": func(p *pdk.GenericParser, m *pdk.CollapsingMapper) {
+			p.Strict = true
+			p.Subjecter = &pathSubjecter{path: "Station"}
+		},
+		"pathSubjectAll": func(p *pdk.GenericParser, m *pdk.CollapsingMapper) {
+			p.SubjectAll = true
+			p.Subjecter = &pathSubjecter{path: "Station"}
+		},
+		"mapper": func(p *pdk.GenericParser, m *pdk.CollapsingMapper) {
+			m.BoolFields = true
+			m.MutexFields = []string{"station", "title"}
+			m.AttrFields = []string{"lastname", "geo-timezone"}
+			m.ListModes = map[string]pdk.ListMode{"items": pdk.ListPositional, "favorites": pdk.ListCount}
+			m.TimestampField = "timestamp"
+		},
+		"fallback": func(p *pdk.GenericParser, m *pdk.CollapsingMapper) {
+			p.TimeLayouts = []string{"2006-01-02"}
+		},
+	}
+	for name, set := range settings {
+		t.Run(name, func(t *testing.T) {
+			gp, gm := newParser(), newMapper()
+			set(gp, gm)
+			gen := newGenerated(gp, gm)
+			for _, rec := range recs {
+				expEnt, expErr := gp.Parse(rec)
+				ent, err := gen.Parse(rec)
+				if (err != nil) != (expErr != nil) {
+					t.Fatalf("parsing %#v: expected error %v, got %v", rec, expErr, err)
+				}
+				if !reflect.DeepEqual(ent, expEnt) {
+					t.Fatalf("parsing %#v: expected entity\n%#v\ngot\n%#v", rec, expEnt, ent)
+				}
+				if expErr != nil {
+					continue
+				}
+				expPR, expErr := gm.Map(expEnt)
+				pr, err := gen.ParseRecord(rec)
+				if (err != nil) != (expErr != nil) {
+					t.Fatalf("mapping %#v: expected error %v, got %v", rec, expErr, err)
+				}
+				sortRecord(&expPR)
+				sortRecord(&pr)
+				if !reflect.DeepEqual(pr, expPR) {
+					t.Fatalf("mapping %#v: expected record\n%#v\ngot\n%#v", rec, expPR, pr)
+				}
+			}
+		})
+	}
+}
+
+func events(n int) []interface{} {
+	g := fake.NewEventGenerator(7)
+	recs := make([]interface{}, n)
+	for i := range recs {
+		ev := example.NewEvent(g.Event())
+		if i%2 == 0 {
+			recs[i] = *ev
+		} else {
+			recs[i] = ev
+		}
+	}
+	return recs
+}
+
+func users(n int) []interface{} {
+	g := fake.NewUserGenerator(7)
+	recs := make([]interface{}, n)
+	for i := range recs {
+		u := g.Record()
+		u.ID = uint64(i)
+		recs[i] = example.NewUser(u)
+	}
+	return recs
+}
+
+func visits(n int) []interface{} {
+	g := fake.NewEventGenerator(7)
+	recs := make([]interface{}, n)
+	for i := range recs {
+		ev := example.NewEvent(g.Event())
+		v := &example.Visit{Station: ev.Station, UserID: ev.UserID, Items: ev.Items}
+		if ev.Active {
+			v.Geo = &ev.Geo
+		}
+		if i%2 == 0 {
+			recs[i] = *v
+		} else {
+			recs[i] = v
+		}
+	}
+	return recs
+}
+
+func TestEventParser(t *testing.T) {
+	recs := events(200)
+	recs = append(recs, &example.Event{Timestamp: "yesterday", Ranking: []*example.Item{nil}}, map[string]interface{}{"id": "a"})
+	testEquivalence(t, recs, func(p *pdk.GenericParser, m *pdk.CollapsingMapper) parser {
+		return example.NewEventParser(p, m)
+	})
+}
+
+func TestUserParser(t *testing.T) {
+	testEquivalence(t, users(200), func(p *pdk.GenericParser, m *pdk.CollapsingMapper) parser {
+		return example.NewUserParser(p, m)
+	})
+}
+
+func TestVisitParser(t *testing.T) {
+	recs := visits(200)
+	recs = append(recs, &example.Visit{}, map[string]interface{}{"station": "a"})
+	testEquivalence(t, recs, func(p *pdk.GenericParser, m *pdk.CollapsingMapper) parser {
+		return example.NewVisitParser(p, m)
+	})
+}
+
+func TestParseRecordSubjecter(t *testing.T) {
+	for _, test := range []struct {
+		rec   interface{}
+		subj  string
+		calls int
+	}{
+		// the subject field is used instead of the Subjecter.
+		{rec: &example.User{ID: 3, Title: "s1"}, subj: "3", calls: 0},
+		{rec: &example.Visit{Station: "s2"}, subj: "s2", calls: 1},
+	} {
+		subjecter := &pathSubjecter{path: "Station"}
+		p := newParser()
+		p.Subjecter = subjecter
+		var gen pdk.DirectParser = example.NewUserParser(p, newMapper())
+		if _, ok := test.rec.(*example.Visit); ok {
+			gen = example.NewVisitParser(p, newMapper())
+		}
+		pr, err := gen.ParseRecord(test.rec)
+		if err != nil {
+			t.Fatalf("parsing %#v: %v", test.rec, err)
+		}
+		if pr.Col != test.subj {
+			t.Errorf("parsing %#v: expected column %s, got %v", test.rec, test.subj, pr.Col)
+		}
+		if subjecter.calls != test.calls {
+			t.Errorf("parsing %#v: expected %d calls to the Subjecter, got %d", test.rec, test.calls, subjecter.calls)
+		}
+	}
+}
+
+func benchmarkGeneric(b *testing.B, recs []interface{}) {
+	p, m := newParser(), newMapper()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ent, err := p.Parse(recs[i%len(recs)])
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := m.Map(ent); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkGenerated(b *testing.B, recs []interface{}, p pdk.DirectParser) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.ParseRecord(recs[i%len(recs)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEventGeneric(b *testing.B) {
+	benchmarkGeneric(b, events(1000))
+}
+
+func BenchmarkEventGenerated(b *testing.B) {
+	benchmarkGenerated(b, events(1000), example.NewEventParser(newParser(), newMapper()))
+}
+
+func BenchmarkUserGeneric(b *testing.B) {
+	benchmarkGeneric(b, users(1000))
+}
+
+func BenchmarkUserGenerated(b *testing.B) {
+	benchmarkGenerated(b, users(1000), example.NewUserParser(newParser(), newMapper()))
+}
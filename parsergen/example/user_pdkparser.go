@@ -0,0 +1,183 @@
+// Code generated by pdk gen-parser. DO NOT EDIT.
+
+package example
+
+import (
+	"github.com/pilosa/pdk"
+	"github.com/pkg/errors"
+)
+
+// UserParser parses User records without reflection. It is a pdk.RecordParser
+// which returns the same Entities as Parser, and a pdk.DirectParser which
+// returns the same PilosaRecords as Parser followed by Mapper. Records which
+// aren't Users, and Parser settings which the generated code doesn't
+// implement (TimeLayouts, type inference and EntitySubjecter), are handled by
+// Parser and Mapper.
+type UserParser struct {
+	Parser *pdk.GenericParser
+	Mapper *pdk.CollapsingMapper
+}
+
+// NewUserParser returns a new UserParser using parser and mapper.
+func NewUserParser(parser *pdk.GenericParser, mapper *pdk.CollapsingMapper) *UserParser {
+	return &UserParser{Parser: parser, Mapper: mapper}
+}
+
+// RecordMapper implements pdk.DirectParser, and returns p.Mapper.
+func (p *UserParser) RecordMapper() pdk.RecordMapper {
+	return p.Mapper
+}
+
+// Parse implements pdk.RecordParser, and returns the same Entity as
+// p.Parser.Parse.
+func (p *UserParser) Parse(data interface{}) (*pdk.Entity, error) {
+	v, ok := p.record(data)
+	if !ok {
+		return p.Parser.Parse(data)
+	}
+	ent, err := p.entityUser(v)
+	if err != nil {
+		return nil, err
+	}
+	return ent, nil
+}
+
+// ParseRecord implements pdk.DirectParser, and returns the same PilosaRecord
+// as p.Mapper.Map would for the Entity returned by p.Parser.Parse.
+func (p *UserParser) ParseRecord(data interface{}) (pdk.PilosaRecord, error) {
+	v, ok := p.record(data)
+	if !ok {
+		ent, err := p.Parser.Parse(data)
+		if err != nil {
+			return pdk.PilosaRecord{}, err
+		}
+		return p.Mapper.Map(ent)
+	}
+	var subj string
+	// ID
+	{
+		obj := pdk.U64(v.ID)
+		s, err := pdk.FormatSubject(obj)
+		if err != nil {
+			return pdk.PilosaRecord{}, errors.Wrapf(err, "getting subject from field '%s'", "ID")
+		}
+		subj = s
+	}
+	pr, err := p.Mapper.NewRecord(pdk.IRI(subj))
+	if err != nil {
+		return pr, err
+	}
+	// Age
+	{
+		obj := pdk.I(v.Age)
+		if err := p.Mapper.MapObject(&pr, obj, "age"); err != nil {
+			return pr, errors.Wrap(err, "mapping entity")
+		}
+	}
+	// FirstName
+	{
+		obj := pdk.S(v.FirstName)
+		if err := p.Mapper.MapObject(&pr, obj, "firstname"); err != nil {
+			return pr, errors.Wrap(err, "mapping entity")
+		}
+	}
+	// LastName
+	{
+		obj := pdk.S(v.LastName)
+		if err := p.Mapper.MapObject(&pr, obj, "lastname"); err != nil {
+			return pr, errors.Wrap(err, "mapping entity")
+		}
+	}
+	// Allergies
+	{
+		obj, err := p.obj1(v.Allergies)
+		if err != nil {
+			if p.Parser.Strict {
+				return pr, errors.Wrapf(err, "parsing field %s", "Allergies")
+			}
+		} else {
+			if err := p.Mapper.MapObject(&pr, obj, "allergies"); err != nil {
+				return pr, errors.Wrap(err, "mapping entity")
+			}
+		}
+	}
+	// Title
+	{
+		obj := pdk.S(v.Title)
+		if err := p.Mapper.MapObject(&pr, obj, "title"); err != nil {
+			return pr, errors.Wrap(err, "mapping entity")
+		}
+	}
+	p.Mapper.FinishRecord(&pr)
+	return pr, nil
+}
+
+// record returns data as a *User, or false if it isn't one or p.Parser has
+// settings which the generated code doesn't implement.
+func (p *UserParser) record(data interface{}) (*User, bool) {
+	if p.Parser.EntitySubjecter != nil || len(p.Parser.TimeLayouts) > 0 || p.Parser.InferTypes || len(p.Parser.InferOverrides) > 0 {
+		return nil, false
+	}
+	switch v := data.(type) {
+	case *User:
+		return v, v != nil
+	case User:
+		return &v, true
+	}
+	return nil, false
+}
+
+// entityUser parses an User into an Entity.
+func (p *UserParser) entityUser(v *User) (*pdk.Entity, error) {
+	ent := pdk.NewEntity()
+	// ID
+	{
+		obj := pdk.U64(v.ID)
+		s, err := pdk.FormatSubject(obj)
+		if err != nil {
+			return nil, errors.Wrapf(err, "getting subject from field '%s'", "ID")
+		}
+		ent.Subject = pdk.IRI(s)
+	}
+	// Age
+	{
+		obj := pdk.I(v.Age)
+		ent.Objects["age"] = obj
+	}
+	// FirstName
+	{
+		obj := pdk.S(v.FirstName)
+		ent.Objects["firstname"] = obj
+	}
+	// LastName
+	{
+		obj := pdk.S(v.LastName)
+		ent.Objects["lastname"] = obj
+	}
+	// Allergies
+	{
+		obj, err := p.obj1(v.Allergies)
+		if err != nil {
+			if p.Parser.Strict {
+				return nil, errors.Wrapf(err, "parsing field %s", "Allergies")
+			}
+		} else {
+			ent.Objects["allergies"] = obj
+		}
+	}
+	// Title
+	{
+		obj := pdk.S(v.Title)
+		ent.Objects["title"] = obj
+	}
+	return ent, nil
+}
+
+// obj1 parses a []string into an Object.
+func (p *UserParser) obj1(v []string) (pdk.Object, error) {
+	ret := make(pdk.Objects, len(v))
+	for i := range v {
+		ret[i] = pdk.S(v[i])
+	}
+	return ret, nil
+}
@@ -0,0 +1,267 @@
+// Code generated by pdk gen-parser. DO NOT EDIT.
+
+package example
+
+import (
+	"github.com/pilosa/pdk"
+	"github.com/pkg/errors"
+)
+
+// VisitParser parses Visit records without reflection. It is a pdk.RecordParser
+// which returns the same Entities as Parser, and a pdk.DirectParser which
+// returns the same PilosaRecords as Parser followed by Mapper. Records which
+// aren't Visits, and Parser settings which the generated code doesn't
+// implement (TimeLayouts, type inference and EntitySubjecter), are handled by
+// Parser and Mapper.
+type VisitParser struct {
+	Parser *pdk.GenericParser
+	Mapper *pdk.CollapsingMapper
+}
+
+// NewVisitParser returns a new VisitParser using parser and mapper.
+func NewVisitParser(parser *pdk.GenericParser, mapper *pdk.CollapsingMapper) *VisitParser {
+	return &VisitParser{Parser: parser, Mapper: mapper}
+}
+
+// RecordMapper implements pdk.DirectParser, and returns p.Mapper.
+func (p *VisitParser) RecordMapper() pdk.RecordMapper {
+	return p.Mapper
+}
+
+// Parse implements pdk.RecordParser, and returns the same Entity as
+// p.Parser.Parse.
+func (p *VisitParser) Parse(data interface{}) (*pdk.Entity, error) {
+	v, ok := p.record(data)
+	if !ok {
+		return p.Parser.Parse(data)
+	}
+	ent, err := p.entityVisit(v)
+	if err != nil {
+		return nil, err
+	}
+	if !p.Parser.SubjectAll {
+		subj, err := p.Parser.Subjecter.Subject(data)
+		ent.Subject = pdk.IRI(subj)
+		if err != nil {
+			return ent, err
+		}
+	}
+	return ent, nil
+}
+
+// ParseRecord implements pdk.DirectParser, and returns the same PilosaRecord
+// as p.Mapper.Map would for the Entity returned by p.Parser.Parse.
+func (p *VisitParser) ParseRecord(data interface{}) (pdk.PilosaRecord, error) {
+	v, ok := p.record(data)
+	if !ok {
+		ent, err := p.Parser.Parse(data)
+		if err != nil {
+			return pdk.PilosaRecord{}, err
+		}
+		return p.Mapper.Map(ent)
+	}
+	var subj string
+	if p.Parser.SubjectAll {
+		s, err := p.Parser.Subjecter.Subject(*v)
+		if err != nil {
+			return pdk.PilosaRecord{}, errors.Wrapf(err, "getting subject from '%v", *v)
+		}
+		subj = s
+	} else {
+		s, err := p.Parser.Subjecter.Subject(data)
+		if err != nil {
+			return pdk.PilosaRecord{}, err
+		}
+		subj = s
+	}
+	pr, err := p.Mapper.NewRecord(pdk.IRI(subj))
+	if err != nil {
+		return pr, err
+	}
+	// Station
+	{
+		obj := pdk.S(v.Station)
+		if err := p.Mapper.MapObject(&pr, obj, "station"); err != nil {
+			return pr, errors.Wrap(err, "mapping entity")
+		}
+	}
+	// UserID
+	{
+		obj := pdk.I(v.UserID)
+		if err := p.Mapper.MapObject(&pr, obj, "user_id"); err != nil {
+			return pr, errors.Wrap(err, "mapping entity")
+		}
+	}
+	// Items
+	{
+		obj, err := p.obj1(v.Items)
+		if err != nil {
+			if p.Parser.Strict {
+				return pr, errors.Wrapf(err, "parsing field %s", "Items")
+			}
+		} else {
+			if err := p.Mapper.MapObject(&pr, obj, "items"); err != nil {
+				return pr, errors.Wrap(err, "mapping entity")
+			}
+		}
+	}
+	// Geo
+	if !(v.Geo == nil) {
+		obj, err := p.obj2(v.Geo)
+		if err != nil {
+			if p.Parser.Strict {
+				return pr, errors.Wrapf(err, "parsing field %s", "Geo")
+			}
+		} else {
+			if err := p.Mapper.MapObject(&pr, obj, "geo"); err != nil {
+				return pr, errors.Wrap(err, "mapping entity")
+			}
+		}
+	}
+	p.Mapper.FinishRecord(&pr)
+	return pr, nil
+}
+
+// record returns data as a *Visit, or false if it isn't one or p.Parser has
+// settings which the generated code doesn't implement.
+func (p *VisitParser) record(data interface{}) (*Visit, bool) {
+	if p.Parser.EntitySubjecter != nil || len(p.Parser.TimeLayouts) > 0 || p.Parser.InferTypes || len(p.Parser.InferOverrides) > 0 {
+		return nil, false
+	}
+	switch v := data.(type) {
+	case *Visit:
+		return v, v != nil
+	case Visit:
+		return &v, true
+	}
+	return nil, false
+}
+
+// entityVisit parses a Visit into an Entity.
+func (p *VisitParser) entityVisit(v *Visit) (*pdk.Entity, error) {
+	ent := pdk.NewEntity()
+	subj, err := p.Parser.Subjecter.Subject(*v)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting subject from '%v", *v)
+	}
+	ent.Subject = pdk.IRI(subj)
+	// Station
+	{
+		obj := pdk.S(v.Station)
+		ent.Objects["station"] = obj
+	}
+	// UserID
+	{
+		obj := pdk.I(v.UserID)
+		ent.Objects["user_id"] = obj
+	}
+	// Items
+	{
+		obj, err := p.obj1(v.Items)
+		if err != nil {
+			if p.Parser.Strict {
+				return nil, errors.Wrapf(err, "parsing field %s", "Items")
+			}
+		} else {
+			ent.Objects["items"] = obj
+		}
+	}
+	// Geo
+	if !(v.Geo == nil) {
+		obj, err := p.obj2(v.Geo)
+		if err != nil {
+			if p.Parser.Strict {
+				return nil, errors.Wrapf(err, "parsing field %s", "Geo")
+			}
+		} else {
+			ent.Objects["geo"] = obj
+		}
+	}
+	return ent, nil
+}
+
+// obj1 parses a []Item into an Object.
+func (p *VisitParser) obj1(v []Item) (pdk.Object, error) {
+	ret := make(pdk.Objects, len(v))
+	for i := range v {
+		obj, err := p.obj3(&v[i])
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing value")
+		}
+		ret[i] = obj
+	}
+	return ret, nil
+}
+
+// obj2 parses a *Geo into an Object.
+func (p *VisitParser) obj2(v *Geo) (pdk.Object, error) {
+	if v == nil {
+		return nil, errors.New("nil pointer")
+	}
+	return p.obj4(v)
+}
+
+// obj3 parses an Item into an Object.
+func (p *VisitParser) obj3(v *Item) (pdk.Object, error) {
+	ent, err := p.entityItem(v)
+	if err != nil {
+		return nil, err
+	}
+	return ent, nil
+}
+
+// obj4 parses a Geo into an Object.
+func (p *VisitParser) obj4(v *Geo) (pdk.Object, error) {
+	ent, err := p.entityGeo(v)
+	if err != nil {
+		return nil, err
+	}
+	return ent, nil
+}
+
+// entityItem parses an Item into an Entity.
+func (p *VisitParser) entityItem(v *Item) (*pdk.Entity, error) {
+	ent := pdk.NewEntity()
+	subj, err := p.Parser.Subjecter.Subject(*v)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting subject from '%v", *v)
+	}
+	ent.Subject = pdk.IRI(subj)
+	// Name
+	{
+		obj := pdk.S(v.Name)
+		ent.Objects["name"] = obj
+	}
+	// Value
+	{
+		obj := pdk.I(v.Value)
+		ent.Objects["value"] = obj
+	}
+	return ent, nil
+}
+
+// entityGeo parses a Geo into an Entity.
+func (p *VisitParser) entityGeo(v *Geo) (*pdk.Entity, error) {
+	ent := pdk.NewEntity()
+	subj, err := p.Parser.Subjecter.Subject(*v)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting subject from '%v", *v)
+	}
+	ent.Subject = pdk.IRI(subj)
+	// TimeZone
+	{
+		obj := pdk.S(v.TimeZone)
+		ent.Objects["timezone"] = obj
+	}
+	// Longitude
+	{
+		obj := pdk.F64(v.Longitude)
+		ent.Objects["longitude"] = obj
+	}
+	// Latitude
+	{
+		obj := pdk.F64(v.Latitude)
+		ent.Objects["latitude"] = obj
+	}
+	return ent, nil
+}
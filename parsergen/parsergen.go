@@ -0,0 +1,824 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+// Package parsergen generates parsers for Go struct types which do the work of
+// a pdk.GenericParser and pdk.CollapsingMapper without reflection, and
+// without building an Entity when mapping straight to a PilosaRecord. It
+// backs the pdk gen-parser subcommand.
+//
+// Generated parsers follow the same rules (including pdk struct tags) as
+// GenericParser, and fall back to it for interface and map values, and for
+// GenericParser settings they don't implement (TimeLayouts, type inference and
+// EntitySubjecter). Parsers can only be generated from Go types, not from JSON
+// or Avro schemas.
+package parsergen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pilosa/pdk"
+	"github.com/pkg/errors"
+)
+
+// Config describes the parser to generate.
+type Config struct {
+	// Dir is the directory of the package which declares the type.
+	Dir string
+
+	// Type is the name of the struct type to generate a parser for.
+	Type string
+
+	// Name is the name of the generated parser type. It defaults to Type
+	// followed by "Parser".
+	Name string
+}
+
+// Generate returns the source of a parser for the type described by c, to be
+// added to the package in c.Dir.
+func Generate(c Config) ([]byte, error) {
+	if c.Type == "" {
+		return nil, errors.New("no type given")
+	}
+	if c.Name == "" {
+		c.Name = c.Type + "Parser"
+	}
+	g := &generator{
+		cfg:     c,
+		fset:    token.NewFileSet(),
+		specs:   make(map[string]*typeSpec),
+		structs: make(map[string]*structType),
+		funcs:   make(map[string]string),
+	}
+	if err := g.load(); err != nil {
+		return nil, errors.Wrap(err, "loading package")
+	}
+	spec, ok := g.specs[c.Type]
+	if !ok {
+		return nil, errors.Errorf("type %s not found in %s", c.Type, c.Dir)
+	}
+	typ, err := g.resolve(ast.NewIdent(c.Type), spec.imports)
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolving %s", c.Type)
+	}
+	if typ.kind != kindStruct {
+		return nil, errors.Errorf("%s is not a struct type", c.Type)
+	}
+	src, err := g.generate(typ)
+	if err != nil {
+		return nil, err
+	}
+	out, err := format.Source(src)
+	if err != nil {
+		return nil, errors.Wrapf(err, "formatting generated code:\n%s", src)
+	}
+	return out, nil
+}
+
+// typeSpec is a type declared in the package, along with the imports of the
+// file declaring it.
+type typeSpec struct {
+	expr    ast.Expr
+	imports map[string]string
+}
+
+type kind int
+
+const (
+	kindLit    kind = iota // a bool, number or string
+	kindBytes              // a byte slice or array, parsed as a string
+	kindTime               // time.Time
+	kindStruct             // a struct declared in the package
+	kindPtr                // a pointer
+	kindList               // a slice or array
+	kindValue              // an interface or map, parsed by GenericParser.ParseValue
+)
+
+// goType is a resolved field type.
+type goType struct {
+	kind kind
+	// expr is the Go source for the type.
+	expr string
+	// lit is the pdk Literal type of kindLit types.
+	lit string
+	// array is set for kindBytes and kindList types which are arrays, and
+	// isMap for kindValue types which are maps.
+	array bool
+	isMap bool
+	elem  *goType
+	strct *structType
+}
+
+type structType struct {
+	name   string
+	fields []*structField
+}
+
+// hasSubject reports whether st has a subject field, which takes the place of
+// the Subjecter.
+func (st *structType) hasSubject() bool {
+	for _, f := range st.fields {
+		if f.tag.Subject {
+			return true
+		}
+	}
+	return false
+}
+
+type structField struct {
+	goName string
+	prop   string
+	typ    *goType
+	tag    pdk.StructTag
+}
+
+// literals maps the names of basic types to the pdk Literals GenericParser
+// parses them as.
+var literals = map[string]string{
+	"bool":    "B",
+	"int":     "I",
+	"int8":    "I8",
+	"int16":   "I16",
+	"int32":   "I32",
+	"rune":    "I32",
+	"int64":   "I64",
+	"uint":    "U",
+	"uint8":   "U8",
+	"byte":    "U8",
+	"uint16":  "U16",
+	"uint32":  "U32",
+	"uint64":  "U64",
+	"float32": "F32",
+	"float64": "F64",
+	"string":  "S",
+}
+
+type generator struct {
+	cfg     Config
+	fset    *token.FileSet
+	pkg     string
+	specs   map[string]*typeSpec
+	structs map[string]*structType
+
+	// funcs holds the names of the helper functions which have been
+	// generated, keyed by what they do, and body holds their code.
+	funcs    map[string]string
+	queue    []pendingFunc
+	objs     int
+	body     bytes.Buffer
+	usesTime bool
+}
+
+// load parses the non-test Go files in the package directory and collects
+// their type declarations.
+func (g *generator) load() error {
+	pkgs, err := parser.ParseDir(g.fset, g.cfg.Dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return err
+	}
+	if len(pkgs) != 1 {
+		return errors.Errorf("expected one package in %s, found %d", g.cfg.Dir, len(pkgs))
+	}
+	for name, pkg := range pkgs {
+		g.pkg = name
+		for _, file := range pkg.Files {
+			imports := make(map[string]string)
+			for _, imp := range file.Imports {
+				path, err := strconv.Unquote(imp.Path.Value)
+				if err != nil {
+					return errors.Wrap(err, "unquoting import")
+				}
+				name := path[strings.LastIndex(path, "/")+1:]
+				if imp.Name != nil {
+					name = imp.Name.Name
+				}
+				imports[name] = path
+			}
+			for _, decl := range file.Decls {
+				gd, ok := decl.(*ast.GenDecl)
+				if !ok || gd.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gd.Specs {
+					ts := spec.(*ast.TypeSpec)
+					g.specs[ts.Name.Name] = &typeSpec{expr: ts.Type, imports: imports}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// exprString returns the Go source for expr.
+func (g *generator) exprString(expr ast.Expr) string {
+	buf := &bytes.Buffer{}
+	_ = printer.Fprint(buf, g.fset, expr)
+	return buf.String()
+}
+
+// resolve works out how GenericParser would treat values of the type expr.
+func (g *generator) resolve(expr ast.Expr, imports map[string]string) (*goType, error) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if lit, ok := literals[e.Name]; ok {
+			return &goType{kind: kindLit, expr: e.Name, lit: lit}, nil
+		}
+		if e.Name == "error" {
+			return &goType{kind: kindValue, expr: e.Name}, nil
+		}
+		spec, ok := g.specs[e.Name]
+		if !ok {
+			return nil, errors.Errorf("unsupported type %s", e.Name)
+		}
+		if _, ok := spec.expr.(*ast.StructType); ok {
+			return g.resolveStruct(e.Name, spec)
+		}
+		under, err := g.resolve(spec.expr, spec.imports)
+		if err != nil {
+			return nil, errors.Wrapf(err, "resolving %s", e.Name)
+		}
+		named := *under
+		named.expr = e.Name
+		if under.kind == kindTime {
+			// a named time.Time isn't a time.Time, so it's parsed as a
+			// struct without any exported fields.
+			named.kind = kindValue
+		}
+		return &named, nil
+	case *ast.SelectorExpr:
+		if pkg, ok := e.X.(*ast.Ident); ok && imports[pkg.Name] == "time" && e.Sel.Name == "Time" {
+			g.usesTime = true
+			return &goType{kind: kindTime, expr: "time.Time"}, nil
+		}
+		return nil, errors.Errorf("unsupported type %s from another package", g.exprString(e))
+	case *ast.StarExpr:
+		elem, err := g.resolve(e.X, imports)
+		if err != nil {
+			return nil, err
+		}
+		return &goType{kind: kindPtr, expr: "*" + elem.expr, elem: elem}, nil
+	case *ast.ArrayType:
+		elem, err := g.resolve(e.Elt, imports)
+		if err != nil {
+			return nil, err
+		}
+		t := &goType{kind: kindList, elem: elem, array: e.Len != nil}
+		if t.array {
+			t.expr = "[" + g.exprString(e.Len) + "]" + elem.expr
+		} else {
+			t.expr = "[]" + elem.expr
+		}
+		if elem.kind == kindLit && elem.lit == "U8" {
+			if elem.expr != "byte" && elem.expr != "uint8" {
+				return nil, errors.Errorf("unsupported type %s", t.expr)
+			}
+			t.kind = kindBytes
+		}
+		return t, nil
+	case *ast.MapType, *ast.InterfaceType:
+		var err error
+		ast.Inspect(e, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok && err == nil {
+				err = errors.Errorf("unsupported type %s from another package", g.exprString(sel))
+			}
+			return err == nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		_, isMap := e.(*ast.MapType)
+		return &goType{kind: kindValue, expr: g.exprString(e), isMap: isMap}, nil
+	case *ast.StructType:
+		return nil, errors.New("anonymous structs are not supported, declare a named type")
+	}
+	return nil, errors.Errorf("unsupported type %s", g.exprString(expr))
+}
+
+// resolveStruct resolves the fields of the named struct type, following the
+// same rules as GenericParser.
+func (g *generator) resolveStruct(name string, spec *typeSpec) (*goType, error) {
+	if st, ok := g.structs[name]; ok {
+		return &goType{kind: kindStruct, expr: name, strct: st}, nil
+	}
+	st := &structType{name: name}
+	g.structs[name] = st
+	props := make(map[string]bool)
+	for _, f := range spec.expr.(*ast.StructType).Fields.List {
+		var tag pdk.StructTag
+		if f.Tag != nil {
+			raw, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return nil, errors.Wrap(err, "unquoting struct tag")
+			}
+			tag, err = pdk.ParseStructTag(reflect.StructTag(raw).Get("pdk"))
+			if err != nil {
+				return nil, errors.Wrapf(err, "parsing pdk tag in %s", name)
+			}
+		}
+		names := make([]string, 0, len(f.Names))
+		for _, ident := range f.Names {
+			names = append(names, ident.Name)
+		}
+		if len(names) == 0 {
+			names = append(names, embeddedName(f.Type))
+		}
+		for _, goName := range names {
+			if !ast.IsExported(goName) || tag.Ignore {
+				continue
+			}
+			typ, err := g.resolve(f.Type, spec.imports)
+			if err != nil {
+				return nil, errors.Wrapf(err, "field %s.%s (tag it `pdk:\"-\"` to skip it)", name, goName)
+			}
+			if err := checkField(typ, tag); err != nil {
+				return nil, errors.Wrapf(err, "field %s.%s", name, goName)
+			}
+			prop := goName
+			if tag.Name != "" {
+				prop = tag.Name
+			}
+			if !tag.Subject {
+				if props[prop] {
+					return nil, errors.Errorf("name collision at %s.%s", name, goName)
+				}
+				props[prop] = true
+			}
+			st.fields = append(st.fields, &structField{goName: goName, prop: prop, typ: typ, tag: tag})
+		}
+	}
+	return &goType{kind: kindStruct, expr: name, strct: st}, nil
+}
+
+// embeddedName returns the field name of an embedded type.
+func embeddedName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.StarExpr:
+		return embeddedName(e.X)
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	}
+	return ""
+}
+
+// checkField checks that the options in tag can be used with typ.
+func checkField(typ *goType, tag pdk.StructTag) error {
+	if tag.TimeLayout != "" && typ.kind != kindTime && !(typ.kind == kindLit && typ.lit == "S") {
+		return errors.Errorf("time layout given for %s, which is not a string or time.Time", typ.expr)
+	}
+	for t := typ; t != nil; t = t.elem {
+		if tag.OmitEmpty && t.kind == kindValue && !t.isMap {
+			return errors.Errorf("omitempty is not supported for interface type %s", t.expr)
+		}
+		if t.kind != kindPtr {
+			break
+		}
+	}
+	return nil
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.body, format, args...)
+}
+
+// generate generates the parser for the struct type typ.
+func (g *generator) generate(typ *goType) ([]byte, error) {
+	name, rec := g.cfg.Name, typ.expr
+	entity := g.entityFunc(typ.strct)
+	hasSubject := typ.strct.hasSubject()
+
+	g.printf(`
+// Parse implements pdk.RecordParser, and returns the same Entity as
+// p.Parser.Parse.
+func (p *%[1]s) Parse(data interface{}) (*pdk.Entity, error) {
+	v, ok := p.record(data)
+	if !ok {
+		return p.Parser.Parse(data)
+	}
+	ent, err := p.%[2]s(v)
+	if err != nil {
+		return nil, err
+	}
+`, name, entity)
+	if !hasSubject {
+		g.printf(`	if !p.Parser.SubjectAll {
+		subj, err := p.Parser.Subjecter.Subject(data)
+		ent.Subject = pdk.IRI(subj)
+		if err != nil {
+			return ent, err
+		}
+	}
+`)
+	}
+	g.printf(`	return ent, nil
+}
+
+// ParseRecord implements pdk.DirectParser, and returns the same PilosaRecord
+// as p.Mapper.Map would for the Entity returned by p.Parser.Parse.
+func (p *%[1]s) ParseRecord(data interface{}) (pdk.PilosaRecord, error) {
+	v, ok := p.record(data)
+	if !ok {
+		ent, err := p.Parser.Parse(data)
+		if err != nil {
+			return pdk.PilosaRecord{}, err
+		}
+		return p.Mapper.Map(ent)
+	}
+	var subj string
+`, name)
+	if hasSubject {
+		for _, f := range typ.strct.fields {
+			if f.tag.Subject {
+				g.field(f, "pdk.PilosaRecord{}", `s, err := pdk.FormatSubject(obj)
+if err != nil {
+	return pdk.PilosaRecord{}, errors.Wrapf(err, "getting subject from field '%s'", "`+f.goName+`")
+}
+subj = s`)
+			}
+		}
+	} else {
+		g.printf(`	if p.Parser.SubjectAll {
+		s, err := p.Parser.Subjecter.Subject(*v)
+		if err != nil {
+			return pdk.PilosaRecord{}, errors.Wrapf(err, "getting subject from '%%v", *v)
+		}
+		subj = s
+	} else {
+		s, err := p.Parser.Subjecter.Subject(data)
+		if err != nil {
+			return pdk.PilosaRecord{}, err
+		}
+		subj = s
+	}
+`)
+	}
+	g.printf(`	pr, err := p.Mapper.NewRecord(pdk.IRI(subj))
+	if err != nil {
+		return pr, err
+	}
+`)
+	for _, f := range typ.strct.fields {
+		if f.tag.Subject {
+			continue
+		}
+		path := strconv.Quote(f.prop)
+		if f.tag.Field != "" {
+			path = strconv.Quote(f.tag.Field)
+		}
+		g.field(f, "pr", `if err := p.Mapper.MapObject(&pr, obj, `+path+`); err != nil {
+	return pr, errors.Wrap(err, "mapping entity")
+}`)
+	}
+	g.printf(`	p.Mapper.FinishRecord(&pr)
+	return pr, nil
+}
+
+// record returns data as a *%[2]s, or false if it isn't one or p.Parser has
+// settings which the generated code doesn't implement.
+func (p *%[1]s) record(data interface{}) (*%[2]s, bool) {
+	if p.Parser.EntitySubjecter != nil || len(p.Parser.TimeLayouts) > 0 || p.Parser.InferTypes || len(p.Parser.InferOverrides) > 0 {
+		return nil, false
+	}
+	switch v := data.(type) {
+	case *%[2]s:
+		return v, v != nil
+	case %[2]s:
+		return &v, true
+	}
+	return nil, false
+}
+`, name, rec)
+	g.drain()
+
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "// Code generated by pdk gen-parser. DO NOT EDIT.\n\npackage %s\n\nimport (\n", g.pkg)
+	if g.usesTime {
+		fmt.Fprintf(out, "\t\"time\"\n\n")
+	}
+	fmt.Fprintf(out, `	"github.com/pilosa/pdk"
+	"github.com/pkg/errors"
+)
+
+// %[1]s parses %[2]s records without reflection. It is a pdk.RecordParser
+// which returns the same Entities as Parser, and a pdk.DirectParser which
+// returns the same PilosaRecords as Parser followed by Mapper. Records which
+// aren't %[2]ss, and Parser settings which the generated code doesn't
+// implement (TimeLayouts, type inference and EntitySubjecter), are handled by
+// Parser and Mapper.
+type %[1]s struct {
+	Parser *pdk.GenericParser
+	Mapper *pdk.CollapsingMapper
+}
+
+// New%[1]s returns a new %[1]s using parser and mapper.
+func New%[1]s(parser *pdk.GenericParser, mapper *pdk.CollapsingMapper) *%[1]s {
+	return &%[1]s{Parser: parser, Mapper: mapper}
+}
+
+// RecordMapper implements pdk.DirectParser, and returns p.Mapper.
+func (p *%[1]s) RecordMapper() pdk.RecordMapper {
+	return p.Mapper
+}
+`, name, rec)
+	out.Write(g.body.Bytes())
+	return out.Bytes(), nil
+}
+
+// pendingFunc is a helper function which has been named but not yet
+// generated.
+type pendingFunc struct {
+	name string
+	gen  func(name string)
+}
+
+// helper returns the name of the helper function identified by key, arranging
+// for it to be generated by gen if it hasn't been already.
+func (g *generator) helper(key, name string, gen func(name string)) string {
+	if fn, ok := g.funcs[key]; ok {
+		return fn
+	}
+	if name == "" {
+		g.objs++
+		name = fmt.Sprintf("obj%d", g.objs)
+	}
+	g.funcs[key] = name
+	g.queue = append(g.queue, pendingFunc{name: name, gen: gen})
+	return name
+}
+
+// drain generates the queued helper functions, along with any they need.
+func (g *generator) drain() {
+	for len(g.queue) > 0 {
+		next := g.queue[0]
+		g.queue = g.queue[1:]
+		next.gen(next.name)
+	}
+}
+
+// entityFunc returns the name of a function which parses an *st into an
+// Entity as GenericParser does.
+func (g *generator) entityFunc(st *structType) string {
+	return g.helper("entity:"+st.name, "entity"+st.name, func(fn string) {
+		g.printf(`
+// %[2]s parses %[3]s into an Entity.
+func (p *%[1]s) %[2]s(v *%[4]s) (*pdk.Entity, error) {
+	ent := pdk.NewEntity()
+`, g.cfg.Name, fn, article(st.name), st.name)
+		if !st.hasSubject() {
+			g.printf(`	subj, err := p.Parser.Subjecter.Subject(*v)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting subject from '%%v", *v)
+	}
+	ent.Subject = pdk.IRI(subj)
+`)
+		}
+		for _, f := range st.fields {
+			if f.tag.Subject {
+				g.field(f, "nil", `s, err := pdk.FormatSubject(obj)
+if err != nil {
+	return nil, errors.Wrapf(err, "getting subject from field '%s'", "`+f.goName+`")
+}
+ent.Subject = pdk.IRI(s)`)
+				continue
+			}
+			sink := fmt.Sprintf("ent.Objects[%q] = obj", f.prop)
+			if f.tag.Field != "" {
+				sink += fmt.Sprintf(`
+if ent.Fields == nil {
+	ent.Fields = make(map[pdk.Property]string)
+}
+ent.Fields[%q] = %q`, f.prop, f.tag.Field)
+			}
+			g.field(f, "nil", sink)
+		}
+		g.printf("\treturn ent, nil\n}\n")
+	})
+}
+
+// field generates code which parses the field f of v into obj and runs sink,
+// or skips the field if it can't be parsed, unless the parser is strict, in
+// which case zero and the error are returned.
+func (g *generator) field(f *structField, zero, sink string) {
+	x := "v." + f.goName
+	expr, fallible := g.objExpr(f.typ, x)
+	if f.tag.TimeLayout != "" && f.typ.kind != kindTime {
+		expr, fallible = fmt.Sprintf("p.%s(string(%s), %q)", g.timeFunc(), x, f.tag.TimeLayout), true
+	}
+	g.printf("\t// %s\n", f.goName)
+	closing := "\t}\n"
+	if empty := emptyExpr(f.typ, x); f.tag.OmitEmpty && empty != "" {
+		g.printf("\tif !(%s) {\n", empty)
+	} else {
+		g.printf("\t{\n")
+	}
+	if fallible {
+		g.printf(`obj, err := %s
+if err != nil {
+	if p.Parser.Strict {
+		return %s, errors.Wrapf(err, "parsing field %%s", %q)
+	}
+} else {
+%s
+}
+`, expr, zero, f.goName, sink)
+	} else {
+		g.printf("obj := %s\n%s\n", expr, sink)
+	}
+	g.body.WriteString(closing)
+}
+
+// objExpr returns an expression which parses x, of type t, into an Object,
+// and whether the expression also returns an error.
+func (g *generator) objExpr(t *goType, x string) (string, bool) {
+	if x == "(*v)" {
+		switch t.kind {
+		case kindLit, kindTime, kindValue:
+			x = "*v"
+		case kindStruct:
+			return fmt.Sprintf("p.%s(v)", g.structFunc(t)), true
+		}
+	}
+	switch t.kind {
+	case kindLit:
+		return fmt.Sprintf("pdk.%s(%s)", t.lit, x), false
+	case kindBytes:
+		if t.array {
+			return fmt.Sprintf("pdk.S(%s[:])", x), false
+		}
+		return fmt.Sprintf("pdk.S(%s)", x), false
+	case kindTime:
+		return fmt.Sprintf("pdk.Time(%s)", x), false
+	case kindStruct:
+		return fmt.Sprintf("p.%s(&%s)", g.structFunc(t), x), true
+	case kindPtr:
+		return fmt.Sprintf("p.%s(%s)", g.ptrFunc(t), x), true
+	case kindList:
+		if t.array {
+			return fmt.Sprintf("p.%s(&%s)", g.listFunc(t), x), true
+		}
+		return fmt.Sprintf("p.%s(%s)", g.listFunc(t), x), true
+	}
+	return fmt.Sprintf("p.Parser.ParseValue(%s)", x), true
+}
+
+// structFunc returns the name of a function parsing a pointer to the struct
+// type t into an Object.
+func (g *generator) structFunc(t *goType) string {
+	return g.helper("struct:"+t.expr, "", func(fn string) {
+		g.printf(`
+// %[2]s parses %[4]s into an Object.
+func (p *%[1]s) %[2]s(v *%[3]s) (pdk.Object, error) {
+	ent, err := p.%[5]s(v)
+	if err != nil {
+		return nil, err
+	}
+	return ent, nil
+}
+`, g.cfg.Name, fn, t.expr, article(t.expr), g.entityFunc(t.strct))
+	})
+}
+
+// ptrFunc returns the name of a function parsing values of the pointer type
+// t into Objects.
+func (g *generator) ptrFunc(t *goType) string {
+	return g.helper("ptr:"+t.expr, "", func(fn string) {
+		g.printf(`
+// %[2]s parses %[4]s into an Object.
+func (p *%[1]s) %[2]s(v %[3]s) (pdk.Object, error) {
+	if v == nil {
+		return nil, errors.New("nil pointer")
+	}
+`, g.cfg.Name, fn, t.expr, article(t.expr))
+		expr, fallible := g.objExpr(t.elem, "(*v)")
+		if fallible {
+			g.printf("\treturn %s\n}\n", expr)
+		} else {
+			g.printf("\treturn %s, nil\n}\n", expr)
+		}
+	})
+}
+
+// listFunc returns the name of a function parsing values of the slice type
+// t (or pointers to the array type t) into Objects.
+func (g *generator) listFunc(t *goType) string {
+	return g.helper("list:"+t.expr, "", func(fn string) {
+		param := t.expr
+		if t.array {
+			param = "*" + param
+		}
+		g.printf(`
+// %[2]s parses %[4]s into an Object.
+func (p *%[1]s) %[2]s(v %[3]s) (pdk.Object, error) {
+	ret := make(pdk.Objects, len(v))
+	for i := range v {
+`, g.cfg.Name, fn, param, article(t.expr))
+		expr, fallible := g.objExpr(t.elem, "v[i]")
+		if fallible {
+			g.printf(`obj, err := %s
+if err != nil {
+	return nil, errors.Wrap(err, "parsing value")
+}
+ret[i] = obj
+`, expr)
+		} else {
+			g.printf("ret[i] = %s\n", expr)
+		}
+		g.printf("\t}\n\treturn ret, nil\n}\n")
+	})
+}
+
+// timeFunc returns the name of a function parsing a string with a layout
+// into a Time.
+func (g *generator) timeFunc() string {
+	g.usesTime = true
+	return g.helper("time", "parseTime", func(fn string) {
+		g.printf(`
+// %[2]s parses s into a Time using layout.
+func (p *%[1]s) %[2]s(s, layout string) (pdk.Object, error) {
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing time")
+	}
+	return pdk.Time(t), nil
+}
+`, g.cfg.Name, fn)
+	})
+}
+
+// article returns typ preceded by "a" or "an".
+func article(typ string) string {
+	if strings.IndexAny(typ[:1], "AEIOUaeiou") == 0 {
+		return "an " + typ
+	}
+	return "a " + typ
+}
+
+// emptyExpr returns an expression which is true if x, of type t, is empty
+// for the purposes of omitempty, or "" if it can never be empty.
+func emptyExpr(t *goType, x string) string {
+	switch t.kind {
+	case kindLit:
+		switch t.lit {
+		case "B":
+			return "!" + x
+		case "S":
+			return x + ` == ""`
+		}
+		return x + " == 0"
+	case kindBytes, kindList:
+		return "len(" + x + ") == 0"
+	case kindValue:
+		if t.isMap {
+			return "len(" + x + ") == 0"
+		}
+	case kindTime:
+		return x + ".IsZero()"
+	case kindPtr:
+		if elem := emptyExpr(t.elem, "(*"+x+")"); elem != "" {
+			return x + " == nil || " + elem
+		}
+		return x + " == nil"
+	}
+	return ""
+}
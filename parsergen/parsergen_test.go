@@ -0,0 +1,94 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package parsergen
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateExample(t *testing.T) {
+	for typ, file := range map[string]string{"Event": "event_pdkparser.go", "User": "user_pdkparser.go", "Visit": "visit_pdkparser.go"} {
+		src, err := Generate(Config{Dir: "example", Type: typ})
+		if err != nil {
+			t.Fatalf("generating %s parser: %v", typ, err)
+		}
+		exp, err := ioutil.ReadFile(filepath.Join("example", file))
+		if err != nil {
+			t.Fatalf("reading %s: %v", file, err)
+		}
+		if !bytes.Equal(src, exp) {
+			t.Errorf("%s is out of date, run go generate in parsergen/example", file)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		typ  string
+		err  string
+	}{
+		{name: "missing", src: "type T struct{}", typ: "U", err: "not found"},
+		{name: "notstruct", src: "type T int", typ: "T", err: "not a struct"},
+		{name: "chan", src: "type T struct{ C chan int }", typ: "T", err: "field T.C"},
+		{name: "package", src: "import \"net\"\ntype T struct{ IP net.IP }", typ: "T", err: "another package"},
+		{name: "anonymous", src: "type T struct{ S struct{ A int } }", typ: "T", err: "anonymous"},
+		{name: "time", src: "type T struct{ A int `pdk:\"a,time=2006\"`}", typ: "T", err: "time layout"},
+		{name: "omitempty", src: "type T struct{ A interface{} `pdk:\"a,omitempty\"`}", typ: "T", err: "omitempty"},
+		{name: "collision", src: "type T struct{ A int `pdk:\"b\"`; B int `pdk:\"b\"` }", typ: "T", err: "collision"},
+		{name: "tag", src: "type T struct{ A int `pdk:\"a,nope\"` }", typ: "T", err: "unknown option"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "parsergen")
+			if err != nil {
+				t.Fatalf("creating temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			err = ioutil.WriteFile(filepath.Join(dir, "t.go"), []byte("package t\n"+test.src+"\n"), 0600)
+			if err != nil {
+				t.Fatalf("writing source: %v", err)
+			}
+			_, err = Generate(Config{Dir: dir, Type: test.typ})
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error containing '%s', got %v", test.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,633 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pdk
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidPath is returned (wrapped) by CompilePath for malformed
+// expressions.
+var ErrInvalidPath = errors.New("invalid path expression")
+
+// Path is a compiled path expression which selects Objects in an Entity. The
+// syntax is a subset of JSONPath (https://goessner.net/articles/JsonPath/):
+//
+//	$                the root Entity (optional at the start of an expression)
+//	.name            the property "name" of an Entity
+//	['name']         the same, for names containing '.', '[' or spaces
+//	[n]              the nth item of a list of Objects, counting from the end
+//	                 if n is negative
+//	.* or [*]        every property of an Entity, or every item of a list
+//	..name, ..*      like .name or .*, but at any depth
+//
+// So "$.items[*].category" selects the category of every item, and
+// "$.geo.lat" (or just "geo.lat") the latitude of geo. The properties of an
+// Entity matched by a wildcard are visited in sorted order, so results are
+// deterministic.
+//
+// A Path is safe for concurrent use.
+type Path struct {
+	expr  string
+	steps []pathStep
+}
+
+type stepKind int
+
+const (
+	stepName stepKind = iota
+	stepIndex
+	stepWildcard
+)
+
+type pathStep struct {
+	kind      stepKind
+	name      Property
+	index     int
+	recursive bool
+}
+
+// CompilePath parses a path expression into a Path which can be used to
+// query Entities.
+func CompilePath(expr string) (*Path, error) {
+	p := &Path{expr: expr}
+	s := strings.TrimSpace(expr)
+	if strings.HasPrefix(s, "$") {
+		s = s[1:]
+	} else if s != "" && s[0] != '.' && s[0] != '[' {
+		// allow a bare first property name, as in "geo.lat".
+		s = "." + s
+	}
+	for pos := len(expr) - len(s); s != ""; pos = len(expr) - len(s) {
+		var step pathStep
+		var err error
+		switch {
+		case strings.HasPrefix(s, ".."):
+			step.recursive = true
+			s = s[2:]
+			if strings.HasPrefix(s, "[") {
+				step, s, err = compileBracket(s, step)
+			} else {
+				step, s, err = compileDot(s, step)
+			}
+		case s[0] == '.':
+			step, s, err = compileDot(s[1:], step)
+		case s[0] == '[':
+			step, s, err = compileBracket(s, step)
+		default:
+			err = errors.Errorf("unexpected %q", s[0])
+		}
+		if err != nil {
+			return nil, errors.Wrapf(ErrInvalidPath, "%s at offset %d of %q", err, pos, expr)
+		}
+		p.steps = append(p.steps, step)
+	}
+	return p, nil
+}
+
+// MustCompilePath is like CompilePath, but panics if the expression is
+// invalid.
+func MustCompilePath(expr string) *Path {
+	p, err := CompilePath(expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func compileDot(s string, step pathStep) (pathStep, string, error) {
+	end := strings.IndexAny(s, ".[]")
+	if end < 0 {
+		end = len(s)
+	}
+	name := s[:end]
+	switch name {
+	case "":
+		return step, s, errors.New("missing property name")
+	case "*":
+		step.kind = stepWildcard
+	default:
+		step.kind = stepName
+		step.name = Property(name)
+	}
+	return step, s[end:], nil
+}
+
+func compileBracket(s string, step pathStep) (pathStep, string, error) {
+	s = s[1:]
+	if s == "" {
+		return step, s, errors.New("unterminated '['")
+	}
+	switch q := s[0]; {
+	case q == '\'' || q == '"':
+		var name strings.Builder
+		i := 1
+		for ; i < len(s) && s[i] != q; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+			}
+			name.WriteByte(s[i])
+		}
+		if i >= len(s) {
+			return step, s, errors.New("unterminated quoted name")
+		}
+		step.kind = stepName
+		step.name = Property(name.String())
+		s = s[i+1:]
+	case q == '*':
+		step.kind = stepWildcard
+		s = s[1:]
+	default:
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return step, s, errors.New("unterminated '['")
+		}
+		idx, err := strconv.Atoi(strings.TrimSpace(s[:end]))
+		if err != nil {
+			return step, s, errors.Errorf("invalid index %q", s[:end])
+		}
+		step.kind = stepIndex
+		step.index = idx
+		s = s[end:]
+	}
+	if !strings.HasPrefix(s, "]") {
+		return step, s, errors.New("expected ']'")
+	}
+	return step, s[1:], nil
+}
+
+// String returns the expression the Path was compiled from.
+func (p *Path) String() string {
+	return p.expr
+}
+
+// Find returns every Object in e selected by the path, in order. An empty
+// path selects e itself.
+func (p *Path) Find(e *Entity) []Object {
+	cur := []Object{e}
+	for _, step := range p.steps {
+		var next []Object
+		for _, obj := range cur {
+			if step.recursive {
+				next = descend(obj, step, next)
+			} else {
+				next = step.apply(obj, next)
+			}
+		}
+		if len(next) == 0 {
+			return nil
+		}
+		cur = next
+	}
+	return cur
+}
+
+// apply appends the Objects selected by step from obj to dst.
+func (step pathStep) apply(obj Object, dst []Object) []Object {
+	switch step.kind {
+	case stepName:
+		if ent, ok := obj.(*Entity); ok {
+			if val, ok := ent.Objects[step.name]; ok {
+				dst = append(dst, val)
+			}
+		}
+	case stepIndex:
+		if objs, ok := obj.(Objects); ok {
+			if i, ok := listIndex(objs, step.index); ok {
+				dst = append(dst, objs[i])
+			}
+		}
+	case stepWildcard:
+		switch obj := obj.(type) {
+		case *Entity:
+			for _, prop := range sortedProps(obj) {
+				dst = append(dst, obj.Objects[prop])
+			}
+		case Objects:
+			dst = append(dst, obj...)
+		}
+	}
+	return dst
+}
+
+// descend applies step to obj and to everything beneath it.
+func descend(obj Object, step pathStep, dst []Object) []Object {
+	dst = step.apply(obj, dst)
+	switch obj := obj.(type) {
+	case *Entity:
+		for _, prop := range sortedProps(obj) {
+			dst = descend(obj.Objects[prop], step, dst)
+		}
+	case Objects:
+		for _, o := range obj {
+			dst = descend(o, step, dst)
+		}
+	}
+	return dst
+}
+
+func listIndex(objs Objects, i int) (int, bool) {
+	if i < 0 {
+		i += len(objs)
+	}
+	return i, i >= 0 && i < len(objs)
+}
+
+func sortedProps(e *Entity) []Property {
+	props := make([]Property, 0, len(e.Objects))
+	for prop := range e.Objects {
+		props = append(props, prop)
+	}
+	sort.Slice(props, func(i, j int) bool { return props[i] < props[j] })
+	return props
+}
+
+// Get returns the first Object in e selected by the path.
+func (p *Path) Get(e *Entity) (Object, error) {
+	objs := p.Find(e)
+	if len(objs) == 0 {
+		return nil, errors.Wrap(ErrPathNotFound, p.expr)
+	}
+	return objs[0], nil
+}
+
+// Literal returns the first Object in e selected by the path, which must be a
+// Literal.
+func (p *Path) Literal(e *Entity) (Literal, error) {
+	obj, err := p.Get(e)
+	if err != nil {
+		return nil, err
+	}
+	lit, ok := obj.(Literal)
+	if !ok {
+		return nil, errors.Wrapf(ErrNotALiteral, "%s: %#v", p.expr, obj)
+	}
+	return lit, nil
+}
+
+// Literals returns every Literal in e selected by the path, skipping
+// Entities and lists.
+func (p *Path) Literals(e *Entity) []Literal {
+	var lits []Literal
+	for _, obj := range p.Find(e) {
+		if lit, ok := obj.(Literal); ok {
+			lits = append(lits, lit)
+		}
+	}
+	return lits
+}
+
+// Entity returns the first Object in e selected by the path, which must be an
+// Entity.
+func (p *Path) Entity(e *Entity) (*Entity, error) {
+	obj, err := p.Get(e)
+	if err != nil {
+		return nil, err
+	}
+	ent, ok := obj.(*Entity)
+	if !ok {
+		return nil, errors.Wrapf(ErrUnexpectedType, "%s: %#v not an Entity", p.expr, obj)
+	}
+	return ent, nil
+}
+
+// The typed getters below return the first Literal selected by the path,
+// which must be of their type.
+
+// B returns the B at the path in e.
+func (p *Path) B(e *Entity) (B, error) {
+	lit, err := p.Literal(e)
+	if err != nil {
+		return false, err
+	}
+	v, ok := lit.(B)
+	if !ok {
+		return false, errors.Wrapf(ErrUnexpectedType, "%s: %#v not a bool", p.expr, lit)
+	}
+	return v, nil
+}
+
+// S returns the S at the path in e.
+func (p *Path) S(e *Entity) (S, error) {
+	lit, err := p.Literal(e)
+	if err != nil {
+		return "", err
+	}
+	v, ok := lit.(S)
+	if !ok {
+		return "", errors.Wrapf(ErrUnexpectedType, "%s: %#v not a string", p.expr, lit)
+	}
+	return v, nil
+}
+
+// Time returns the Time at the path in e.
+func (p *Path) Time(e *Entity) (Time, error) {
+	lit, err := p.Literal(e)
+	if err != nil {
+		return Time{}, err
+	}
+	v, ok := lit.(Time)
+	if !ok {
+		return Time{}, errors.Wrapf(ErrUnexpectedType, "%s: %#v not a time", p.expr, lit)
+	}
+	return v, nil
+}
+
+// IPv4 returns the IPv4 at the path in e.
+func (p *Path) IPv4(e *Entity) (IPv4, error) {
+	lit, err := p.Literal(e)
+	if err != nil {
+		return IPv4{}, err
+	}
+	v, ok := lit.(IPv4)
+	if !ok {
+		return IPv4{}, errors.Wrapf(ErrUnexpectedType, "%s: %#v not an IPv4 address", p.expr, lit)
+	}
+	return v, nil
+}
+
+// IPv6 returns the IPv6 at the path in e.
+func (p *Path) IPv6(e *Entity) (IPv6, error) {
+	lit, err := p.Literal(e)
+	if err != nil {
+		return IPv6{}, err
+	}
+	v, ok := lit.(IPv6)
+	if !ok {
+		return IPv6{}, errors.Wrapf(ErrUnexpectedType, "%s: %#v not an IPv6 address", p.expr, lit)
+	}
+	return v, nil
+}
+
+// F32 returns the F32 at the path in e.
+func (p *Path) F32(e *Entity) (F32, error) {
+	lit, err := p.Literal(e)
+	if err != nil {
+		return 0, err
+	}
+	v, ok := lit.(F32)
+	if !ok {
+		return 0, errors.Wrapf(ErrUnexpectedType, "%s: %#v not a float32", p.expr, lit)
+	}
+	return v, nil
+}
+
+// F64 returns the F64 at the path in e.
+func (p *Path) F64(e *Entity) (F64, error) {
+	lit, err := p.Literal(e)
+	if err != nil {
+		return 0, err
+	}
+	v, ok := lit.(F64)
+	if !ok {
+		return 0, errors.Wrapf(ErrUnexpectedType, "%s: %#v not a float64", p.expr, lit)
+	}
+	return v, nil
+}
+
+// I returns the I at the path in e.
+func (p *Path) I(e *Entity) (I, error) {
+	lit, err := p.Literal(e)
+	if err != nil {
+		return 0, err
+	}
+	v, ok := lit.(I)
+	if !ok {
+		return 0, errors.Wrapf(ErrUnexpectedType, "%s: %#v not an int", p.expr, lit)
+	}
+	return v, nil
+}
+
+// I8 returns the I8 at the path in e.
+func (p *Path) I8(e *Entity) (I8, error) {
+	lit, err := p.Literal(e)
+	if err != nil {
+		return 0, err
+	}
+	v, ok := lit.(I8)
+	if !ok {
+		return 0, errors.Wrapf(ErrUnexpectedType, "%s: %#v not an int8", p.expr, lit)
+	}
+	return v, nil
+}
+
+// I16 returns the I16 at the path in e.
+func (p *Path) I16(e *Entity) (I16, error) {
+	lit, err := p.Literal(e)
+	if err != nil {
+		return 0, err
+	}
+	v, ok := lit.(I16)
+	if !ok {
+		return 0, errors.Wrapf(ErrUnexpectedType, "%s: %#v not an int16", p.expr, lit)
+	}
+	return v, nil
+}
+
+// I32 returns the I32 at the path in e.
+func (p *Path) I32(e *Entity) (I32, error) {
+	lit, err := p.Literal(e)
+	if err != nil {
+		return 0, err
+	}
+	v, ok := lit.(I32)
+	if !ok {
+		return 0, errors.Wrapf(ErrUnexpectedType, "%s: %#v not an int32", p.expr, lit)
+	}
+	return v, nil
+}
+
+// I64 returns the I64 at the path in e.
+func (p *Path) I64(e *Entity) (I64, error) {
+	lit, err := p.Literal(e)
+	if err != nil {
+		return 0, err
+	}
+	v, ok := lit.(I64)
+	if !ok {
+		return 0, errors.Wrapf(ErrUnexpectedType, "%s: %#v not an int64", p.expr, lit)
+	}
+	return v, nil
+}
+
+// U returns the U at the path in e.
+func (p *Path) U(e *Entity) (U, error) {
+	lit, err := p.Literal(e)
+	if err != nil {
+		return 0, err
+	}
+	v, ok := lit.(U)
+	if !ok {
+		return 0, errors.Wrapf(ErrUnexpectedType, "%s: %#v not a uint", p.expr, lit)
+	}
+	return v, nil
+}
+
+// U8 returns the U8 at the path in e.
+func (p *Path) U8(e *Entity) (U8, error) {
+	lit, err := p.Literal(e)
+	if err != nil {
+		return 0, err
+	}
+	v, ok := lit.(U8)
+	if !ok {
+		return 0, errors.Wrapf(ErrUnexpectedType, "%s: %#v not a uint8", p.expr, lit)
+	}
+	return v, nil
+}
+
+// U16 returns the U16 at the path in e.
+func (p *Path) U16(e *Entity) (U16, error) {
+	lit, err := p.Literal(e)
+	if err != nil {
+		return 0, err
+	}
+	v, ok := lit.(U16)
+	if !ok {
+		return 0, errors.Wrapf(ErrUnexpectedType, "%s: %#v not a uint16", p.expr, lit)
+	}
+	return v, nil
+}
+
+// U32 returns the U32 at the path in e.
+func (p *Path) U32(e *Entity) (U32, error) {
+	lit, err := p.Literal(e)
+	if err != nil {
+		return 0, err
+	}
+	v, ok := lit.(U32)
+	if !ok {
+		return 0, errors.Wrapf(ErrUnexpectedType, "%s: %#v not a uint32", p.expr, lit)
+	}
+	return v, nil
+}
+
+// U64 returns the U64 at the path in e.
+func (p *Path) U64(e *Entity) (U64, error) {
+	lit, err := p.Literal(e)
+	if err != nil {
+		return 0, err
+	}
+	v, ok := lit.(U64)
+	if !ok {
+		return 0, errors.Wrapf(ErrUnexpectedType, "%s: %#v not a uint64", p.expr, lit)
+	}
+	return v, nil
+}
+
+// Set sets the Objects selected by the path in e to obj. Entities are created
+// for properties along the way which don't exist, but list items must exist
+// already. If the path has wildcards, every match is set. Recursive steps
+// can't be set, and nor can an empty path.
+func (p *Path) Set(e *Entity, obj Object) error {
+	if len(p.steps) == 0 {
+		return ErrEmptyPath
+	}
+	for _, step := range p.steps {
+		if step.recursive {
+			return errors.Wrapf(ErrInvalidPath, "can't set recursive path %q", p.expr)
+		}
+	}
+	return errors.Wrap(set(e, p.steps, obj), p.expr)
+}
+
+func set(cur Object, steps []pathStep, obj Object) error {
+	step, last := steps[0], len(steps) == 1
+	switch step.kind {
+	case stepName:
+		ent, ok := cur.(*Entity)
+		if !ok {
+			return errors.Wrapf(ErrPathNotFound, "property %v of non-entity %#v", step.name, cur)
+		}
+		if last {
+			ent.Objects[step.name] = obj
+			return nil
+		}
+		next, ok := ent.Objects[step.name]
+		if !ok {
+			next = NewEntity()
+			ent.Objects[step.name] = next
+		}
+		return set(next, steps[1:], obj)
+	case stepIndex:
+		objs, ok := cur.(Objects)
+		if !ok {
+			return errors.Wrapf(ErrPathNotFound, "index %d of non-list %#v", step.index, cur)
+		}
+		i, ok := listIndex(objs, step.index)
+		if !ok {
+			return errors.Wrapf(ErrPathNotFound, "index %d out of range for list of %d", step.index, len(objs))
+		}
+		if last {
+			objs[i] = obj
+			return nil
+		}
+		return set(objs[i], steps[1:], obj)
+	default: // stepWildcard
+		switch cur := cur.(type) {
+		case *Entity:
+			for _, prop := range sortedProps(cur) {
+				if last {
+					cur.Objects[prop] = obj
+				} else if err := set(cur.Objects[prop], steps[1:], obj); err != nil {
+					return errors.Wrapf(err, "%v", prop)
+				}
+			}
+		case Objects:
+			for i := range cur {
+				if last {
+					cur[i] = obj
+				} else if err := set(cur[i], steps[1:], obj); err != nil {
+					return errors.Wrapf(err, "index %d", i)
+				}
+			}
+		default:
+			return errors.Wrapf(ErrPathNotFound, "wildcard on %#v", cur)
+		}
+		return nil
+	}
+}
+
+// Query compiles expr and returns every Object in e it selects. See Path for
+// the syntax.
+func (e *Entity) Query(expr string) ([]Object, error) {
+	p, err := CompilePath(expr)
+	if err != nil {
+		return nil, err
+	}
+	return p.Find(e), nil
+}
@@ -0,0 +1,184 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pdk_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pilosa/pdk"
+	"github.com/pkg/errors"
+)
+
+func pathTestEntity() *pdk.Entity {
+	return &pdk.Entity{
+		Subject: "e",
+		Objects: map[pdk.Property]pdk.Object{
+			"geo": &pdk.Entity{
+				Objects: map[pdk.Property]pdk.Object{
+					"lat": pdk.F64(31.1),
+					"lon": pdk.F64(42.2),
+				},
+			},
+			"items": pdk.Objects{
+				&pdk.Entity{Objects: map[pdk.Property]pdk.Object{"category": pdk.S("a"), "price": pdk.I(3)}},
+				&pdk.Entity{Objects: map[pdk.Property]pdk.Object{"category": pdk.S("b")}},
+				&pdk.Entity{Objects: map[pdk.Property]pdk.Object{"price": pdk.I(5)}},
+			},
+			"user.name": pdk.S("bob"),
+			"ok":        pdk.B(true),
+			"tags":      pdk.Objects{pdk.S("x"), pdk.S("y")},
+		},
+	}
+}
+
+func TestPathFind(t *testing.T) {
+	tests := []struct {
+		expr string
+		exp  []pdk.Object
+	}{
+		{expr: "$.geo.lat", exp: []pdk.Object{pdk.F64(31.1)}},
+		{expr: "geo.lon", exp: []pdk.Object{pdk.F64(42.2)}},
+		{expr: "$['user.name']", exp: []pdk.Object{pdk.S("bob")}},
+		{expr: `$["user.name"]`, exp: []pdk.Object{pdk.S("bob")}},
+		{expr: "$.items[*].category", exp: []pdk.Object{pdk.S("a"), pdk.S("b")}},
+		{expr: "$.items[0].price", exp: []pdk.Object{pdk.I(3)}},
+		{expr: "$.items[-1].price", exp: []pdk.Object{pdk.I(5)}},
+		{expr: "$.items[3].price"},
+		{expr: "$.tags[*]", exp: []pdk.Object{pdk.S("x"), pdk.S("y")}},
+		{expr: "$.geo.*", exp: []pdk.Object{pdk.F64(31.1), pdk.F64(42.2)}},
+		{expr: "$..price", exp: []pdk.Object{pdk.I(3), pdk.I(5)}},
+		{expr: "$..lat", exp: []pdk.Object{pdk.F64(31.1)}},
+		{expr: "$.geo.lat.x"},
+		{expr: "$.geo[0]"},
+		{expr: "$.nope"},
+	}
+	e := pathTestEntity()
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			objs, err := e.Query(test.expr)
+			if err != nil {
+				t.Fatalf("querying: %v", err)
+			}
+			if !reflect.DeepEqual(objs, test.exp) {
+				t.Fatalf("got %#v, expected %#v", objs, test.exp)
+			}
+		})
+	}
+
+	if objs := pdk.MustCompilePath("$").Find(e); len(objs) != 1 || objs[0] != pdk.Object(e) {
+		t.Fatalf("root path should select the entity, got %#v", objs)
+	}
+}
+
+func TestCompilePathInvalid(t *testing.T) {
+	for _, expr := range []string{"$.", "$..", "$[", "$[1", "$['a]", "$[a]", "$.a]", "$.a[*"} {
+		t.Run(expr, func(t *testing.T) {
+			_, err := pdk.CompilePath(expr)
+			if errors.Cause(err) != pdk.ErrInvalidPath {
+				t.Fatalf("expected invalid path error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPathGetters(t *testing.T) {
+	e := pathTestEntity()
+	lat, err := pdk.MustCompilePath("$.geo.lat").F64(e)
+	if err != nil || lat != 31.1 {
+		t.Fatalf("getting lat: %v, %v", lat, err)
+	}
+	ok, err := pdk.MustCompilePath("$.ok").B(e)
+	if err != nil || !ok {
+		t.Fatalf("getting ok: %v, %v", ok, err)
+	}
+	cat, err := pdk.MustCompilePath("$.items[*].category").S(e)
+	if err != nil || cat != "a" {
+		t.Fatalf("getting first category: %v, %v", cat, err)
+	}
+	if _, err := pdk.MustCompilePath("$.geo.lat").S(e); errors.Cause(err) != pdk.ErrUnexpectedType {
+		t.Fatalf("expected unexpected type error, got %v", err)
+	}
+	if _, err := pdk.MustCompilePath("$.geo").Literal(e); errors.Cause(err) != pdk.ErrNotALiteral {
+		t.Fatalf("expected not a literal error, got %v", err)
+	}
+	if _, err := pdk.MustCompilePath("$.nope").I(e); errors.Cause(err) != pdk.ErrPathNotFound {
+		t.Fatalf("expected path not found error, got %v", err)
+	}
+	geo, err := pdk.MustCompilePath("$.geo").Entity(e)
+	if err != nil || len(geo.Objects) != 2 {
+		t.Fatalf("getting geo: %v, %v", geo, err)
+	}
+	prices := pdk.MustCompilePath("$.items[*].price").Literals(e)
+	if !reflect.DeepEqual(prices, []pdk.Literal{pdk.I(3), pdk.I(5)}) {
+		t.Fatalf("unexpected prices: %#v", prices)
+	}
+}
+
+func TestPathSet(t *testing.T) {
+	tests := []struct {
+		name   string
+		expr   string
+		expErr error
+		exp    []pdk.Object
+	}{
+		{name: "existing", expr: "$.geo.lat"},
+		{name: "create", expr: "$.a.b.c"},
+		{name: "list item", expr: "$.items[1].category"},
+		{name: "wildcard", expr: "$.items[*].hash", exp: []pdk.Object{pdk.S("V"), pdk.S("V"), pdk.S("V")}},
+		{name: "out of range", expr: "$.items[5].category", expErr: pdk.ErrPathNotFound},
+		{name: "through literal", expr: "$.ok.x", expErr: pdk.ErrPathNotFound},
+		{name: "recursive", expr: "$..x", expErr: pdk.ErrInvalidPath},
+		{name: "empty", expr: "$", expErr: pdk.ErrEmptyPath},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := pathTestEntity()
+			p := pdk.MustCompilePath(test.expr)
+			err := p.Set(e, pdk.S("V"))
+			if errors.Cause(err) != test.expErr {
+				t.Fatalf("got %v, expected %v", err, test.expErr)
+			}
+			if err != nil {
+				return
+			}
+			exp := test.exp
+			if exp == nil {
+				exp = []pdk.Object{pdk.S("V")}
+			}
+			if got := p.Find(e); !reflect.DeepEqual(got, exp) {
+				t.Fatalf("got %#v after set, expected %#v", got, exp)
+			}
+		})
+	}
+}
@@ -33,10 +33,13 @@
 package pdk
 
 import (
-	"fmt"
 	"io"
 	"log"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	gopilosa "github.com/pilosa/go-pilosa"
@@ -52,12 +55,41 @@ type Index struct {
 	index       *gopilosa.Index
 	importWG    sync.WaitGroup
 	recordChans map[string]chanRecordIterator
+
+	// fields holds the fields being imported into. Fields created after
+	// setup are not added to index, since go-pilosa's ImportField iterates
+	// over the fields of a field's index while importing.
+	fields map[string]*gopilosa.Field
+
+	ackLock sync.Mutex
+	acks    []func(err error)
+
+	errLock    sync.Mutex
+	importErrs map[string]error
+	// unackedErr is the first import error which wasn't passed to any
+	// acknowledgements. Close returns it.
+	unackedErr error
+
+	// attrs are the attributes waiting to be sent. attrSendLock is held
+	// while sending them, so that they are sent in order. If there is a
+	// WAL, they are written to attrWAL instead.
+	attrLock     sync.Mutex
+	attrs        attrBatch
+	attrSendLock sync.Mutex
+	attrWAL      *fieldWAL
+
+	// dirty is set when anything is added, and cleared by autoFlush.
+	dirty        uint32
+	stopFlushing chan struct{}
+	flushWG      sync.WaitGroup
 }
 
 func newIndex(options *pilosaOptions) *Index {
 	return &Index{
 		options:     options,
 		recordChans: make(map[string]chanRecordIterator),
+		fields:      make(map[string]*gopilosa.Field),
+		importErrs:  make(map[string]error),
 	}
 }
 
@@ -67,16 +99,34 @@ func (i *Index) Client() *gopilosa.Client {
 }
 
 // AddColumnTimestamp adds a column to be imported to Pilosa with a timestamp.
-func (i *Index) AddColumnTimestamp(field string, row, col uint64OrString, ts time.Time) {
-	i.addColumn(field, row, col, ts.UnixNano())
+func (i *Index) AddColumnTimestamp(field string, col, row uint64OrString, ts time.Time) error {
+	return i.addColumn(field, gopilosa.FieldTypeTime, col, row, ts.UnixNano())
 }
 
 // AddColumn adds a column to be imported to Pilosa.
-func (i *Index) AddColumn(field string, col, row uint64OrString) {
-	i.addColumn(field, col, row, 0)
+func (i *Index) AddColumn(field string, col, row uint64OrString) error {
+	return i.addColumn(field, gopilosa.FieldTypeSet, col, row, 0)
 }
 
-type uint64OrString interface{}
+// AddMutex adds a column to be imported to Pilosa, in a field which is
+// created as a mutex field if it doesn't exist.
+func (i *Index) AddMutex(field string, col, row uint64OrString) error {
+	return i.addColumn(field, gopilosa.FieldTypeMutex, col, row, 0)
+}
+
+// AddBool adds a column to be imported to Pilosa, in a field which is created
+// as a bool field if it doesn't exist.
+func (i *Index) AddBool(field string, col uint64OrString, val bool) error {
+	var row uint64
+	if val {
+		row = 1
+	}
+	return i.addColumn(field, gopilosa.FieldTypeBool, col, row, 0)
+}
+
+// uint64OrString is an alias so that Indexers can be implemented outside this
+// package with interface{} parameters.
+type uint64OrString = interface{}
 
 func uint64Cast(u uint64OrString) uint64 {
 	ret, _ := u.(uint64)
@@ -97,77 +147,300 @@ func validUint64OrString(u uint64OrString) bool {
 	return true
 }
 
-func (i *Index) addColumn(fieldName string, col uint64OrString, row uint64OrString, ts int64) {
+// addColumn adds a column to the named field, creating the field with the
+// given type if it doesn't exist and isn't configured otherwise.
+func (i *Index) addColumn(fieldName string, fieldType gopilosa.FieldType, col uint64OrString, row uint64OrString, ts int64) error {
 	if !validUint64OrString(col) || !validUint64OrString(row) {
-		panic(fmt.Sprintf("a %T and a %T were passed, both must be either uint64 or string", col, row))
+		return errors.Errorf("a %T and a %T were passed to field '%s', both must be either uint64 or string", col, row, fieldName)
 	}
-	var c chanRecordIterator
-	var ok bool
-	i.lock.RLock()
-	if c, ok = i.recordChans[fieldName]; !ok {
-		i.lock.RUnlock()
-		i.lock.Lock()
-		defer i.lock.Unlock()
-		fieldType := gopilosa.OptFieldTypeSet(gopilosa.CacheTypeRanked, 100000)
-		if ts != 0 {
-			fieldType = gopilosa.OptFieldTypeTime(gopilosa.TimeQuantumYearMonthDayHour)
-		}
-		fieldOpts := []gopilosa.FieldOption{fieldType}
-		// If row value is a string then configure the field to use row keys.
-		if _, ok := row.(string); ok {
-			fieldOpts = append(fieldOpts, gopilosa.OptFieldKeys(true))
-		}
-		field := i.index.Field(fieldName, fieldOpts...)
-		err := i.setupField(field)
-		if err != nil {
-			log.Println(errors.Wrapf(err, "setting up field '%s'", fieldName)) // TODO make AddBit/AddValue return err?
-			return
-		}
-		c = i.recordChans[fieldName]
-	} else {
-		i.lock.RUnlock()
+	_, rowKeys := row.(string)
+	c, field, err := i.recordChan(fieldName, func() ([]gopilosa.FieldOption, error) {
+		return fieldOptions(i.fieldConfigs(), fieldName, fieldType, rowKeys || i.nativeKeys())
+	})
+	if err != nil {
+		return err
+	}
+	// Only time fields can take timestamps.
+	if field.Options().Type() != gopilosa.FieldTypeTime {
+		ts = 0
 	}
+	col, row = i.colKey(col), rowKey(field, row)
 	c <- gopilosa.Column{
 		RowID: uint64Cast(row), ColumnID: uint64Cast(col),
 		RowKey: stringCast(row), ColumnKey: stringCast(col),
 		Timestamp: ts}
+	return nil
 }
 
 // AddValue adds a value to be imported to Pilosa.
-func (i *Index) AddValue(fieldName string, col uint64OrString, val int64) {
-	var c chanRecordIterator
-	var ok bool
+func (i *Index) AddValue(fieldName string, col uint64OrString, val int64) error {
+	if !validUint64OrString(col) {
+		return errors.Errorf("a %T was passed to field '%s', must be either uint64 or string", col, fieldName)
+	}
+	c, _, err := i.recordChan(fieldName, func() ([]gopilosa.FieldOption, error) {
+		return fieldOptions(i.fieldConfigs(), fieldName, gopilosa.FieldTypeInt, false)
+	})
+	if err != nil {
+		return err
+	}
+	col = i.colKey(col)
+	c <- gopilosa.FieldValue{ColumnID: uint64Cast(col), ColumnKey: stringCast(col), Value: val}
+	return nil
+}
 
+// ClearColumn clears a column to be imported to Pilosa. Clearing from a field
+// which the Index doesn't know about (one which didn't exist when it was set
+// up, and hasn't been added to since) does nothing.
+func (i *Index) ClearColumn(fieldName string, col, row uint64OrString) error {
+	if !validUint64OrString(col) || !validUint64OrString(row) {
+		return errors.Errorf("a %T and a %T were passed to field '%s', both must be either uint64 or string", col, row, fieldName)
+	}
+	c, field, err := i.recordChan(fieldName, nil)
+	if c == nil || err != nil {
+		return err
+	}
+	col, row = i.colKey(col), rowKey(field, row)
+	c <- clearRecord{gopilosa.Column{
+		RowID: uint64Cast(row), ColumnID: uint64Cast(col),
+		RowKey: stringCast(row), ColumnKey: stringCast(col)}}
+	return nil
+}
+
+// ClearValue clears a column's value in an int field. As with ClearColumn,
+// fields which the Index doesn't know about are left alone.
+func (i *Index) ClearValue(fieldName string, col uint64OrString) error {
 	if !validUint64OrString(col) {
-		panic(fmt.Sprintf("a %T was passed, must be eithe uint64 or string", col))
+		return errors.Errorf("a %T was passed to field '%s', must be either uint64 or string", col, fieldName)
+	}
+	c, field, err := i.recordChan(fieldName, nil)
+	if c == nil || err != nil {
+		return err
 	}
+	opts := field.Options()
+	if opts.Type() != gopilosa.FieldTypeInt {
+		return errors.Errorf("can't clear a value from %s field '%s'", opts.Type(), fieldName)
+	}
+	// Pilosa clears the value's bits and marks it as not set. The field's
+	// minimum is sent since it is stored with no bits set.
+	col = i.colKey(col)
+	c <- clearRecord{gopilosa.FieldValue{ColumnID: uint64Cast(col), ColumnKey: stringCast(col), Value: opts.Min()}}
+	return nil
+}
+
+func (i *Index) nativeKeys() bool {
+	return i.options != nil && i.options.nativeKeys
+}
+
+// colKey returns col as a key if the Index uses native keys.
+func (i *Index) colKey(col uint64OrString) uint64OrString {
+	if id, ok := col.(uint64); ok && i.nativeKeys() {
+		return strconv.FormatUint(id, 10)
+	}
+	return col
+}
+
+// rowKey returns row as a key if field uses keys.
+func rowKey(field *gopilosa.Field, row uint64OrString) uint64OrString {
+	if id, ok := row.(uint64); ok && field.Options().Keys() {
+		return strconv.FormatUint(id, 10)
+	}
+	return row
+}
 
+func (i *Index) fieldConfigs() []FieldConfig {
+	if i.options == nil {
+		return nil
+	}
+	return i.options.fieldConfigs
+}
+
+// recordChan gets the channel which feeds the importer for the named field,
+// setting up the field with the options returned by opts if it doesn't exist
+// yet. If opts is nil, fields aren't set up, and a nil channel is returned for
+// a field which doesn't exist. It returns an error if the field's write-ahead
+// log has failed, since nothing more can be imported into it.
+func (i *Index) recordChan(fieldName string, opts func() ([]gopilosa.FieldOption, error)) (chanRecordIterator, *gopilosa.Field, error) {
 	i.lock.RLock()
-	if c, ok = i.recordChans[fieldName]; !ok {
-		i.lock.RUnlock()
+	c, ok := i.recordChans[fieldName]
+	var field *gopilosa.Field
+	if ok {
+		field = i.fields[fieldName]
+	}
+	i.lock.RUnlock()
+	if !ok && opts == nil {
+		return nil, nil, nil
+	}
+	if !ok {
 		i.lock.Lock()
-		defer i.lock.Unlock()
-		field := i.index.Field(fieldName, gopilosa.OptFieldTypeInt())
-		err := i.setupField(field)
+		var err error
+		field, err = i.createField(fieldName, opts)
+		c = i.recordChans[fieldName]
+		i.lock.Unlock()
 		if err != nil {
-			log.Println(errors.Wrap(err, "setting up field"))
+			return nil, nil, errors.Wrapf(err, "setting up field '%s'", fieldName)
+		}
+	}
+	i.errLock.Lock()
+	err := i.importErrs[fieldName]
+	i.errLock.Unlock()
+	atomic.StoreUint32(&i.dirty, 1)
+	return c, field, err
+}
+
+// createField sets up the named field, getting options for it from opts if it
+// hasn't been set up already. Callers must hold i.lock.Lock().
+func (i *Index) createField(fieldName string, opts func() ([]gopilosa.FieldOption, error)) (*gopilosa.Field, error) {
+	if _, ok := i.recordChans[fieldName]; ok {
+		return i.fields[fieldName], nil
+	}
+	fieldOpts, err := opts()
+	if err != nil {
+		return nil, err
+	}
+	// create the field on an index of its own, so that i.index isn't
+	// changed while other fields are importing.
+	indexOpts := i.index.Opts()
+	index := gopilosa.NewSchema().Index(i.index.Name(), gopilosa.OptIndexKeys(indexOpts.Keys()), gopilosa.OptIndexTrackExistence(indexOpts.TrackExistence()))
+	field := index.Field(fieldName, fieldOpts...)
+	return field, i.setupField(field)
+}
+
+// Acknowledge implements Acknowledger. Acknowledgements are collected until
+// there are batchSize of them (or the Index is flushed or closed), at which
+// point everything added so far is imported before they are called.
+func (i *Index) Acknowledge(ack func(err error)) {
+	i.ackLock.Lock()
+	i.acks = append(i.acks, ack)
+	if uint(len(i.acks)) < i.batchSize {
+		i.ackLock.Unlock()
+		return
+	}
+	acks := i.acks
+	i.acks = nil
+	i.ackLock.Unlock()
+	i.flush(acks)
+}
+
+// Flush implements Indexer. Any pending acknowledgements are called once the
+// import has finished.
+func (i *Index) Flush() error {
+	i.ackLock.Lock()
+	acks := i.acks
+	i.acks = nil
+	i.ackLock.Unlock()
+	return i.flush(acks)
+}
+
+// swapDirty clears the Index's dirty flag, returning whether it was set.
+func (i *Index) swapDirty() bool {
+	return atomic.SwapUint32(&i.dirty, 0) == 1
+}
+
+// autoFlush calls flush every interval (if dirty says anything has been added
+// since the last time) until done is closed.
+func autoFlush(interval time.Duration, done <-chan struct{}, dirty func() bool, flush func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !dirty() {
+				continue
+			}
+			if err := flush(); err != nil {
+				log.Printf("flushing index: %v", err)
+			}
+		case <-done:
 			return
 		}
-		c = i.recordChans[fieldName]
-	} else {
-		i.lock.RUnlock()
 	}
-	c <- gopilosa.FieldValue{ColumnID: uint64Cast(col), ColumnKey: stringCast(col), Value: val}
+}
+
+// flush waits for everything which has been added to the Index to be imported,
+// and then calls acks with the result, which it also returns.
+func (i *Index) flush(acks []func(err error)) error {
+	err := i.flushAttrs()
+
+	i.lock.RLock()
+	markers := make([]importMarker, 0, len(i.recordChans))
+	for _, c := range i.recordChans {
+		m := make(importMarker, 1)
+		c <- m
+		markers = append(markers, m)
+	}
+	i.lock.RUnlock()
+
+	for _, m := range markers {
+		if merr := <-m; merr != nil && err == nil {
+			err = merr
+		}
+	}
+	if len(acks) == 0 {
+		i.setUnackedError(err)
+	}
+	for _, ack := range acks {
+		ack(err)
+	}
+	return err
 }
 
 // Close ensures that all ongoing imports have finished and cleans up internal
 // state.
 func (i *Index) Close() error {
+	if i.stopFlushing != nil {
+		close(i.stopFlushing)
+		i.flushWG.Wait()
+	}
+	i.ackLock.Lock()
+	acks := i.acks
+	i.acks = nil
+	i.ackLock.Unlock()
+	if len(acks) > 0 {
+		i.flush(acks)
+	}
+	attrErr := i.flushAttrs()
+	if i.attrWAL != nil {
+		i.attrSendLock.Lock()
+		i.setImportError(attrWALName, i.attrWAL.close())
+		i.attrSendLock.Unlock()
+	}
+
 	for _, cbi := range i.recordChans {
 		close(cbi)
 	}
 	i.importWG.Wait()
-	return nil
+	if err := i.importError(); err != nil {
+		return err
+	}
+	i.errLock.Lock()
+	err := i.unackedErr
+	i.errLock.Unlock()
+	if err != nil {
+		return err
+	}
+	return attrErr
+}
+
+// importError combines the errors from all the failed imports.
+func (i *Index) importError() error {
+	i.errLock.Lock()
+	defer i.errLock.Unlock()
+	if len(i.importErrs) == 0 {
+		return nil
+	}
+	fields := make([]string, 0, len(i.importErrs))
+	for field := range i.importErrs {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	if len(fields) == 1 {
+		return i.importErrs[fields[0]]
+	}
+	msgs := make([]string, len(fields))
+	for j, field := range fields {
+		msgs[j] = i.importErrs[field].Error()
+	}
+	return errors.Errorf("%d field imports failed: %s", len(fields), strings.Join(msgs, "; "))
 }
 
 func NewRankedField(index *gopilosa.Index, name string, size int) *gopilosa.Field {
@@ -179,7 +452,7 @@ func NewIntField(index *gopilosa.Index, name string, min, max int64) *gopilosa.F
 }
 
 // setupField ensures the existence of a field in Pilosa,
-// and starts importers for the field.
+// and starts importers for the field (which go via a WAL if there is one).
 // It is not threadsafe - callers must hold i.lock.Lock() or guarantee that they have
 // exclusive access to Index before calling.
 func (i *Index) setupField(field *gopilosa.Field) error {
@@ -189,35 +462,153 @@ func (i *Index) setupField(field *gopilosa.Field) error {
 		if err != nil {
 			return errors.Wrapf(err, "creating field '%v'", field)
 		}
-		i.recordChans[fieldName] = newChanRecordIterator()
-		i.importWG.Add(1)
-		var importOptions []gopilosa.ImportOption
-		if i.options != nil {
-			importOptions = i.options.importOptions
-		}
-		if importOptions == nil {
-			// We don't mutate pilosaOptions.importOptions since the default
-			// may be different elsewhere.
-			importOptions = []gopilosa.ImportOption{
-				gopilosa.OptImportBatchSize(int(i.batchSize)),
-				gopilosa.OptImportRoaring(true),
+		var wal *fieldWAL
+		if i.options != nil && i.options.walDir != "" {
+			wal, err = openFieldWAL(i.walDir(fieldName))
+			if err != nil {
+				return errors.Wrapf(err, "opening WAL for field '%s'", fieldName)
 			}
 		}
+		i.recordChans[fieldName] = newChanRecordIterator()
+		i.fields[fieldName] = field
+		importOptions := fieldImportOptions(i.options, i.batchSize, field)
+		if wal != nil {
+			i.importWG.Add(2)
+			go func(c chanRecordIterator) {
+				defer i.importWG.Done()
+				i.writeWAL(fieldName, wal, c)
+			}(i.recordChans[fieldName])
+			go func() {
+				defer i.importWG.Done()
+				i.drainWAL(field, wal, importOptions)
+			}()
+			return nil
+		}
+		i.importWG.Add(1)
 		go func(fram *gopilosa.Field, cbi chanRecordIterator) {
 			defer i.importWG.Done()
-			err := i.client.ImportField(fram, cbi, importOptions...)
-			if err != nil {
-				log.Println(errors.Wrapf(err, "starting field import for %v", fieldName))
-			}
+			i.importField(fram, cbi, importOptions)
 		}(field, i.recordChans[fieldName])
 	}
 	return nil
 }
 
+// fieldImportOptions returns the options for importing into field. options may
+// be nil.
+func fieldImportOptions(options *pilosaOptions, batchSize uint, field *gopilosa.Field) []gopilosa.ImportOption {
+	var importOptions []gopilosa.ImportOption
+	if options != nil {
+		importOptions = options.importOptions
+	}
+	if importOptions == nil {
+		// We don't mutate pilosaOptions.importOptions since the default
+		// may be different elsewhere.
+		importOptions = []gopilosa.ImportOption{
+			gopilosa.OptImportBatchSize(int(batchSize)),
+			gopilosa.OptImportRoaring(true),
+		}
+	}
+	switch field.Options().Type() {
+	case gopilosa.FieldTypeMutex, gopilosa.FieldTypeBool:
+		// Pilosa only supports roaring imports for set and time fields.
+		importOptions = append(importOptions[:len(importOptions):len(importOptions)], gopilosa.OptImportRoaring(false))
+	}
+	return importOptions
+}
+
+// setImportError records err as the error from importing the named field,
+// unless it is nil or there is already an error.
+func (i *Index) setImportError(field string, err error) {
+	if err == nil {
+		return
+	}
+	i.errLock.Lock()
+	if _, ok := i.importErrs[field]; !ok {
+		i.importErrs[field] = err
+	}
+	i.errLock.Unlock()
+}
+
+// setUnackedError records err as an import error which wasn't passed to any
+// acknowledgements, unless it is nil or there is already one.
+func (i *Index) setUnackedError(err error) {
+	if err == nil {
+		return
+	}
+	i.errLock.Lock()
+	if i.unackedErr == nil {
+		i.unackedErr = err
+	}
+	i.errLock.Unlock()
+}
+
+// importField imports the records sent on c into field until c is closed.
+// Each time an importMarker is received, the import is finished off and
+// restarted so that the marker can be told once everything sent before it has
+// been imported. The import is also restarted whenever it switches between
+// setting and clearing, so that they happen in the order they were sent. If
+// an import fails, the records in it are lost, the next marker is given the
+// error (so the acknowledgements waiting on it go through the error policy),
+// and importing carries on with the records after them.
+func (i *Index) importField(field *gopilosa.Field, c chanRecordIterator, importOptions []gopilosa.ImportOption) {
+	clearOptions := append(importOptions[:len(importOptions):len(importOptions)], gopilosa.OptImportClear(true))
+	failure := &importFailure{}
+	var next gopilosa.Record
+	var clear bool
+	for {
+		it := &markerIterator{c: c, stop: make(chan struct{}), first: next, clear: clear, failure: failure}
+		opts := importOptions
+		if clear {
+			opts = clearOptions
+		}
+		if err := i.client.ImportField(field, it, opts...); err != nil {
+			failure.set(errors.Wrapf(err, "importing field '%s'", field.Name()))
+		}
+		marker, closed := it.finish()
+		if marker != nil {
+			marker <- failure.take()
+		}
+		next, clear = it.next, it.clear
+		if closed {
+			// nothing is waiting for this one, so leave it for Close.
+			i.setUnackedError(failure.take())
+			return
+		}
+	}
+}
+
+// importFailure holds the first error from importing a field since one was
+// last given to a marker.
+type importFailure struct {
+	mu  sync.Mutex
+	err error
+}
+
+// set records err, unless there is already an error.
+func (f *importFailure) set(err error) {
+	f.mu.Lock()
+	if f.err == nil {
+		f.err = err
+	}
+	f.mu.Unlock()
+}
+
+// take returns the error and clears it.
+func (f *importFailure) take() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	err := f.err
+	f.err = nil
+	return err
+}
+
 // SetupPilosa returns a new Indexer after creating the given fields and starting importers.
 // You can pass options to the underlying go-pilosa client using the following functions:
 // - pdk.OptPilosaImportOptions: Pass import options. See: https://github.com/pilosa/go-pilosa/blob/master/docs/server-interaction.md#pilosa-client for the list of options you can pass.
 // - pdk.OptPilosaClientOptions: Pass client options. See: https://github.com/pilosa/go-pilosa/blob/master/docs/imports-exports.md#advanced-usage for the list of options you can pass.
+// - pdk.OptPilosaFlushInterval: Flush the Indexer periodically.
+// - pdk.OptPilosaFieldConfigs, pdk.OptPilosaFieldConfigFile: Configure how fields are created.
+// - pdk.OptPilosaWAL: Buffer data in a write-ahead log on disk on its way to Pilosa.
 // Note that each of the functions above should be specified at most once.
 // Example:
 // pdk.SetupPilosa(...,
@@ -235,35 +626,69 @@ func SetupPilosa(hosts []string, indexName string, schema *gopilosa.Schema, batc
 			return nil, errors.Wrap(err, "applying options")
 		}
 	}
-	clientOptions := pilosaOptions.clientOptions
-	if clientOptions == nil {
-		// We don't mutate pilosaOptions.clientOptions since the default
-		// may be different elsewhere.
-		clientOptions = []gopilosa.ClientOption{
-			gopilosa.OptClientSocketTimeout(time.Minute * 60),
-			gopilosa.OptClientConnectTimeout(time.Second * 60),
-			gopilosa.OptClientRetries(5),
-		}
+	client, err := gopilosa.NewClient(hosts, pilosaOptions.clientOpts()...)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating pilosa cluster client")
+	}
+	indexer, err := setupIndex(client, schema, indexName, batchsize, pilosaOptions)
+	if err != nil {
+		return nil, err
+	}
+	if pilosaOptions.flushInterval > 0 {
+		indexer.stopFlushing = make(chan struct{})
+		indexer.flushWG.Add(1)
+		go func() {
+			defer indexer.flushWG.Done()
+			autoFlush(pilosaOptions.flushInterval, indexer.stopFlushing, indexer.swapDirty, indexer.Flush)
+		}()
 	}
+	return indexer, nil
+}
 
+// setupIndex returns a new Index which imports into the named index of
+// schema using client, after creating it and starting importers for its
+// fields.
+func setupIndex(client *gopilosa.Client, schema *gopilosa.Schema, indexName string, batchsize uint, pilosaOptions *pilosaOptions) (*Index, error) {
 	indexer := newIndex(pilosaOptions)
 	indexer.batchSize = batchsize
-	client, err := gopilosa.NewClient(hosts, clientOptions...)
-	if err != nil {
-		return nil, errors.Wrap(err, "creating pilosa cluster client")
-	}
 	indexer.client = client
-	indexer.index = schema.Index(indexName)
-	err = client.SyncSchema(schema)
+	var indexOpts []gopilosa.IndexOption
+	if pilosaOptions.nativeKeys {
+		indexOpts = append(indexOpts, gopilosa.OptIndexKeys(true))
+	}
+	indexer.index = schema.Index(indexName, indexOpts...)
+	err := client.SyncSchema(schema)
 	if err != nil {
 		return nil, errors.Wrap(err, "synchronizing schema")
 	}
+	if pilosaOptions.nativeKeys {
+		// SyncSchema doesn't change the options of an index which already
+		// exists, so check what Pilosa has.
+		serverSchema, err := client.Schema()
+		if err != nil {
+			return nil, errors.Wrap(err, "getting schema")
+		}
+		if idx, ok := serverSchema.Indexes()[indexName]; ok && !idx.Opts().Keys() {
+			return nil, errors.Errorf("index '%s' already exists without keys", indexName)
+		}
+	}
 	for _, field := range indexer.index.Fields() {
 		err := indexer.setupField(field)
 		if err != nil {
 			return nil, errors.Wrapf(err, "setting up field '%s'", field.Name())
 		}
 	}
+	if pilosaOptions.walDir != "" {
+		indexer.attrWAL, err = openFieldWAL(indexer.walDir(attrWALName))
+		if err != nil {
+			return nil, errors.Wrap(err, "opening attribute WAL")
+		}
+		indexer.importWG.Add(1)
+		go func() {
+			defer indexer.importWG.Done()
+			indexer.drainAttrWAL(indexer.attrWAL)
+		}()
+	}
 	return indexer, nil
 }
 
@@ -273,17 +698,128 @@ func newChanRecordIterator() chanRecordIterator {
 	return make(chan gopilosa.Record, 200000)
 }
 
-func (c chanRecordIterator) NextRecord() (gopilosa.Record, error) {
-	b, ok := <-c
+// importMarker is sent through a chanRecordIterator to find out when
+// everything before it has been imported. The result of the import is sent
+// back on it.
+type importMarker chan error
+
+// Shard implements gopilosa.Record.
+func (importMarker) Shard(shardWidth uint64) uint64 { return 0 }
+
+// Less implements gopilosa.Record.
+func (importMarker) Less(other gopilosa.Record) bool { return false }
+
+// clearRecord is sent through a chanRecordIterator in place of a record which
+// should be cleared rather than set.
+type clearRecord struct {
+	rec gopilosa.Record
+}
+
+// Shard implements gopilosa.Record.
+func (c clearRecord) Shard(shardWidth uint64) uint64 { return c.rec.Shard(shardWidth) }
+
+// Less implements gopilosa.Record.
+func (clearRecord) Less(other gopilosa.Record) bool { return false }
+
+// markerIterator is a gopilosa.RecordIterator for a single call to
+// ImportField. It reads from a chanRecordIterator, and ends the import at the
+// first importMarker, or the first record which is to be cleared when the
+// import is setting (or vice versa).
+type markerIterator struct {
+	c    chanRecordIterator
+	stop chan struct{}
+
+	// first is returned before reading from c. It is the record which ended
+	// the previous import.
+	first gopilosa.Record
+
+	// clear is whether the import is clearing records. If a record of the
+	// other kind ends the import, it is held in next and clear is flipped,
+	// ready for the next import.
+	clear bool
+	next  gopilosa.Record
+
+	// failure is shared by all the imports of a field.
+	failure *importFailure
+
+	mu       sync.Mutex
+	finished bool
+	marker   importMarker
+	closed   bool
+}
+
+// NextRecord implements gopilosa.RecordIterator.
+func (m *markerIterator) NextRecord() (gopilosa.Record, error) {
+	if m.first != nil {
+		rec := m.first
+		m.first = nil
+		return rec, nil
+	}
+	var rec gopilosa.Record
+	var ok bool
+	select {
+	case rec, ok = <-m.c:
+	case <-m.stop:
+		return nil, io.EOF
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if !ok {
-		return b, io.EOF
+		m.closed = true
+		return nil, io.EOF
+	}
+	if marker, isMarker := rec.(importMarker); isMarker {
+		if m.finished {
+			// ImportField has already given up, and this is a straggling
+			// read by its reader goroutine.
+			marker <- m.failure.take()
+		} else {
+			m.marker = marker
+		}
+		return nil, io.EOF
 	}
-	return b, nil
+	clear := false
+	if cr, isClear := rec.(clearRecord); isClear {
+		rec, clear = cr.rec, true
+	}
+	if clear != m.clear && !m.finished {
+		m.next, m.clear = rec, clear
+		return nil, io.EOF
+	}
+	return rec, nil
+}
+
+// finish is called when ImportField returns. It returns the marker which ended
+// the import (if any) and whether the underlying channel was closed.
+func (m *markerIterator) finish() (importMarker, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.finished = true
+	close(m.stop)
+	return m.marker, m.closed
 }
 
 type pilosaOptions struct {
 	importOptions []gopilosa.ImportOption
 	clientOptions []gopilosa.ClientOption
+	flushInterval time.Duration
+	fieldConfigs  []FieldConfig
+	walDir        string
+	nativeKeys    bool
+}
+
+// clientOpts returns the options for creating a go-pilosa client.
+func (o *pilosaOptions) clientOpts() []gopilosa.ClientOption {
+	if o.clientOptions != nil {
+		return o.clientOptions
+	}
+	// We don't mutate pilosaOptions.clientOptions since the default may be
+	// different elsewhere.
+	return []gopilosa.ClientOption{
+		gopilosa.OptClientSocketTimeout(time.Minute * 60),
+		gopilosa.OptClientConnectTimeout(time.Second * 60),
+		gopilosa.OptClientRetries(5),
+	}
 }
 
 type PilosaOption func(opt *pilosaOptions) error
@@ -301,3 +837,25 @@ func OptPilosaClientOptions(options ...gopilosa.ClientOption) PilosaOption {
 		return nil
 	}
 }
+
+// OptPilosaNativeKeys makes Pilosa translate keys to IDs rather than relying
+// on local translators. The index is created with column keys, and set, mutex
+// and time fields are created with row keys. uint64 columns, and rows in keyed
+// fields, are turned into keys with their decimal representation. It is an
+// error if the index already exists without keys.
+func OptPilosaNativeKeys(enable bool) PilosaOption {
+	return func(pilosaOpt *pilosaOptions) error {
+		pilosaOpt.nativeKeys = enable
+		return nil
+	}
+}
+
+// OptPilosaFlushInterval makes the Indexer flush at least every interval, so
+// that data is never waiting to be imported (and records waiting to be
+// acknowledged) for much longer than that.
+func OptPilosaFlushInterval(interval time.Duration) PilosaOption {
+	return func(pilosaOpt *pilosaOptions) error {
+		pilosaOpt.flushInterval = interval
+		return nil
+	}
+}
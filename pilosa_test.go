@@ -34,7 +34,14 @@ package pdk_test
 
 import (
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
 	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -155,3 +162,655 @@ func TestSetupPilosa(t *testing.T) {
 	}
 
 }
+
+func TestIndexAcknowledge(t *testing.T) {
+	s := ptest.MustRunCluster(t, 1)
+	hosts := []string{s[0].URL()}
+
+	indexer, err := pdk.SetupPilosa(hosts, "ackindex", nil, 3)
+	if err != nil {
+		t.Fatalf("SetupPilosa: %v", err)
+	}
+	client := indexer.Client()
+	schema, err := client.Schema()
+	if err != nil {
+		t.Fatalf("getting schema: %v", err)
+	}
+	field := schema.Index("ackindex").Field("f")
+
+	acks := make(chan error, 10)
+	for col := uint64(0); col < 4; col++ {
+		indexer.AddColumn("f", col, uint64(1))
+		indexer.(pdk.Acknowledger).Acknowledge(func(err error) {
+			resp, qerr := client.Query(field.Row(1))
+			if qerr != nil {
+				t.Errorf("querying: %v", qerr)
+			} else if n := len(resp.Result().Row().Columns); n < 3 {
+				t.Errorf("acknowledged before import, only %d columns set", n)
+			}
+			acks <- err
+		})
+	}
+	if len(acks) != 3 {
+		t.Fatalf("expected first 3 acks after a full batch, got %d", len(acks))
+	}
+	if err := indexer.Close(); err != nil {
+		t.Fatalf("closing indexer: %v", err)
+	}
+	close(acks)
+	n := 0
+	for err := range acks {
+		if err != nil {
+			t.Fatalf("unexpected import error: %v", err)
+		}
+		n++
+	}
+	if n != 4 {
+		t.Fatalf("expected 4 acks, got %d", n)
+	}
+}
+
+func TestIndexErrors(t *testing.T) {
+	s := ptest.MustRunCluster(t, 1)
+	hosts := []string{s[0].URL()}
+
+	schema := gopilosa.NewSchema()
+	index := schema.Index("errindex")
+	index.Field("small", gopilosa.OptFieldTypeInt(0, 10))
+	indexer, err := pdk.SetupPilosa(hosts, index.Name(), schema, 10, pdk.OptPilosaClientOptions(gopilosa.OptClientRetries(0)))
+	if err != nil {
+		t.Fatalf("SetupPilosa: %v", err)
+	}
+
+	if err := indexer.AddColumn("f", 1, uint64(1)); err == nil {
+		t.Fatal("expected error adding column with int id")
+	}
+	if err := indexer.AddValue("small", uint64(1), 1000); err != nil {
+		t.Fatalf("adding value: %v", err)
+	}
+	if err := indexer.Close(); err == nil || !strings.Contains(err.Error(), "small") {
+		t.Fatalf("expected import error for field 'small' from Close, got: %v", err)
+	}
+}
+
+func TestIndexErrorsRecover(t *testing.T) {
+	s := ptest.MustRunCluster(t, 1)
+	hosts := []string{s[0].URL()}
+
+	schema := gopilosa.NewSchema()
+	index := schema.Index("recoverindex")
+	small := index.Field("small", gopilosa.OptFieldTypeInt(0, 10))
+	indexer, err := pdk.SetupPilosa(hosts, index.Name(), schema, 2, pdk.OptPilosaClientOptions(gopilosa.OptClientRetries(0)))
+	if err != nil {
+		t.Fatalf("SetupPilosa: %v", err)
+	}
+	client := indexer.Client()
+
+	var acks []error
+	add := func(col uint64, val int64) {
+		if err := indexer.AddValue("small", col, val); err != nil {
+			t.Fatalf("adding value %d to column %d: %v", val, col, err)
+		}
+		indexer.(pdk.Acknowledger).Acknowledge(func(err error) {
+			acks = append(acks, err)
+		})
+	}
+	add(1, 1000)
+	add(2, 5)
+	if len(acks) != 2 || acks[0] == nil || acks[1] == nil {
+		t.Fatalf("expected the failed batch to be acknowledged with errors, got %v", acks)
+	}
+	add(3, 7)
+	add(4, 8)
+	if len(acks) != 4 || acks[2] != nil || acks[3] != nil {
+		t.Fatalf("expected the next batch to be acknowledged without errors, got %v", acks)
+	}
+	resp, err := client.Query(small.GT(6))
+	if err != nil {
+		t.Fatalf("querying: %v", err)
+	}
+	if cols := resp.Result().Row().Columns; len(cols) != 2 || cols[0] != 3 || cols[1] != 4 {
+		t.Fatalf("unexpected columns imported after a failed import: %v", cols)
+	}
+	if err := indexer.Close(); err != nil {
+		t.Fatalf("expected no error from Close once the failure was acknowledged, got: %v", err)
+	}
+}
+
+func TestIndexFlush(t *testing.T) {
+	s := ptest.MustRunCluster(t, 1)
+	hosts := []string{s[0].URL()}
+
+	indexer, err := pdk.SetupPilosa(hosts, "flushindex", nil, 1000)
+	if err != nil {
+		t.Fatalf("SetupPilosa: %v", err)
+	}
+	defer indexer.Close()
+	client := indexer.Client()
+	field := gopilosa.NewSchema().Index("flushindex").Field("f")
+
+	for col := uint64(0); col < 2; col++ {
+		if err := indexer.AddColumn("f", col, uint64(1)); err != nil {
+			t.Fatalf("adding column: %v", err)
+		}
+		if err := indexer.Flush(); err != nil {
+			t.Fatalf("flushing: %v", err)
+		}
+		resp, err := client.Query(field.Row(1))
+		if err != nil {
+			t.Fatalf("querying: %v", err)
+		}
+		if cols := resp.Result().Row().Columns; len(cols) != int(col)+1 {
+			t.Fatalf("unexpected columns after flush %d: %v", col, cols)
+		}
+	}
+}
+
+func TestIndexAutoFlush(t *testing.T) {
+	s := ptest.MustRunCluster(t, 1)
+	hosts := []string{s[0].URL()}
+
+	indexer, err := pdk.SetupPilosa(hosts, "autoflushindex", nil, 1000, pdk.OptPilosaFlushInterval(time.Millisecond*10))
+	if err != nil {
+		t.Fatalf("SetupPilosa: %v", err)
+	}
+	defer indexer.Close()
+	client := indexer.Client()
+	field := gopilosa.NewSchema().Index("autoflushindex").Field("f")
+
+	if err := indexer.AddColumn("f", uint64(7), uint64(1)); err != nil {
+		t.Fatalf("adding column: %v", err)
+	}
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		resp, err := client.Query(field.Row(1))
+		if err != nil {
+			t.Fatalf("querying: %v", err)
+		}
+		if cols := resp.Result().Row().Columns; len(cols) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("bit was not imported without an explicit flush")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestIndexFieldConfigs(t *testing.T) {
+	s := ptest.MustRunCluster(t, 1)
+	hosts := []string{s[0].URL()}
+
+	min, max := int64(0), int64(150)
+	indexer, err := pdk.SetupPilosa(hosts, "confindex", nil, 1000, pdk.OptPilosaFieldConfigs(
+		pdk.FieldConfig{Name: "m_*", Type: "mutex", CacheType: "lru", CacheSize: 50},
+		pdk.FieldConfig{Name: "age", Min: &min, Max: &max},
+		pdk.FieldConfig{Name: "day", Quantum: "YMD"},
+		pdk.FieldConfig{Name: "notime", Type: "set"},
+	))
+	if err != nil {
+		t.Fatalf("SetupPilosa: %v", err)
+	}
+	defer indexer.Close()
+	ts := time.Date(2019, 1, 2, 3, 0, 0, 0, time.UTC)
+	if err := indexer.AddColumn("m_color", uint64(1), uint64(2)); err != nil {
+		t.Fatalf("adding column: %v", err)
+	}
+	if err := indexer.AddValue("age", uint64(1), 30); err != nil {
+		t.Fatalf("adding value: %v", err)
+	}
+	if err := indexer.AddColumnTimestamp("day", uint64(1), uint64(2), ts); err != nil {
+		t.Fatalf("adding column: %v", err)
+	}
+	if err := indexer.AddColumnTimestamp("notime", uint64(1), uint64(2), ts); err != nil {
+		t.Fatalf("adding column: %v", err)
+	}
+	if err := indexer.AddValue("m_size", uint64(1), 3); err == nil {
+		t.Fatal("expected error adding a value to a mutex field")
+	}
+	if err := indexer.Flush(); err != nil {
+		t.Fatalf("flushing: %v", err)
+	}
+
+	schema, err := indexer.Client().Schema()
+	if err != nil {
+		t.Fatalf("getting schema: %v", err)
+	}
+	fields := schema.Index("confindex").Fields()
+	if _, ok := fields["m_size"]; ok {
+		t.Fatal("field m_size should not have been created")
+	}
+	opts := fields["m_color"].Options()
+	if opts.Type() != gopilosa.FieldTypeMutex || opts.CacheType() != gopilosa.CacheTypeLRU || opts.CacheSize() != 50 {
+		t.Fatalf("unexpected options for m_color: %v", opts)
+	}
+	opts = fields["age"].Options()
+	if opts.Type() != gopilosa.FieldTypeInt || opts.Min() != 0 || opts.Max() != 150 {
+		t.Fatalf("unexpected options for age: %v", opts)
+	}
+	opts = fields["day"].Options()
+	if opts.Type() != gopilosa.FieldTypeTime || opts.TimeQuantum() != gopilosa.TimeQuantumYearMonthDay {
+		t.Fatalf("unexpected options for day: %v", opts)
+	}
+	opts = fields["notime"].Options()
+	if opts.Type() != gopilosa.FieldTypeSet || opts.CacheType() != gopilosa.CacheTypeRanked || opts.CacheSize() != 100000 {
+		t.Fatalf("unexpected options for notime: %v", opts)
+	}
+}
+
+func TestIndexMutexAndBool(t *testing.T) {
+	s := ptest.MustRunCluster(t, 1)
+	hosts := []string{s[0].URL()}
+
+	indexer, err := pdk.SetupPilosa(hosts, "kindindex", nil, 1000)
+	if err != nil {
+		t.Fatalf("SetupPilosa: %v", err)
+	}
+	defer indexer.Close()
+	for _, row := range []uint64{1, 2} {
+		if err := indexer.AddMutex("status", uint64(1), row); err != nil {
+			t.Fatalf("adding mutex: %v", err)
+		}
+		if err := indexer.Flush(); err != nil {
+			t.Fatalf("flushing: %v", err)
+		}
+	}
+	if err := indexer.AddBool("active", uint64(1), true); err != nil {
+		t.Fatalf("adding bool: %v", err)
+	}
+	if err := indexer.AddBool("active", uint64(2), false); err != nil {
+		t.Fatalf("adding bool: %v", err)
+	}
+	if err := indexer.Flush(); err != nil {
+		t.Fatalf("flushing: %v", err)
+	}
+
+	client := indexer.Client()
+	schema, err := client.Schema()
+	if err != nil {
+		t.Fatalf("getting schema: %v", err)
+	}
+	index := schema.Index("kindindex")
+	fields := index.Fields()
+	if typ := fields["status"].Options().Type(); typ != gopilosa.FieldTypeMutex {
+		t.Fatalf("expected mutex field, got %s", typ)
+	}
+	if typ := fields["active"].Options().Type(); typ != gopilosa.FieldTypeBool {
+		t.Fatalf("expected bool field, got %s", typ)
+	}
+
+	for q, expected := range map[*gopilosa.PQLRowQuery][]uint64{
+		fields["status"].Row(1):     nil,
+		fields["status"].Row(2):     {1},
+		fields["active"].Row(true):  {1},
+		fields["active"].Row(false): {2},
+	} {
+		resp, err := client.Query(q)
+		if err != nil {
+			t.Fatalf("querying: %v", err)
+		}
+		if cols := resp.Result().Row().Columns; !reflect.DeepEqual(cols, expected) && len(cols)+len(expected) > 0 {
+			t.Fatalf("expected %v for %s, got %v", expected, q.Serialize(), cols)
+		}
+	}
+}
+
+func TestIndexClear(t *testing.T) {
+	s := ptest.MustRunCluster(t, 1)
+	hosts := []string{s[0].URL()}
+
+	indexer, err := pdk.SetupPilosa(hosts, "clearindex", nil, 1000)
+	if err != nil {
+		t.Fatalf("SetupPilosa: %v", err)
+	}
+	defer indexer.Close()
+	for _, row := range []uint64{1, 2} {
+		if err := indexer.AddColumn("f", uint64(1), row); err != nil {
+			t.Fatalf("adding column: %v", err)
+		}
+	}
+	if err := indexer.AddValue("v", uint64(1), 10); err != nil {
+		t.Fatalf("adding value: %v", err)
+	}
+	if err := indexer.Flush(); err != nil {
+		t.Fatalf("flushing: %v", err)
+	}
+
+	// Clears and sets are imported in order.
+	if err := indexer.ClearColumn("f", uint64(1), uint64(1)); err != nil {
+		t.Fatalf("clearing column: %v", err)
+	}
+	if err := indexer.AddColumn("f", uint64(1), uint64(3)); err != nil {
+		t.Fatalf("adding column: %v", err)
+	}
+	if err := indexer.ClearColumn("f", uint64(1), uint64(3)); err != nil {
+		t.Fatalf("clearing column: %v", err)
+	}
+	if err := indexer.AddColumn("f", uint64(2), uint64(3)); err != nil {
+		t.Fatalf("adding column: %v", err)
+	}
+	if err := indexer.ClearValue("v", uint64(1)); err != nil {
+		t.Fatalf("clearing value: %v", err)
+	}
+	if err := indexer.ClearValue("f", uint64(1)); err == nil {
+		t.Fatal("expected error clearing a value from a set field")
+	}
+	if err := indexer.ClearColumn("nofield", uint64(1), uint64(1)); err != nil {
+		t.Fatalf("clearing column from unknown field: %v", err)
+	}
+	if err := indexer.Flush(); err != nil {
+		t.Fatalf("flushing: %v", err)
+	}
+
+	client := indexer.Client()
+	index := gopilosa.NewSchema().Index("clearindex")
+	f := index.Field("f")
+	for row, expected := range map[uint64][]uint64{1: nil, 2: {1}, 3: {2}} {
+		resp, err := client.Query(f.Row(row))
+		if err != nil {
+			t.Fatalf("querying: %v", err)
+		}
+		if cols := resp.Result().Row().Columns; !reflect.DeepEqual(cols, expected) && len(cols)+len(expected) > 0 {
+			t.Fatalf("expected %v in row %d, got %v", expected, row, cols)
+		}
+	}
+	resp, err := client.Query(index.Field("v").NotNull())
+	if err != nil {
+		t.Fatalf("querying: %v", err)
+	}
+	if cols := resp.Result().Row().Columns; len(cols) != 0 {
+		t.Fatalf("expected value to be cleared, got columns %v", cols)
+	}
+	schema, err := client.Schema()
+	if err != nil {
+		t.Fatalf("getting schema: %v", err)
+	}
+	if _, ok := schema.Index("clearindex").Fields()["nofield"]; ok {
+		t.Fatal("clearing from an unknown field shouldn't create it")
+	}
+}
+
+func TestIndexWAL(t *testing.T) {
+	s := ptest.MustRunCluster(t, 1)
+	dir, err := ioutil.TempDir("", "wal")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Pilosa is "down" while down is set, as far as the Index can tell.
+	var down int32
+	target, err := url.Parse(s[0].URL())
+	if err != nil {
+		t.Fatalf("parsing url: %v", err)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	hosts := []string{server.URL}
+	setup := func() pdk.Indexer {
+		indexer, err := pdk.SetupPilosa(hosts, "walindex", nil, 10, pdk.OptPilosaWAL(dir), pdk.OptPilosaClientOptions(gopilosa.OptClientRetries(0)))
+		if err != nil {
+			t.Fatalf("SetupPilosa: %v", err)
+		}
+		return indexer
+	}
+	field := gopilosa.NewSchema().Index("walindex").Field("f")
+	client, err := gopilosa.NewClient(s[0].URL())
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	waitForColumns := func(expected []uint64) {
+		deadline := time.Now().Add(time.Second * 10)
+		for {
+			resp, err := client.Query(field.Row(1))
+			if err != nil {
+				t.Fatalf("querying: %v", err)
+			}
+			cols := resp.Result().Row().Columns
+			if reflect.DeepEqual(cols, expected) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected columns %v, got %v", expected, cols)
+			}
+			time.Sleep(time.Millisecond * 50)
+		}
+	}
+	waitForAttrs := func(expected map[string]interface{}) {
+		deadline := time.Now().Add(time.Second * 10)
+		for {
+			resp, err := client.Query(field.Row(1))
+			if err != nil {
+				t.Fatalf("querying: %v", err)
+			}
+			attrs := resp.Result().Row().Attributes
+			if reflect.DeepEqual(attrs, expected) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected row attributes %v, got %v", expected, attrs)
+			}
+			time.Sleep(time.Millisecond * 50)
+		}
+	}
+
+	indexer := setup()
+	if err := indexer.AddColumn("f", uint64(0), uint64(1)); err != nil {
+		t.Fatalf("adding column: %v", err)
+	}
+	waitForColumns([]uint64{0})
+
+	// Adding and flushing don't wait for Pilosa, and the import is retried
+	// until it comes back. The same goes for attributes.
+	atomic.StoreInt32(&down, 1)
+	if err := indexer.AddColumn("f", uint64(1), uint64(1)); err != nil {
+		t.Fatalf("adding column: %v", err)
+	}
+	if err := indexer.AddRowAttr("f", uint64(1), "color", "red"); err != nil {
+		t.Fatalf("adding row attribute: %v", err)
+	}
+	if err := indexer.Flush(); err != nil {
+		t.Fatalf("flushing: %v", err)
+	}
+	time.Sleep(time.Millisecond * 500)
+	atomic.StoreInt32(&down, 0)
+	waitForColumns([]uint64{0, 1})
+	waitForAttrs(map[string]interface{}{"color": "red"})
+
+	// What can't be imported before closing is imported the next time.
+	atomic.StoreInt32(&down, 1)
+	if err := indexer.AddColumn("f", uint64(2), uint64(1)); err != nil {
+		t.Fatalf("adding column: %v", err)
+	}
+	if err := indexer.AddRowAttr("f", uint64(1), "color", "blue"); err != nil {
+		t.Fatalf("adding row attribute: %v", err)
+	}
+	if err := indexer.Close(); err == nil {
+		t.Fatal("expected error closing while Pilosa is down")
+	}
+	atomic.StoreInt32(&down, 0)
+	indexer = setup()
+	waitForColumns([]uint64{0, 1, 2})
+	waitForAttrs(map[string]interface{}{"color": "blue"})
+	if err := indexer.Close(); err != nil {
+		t.Fatalf("closing: %v", err)
+	}
+}
+
+func TestMultiIndex(t *testing.T) {
+	s := ptest.MustRunCluster(t, 1)
+	hosts := []string{s[0].URL()}
+
+	indexer, err := pdk.SetupMultiPilosa(hosts, "defaultindex", 1000)
+	if err != nil {
+		t.Fatalf("SetupMultiPilosa: %v", err)
+	}
+	if err := indexer.AddColumn("f", uint64(1), uint64(1)); err != nil {
+		t.Fatalf("adding to default index: %v", err)
+	}
+	for _, index := range []string{"users", "sessions"} {
+		idx, err := indexer.IndexerFor(index)
+		if err != nil {
+			t.Fatalf("getting indexer for %s: %v", index, err)
+		}
+		if idx.Client() != indexer.Client() {
+			t.Fatal("expected indexes to share a client")
+		}
+		if err := idx.AddColumn("f", uint64(2), uint64(1)); err != nil {
+			t.Fatalf("adding to %s: %v", index, err)
+		}
+	}
+	acked := make(chan error, 1)
+	indexer.Acknowledge(func(err error) { acked <- err })
+	if err := indexer.Flush(); err != nil {
+		t.Fatalf("flushing: %v", err)
+	}
+	if err := <-acked; err != nil {
+		t.Fatalf("acknowledgement error: %v", err)
+	}
+
+	client := indexer.Client()
+	schema, err := client.Schema()
+	if err != nil {
+		t.Fatalf("getting schema: %v", err)
+	}
+	for index, expected := range map[string][]uint64{
+		"defaultindex": {1},
+		"users":        {2},
+		"sessions":     {2},
+	} {
+		resp, err := client.Query(schema.Index(index).Field("f").Row(1))
+		if err != nil {
+			t.Fatalf("querying %s: %v", index, err)
+		}
+		if cols := resp.Result().Row().Columns; !reflect.DeepEqual(cols, expected) {
+			t.Fatalf("expected %v in %s, got %v", expected, index, cols)
+		}
+	}
+	if err := indexer.Close(); err != nil {
+		t.Fatalf("closing: %v", err)
+	}
+}
+
+func TestIndexAttrs(t *testing.T) {
+	s := ptest.MustRunCluster(t, 1)
+	hosts := []string{s[0].URL()}
+
+	indexer, err := pdk.SetupPilosa(hosts, "attrindex", nil, 1000)
+	if err != nil {
+		t.Fatalf("SetupPilosa: %v", err)
+	}
+	defer indexer.Close()
+	if err := indexer.AddColAttr(uint64(1), "bad name", "x"); err == nil {
+		t.Fatal("expected error for invalid attribute name")
+	}
+	if err := indexer.AddColAttr(uint64(1), "name", []string{"x"}); err == nil {
+		t.Fatal("expected error for invalid attribute value")
+	}
+	for _, err := range []error{
+		indexer.AddColumn("f", uint64(1), uint64(1)),
+		indexer.AddColAttr(uint64(1), "name", "first"),
+		indexer.AddColAttr(uint64(1), "score", 3),
+		indexer.AddColAttr(uint64(1), "name", "one"),
+		indexer.AddRowAttr("f", uint64(1), "color", "red"),
+		indexer.AddRowAttr("g", uint64(2), "active", true),
+	} {
+		if err != nil {
+			t.Fatalf("adding: %v", err)
+		}
+	}
+	if err := indexer.Flush(); err != nil {
+		t.Fatalf("flushing: %v", err)
+	}
+
+	client := indexer.Client()
+	schema, err := client.Schema()
+	if err != nil {
+		t.Fatalf("getting schema: %v", err)
+	}
+	index := schema.Index("attrindex")
+	resp, err := client.Query(index.Field("f").Row(1), gopilosa.OptQueryColumnAttrs(true))
+	if err != nil {
+		t.Fatalf("querying: %v", err)
+	}
+	if attrs := resp.Result().Row().Attributes; !reflect.DeepEqual(attrs, map[string]interface{}{"color": "red"}) {
+		t.Fatalf("unexpected row attributes %v", attrs)
+	}
+	cols := resp.Columns()
+	if len(cols) != 1 || !reflect.DeepEqual(cols[0].Attributes, map[string]interface{}{"name": "one", "score": int64(3)}) {
+		t.Fatalf("unexpected column attributes %v", cols)
+	}
+	resp, err = client.Query(index.Field("g").Row(2))
+	if err != nil {
+		t.Fatalf("querying: %v", err)
+	}
+	if attrs := resp.Result().Row().Attributes; !reflect.DeepEqual(attrs, map[string]interface{}{"active": true}) {
+		t.Fatalf("unexpected row attributes %v", attrs)
+	}
+}
+
+func TestIndexNativeKeys(t *testing.T) {
+	s := ptest.MustRunCluster(t, 1)
+	hosts := []string{s[0].URL()}
+
+	indexer, err := pdk.SetupPilosa(hosts, "keyindex", nil, 1000, pdk.OptPilosaNativeKeys(true))
+	if err != nil {
+		t.Fatalf("SetupPilosa: %v", err)
+	}
+	defer indexer.Close()
+	for _, err := range []error{
+		indexer.AddColumn("f", "a", "x"),
+		indexer.AddColumn("f", uint64(7), uint64(3)),
+		indexer.AddValue("v", "a", 12),
+		indexer.AddColAttr("a", "name", "first"),
+	} {
+		if err != nil {
+			t.Fatalf("adding: %v", err)
+		}
+	}
+	if err := indexer.Flush(); err != nil {
+		t.Fatalf("flushing: %v", err)
+	}
+
+	client := indexer.Client()
+	schema, err := client.Schema()
+	if err != nil {
+		t.Fatalf("getting schema: %v", err)
+	}
+	index := schema.Index("keyindex")
+	if !index.Opts().Keys() || !index.Field("f").Options().Keys() || index.Field("v").Options().Keys() {
+		t.Fatalf("unexpected keys: index %v, f %v, v %v", index.Opts().Keys(), index.Field("f").Options().Keys(), index.Field("v").Options().Keys())
+	}
+	resp, err := client.Query(index.Field("f").Row("x"), gopilosa.OptQueryColumnAttrs(true))
+	if err != nil {
+		t.Fatalf("querying: %v", err)
+	}
+	if keys := resp.Result().Row().Keys; !reflect.DeepEqual(keys, []string{"a"}) {
+		t.Fatalf("unexpected columns for row x: %v", keys)
+	}
+	if cols := resp.Columns(); len(cols) != 1 || cols[0].Attributes["name"] != "first" {
+		t.Fatalf("unexpected column attributes %v", cols)
+	}
+	resp, err = client.Query(index.Field("f").Row("3"))
+	if err != nil {
+		t.Fatalf("querying: %v", err)
+	}
+	if keys := resp.Result().Row().Keys; !reflect.DeepEqual(keys, []string{"7"}) {
+		t.Fatalf("unexpected columns for row 3: %v", keys)
+	}
+
+	_, err = pdk.SetupPilosa(hosts, "unkeyed", nil, 1000)
+	if err != nil {
+		t.Fatalf("SetupPilosa: %v", err)
+	}
+	if _, err = pdk.SetupPilosa(hosts, "unkeyed", nil, 1000, pdk.OptPilosaNativeKeys(true)); err == nil {
+		t.Fatal("expected error for existing index without keys")
+	}
+}
@@ -71,6 +71,23 @@ type Source interface {
 	Record() (interface{}, error)
 }
 
+// Acker is an optional interface for Sources which need to know when the
+// records they returned are done with, e.g. so they can commit offsets only
+// once the data has made it into Pilosa. The Ingester gets records from an
+// Acker with RecordToken instead of Record, and passes the token for every
+// record back to Ack exactly once, but not necessarily in order. err is nil if
+// the record was imported (or deliberately dropped by an ErrorPolicy), and
+// otherwise says why it wasn't.
+type Acker interface {
+	RecordToken() (rec interface{}, token AckToken, err error)
+	Ack(token AckToken, err error) error
+}
+
+// AckToken identifies a record returned by an Acker. It means nothing to the
+// Ingester, which only passes it back to Ack, so an Acker can hand them out
+// from a counter and use them to look up whatever it needs to track.
+type AckToken uint64
+
 // Peeker is an interface for peeking ahead at the next record
 // to be returned by Source.Record().
 type Peeker interface {
@@ -83,6 +100,35 @@ type RecordParser interface {
 	Parse(data interface{}) (*Entity, error)
 }
 
+// SamplingParser is implemented by RecordParsers which need to see a sample
+// of the records before parsing any, such as a GenericParser inferring types.
+// Before running the pipeline, an Ingester reads up to SampleSize records from
+// the Source, passing each to Sample, and then calls EndSample. The sampled
+// records are then parsed first, in order.
+type SamplingParser interface {
+	SampleSize() int
+	Sample(data interface{})
+	EndSample()
+}
+
+// DirectParser is implemented by RecordParsers which can also turn raw
+// records straight into PilosaRecords, doing the work of a RecordMapper
+// without building an Entity, such as those generated by pdk gen-parser.
+// RecordMapper returns the mapper whose work ParseRecord does; an Ingester
+// only uses ParseRecord if that is its own mapper.
+type DirectParser interface {
+	ParseRecord(data interface{}) (PilosaRecord, error)
+	RecordMapper() RecordMapper
+}
+
+// OrderedMapper is implemented by RecordMappers which may need to see the
+// records for each column in the order they were read, and to have their
+// PilosaRecords indexed in that order, such as a CollapsingMapper with
+// ReplaceFields. An Ingester won't run concurrently if NeedsOrder is true.
+type OrderedMapper interface {
+	NeedsOrder() bool
+}
+
 // RecordMapper is the interface for taking parsed records from the Parser and
 // figuring out what bits and values to set in Pilosa. RecordMappers usually
 // have a Translator and a Nexter for converting arbitrary values to monotonic
@@ -92,17 +138,48 @@ type RecordMapper interface {
 	Map(record *Entity) (PilosaRecord, error)
 }
 
-// Indexer puts stuff into Pilosa.
+// Indexer puts stuff into Pilosa. Data is imported in the background, so the
+// errors returned when adding it are for problems which can be detected
+// straight away - Close waits for the imports to finish and returns any errors
+// from them.
 type Indexer interface {
-	AddColumn(field string, col, row uint64OrString)
-	AddColumnTimestamp(field string, col, row uint64OrString, ts time.Time)
-	AddValue(field string, col uint64OrString, val int64)
-	// AddRowAttr(field string, row uint64, key string, value AttrVal)
-	// AddColAttr(col uint64, key string, value AttrVal)
+	AddColumn(field string, col, row uint64OrString) error
+	AddColumnTimestamp(field string, col, row uint64OrString, ts time.Time) error
+	AddValue(field string, col uint64OrString, val int64) error
+	AddMutex(field string, col, row uint64OrString) error
+	AddBool(field string, col uint64OrString, val bool) error
+	ClearColumn(field string, col, row uint64OrString) error
+	ClearValue(field string, col uint64OrString) error
+	// AddRowAttr and AddColAttr set attributes on a row or a column. Values
+	// must be strings, bools, integers or floats.
+	AddRowAttr(field string, row uint64OrString, key string, value interface{}) error
+	AddColAttr(col uint64OrString, key string, value interface{}) error
+
+	// Flush blocks until everything added so far has been imported, and
+	// returns any errors from importing it. The Indexer can still be used
+	// afterwards.
+	Flush() error
 	Close() error
 	Client() *gopilosa.Client
 }
 
+// Acknowledger is an optional interface for Indexers which can tell when what
+// has been added to them has been imported into Pilosa.
+type Acknowledger interface {
+	// Acknowledge arranges for ack to be called once everything which was
+	// added to the Indexer before the call has been imported. The error is
+	// non-nil if the import failed.
+	Acknowledge(ack func(err error))
+}
+
+// IndexRouter is an optional interface for Indexers which can write to more
+// than one Pilosa index. The Ingester uses it for PilosaRecords which name an
+// Index.
+type IndexRouter interface {
+	// IndexerFor returns the Indexer for the named index.
+	IndexerFor(index string) (Indexer, error)
+}
+
 // Transformer is an interface for something which performs an in-place
 // transformation on an Entity. It might enrich the entity by adding new fields,
 // delete existing fields that don't need to be indexed, or change fields.
@@ -36,8 +36,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
 	"net/url"
 	"strings"
@@ -77,18 +79,28 @@ type pilosaForwarder struct {
 	km        KeyMapper
 	colMapper FieldTranslator
 	proxy     Proxy
+
+	// FieldConfigs with a Scale make the forwarder multiply numbers in
+	// conditions on their fields (e.g. Row(price > 3.99)) by 10^Scale, and
+	// divide Sum, Min and Max results by it, so that queries see the values
+	// which were mapped rather than the stored ones.
+	FieldConfigs []FieldConfig
 }
 
 // NewPilosaForwarder returns a new pilosaForwarder which forwards all requests
 // to `phost`. It inspects pilosa responses and runs the row ids through the
-// Translator `t` to translate them to whatever they were mapped from.
+// Translator `t` to translate them to whatever they were mapped from. If there
+// are no translators (e.g. because Pilosa is translating keys itself), no
+// mapping is needed and requests and responses are passed through unchanged.
 func NewPilosaForwarder(phost string, t Translator, colTranslator ...FieldTranslator) *pilosaForwarder {
 	if !strings.HasPrefix(phost, "http://") {
 		phost = "http://" + phost
 	}
 	f := &pilosaForwarder{
 		phost: phost,
-		km:    NewPilosaKeyMapper(t, colTranslator...),
+	}
+	if t != nil || (len(colTranslator) > 0 && colTranslator[0] != nil) {
+		f.km = NewPilosaKeyMapper(t, colTranslator...)
 	}
 	f.proxy = NewPilosaProxy(phost, &f.client)
 	return f
@@ -102,6 +114,16 @@ func (p *pilosaForwarder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	scaled := hasScale(p.FieldConfigs)
+	km := p.km
+	if km == nil {
+		if !scaled {
+			p.passThrough(w, req, body)
+			return
+		}
+		km = NewPilosaKeyMapper(nil)
+	}
+
 	// inspect the request to determine which queries have a field - the Translator
 	// needs the field for it's lookups.
 	fields, err := GetFields(body)
@@ -110,7 +132,15 @@ func (p *pilosaForwarder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	body, err = p.km.MapRequest(body)
+	if scaled {
+		body, err = scaleRequest(body, p.FieldConfigs)
+		if err != nil {
+			http.Error(w, "scaling request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	body, err = km.MapRequest(body)
 	if err != nil {
 		http.Error(w, "mapping request: "+err.Error(), http.StatusBadRequest)
 		return
@@ -140,7 +170,7 @@ func (p *pilosaForwarder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 	for i, result := range pilosaResp.Results {
 		if fields[i] == "" {
-			mappedResult, err := p.km.MapResult(fields[i], result)
+			mappedResult, err := km.MapResult(fields[i], result)
 			if err != nil {
 				log.Printf("mapping fieldless result: %v", err)
 				mappedResp.Results[i] = result
@@ -148,11 +178,14 @@ func (p *pilosaForwarder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 				mappedResp.Results[i] = mappedResult
 			}
 		} else {
-			mappedResult, err := p.km.MapResult(fields[i], result)
+			mappedResult, err := km.MapResult(fields[i], result)
 			if err != nil {
 				http.Error(w, "mapping result: "+err.Error(), http.StatusInternalServerError)
 				return
 			}
+			if scale := findFieldConfig(p.FieldConfigs, fields[i]).Scale; scale != 0 {
+				unscaleResult(mappedResult, scale)
+			}
 			mappedResp.Results[i] = mappedResult
 		}
 	}
@@ -170,6 +203,102 @@ func (p *pilosaForwarder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// scaleRequest multiplies the numbers in conditions on fields with a Scale by
+// 10^Scale.
+func scaleRequest(body []byte, configs []FieldConfig) ([]byte, error) {
+	query, err := pql.ParseString(string(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing string")
+	}
+	for _, call := range query.Calls {
+		if err := scaleCall(call, configs); err != nil {
+			return nil, err
+		}
+	}
+	return []byte(query.String()), nil
+}
+
+func scaleCall(call *pql.Call, configs []FieldConfig) error {
+	for field, arg := range call.Args {
+		cond, ok := arg.(*pql.Condition)
+		if !ok || strings.HasPrefix(field, "_") {
+			continue
+		}
+		scale := findFieldConfig(configs, field).Scale
+		if scale == 0 {
+			continue
+		}
+		switch val := cond.Value.(type) {
+		case []interface{}:
+			scaled := make([]interface{}, len(val))
+			for i, v := range val {
+				s, err := scaleNumber(v, scale)
+				if err != nil {
+					return errors.Wrapf(err, "scaling condition on '%s'", field)
+				}
+				scaled[i] = s
+			}
+			cond.Value = scaled
+		default:
+			s, err := scaleNumber(val, scale)
+			if err != nil {
+				return errors.Wrapf(err, "scaling condition on '%s'", field)
+			}
+			cond.Value = s
+		}
+	}
+	for _, child := range call.Children {
+		if err := scaleCall(child, configs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scaleNumber(v interface{}, scale int) (int64, error) {
+	switch n := v.(type) {
+	case int64:
+		return scaleValue(I64(n), scale), nil
+	case float64:
+		return scaleValue(F64(n), scale), nil
+	default:
+		return 0, errors.Errorf("expected a number, but got %T %#v", v, v)
+	}
+}
+
+// unscaleResult divides the value of a Sum, Min or Max result by 10^scale.
+func unscaleResult(result interface{}, scale int) {
+	valCount, ok := result.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if v, ok := valCount["value"].(float64); ok {
+		valCount["value"] = v / math.Pow10(scale)
+	}
+}
+
+// passThrough forwards the request to pilosa and copies the response back
+// without mapping it.
+func (p *pilosaForwarder) passThrough(w http.ResponseWriter, req *http.Request, body []byte) {
+	resp, err := p.proxy.ProxyRequest(req, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer resp.Body.Close()
+	for k, vals := range resp.Header {
+		for _, v := range vals {
+			w.Header().Add(k, v)
+		}
+	}
+	// Allow cross-domain requests
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		log.Printf("copying response: %v", err)
+	}
+}
+
 // pilosaProxy implements the Proxy interface.
 type pilosaProxy struct {
 	host   string
@@ -208,7 +337,8 @@ type PilosaKeyMapper struct {
 	c FieldTranslator
 }
 
-// NewPilosaKeyMapper returns a PilosaKeyMapper.
+// NewPilosaKeyMapper returns a PilosaKeyMapper. If t or the column translator
+// is nil, rows or columns respectively are left as they are.
 func NewPilosaKeyMapper(t Translator, colTranslator ...FieldTranslator) *PilosaKeyMapper {
 	pkm := &PilosaKeyMapper{
 		t: t,
@@ -233,6 +363,10 @@ func (p *PilosaKeyMapper) MapResult(field string, res interface{}) (mappedRes in
 	case []interface{}:
 		return p.mapSliceInterfaceResult(field, result)
 	case map[string]interface{}:
+		if _, ok := result["count"]; ok {
+			// Sum/Min/Max
+			return result, nil
+		}
 		// Bitmap/Intersect/Difference/Union
 		return p.mapBitmapResult(field, result)
 	case bool:
@@ -279,6 +413,9 @@ func (p *PilosaKeyMapper) mapSliceInterfaceResult(field string, res []interface{
 }
 
 func (p *PilosaKeyMapper) mapColumnSlice(field string, result []interface{}) (mappedRes interface{}, err error) {
+	if p.c == nil {
+		return result, nil
+	}
 	cols := make([]interface{}, len(result))
 	for i, icol := range result {
 		col, ok := icol.(float64)
@@ -295,6 +432,9 @@ func (p *PilosaKeyMapper) mapColumnSlice(field string, result []interface{}) (ma
 }
 
 func (p *PilosaKeyMapper) mapTopNResult(field string, result []interface{}) (mappedRes interface{}, err error) {
+	if p.t == nil {
+		return result, nil
+	}
 	mr := make([]struct {
 		Key   interface{}
 		Count uint64
@@ -349,7 +489,7 @@ func (p *PilosaKeyMapper) MapRequest(body []byte) ([]byte, error) {
 }
 
 func (p *PilosaKeyMapper) mapCall(call *pql.Call) error {
-	if call.Name == "Row" {
+	if call.Name == "Row" && p.t != nil {
 		var field string
 		var value interface{}
 		for k, v := range call.Args {
@@ -0,0 +1,106 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pdk_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pilosa/pdk"
+)
+
+func TestPilosaForwarderPassThrough(t *testing.T) {
+	var gotBody string
+	pilosa := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		gotBody = string(body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte(`{"results":[{"attrs":{},"columns":[],"keys":["a"]}]}`))
+	}))
+	defer pilosa.Close()
+
+	fwd := pdk.NewPilosaForwarder(strings.TrimPrefix(pilosa.URL, "http://"), nil, nil)
+	req := httptest.NewRequest("POST", "/index/i/query", strings.NewReader(`Row(f="x")`))
+	w := httptest.NewRecorder()
+	fwd.ServeHTTP(w, req)
+
+	if gotBody != `Row(f="x")` {
+		t.Fatalf("unexpected forwarded body: %s", gotBody)
+	}
+	if w.Code != http.StatusTeapot {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("unexpected content type: %s", ct)
+	}
+	if body := w.Body.String(); body != `{"results":[{"attrs":{},"columns":[],"keys":["a"]}]}` {
+		t.Fatalf("unexpected body: %s", body)
+	}
+}
+
+func TestPilosaForwarderScale(t *testing.T) {
+	var gotBody string
+	pilosa := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		gotBody = string(body)
+		_, _ = w.Write([]byte(`{"results":[{"value":1234,"count":3},{"attrs":{},"columns":[1,2]}]}`))
+	}))
+	defer pilosa.Close()
+
+	fwd := pdk.NewPilosaForwarder(strings.TrimPrefix(pilosa.URL, "http://"), nil)
+	fwd.FieldConfigs = []pdk.FieldConfig{{Name: "price", Scale: 2}}
+	req := httptest.NewRequest("POST", "/index/i/query", strings.NewReader(`Sum(Row(price > 3.99), field="price") Row(price >< [1, 2.5])`))
+	w := httptest.NewRecorder()
+	fwd.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	if gotBody != `Sum(Row(price > 399), field="price")`+"\n"+`Row(price >< [100,250])` {
+		t.Fatalf("unexpected forwarded body: %s", gotBody)
+	}
+	var resp struct {
+		Results []map[string]interface{}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if len(resp.Results) != 2 || resp.Results[0]["value"] != 12.34 || resp.Results[0]["count"] != float64(3) {
+		t.Fatalf("unexpected results: %v", resp.Results)
+	}
+}
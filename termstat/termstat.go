@@ -77,6 +77,18 @@ func (t *Collector) Count(name string, value int64, rate float64, tags ...string
 	t.changed = true
 	defer t.lock.Unlock()
 
+	idx := t.index(name)
+	if rate < 1 {
+		if rand.Float64() > rate {
+			return
+		}
+	}
+	t.stats[idx] += value
+}
+
+// index returns the index of the named stat, adding it if necessary. The lock
+// must be held.
+func (t *Collector) index(name string) int {
 	idx, ok := t.indexes[name]
 	if !ok {
 		idx = len(t.stats)
@@ -84,12 +96,7 @@ func (t *Collector) Count(name string, value int64, rate float64, tags ...string
 		t.names = append(t.names, name)
 		t.indexes[name] = idx
 	}
-	if rate < 1 {
-		if rand.Float64() > rate {
-			return
-		}
-	}
-	t.stats[idx] += value
+	return idx
 }
 
 func (t *Collector) write() {
@@ -107,8 +114,13 @@ func (t *Collector) write() {
 	t.lock.Unlock()
 }
 
-// Gauge does nothing.
-func (t *Collector) Gauge(name string, value float64, rate float64, tags ...string) {}
+// Gauge sets the named stat to value (truncated to an integer).
+func (t *Collector) Gauge(name string, value float64, rate float64, tags ...string) {
+	t.lock.Lock()
+	t.changed = true
+	t.stats[t.index(name)] = int64(value)
+	t.lock.Unlock()
+}
 
 // Histogram does nothing.
 func (t *Collector) Histogram(name string, value float64, rate float64, tags ...string) {}
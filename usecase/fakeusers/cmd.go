@@ -51,7 +51,9 @@ func (m *Main) Run() error {
 
 	for rec, err := src.Record(); err == nil; rec, err = src.Record() {
 		pr := parseUserRecord(rec.(*fake.User))
-		ingestPilosaRecord(indexer, pr)
+		if err := ingestPilosaRecord(indexer, pr); err != nil {
+			return errors.Wrap(err, "ingesting record")
+		}
 	}
 	return errors.Wrap(indexer.Close(), "closing indexer")
 }
@@ -72,12 +74,16 @@ func parseUserRecord(u *fake.User) pdk.PilosaRecord {
 	return ret
 }
 
-func ingestPilosaRecord(indexer pdk.Indexer, pr pdk.PilosaRecord) {
+func ingestPilosaRecord(indexer pdk.Indexer, pr pdk.PilosaRecord) error {
 	for _, row := range pr.Rows {
-		indexer.AddColumn(row.Field, pr.Col, row.ID)
+		if err := indexer.AddColumn(row.Field, pr.Col, row.ID); err != nil {
+			return err
+		}
 	}
 	for _, val := range pr.Vals {
-		indexer.AddValue(val.Field, pr.Col, val.Value)
+		if err := indexer.AddValue(val.Field, pr.Col, val.Value); err != nil {
+			return err
+		}
 	}
-
+	return nil
 }
@@ -140,93 +140,107 @@ func (m *Main) mapRecords(rc <-chan *record) {
 		if err != nil {
 			log.Printf("Couldn't map record col: %v, rec: %v, err: %v", col, rec, err)
 		}
-		m.index.AddColumn("lo_year", col, id)
+		m.addColumn("lo_year", col, id)
 		id, err = m.trans.GetID("lo_month", rec.order_month)
 		if err != nil {
 			log.Printf("Couldn't map record col: %v, rec: %v, err: %v", col, rec, err)
 		}
-		m.index.AddColumn("lo_month", col, id)
+		m.addColumn("lo_month", col, id)
 
 		id, err = m.trans.GetID("lo_weeknum", rec.order_weeknum)
 		if err != nil {
 			log.Printf("Couldn't map record col: %v, rec: %v, err: %v", col, rec, err)
 		}
-		m.index.AddColumn("lo_weeknum", col, id)
+		m.addColumn("lo_weeknum", col, id)
 
 		id, err = m.trans.GetID("lo_discount_b", rec.lo_discount)
 		if err != nil {
 			log.Printf("Couldn't map record col: %v, rec: %v, err: %v", col, rec, err)
 		}
-		m.index.AddColumn("lo_discount_b", col, id)
+		m.addColumn("lo_discount_b", col, id)
 
 		id, err = m.trans.GetID("lo_quantity_b", rec.lo_quantity)
 		if err != nil {
 			log.Printf("Couldn't map record col: %v, rec: %v, err: %v", col, rec, err)
 		}
-		m.index.AddColumn("lo_quantity_b", col, id)
+		m.addColumn("lo_quantity_b", col, id)
 
-		m.index.AddValue("lo_quantity", col, int64(rec.lo_quantity))
-		m.index.AddValue("lo_extendedprice", col, int64(rec.lo_extendedprice))
-		m.index.AddValue("lo_discount", col, int64(rec.lo_discount))
-		m.index.AddValue("lo_revenue", col, int64(rec.lo_revenue))
-		m.index.AddValue("lo_supplycost", col, int64(rec.lo_supplycost))
+		m.addValue("lo_quantity", col, int64(rec.lo_quantity))
+		m.addValue("lo_extendedprice", col, int64(rec.lo_extendedprice))
+		m.addValue("lo_discount", col, int64(rec.lo_discount))
+		m.addValue("lo_revenue", col, int64(rec.lo_revenue))
+		m.addValue("lo_supplycost", col, int64(rec.lo_supplycost))
 
 		revenueComputed := int64(float64(rec.lo_extendedprice) * float64(rec.lo_discount) * 0.01)
-		m.index.AddValue("lo_revenue_computed", col, revenueComputed)
+		m.addValue("lo_revenue_computed", col, revenueComputed)
 		profitComputed := uint32(rec.lo_revenue) - rec.lo_supplycost
-		m.index.AddValue("lo_profit", col, int64(profitComputed))
+		m.addValue("lo_profit", col, int64(profitComputed))
 
 		id, err = m.trans.GetID("c_city", rec.c_city)
 		if err != nil {
 			log.Printf("Couldn't map record col: %v, rec: %v, err: %v", col, rec, err)
 		}
-		m.index.AddColumn("c_city", col, id)
+		m.addColumn("c_city", col, id)
 		id, err = m.trans.GetID("c_nation", rec.c_nation)
 		if err != nil {
 			log.Printf("Couldn't map record col: %v, rec: %v, err: %v", col, rec, err)
 		}
-		m.index.AddColumn("c_nation", col, id)
+		m.addColumn("c_nation", col, id)
 
 		id, err = m.trans.GetID("c_region", rec.c_region)
 		if err != nil {
 			log.Printf("Couldn't map record col: %v, rec: %v, err: %v", col, rec, err)
 		}
-		m.index.AddColumn("c_region", col, id)
+		m.addColumn("c_region", col, id)
 
 		id, err = m.trans.GetID("s_city", rec.s_city)
 		if err != nil {
 			log.Printf("Couldn't map record col: %v, rec: %v, err: %v", col, rec, err)
 		}
-		m.index.AddColumn("s_city", col, id)
+		m.addColumn("s_city", col, id)
 		id, err = m.trans.GetID("s_nation", rec.s_nation)
 		if err != nil {
 			log.Printf("Couldn't map record col: %v, rec: %v, err: %v", col, rec, err)
 		}
-		m.index.AddColumn("s_nation", col, id)
+		m.addColumn("s_nation", col, id)
 
 		id, err = m.trans.GetID("s_region", rec.s_region)
 		if err != nil {
 			log.Printf("Couldn't map record col: %v, rec: %v, err: %v", col, rec, err)
 		}
-		m.index.AddColumn("s_region", col, id)
+		m.addColumn("s_region", col, id)
 
 		id, err = m.trans.GetID("p_mfgr", rec.p_mfgr)
 		if err != nil {
 			log.Printf("Couldn't map record col: %v, rec: %v, err: %v", col, rec, err)
 		}
-		m.index.AddColumn("p_mfgr", col, id)
+		m.addColumn("p_mfgr", col, id)
 
 		id, err = m.trans.GetID("p_category", rec.p_category)
 		if err != nil {
 			log.Printf("Couldn't map record col: %v, rec: %v, err: %v", col, rec, err)
 		}
-		m.index.AddColumn("p_category", col, id)
+		m.addColumn("p_category", col, id)
 
 		id, err = m.trans.GetID("p_brand1", rec.p_brand1)
 		if err != nil {
 			log.Printf("Couldn't map record col: %v, rec: %v, err: %v", col, rec, err)
 		}
-		m.index.AddColumn("p_brand1", col, id)
+		m.addColumn("p_brand1", col, id)
+	}
+}
+
+// addColumn adds a bit to the index, logging if that fails.
+func (m *Main) addColumn(field string, col, row uint64) {
+	if err := m.index.AddColumn(field, col, row); err != nil {
+		log.Printf("Couldn't add bit col: %v, field: %v, err: %v", col, field, err)
+	}
+}
+
+// addValue adds a value to the index, logging if that fails.
+func (m *Main) addValue(field string, col uint64, val int64) {
+	if err := m.index.AddValue(field, col, val); err != nil {
+		log.Printf("Couldn't add value col: %v, field: %v, err: %v", col, field, err)
 	}
 }
 
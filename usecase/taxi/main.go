@@ -484,10 +484,14 @@ Records:
 		columnsToSet = append(columnsToSet)
 		columnID := m.nexter.Next()
 		for _, bit := range columnsToSet {
-			m.indexer.AddColumn(bit.Field, columnID, bit.Column)
+			if err := m.indexer.AddColumn(bit.Field, columnID, bit.Column); err != nil {
+				log.Printf("index: %v", err)
+			}
 		}
 		for _, val := range valsToSet {
-			m.indexer.AddValue(val.Field, columnID, val.Val)
+			if err := m.indexer.AddValue(val.Field, columnID, val.Val); err != nil {
+				log.Printf("index: %v", err)
+			}
 		}
 	}
 }
@@ -47,7 +47,9 @@ func (m *Main) Run() error {
 	ug := newUserGetter(m.Seed)
 
 	for i := uint64(0); i < m.Num; i++ {
-		indexer.AddColumn(m.Field, i, ug.ID())
+		if err := indexer.AddColumn(m.Field, i, ug.ID()); err != nil {
+			return errors.Wrap(err, "adding column")
+		}
 	}
 
 	return errors.Wrap(indexer.Close(), "closing indexer")
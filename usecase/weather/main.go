@@ -120,19 +120,22 @@ func (m *Main) appendWeatherData() error {
 
 		for _, ID := range response.Result().Row().Columns {
 			// SetBit(weather.precip_code, ID, "precipitation_type")  // not implemented in weatherCache
-			m.importer.AddColumn("weather_condition", ID, condID)
+			err := m.importer.AddColumn("weather_condition", ID, condID)
 
-			if err1 == nil && weather.Precipi > -100 {
-				m.importer.AddColumn("precipitation_inches", ID, precipID)
+			if err == nil && err1 == nil && weather.Precipi > -100 {
+				err = m.importer.AddColumn("precipitation_inches", ID, precipID)
 			}
-			if err2 == nil {
-				m.importer.AddColumn("temp_f", ID, tempID)
+			if err == nil && err2 == nil {
+				err = m.importer.AddColumn("temp_f", ID, tempID)
 			}
-			if err3 == nil {
-				m.importer.AddColumn("pressure_i", ID, pressureID)
+			if err == nil && err3 == nil {
+				err = m.importer.AddColumn("pressure_i", ID, pressureID)
 			}
-			if err4 == nil && weather.Humidity > 10 {
-				m.importer.AddColumn("humidity", ID, humidID)
+			if err == nil && err4 == nil && weather.Humidity > 10 {
+				err = m.importer.AddColumn("humidity", ID, humidID)
+			}
+			if err != nil {
+				return errors.Wrap(err, "adding weather data")
 			}
 		}
 	}
@@ -0,0 +1,679 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pdk
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	gopilosa "github.com/pilosa/go-pilosa"
+	"github.com/pkg/errors"
+)
+
+// walSegmentSize is the size at which a field's write-ahead log moves on to a
+// new segment file.
+var walSegmentSize int64 = 64 << 20
+
+// walFlushSize and walFlushInterval bound how much is written to a
+// write-ahead log, and for how long, before it is flushed to be imported,
+// while records keep arriving.
+var (
+	walFlushSize     int64 = 1 << 20
+	walFlushInterval       = time.Second
+)
+
+// maxWALRecordSize is the largest record which can be read from a write-ahead
+// log. Anything bigger must be corrupt.
+const maxWALRecordSize = 1 << 24
+
+// walPosition is a position in a field's write-ahead log.
+type walPosition struct {
+	seg uint64
+	off int64
+}
+
+// fieldWAL is a write-ahead log of the records for one field, made up of
+// numbered segment files in dir. One goroutine appends to it, and another
+// reads from it and imports what it reads. The position up to which records
+// have been imported is stored in dir, and segments before it are deleted.
+type fieldWAL struct {
+	dir string
+
+	// written is the position up to which records can be read. It is only
+	// advanced once they have been flushed to the segment file.
+	mu      sync.Mutex
+	cond    *sync.Cond
+	written walPosition
+	closed  bool
+	closing chan struct{}
+
+	// used by the writer. flushed and flushedAt are the size of the segment
+	// when it was last flushed, and when that was.
+	f         *os.File
+	w         *bufio.Writer
+	size      int64
+	flushed   int64
+	flushedAt time.Time
+	scratch   []byte
+
+	// used by the reader. committed is the segment of the last position
+	// passed to commit.
+	read      walPosition
+	rf        *os.File
+	committed uint64
+}
+
+func segmentName(seg uint64) string {
+	return fmt.Sprintf("%020d.wal", seg)
+}
+
+// openFieldWAL opens the write-ahead log in dir, creating it if necessary.
+// Anything which wasn't imported when it was last used will be read again, and
+// new records are written to a new segment.
+func openFieldWAL(dir string) (*fieldWAL, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "creating directory")
+	}
+	wal := &fieldWAL{dir: dir, closing: make(chan struct{})}
+	wal.cond = sync.NewCond(&wal.mu)
+
+	pos, err := ioutil.ReadFile(filepath.Join(dir, "position"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "reading position")
+	} else if err == nil {
+		if _, err := fmt.Sscan(string(pos), &wal.read.seg, &wal.read.off); err != nil {
+			return nil, errors.Wrapf(err, "parsing position '%s'", pos)
+		}
+	}
+	if err := wal.removeBefore(wal.read.seg); err != nil {
+		return nil, err
+	}
+	segs, err := wal.segments()
+	if err != nil {
+		return nil, err
+	}
+	// New records go in a new segment, in case the last one was left with
+	// a partly written record.
+	next := wal.read.seg + 1
+	if len(segs) > 0 && segs[len(segs)-1] >= next {
+		next = segs[len(segs)-1] + 1
+	}
+	if len(segs) == 0 {
+		wal.read = walPosition{seg: next}
+	} else if segs[0] != wal.read.seg {
+		wal.read = walPosition{seg: segs[0]}
+	}
+	wal.committed = wal.read.seg
+	if err := wal.openSegment(next); err != nil {
+		return nil, err
+	}
+	return wal, nil
+}
+
+// segments returns the numbers of the segment files in the log, in order.
+func (wal *fieldWAL) segments() ([]uint64, error) {
+	names, err := filepath.Glob(filepath.Join(wal.dir, "*.wal"))
+	if err != nil {
+		return nil, errors.Wrap(err, "listing segments")
+	}
+	segs := make([]uint64, 0, len(names))
+	for _, name := range names {
+		var seg uint64
+		if _, err := fmt.Sscanf(filepath.Base(name), "%d.wal", &seg); err != nil {
+			return nil, errors.Wrapf(err, "parsing segment name '%s'", name)
+		}
+		segs = append(segs, seg)
+	}
+	sort.Slice(segs, func(i, j int) bool { return segs[i] < segs[j] })
+	return segs, nil
+}
+
+// removeBefore deletes the segment files before seg.
+func (wal *fieldWAL) removeBefore(seg uint64) error {
+	segs, err := wal.segments()
+	if err != nil {
+		return err
+	}
+	for _, s := range segs {
+		if s >= seg {
+			break
+		}
+		if err := os.Remove(filepath.Join(wal.dir, segmentName(s))); err != nil {
+			return errors.Wrap(err, "removing segment")
+		}
+	}
+	return nil
+}
+
+// openSegment starts writing to a new segment.
+func (wal *fieldWAL) openSegment(seg uint64) error {
+	f, err := os.OpenFile(filepath.Join(wal.dir, segmentName(seg)), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return errors.Wrap(err, "creating segment")
+	}
+	wal.f = f
+	wal.w = bufio.NewWriterSize(f, 1<<16)
+	wal.size = 0
+	wal.flushed = 0
+	wal.flushedAt = time.Now()
+	wal.mu.Lock()
+	wal.written = walPosition{seg: seg}
+	wal.cond.Broadcast()
+	wal.mu.Unlock()
+	return nil
+}
+
+// append writes a record to the log. It isn't visible to the reader until the
+// log is flushed.
+func (wal *fieldWAL) append(rec gopilosa.Record) error {
+	var err error
+	wal.scratch, err = encodeWALRecord(wal.scratch[:0], rec)
+	if err != nil {
+		return err
+	}
+	var hdr [binary.MaxVarintLen64 + 4]byte
+	n := binary.PutUvarint(hdr[:], uint64(len(wal.scratch)))
+	binary.LittleEndian.PutUint32(hdr[n:], crc32.ChecksumIEEE(wal.scratch))
+	if _, err := wal.w.Write(hdr[:n+4]); err != nil {
+		return errors.Wrap(err, "writing record")
+	}
+	if _, err := wal.w.Write(wal.scratch); err != nil {
+		return errors.Wrap(err, "writing record")
+	}
+	wal.size += int64(n + 4 + len(wal.scratch))
+	if wal.size < walSegmentSize {
+		return nil
+	}
+	if err := wal.sync(); err != nil {
+		return err
+	}
+	if err := wal.f.Close(); err != nil {
+		return errors.Wrap(err, "closing segment")
+	}
+	wal.mu.Lock()
+	seg := wal.written.seg
+	wal.mu.Unlock()
+	return wal.openSegment(seg + 1)
+}
+
+// flush makes everything appended so far visible to the reader.
+func (wal *fieldWAL) flush() error {
+	if err := wal.w.Flush(); err != nil {
+		return errors.Wrap(err, "flushing segment")
+	}
+	wal.flushed = wal.size
+	wal.flushedAt = time.Now()
+	wal.mu.Lock()
+	wal.written.off = wal.size
+	wal.cond.Broadcast()
+	wal.mu.Unlock()
+	return nil
+}
+
+// flushDue returns true if walFlushSize has been appended since the log was
+// last flushed, or walFlushInterval has passed.
+func (wal *fieldWAL) flushDue() bool {
+	return wal.size-wal.flushed >= walFlushSize || time.Since(wal.flushedAt) >= walFlushInterval
+}
+
+// sync flushes the log and makes sure it is on disk.
+func (wal *fieldWAL) sync() error {
+	if err := wal.flush(); err != nil {
+		return err
+	}
+	return errors.Wrap(wal.f.Sync(), "syncing segment")
+}
+
+// close syncs the log and stops writing to it. The reader reads what is left
+// and then gets io.EOF.
+func (wal *fieldWAL) close() error {
+	err := wal.sync()
+	if cerr := wal.f.Close(); err == nil {
+		err = errors.Wrap(cerr, "closing segment")
+	}
+	wal.mu.Lock()
+	wal.closed = true
+	close(wal.closing)
+	wal.cond.Broadcast()
+	wal.mu.Unlock()
+	return err
+}
+
+// next reads up to max records from the log, blocking until there are some.
+// The records are either all to be set or all to be cleared. It returns the
+// position after the last record read, which should be passed to commit once
+// they have been imported, and io.EOF if the log has been closed and
+// everything in it has been read.
+func (wal *fieldWAL) next(max int) (recs []gopilosa.Record, clear bool, pos walPosition, err error) {
+	for {
+		wal.mu.Lock()
+		for wal.read == wal.written && !wal.closed {
+			wal.cond.Wait()
+		}
+		written := wal.written
+		wal.mu.Unlock()
+		if wal.read == written {
+			return nil, false, wal.read, io.EOF
+		}
+
+		if wal.rf == nil {
+			wal.rf, err = os.Open(filepath.Join(wal.dir, segmentName(wal.read.seg)))
+			if err != nil {
+				return nil, false, wal.read, errors.Wrap(err, "opening segment")
+			}
+		}
+		limit := written.off
+		if wal.read.seg < written.seg {
+			// the segment is complete.
+			limit = 1<<63 - 1
+		}
+		recs, clear, pos, err = readWALRecords(wal.rf, wal.read, limit, max)
+		if err != nil && wal.read.seg == written.seg {
+			return nil, false, wal.read, err
+		} else if err != nil {
+			// This can only happen at the end of a segment which was being
+			// written when the process died, so the rest is lost anyway.
+			log.Printf("skipping the rest of WAL segment %s: %v", filepath.Join(wal.dir, segmentName(wal.read.seg)), err)
+		}
+		if len(recs) > 0 {
+			return recs, clear, pos, nil
+		}
+		if wal.read.seg < written.seg {
+			// move on to the next segment.
+			wal.rf.Close()
+			wal.rf = nil
+			wal.read = walPosition{seg: wal.read.seg + 1}
+		}
+	}
+}
+
+// commit records that everything before pos has been imported, and deletes
+// segments which are no longer needed. The position is written to a temporary
+// file which is synced and renamed into place, so that a crash leaves either
+// the old position or the new one.
+func (wal *fieldWAL) commit(pos walPosition) error {
+	wal.read = pos
+	tmp := filepath.Join(wal.dir, "position.tmp")
+	if err := writeFileSync(tmp, []byte(fmt.Sprintf("%d %d\n", pos.seg, pos.off))); err != nil {
+		return errors.Wrap(err, "writing position")
+	}
+	if err := os.Rename(tmp, filepath.Join(wal.dir, "position")); err != nil {
+		return errors.Wrap(err, "writing position")
+	}
+	if err := syncDir(wal.dir); err != nil {
+		return errors.Wrap(err, "writing position")
+	}
+	if pos.seg > wal.committed {
+		wal.committed = pos.seg
+		return wal.removeBefore(pos.seg)
+	}
+	return nil
+}
+
+// writeFileSync writes data to the named file, creating or truncating it, and
+// syncs it to disk.
+func writeFileSync(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir syncs the directory dir, so that files created in or renamed into it
+// are on disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// readWALRecords reads up to max records from f, starting at pos and not
+// going past limit. It stops early at the first record whose kind (set or
+// clear) differs from the first one's.
+func readWALRecords(f *os.File, pos walPosition, limit int64, max int) (recs []gopilosa.Record, clear bool, end walPosition, err error) {
+	r := bufio.NewReader(io.NewSectionReader(f, pos.off, limit-pos.off))
+	end = pos
+	var buf []byte
+	for len(recs) < max {
+		size, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return recs, clear, end, errors.Wrap(err, "reading record size")
+		}
+		var sum [4]byte
+		if _, err := io.ReadFull(r, sum[:]); err != nil {
+			return recs, clear, end, errors.Wrap(err, "reading checksum")
+		}
+		if size > maxWALRecordSize {
+			return recs, clear, end, errors.Errorf("bad record size %d", size)
+		}
+		if uint64(cap(buf)) < size {
+			buf = make([]byte, size)
+		}
+		buf = buf[:size]
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return recs, clear, end, errors.Wrap(err, "reading record")
+		}
+		if crc32.ChecksumIEEE(buf) != binary.LittleEndian.Uint32(sum[:]) {
+			return recs, clear, end, errors.New("bad checksum")
+		}
+		rec, recClear, err := decodeWALRecord(buf)
+		if err != nil {
+			return recs, clear, end, err
+		}
+		if len(recs) == 0 {
+			clear = recClear
+		} else if recClear != clear {
+			break
+		}
+		recs = append(recs, rec)
+		end.off += int64(uvarintLen(size) + 4 + len(buf))
+	}
+	return recs, clear, end, nil
+}
+
+func uvarintLen(x uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], x)
+}
+
+const (
+	walColumn byte = 'c'
+	walValue  byte = 'v'
+	walAttrs  byte = 'a'
+
+	walClear byte = 1
+	walKeys  byte = 2
+)
+
+// encodeWALRecord appends rec (a Column or FieldValue, possibly wrapped in a
+// clearRecord, or an attrRecord) to buf.
+func encodeWALRecord(buf []byte, rec gopilosa.Record) ([]byte, error) {
+	var flags byte
+	if cr, ok := rec.(clearRecord); ok {
+		rec, flags = cr.rec, walClear
+	}
+	switch r := rec.(type) {
+	case gopilosa.Column:
+		buf = append(buf, walColumn, flags)
+		buf = appendUvarint(buf, r.RowID)
+		buf = appendUvarint(buf, r.ColumnID)
+		buf = appendString(buf, r.RowKey)
+		buf = appendString(buf, r.ColumnKey)
+		buf = appendVarint(buf, r.Timestamp)
+	case gopilosa.FieldValue:
+		buf = append(buf, walValue, flags)
+		buf = appendUvarint(buf, r.ColumnID)
+		buf = appendString(buf, r.ColumnKey)
+		buf = appendVarint(buf, r.Value)
+	case attrRecord:
+		if r.keys {
+			flags |= walKeys
+		}
+		buf = append(buf, walAttrs, flags)
+		buf = appendString(buf, r.query)
+	default:
+		return buf, errors.Errorf("can't write a %T to the WAL", rec)
+	}
+	return buf, nil
+}
+
+// decodeWALRecord decodes a record written by encodeWALRecord, and returns
+// whether it is to be cleared.
+func decodeWALRecord(buf []byte) (gopilosa.Record, bool, error) {
+	if len(buf) < 2 {
+		return nil, false, errors.New("record too short")
+	}
+	d := walDecoder{buf: buf[2:]}
+	clear := buf[1]&walClear != 0
+	var rec gopilosa.Record
+	switch buf[0] {
+	case walColumn:
+		rec = gopilosa.Column{
+			RowID:     d.uvarint(),
+			ColumnID:  d.uvarint(),
+			RowKey:    d.string(),
+			ColumnKey: d.string(),
+			Timestamp: d.varint(),
+		}
+	case walValue:
+		rec = gopilosa.FieldValue{
+			ColumnID:  d.uvarint(),
+			ColumnKey: d.string(),
+			Value:     d.varint(),
+		}
+	case walAttrs:
+		rec = attrRecord{query: d.string(), keys: buf[1]&walKeys != 0}
+	default:
+		return nil, false, errors.Errorf("unknown record type %d", buf[0])
+	}
+	if d.err {
+		return nil, false, errors.New("record truncated")
+	}
+	return rec, clear, nil
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(buf, tmp[:binary.PutUvarint(tmp[:], x)]...)
+}
+
+func appendVarint(buf []byte, x int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(buf, tmp[:binary.PutVarint(tmp[:], x)]...)
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = appendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+type walDecoder struct {
+	buf []byte
+	err bool
+}
+
+func (d *walDecoder) uvarint() uint64 {
+	x, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = true
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return x
+}
+
+func (d *walDecoder) varint() int64 {
+	x, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = true
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return x
+}
+
+func (d *walDecoder) string() string {
+	n := d.uvarint()
+	if n > uint64(len(d.buf)) {
+		d.err = true
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
+
+// sliceIterator is a gopilosa.RecordIterator over a slice of records.
+type sliceIterator struct {
+	recs []gopilosa.Record
+}
+
+// NextRecord implements gopilosa.RecordIterator.
+func (s *sliceIterator) NextRecord() (gopilosa.Record, error) {
+	if len(s.recs) == 0 {
+		return nil, io.EOF
+	}
+	rec := s.recs[0]
+	s.recs = s.recs[1:]
+	return rec, nil
+}
+
+// writeWAL appends the records sent on c to wal until c is closed, and then
+// closes it. Markers are answered once everything before them is on disk.
+func (i *Index) writeWAL(field string, wal *fieldWAL, c chanRecordIterator) {
+	var err error
+	for rec := range c {
+		if m, ok := rec.(importMarker); ok {
+			if err == nil {
+				err = wal.sync()
+				i.setImportError(field, err)
+			}
+			m <- err
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		err = wal.append(rec)
+		if err == nil && (len(c) == 0 || wal.flushDue()) {
+			// make what we have so far available to be imported, without
+			// waiting for a steady stream of records to pause.
+			err = wal.flush()
+		}
+		i.setImportError(field, err)
+	}
+	i.setImportError(field, wal.close())
+}
+
+// drainWAL imports the records in wal into field until it is closed. While
+// the Index is open, failed imports are retried indefinitely. Once it is
+// closed, an import failure stops the import, leaving the rest of the records
+// in the log until the next time it is opened.
+func (i *Index) drainWAL(field *gopilosa.Field, wal *fieldWAL, importOptions []gopilosa.ImportOption) {
+	clearOptions := append(importOptions[:len(importOptions):len(importOptions)], gopilosa.OptImportClear(true))
+	for {
+		recs, clear, pos, err := wal.next(int(i.batchSize))
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			i.setImportError(field.Name(), errors.Wrapf(err, "reading WAL for field '%s'", field.Name()))
+			return
+		}
+		opts := importOptions
+		if clear {
+			opts = clearOptions
+		}
+		err = i.retry(wal, func() error {
+			return errors.Wrapf(i.client.ImportField(field, &sliceIterator{recs: recs}, opts...), "importing field '%s'", field.Name())
+		})
+		if err != nil {
+			i.setImportError(field.Name(), err)
+			return
+		}
+		if err := wal.commit(pos); err != nil {
+			i.setImportError(field.Name(), errors.Wrapf(err, "committing WAL for field '%s'", field.Name()))
+			return
+		}
+	}
+}
+
+// retry calls f until it succeeds, backing off between attempts. Once wal is
+// closed, it gives up after the next failure and returns the error.
+func (i *Index) retry(wal *fieldWAL, f func() error) error {
+	for wait := time.Second; ; wait *= 2 {
+		err := f()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-wal.closing:
+			return errors.Wrap(err, "giving up with records left in the WAL")
+		default:
+		}
+		if wait > time.Minute {
+			wait = time.Minute
+		}
+		log.Printf("%v, retrying in %v", err, wait)
+		select {
+		case <-time.After(wait):
+		case <-wal.closing:
+		}
+	}
+}
+
+// walDir returns the directory for the named field's write-ahead log.
+func (i *Index) walDir(field string) string {
+	return filepath.Join(i.options.walDir, i.index.Name(), field)
+}
+
+// OptPilosaWAL makes the Index write everything added to it to a write-ahead
+// log in dir, from which it is imported into Pilosa in the background. Adding
+// to the Index doesn't wait for Pilosa, failed imports are retried until they
+// succeed, and anything which hasn't been imported when the Index is closed
+// (or the process dies) is imported the next time an Index is set up with the
+// same directory. Flushing the Index, and acknowledgements, only wait for data
+// to be written to the log. Column and row attributes are logged too, and sent
+// in the order they were flushed.
+func OptPilosaWAL(dir string) PilosaOption {
+	return func(pilosaOpt *pilosaOptions) error {
+		pilosaOpt.walDir = dir
+		return nil
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pdk
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	gopilosa "github.com/pilosa/go-pilosa"
+)
+
+func TestFieldWAL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(size int64) { walSegmentSize = size }(walSegmentSize)
+	walSegmentSize = 24
+
+	wal, err := openFieldWAL(dir)
+	if err != nil {
+		t.Fatalf("opening WAL: %v", err)
+	}
+	recs := []gopilosa.Record{
+		gopilosa.Column{RowID: 1, ColumnID: 2, Timestamp: -3},
+		gopilosa.Column{RowKey: "a", ColumnKey: "b"},
+		clearRecord{gopilosa.Column{RowID: 4, ColumnID: 5}},
+		gopilosa.FieldValue{ColumnID: 6, Value: -7},
+		gopilosa.FieldValue{ColumnKey: "c", Value: 8},
+		attrRecord{query: `SetColumnAttrs("d",name="e")`, keys: true},
+	}
+	for _, rec := range recs {
+		if err := wal.append(rec); err != nil {
+			t.Fatalf("appending: %v", err)
+		}
+	}
+	if err := wal.flush(); err != nil {
+		t.Fatalf("flushing: %v", err)
+	}
+	segs, err := wal.segments()
+	if err != nil {
+		t.Fatalf("listing segments: %v", err)
+	}
+	if len(segs) < 2 {
+		t.Fatalf("expected multiple segments, got %v", segs)
+	}
+
+	// Read the first batch, but don't commit it.
+	got, clear, _, err := wal.next(100)
+	if err != nil || clear || !reflect.DeepEqual(got, recs[:2]) {
+		t.Fatalf("unexpected first batch: %v, %v, %v", got, clear, err)
+	}
+	if err := wal.close(); err != nil {
+		t.Fatalf("closing: %v", err)
+	}
+
+	// Everything is read again after reopening.
+	wal, err = openFieldWAL(dir)
+	if err != nil {
+		t.Fatalf("reopening WAL: %v", err)
+	}
+	if err := wal.append(gopilosa.Column{RowID: 9}); err != nil {
+		t.Fatalf("appending: %v", err)
+	}
+	if err := wal.close(); err != nil {
+		t.Fatalf("closing: %v", err)
+	}
+	var sets, clears []gopilosa.Record
+	var last walPosition
+	for len(sets)+len(clears) < len(recs)+1 {
+		got, clear, pos, err := wal.next(2)
+		if err != nil {
+			t.Fatalf("reading: %v", err)
+		}
+		if clear {
+			clears = append(clears, got...)
+		} else {
+			sets = append(sets, got...)
+		}
+		if err := wal.commit(pos); err != nil {
+			t.Fatalf("committing: %v", err)
+		}
+		last = pos
+	}
+	expSets := []gopilosa.Record{recs[0], recs[1], recs[3], recs[4], recs[5], gopilosa.Column{RowID: 9}}
+	if !reflect.DeepEqual(sets, expSets) {
+		t.Fatalf("expected %v, got %v", expSets, sets)
+	}
+	if expClears := []gopilosa.Record{recs[2].(clearRecord).rec}; !reflect.DeepEqual(clears, expClears) {
+		t.Fatalf("expected clears %v, got %v", expClears, clears)
+	}
+	if _, _, _, err := wal.next(2); err != io.EOF {
+		t.Fatalf("expected EOF, got: %v", err)
+	}
+	segs, err = wal.segments()
+	if err != nil {
+		t.Fatalf("listing segments: %v", err)
+	}
+	if len(segs) != 1 {
+		t.Fatalf("expected imported segments to be removed, got %v", segs)
+	}
+	if pos, err := ioutil.ReadFile(filepath.Join(dir, "position")); err != nil || string(pos) != fmt.Sprintf("%d %d\n", last.seg, last.off) {
+		t.Fatalf("expected position %v, got %q: %v", last, pos, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "position.tmp")); !os.IsNotExist(err) {
+		t.Fatalf("expected the temporary position file to be renamed, got: %v", err)
+	}
+
+	// A partly written record at the end of a segment is skipped.
+	f, err := os.OpenFile(filepath.Join(dir, segmentName(segs[0])), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("opening segment: %v", err)
+	}
+	if _, err := f.Write([]byte{10, 1, 2}); err != nil {
+		t.Fatalf("writing: %v", err)
+	}
+	f.Close()
+	wal, err = openFieldWAL(dir)
+	if err != nil {
+		t.Fatalf("reopening WAL: %v", err)
+	}
+	if err := wal.close(); err != nil {
+		t.Fatalf("closing: %v", err)
+	}
+	if got, _, _, err := wal.next(2); err != io.EOF {
+		t.Fatalf("expected EOF, got: %v, %v", got, err)
+	}
+}
+
+func TestFieldWALFlushDue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(size int64, interval time.Duration) {
+		walFlushSize, walFlushInterval = size, interval
+	}(walFlushSize, walFlushInterval)
+	walFlushSize, walFlushInterval = 20, time.Hour
+
+	wal, err := openFieldWAL(dir)
+	if err != nil {
+		t.Fatalf("opening WAL: %v", err)
+	}
+	defer wal.close()
+	if wal.flushDue() {
+		t.Fatal("flush due before anything was appended")
+	}
+	for !wal.flushDue() {
+		if wal.size > walFlushSize {
+			t.Fatalf("flush not due after appending %d bytes", wal.size)
+		}
+		if err := wal.append(gopilosa.Column{RowID: 1, ColumnID: 2}); err != nil {
+			t.Fatalf("appending: %v", err)
+		}
+	}
+	if err := wal.flush(); err != nil {
+		t.Fatalf("flushing: %v", err)
+	}
+	if wal.flushDue() {
+		t.Fatal("flush due after flushing")
+	}
+
+	walFlushInterval = time.Millisecond
+	time.Sleep(2 * time.Millisecond)
+	if !wal.flushDue() {
+		t.Fatal("flush not due after the flush interval")
+	}
+}